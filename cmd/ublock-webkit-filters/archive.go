@@ -0,0 +1,105 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// snapshotExt names archived lists, gzip-compressed raw downloads
+const snapshotExt = ".txt.gz"
+
+// archiveStore returns where list snapshots are kept between builds, so
+// lists served from the cache can still be archived with each output
+func archiveStore() string {
+	return filepath.Join(cfg.Cache.Dir, "archive")
+}
+
+// snapshot compresses a download into the archive store while it is
+// converted. All methods accept a nil receiver, which archives nothing.
+type snapshot struct {
+	file *os.File
+	gz   *gzip.Writer
+}
+
+// newSnapshot starts a snapshot in the archive store
+func newSnapshot() (*snapshot, error) {
+	if err := os.MkdirAll(archiveStore(), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(archiveStore(), ".snapshot-*")
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{file: file, gz: gzip.NewWriter(file)}, nil
+}
+
+// Write compresses raw list bytes
+func (s *snapshot) Write(p []byte) (int, error) {
+	return s.gz.Write(p)
+}
+
+// writer returns w, also writing to the snapshot if there is one
+func (s *snapshot) writer(w io.Writer) io.Writer {
+	if s == nil {
+		return w
+	}
+	return io.MultiWriter(w, s)
+}
+
+// commit stores the snapshot under the list's content hash
+func (s *snapshot) commit(contentHash string) error {
+	if s == nil {
+		return nil
+	}
+	err := s.gz.Close()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(s.file.Name())
+		return err
+	}
+	return os.Rename(s.file.Name(), filepath.Join(archiveStore(), contentHash+snapshotExt))
+}
+
+// abort drops a snapshot of a failed download
+func (s *snapshot) abort() {
+	if s == nil {
+		return
+	}
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+// archiveInput copies the snapshot of a list's content into the output's
+// archive directory and returns its path relative to the output directory
+func archiveInput(outputDir, contentHash string) (string, error) {
+	name := contentHash + snapshotExt
+	rel := filepath.ToSlash(filepath.Join(cfg.Archive.Dir, name))
+	dst := filepath.Join(outputDir, cfg.Archive.Dir, name)
+	if _, err := os.Stat(dst); err == nil {
+		return rel, nil // content-addressed, already there
+	}
+
+	src, err := os.Open(filepath.Join(archiveStore(), name))
+	if err != nil {
+		return "", fmt.Errorf("no snapshot of content %s: %w", contentHash, err)
+	}
+	defer src.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return "", err
+	}
+	return rel, out.Close()
+}
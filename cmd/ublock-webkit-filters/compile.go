@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/artifact"
+	"github.com/bnema/ublock-webkit-filters/internal/compilecache"
+	"github.com/bnema/ublock-webkit-filters/internal/converter"
+	"github.com/bnema/ublock-webkit-filters/internal/hooks"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/spf13/cobra"
+)
+
+var compileCmd = &cobra.Command{
+	Use:   "compile",
+	Short: "Check and compile the content blocker files of a build, skipping unchanged ones",
+	Long: `Checks every content blocker file listed in manifest.json against WebKit's
+constraints and runs compile.command on it. Files that compiled before under
+the same identifier, i.e. with the same name and content, are skipped.`,
+	RunE:         runCompile,
+	SilenceUsage: true, // failures are listed, the usage would bury them
+}
+
+func init() {
+	compileCmd.Flags().StringP("output", "o", defaultDirs.Output, "output directory")
+	compileCmd.Flags().Bool("force", false, "compile every file, even those that compiled before")
+	rootCmd.AddCommand(compileCmd)
+}
+
+// compilePlaceholders are the placeholders of compile.command
+var compilePlaceholders = []string{"{file}", "{id}"}
+
+// compileCachePath is where files that compiled are remembered
+func compileCachePath() string {
+	return filepath.Join(cfg.Cache.Dir, "compiled.json")
+}
+
+// compileResult counts the files of a compile run
+type compileResult struct {
+	Compiled int
+	Cached   int               // compiled before, skipped
+	Failed   map[string]string // file -> why
+}
+
+func runCompile(cmd *cobra.Command, args []string) error {
+	outputDir, _ := cmd.Flags().GetString("output")
+	force, _ := cmd.Flags().GetBool("force")
+
+	result, err := compileOutputs(cmd.Context(), outputDir, force)
+	if err != nil {
+		return err
+	}
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("%d content blocker files failed to compile", len(result.Failed))
+	}
+	return nil
+}
+
+// compileOutputs checks and compiles the content blocker files of the
+// build in dir that did not compile before, and records those that did
+func compileOutputs(ctx context.Context, dir string, force bool) (*compileResult, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("decoding manifest: %w", err)
+	}
+	if len(manifest.Identifiers) == 0 {
+		return nil, errors.New("manifest.json has no content blocker identifiers, rebuild first")
+	}
+	target, err := converter.LookupTarget(cfg.Output.Target)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := compilecache.Load(compileCachePath())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &compileResult{Failed: make(map[string]string)}
+	ids := make(map[string]bool, len(manifest.Identifiers))
+	for _, file := range sortedKeys(manifest.Identifiers) {
+		id := manifest.Identifiers[file]
+		if id == "" {
+			continue
+		}
+		ids[id] = true
+		if !force && cache.Compiled(id, cfg.Compile.Command) {
+			result.Cached++
+			continue
+		}
+		if err := compileFile(ctx, dir, file, id, target); err != nil {
+			fmt.Printf("  FAILED %s: %v\n", file, err)
+			result.Failed[file] = err.Error()
+			continue
+		}
+		cache.Record(id, file, cfg.Compile.Command, time.Now().UTC())
+		result.Compiled++
+	}
+	cache.Keep(ids)
+
+	fmt.Printf("Compile: %d compiled, %d unchanged, %d failed\n", result.Compiled, result.Cached, len(result.Failed))
+	return result, cache.Save(compileCachePath())
+}
+
+// compileFile checks that a file still holds the content its identifier
+// was derived from and that WebKit would accept every rule, then runs
+// compile.command on it
+func compileFile(ctx context.Context, dir, file, id string, target converter.Target) error {
+	path := filepath.Join(dir, file)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if artifact.Identifier(file, data) != id {
+		return errors.New("content changed since the build")
+	}
+
+	var rules []models.WebKitRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return err
+	}
+	if len(rules) > target.MaxRules {
+		return fmt.Errorf("%d rules exceed the %s limit of %d", len(rules), target.Name, target.MaxRules)
+	}
+	for i, r := range rules {
+		if problem := converter.LintRule(r, target); problem != "" {
+			return fmt.Errorf("rule %d: %s", i, problem)
+		}
+	}
+
+	if cfg.Compile.Command == "" {
+		return nil
+	}
+	values := map[string]string{"{file}": path, "{id}": id}
+	return hooks.Exec(ctx, cfg.Compile.Command, values, cfg.Compile.Timeout, os.Stdout)
+}
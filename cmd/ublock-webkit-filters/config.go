@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/converter"
+	"github.com/bnema/ublock-webkit-filters/internal/fetcher"
+	"github.com/bnema/ublock-webkit-filters/internal/hooks"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:          "validate",
+	Short:        "Check the configuration without building",
+	RunE:         runConfigValidate,
+	SilenceUsage: true, // problems are listed, the usage would bury them
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	problems := validateConfig()
+	if len(problems) > 0 {
+		fmt.Println("Configuration problems:")
+		for _, p := range problems {
+			fmt.Printf("  - %v\n", p)
+		}
+		return fmt.Errorf("%d configuration problems", len(problems))
+	}
+
+	fmt.Printf("Configuration OK: %d lists, %d enabled\n", len(cfg.Lists), len(cfg.EnabledLists()))
+	return nil
+}
+
+// reHeaderName matches HTTP header field names (RFC 9110 tokens)
+var reHeaderName = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// validateHeaders checks configured request header names and values
+func validateHeaders(where string, headers map[string]string) []error {
+	var problems []error
+	for _, name := range sortedKeys(headers) {
+		if !reHeaderName.MatchString(name) {
+			problems = append(problems, fmt.Errorf("%s: invalid header name %q", where, name))
+		} else if strings.ContainsAny(headers[name], "\r\n") {
+			problems = append(problems, fmt.Errorf("%s: header %s contains a line break", where, name))
+		}
+	}
+	return problems
+}
+
+// validateListTLS checks a list's CA bundle and pins
+func validateListTLS(list models.FilterList) []error {
+	var problems []error
+	if list.CAFile != "" {
+		if _, err := fetcher.LoadCA(list.CAFile); err != nil {
+			problems = append(problems, fmt.Errorf("list %s: ca_file: %w", list.Name, err))
+		}
+	}
+	for _, pin := range list.Pins {
+		if _, err := fetcher.ParsePin(pin); err != nil {
+			problems = append(problems, fmt.Errorf("list %s: %w", list.Name, err))
+		}
+	}
+	if (list.CAFile != "" || len(list.Pins) > 0) && !strings.HasPrefix(list.URL, "https://") {
+		problems = append(problems, fmt.Errorf("list %s: ca_file and pins need an https URL", list.Name))
+	}
+	return problems
+}
+
+// reSHA256 matches a hex encoded SHA-256 digest
+var reSHA256 = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// validateConfig normalizes list URLs and returns every setting a build
+// would reject
+func validateConfig() []error {
+	problems := cfg.NormalizeURLs()
+
+	if profile != "" && viper.Sub("profiles."+profile) == nil {
+		problems = append(problems, fmt.Errorf("unknown profile %q (have %v)", profile, profileNames()))
+	}
+
+	switch cfg.Output.GenericCosmetic {
+	case models.GenericCosmeticKeep, models.GenericCosmeticSeparate, models.GenericCosmeticDrop:
+	default:
+		problems = append(problems, fmt.Errorf("invalid output.generic_cosmetic %q (want keep, separate or drop)", cfg.Output.GenericCosmetic))
+	}
+
+	switch cfg.Output.UnknownOptions {
+	case "", models.UnknownOptionSkip, models.UnknownOptionWarn, models.UnknownOptionIgnore:
+	default:
+		problems = append(problems, fmt.Errorf("invalid output.unknown_options %q (want skip, warn or ignore)", cfg.Output.UnknownOptions))
+	}
+
+	switch cfg.Output.Stale {
+	case "", models.StaleRemove, models.StaleQuarantine, models.StaleKeep:
+	default:
+		problems = append(problems, fmt.Errorf("invalid output.stale %q (want remove, quarantine or keep)", cfg.Output.Stale))
+	}
+
+	switch cfg.Output.Fsync {
+	case "", models.FsyncNone, models.FsyncFiles, models.FsyncFull:
+	default:
+		problems = append(problems, fmt.Errorf("invalid output.fsync %q (want none, files or full)", cfg.Output.Fsync))
+	}
+	if cfg.Output.WriteWorkers < 0 {
+		problems = append(problems, fmt.Errorf("output.write_workers %d must not be negative", cfg.Output.WriteWorkers))
+	}
+
+	if err := converter.ValidatePartName(cfg.Output.PartName); cfg.Output.PartName != "" && err != nil {
+		problems = append(problems, fmt.Errorf("output.part_name %q: %w", cfg.Output.PartName, err))
+	}
+
+	switch cfg.Output.Shard {
+	case "", models.ShardFirstLetter:
+	case models.ShardHash:
+		if cfg.Output.ShardCount < 2 {
+			problems = append(problems, fmt.Errorf("output.shard_count %d must be at least 2 for hash sharding", cfg.Output.ShardCount))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("invalid output.shard %q (want first-letter or hash)", cfg.Output.Shard))
+	}
+
+	for _, pattern := range cfg.Output.GenericUnlessTopURL {
+		if !converter.ValidateRegex(pattern) {
+			problems = append(problems, fmt.Errorf("output.generic_unless_top_url: %q is not a WebKit regex", pattern))
+		}
+	}
+
+	if p := cfg.Output.SelectorPrefix; p != "" {
+		if err := converter.ValidateSelectorPrefix(p); err != nil {
+			problems = append(problems, fmt.Errorf("output.selector_prefix: %w", err))
+		}
+	}
+	for _, pattern := range cfg.Output.SelectorExclude {
+		if _, err := regexp.Compile(pattern); err != nil {
+			problems = append(problems, fmt.Errorf("output.selector_exclude: %q: %w", pattern, err))
+		}
+	}
+	for _, d := range cfg.Output.CosmeticExcludeDomains {
+		if err := converter.ValidateDomain(d); err != nil {
+			problems = append(problems, fmt.Errorf("output.cosmetic_exclude_domains: %w", err))
+		}
+	}
+
+	for i, name := range cfg.Output.TypePartitions {
+		if _, ok := typePartitions[name]; !ok {
+			problems = append(problems, fmt.Errorf("invalid output.type_partitions entry %q (want scripts, images or xhr)", name))
+		} else if slices.Contains(cfg.Output.TypePartitions[:i], name) {
+			problems = append(problems, fmt.Errorf("output.type_partitions lists %q twice", name))
+		}
+	}
+
+	if cfg.Retention.KeepBuilds < 0 || cfg.Retention.KeepDays < 0 {
+		problems = append(problems, errors.New("retention.keep_builds and retention.keep_days can't be negative"))
+	}
+
+	if _, err := cfg.Memory.LimitBytes(); err != nil {
+		problems = append(problems, fmt.Errorf("memory.limit: %w", err))
+	}
+
+	if r := cfg.Daemon.Health.ShrinkRatio; r < 0 || r >= 1 {
+		problems = append(problems, fmt.Errorf("daemon.health.shrink_ratio %g must be at least 0 and below 1", r))
+	}
+
+	if err := validateVersionScheme(cfg.Output); err != nil {
+		problems = append(problems, err)
+	}
+
+	if target, err := converter.LookupTarget(cfg.Output.Target); err != nil {
+		problems = append(problems, fmt.Errorf("output.target: %w", err))
+	} else if cfg.Output.MaxRulesPerFile > target.MaxRules {
+		problems = append(problems, fmt.Errorf("output.max_rules_per_file %d exceeds the %s limit of %d rules per content blocker",
+			cfg.Output.MaxRulesPerFile, target.Name, target.MaxRules))
+	}
+
+	if cfg.Safari.MaxRules < 0 {
+		problems = append(problems, fmt.Errorf("safari.max_rules %d is negative", cfg.Safari.MaxRules))
+	} else if target, err := converter.LookupTarget(cfg.Output.Target); err == nil && cfg.Safari.MaxRules > target.MaxRules {
+		problems = append(problems, fmt.Errorf("safari.max_rules %d exceeds the %s limit of %d rules per content blocker",
+			cfg.Safari.MaxRules, target.Name, target.MaxRules))
+	}
+	seenBundles := make(map[string]bool)
+	for _, id := range cfg.Safari.Bundles {
+		if seenBundles[id] {
+			problems = append(problems, fmt.Errorf("safari.bundle_ids: %q is listed twice", id))
+		}
+		seenBundles[id] = true
+	}
+
+	problems = append(problems, validateHeaders("http.headers", cfg.HTTP.Headers)...)
+	if cfg.HTTP.CAFile != "" {
+		if _, err := fetcher.LoadCA(cfg.HTTP.CAFile); err != nil {
+			problems = append(problems, fmt.Errorf("http.ca_file: %w", err))
+		}
+	}
+	for _, list := range cfg.Lists {
+		problems = append(problems, validateHeaders("list "+list.Name+": headers", list.Headers)...)
+		problems = append(problems, validateListTLS(list)...)
+		if _, err := parser.LookupEncoding(list.Encoding); err != nil {
+			problems = append(problems, fmt.Errorf("list %s: %w", list.Name, err))
+		}
+		if list.SHA256 != "" && !reSHA256.MatchString(list.SHA256) {
+			problems = append(problems, fmt.Errorf("list %s: sha256 %q is not a hex encoded SHA-256 digest", list.Name, list.SHA256))
+		}
+		// The gateway is not checked against the CID, the hash is
+		if list.SHA256 == "" && strings.HasPrefix(list.URL, "ipfs://") {
+			problems = append(problems, fmt.Errorf("list %s: ipfs:// URLs need sha256 to verify the gateway's answer", list.Name))
+		}
+		if err := converter.ValidateDefaultTypes(list.DefaultTypes); err != nil {
+			problems = append(problems, fmt.Errorf("list %s: default_types: %w", list.Name, err))
+		}
+	}
+	if gw := cfg.HTTP.IPFSGateway; gw != "" {
+		if u, err := url.Parse(gw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Errorf("http.ipfs_gateway %q: want an http(s) URL", gw))
+		}
+	}
+
+	problems = append(problems, validatePolicy(cfg.Policy)...)
+
+	for i, t := range cfg.Transforms {
+		if err := converter.ValidateTransform(t); err != nil {
+			problems = append(problems, fmt.Errorf("transforms[%d]: %w", i, err))
+		}
+		for _, name := range t.Lists {
+			if !slices.ContainsFunc(cfg.Lists, func(l models.FilterList) bool { return l.Name == name }) {
+				problems = append(problems, fmt.Errorf("transforms[%d]: unknown list %q", i, name))
+			}
+		}
+	}
+
+	for i, command := range cfg.Hooks.OnSuccess {
+		if err := hooks.Validate(command); err != nil {
+			problems = append(problems, fmt.Errorf("hooks.on_success[%d]: %w", i, err))
+		}
+	}
+	for i, command := range cfg.Hooks.OnFailure {
+		if err := hooks.Validate(command); err != nil {
+			problems = append(problems, fmt.Errorf("hooks.on_failure[%d]: %w", i, err))
+		}
+	}
+
+	if cfg.Compile.Command != "" {
+		if err := hooks.ValidateCommand(cfg.Compile.Command, compilePlaceholders); err != nil {
+			problems = append(problems, fmt.Errorf("compile.command: %w", err))
+		}
+	}
+
+	if cfg.Archive.Enabled {
+		if dir := cfg.Archive.Dir; dir == "" || filepath.IsAbs(dir) || !filepath.IsLocal(dir) {
+			problems = append(problems, fmt.Errorf("archive.dir %q: want a directory inside the output directory", dir))
+		}
+	}
+
+	enabledLists := cfg.EnabledLists()
+	if len(enabledLists) == 0 {
+		problems = append(problems, errors.New("no enabled filter lists found in config"))
+	}
+	for _, list := range enabledLists {
+		for _, tag := range list.Tags {
+			if !reTag.MatchString(tag) || tag == "generic" {
+				problems = append(problems, fmt.Errorf("list %s: invalid tag %q (use lowercase letters, digits and dashes, \"generic\" is reserved)", list.Name, tag))
+			} else if converter.IsPartName(cfg.Output.PartName, "combined", "combined-"+tag) {
+				problems = append(problems, fmt.Errorf("list %s: tag %q would overwrite a part of the split combined output", list.Name, tag))
+			}
+		}
+	}
+	for _, tag := range sortedKeys(cfg.Categories) {
+		if !slices.ContainsFunc(cfg.Lists, func(l models.FilterList) bool { return slices.Contains(l.Tags, tag) }) {
+			problems = append(problems, fmt.Errorf("categories.%s: no list has this tag", tag))
+		}
+	}
+	return problems
+}
+
+// validatePolicy checks the domain policy. A domain cannot be both never
+// and always blocked, subdomains included.
+func validatePolicy(p models.PolicyConfig) []error {
+	var problems []error
+	for _, d := range p.NeverBlockDomains {
+		if err := converter.ValidateDomain(d); err != nil {
+			problems = append(problems, fmt.Errorf("policy.never_block_domains: %w", err))
+		}
+	}
+	for _, d := range p.AlwaysBlockDomains {
+		if err := converter.ValidateDomain(d); err != nil {
+			problems = append(problems, fmt.Errorf("policy.always_block_domains: %w", err))
+		}
+		for _, n := range p.NeverBlockDomains {
+			if d == n || strings.HasSuffix(d, "."+n) || strings.HasSuffix(n, "."+d) {
+				problems = append(problems, fmt.Errorf("policy: %q is always blocked and %q never blocked", d, n))
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,1689 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/artifact"
+	"github.com/bnema/ublock-webkit-filters/internal/converter"
+	"github.com/bnema/ublock-webkit-filters/internal/export"
+	"github.com/bnema/ublock-webkit-filters/internal/fetcher"
+	"github.com/bnema/ublock-webkit-filters/internal/hooks"
+	"github.com/bnema/ublock-webkit-filters/internal/ir"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/notify"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/spf13/cobra"
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert filter lists to WebKit JSON format",
+	RunE:  runConvert,
+}
+
+func init() {
+	addConvertFlags(convertCmd)
+	convertCmd.Flags().Bool("embedded", false, "build from the list snapshots embedded in the binary, without network access")
+	convertCmd.Flags().String("emit-ir", "", "dump the parsed filters of every list to this directory, for --from-ir")
+	convertCmd.Flags().String("from-ir", "", "convert the filters dumped by --emit-ir in this directory instead of fetching and parsing lists")
+	rootCmd.AddCommand(convertCmd)
+}
+
+// convertOptions holds the per-run settings resolved from flags and config
+type convertOptions struct {
+	OutputDir      string
+	DryRun         bool
+	Samples        int  // converted rules printed per list in dry runs
+	Update         bool // reuse cached results of unchanged lists
+	Force          bool // with Update, ask servers even when the cache is fresh
+	CosmeticsAsCSS bool // write hiding rules as stylesheets instead
+	Combined       bool
+	Verbose        bool
+	Strict         bool
+	Publish        bool
+	Embedded       bool     // read lists from the snapshots in the binary
+	Require        []string // lists failing the build, besides those marked required
+	EmitIR         string   // directory to dump the parsed filters of every list to
+	FromIR         string   // directory to convert dumped filters from instead of fetching
+	DNSFormats     []string
+}
+
+// buildResult summarizes a conversion run
+type buildResult struct {
+	ID           string // unique per run, also in the manifest and build summary
+	Started      time.Time
+	Duration     time.Duration
+	Lists        map[string]ListResult
+	Errors       map[string]string // list name -> fetch/parse error
+	FetchFailed  map[string]bool   // lists whose download failed
+	ParseSkips   map[models.SkipReason]int
+	ConvertSkips map[models.SkipReason]int
+	TotalRules   int       // combined rules after deduplication
+	NewSkips     []string  // skip patterns no earlier build recorded
+	Manifest     *Manifest // nil unless a manifest was written
+}
+
+// addConvertFlags registers the flags shared by commands that run builds
+func addConvertFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", defaultDirs.Output, "output directory")
+	cmd.Flags().Bool("dry-run", false, "parse and convert without writing files")
+	cmd.Flags().Int("samples", 3, "with --dry-run, print this many converted rules per list and the first skipped lines per reason")
+	cmd.Flags().Bool("combined", true, "generate combined output file")
+	cmd.Flags().Bool("verbose", false, "verbose output")
+	cmd.Flags().StringSlice("dns-format", nil, "also export DNS blocklists (hosts, dnsmasq, unbound, rpz, pihole)")
+	cmd.Flags().Bool("publish", false, "upload outputs using the [publish] config after a successful build")
+	cmd.Flags().Bool("strict", false, "fail on unrecognized list formats or excessive skip ratios")
+	cmd.Flags().StringSlice("require", nil, "fail the build if these lists can't be fetched or converted, like required = true")
+	cmd.Flags().Bool("cosmetics-as-css", false, "write element hiding as per-domain user stylesheets instead of css-display-none rules")
+}
+
+// convertOptionsFromFlags resolves build options, flags overriding config
+func convertOptionsFromFlags(cmd *cobra.Command) convertOptions {
+	var opts convertOptions
+	opts.OutputDir, _ = cmd.Flags().GetString("output")
+	opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+	opts.Samples, _ = cmd.Flags().GetInt("samples")
+	opts.Combined, _ = cmd.Flags().GetBool("combined")
+	opts.Verbose, _ = cmd.Flags().GetBool("verbose")
+	opts.Require, _ = cmd.Flags().GetStringSlice("require")
+
+	opts.Strict = cfg.Strict.Enabled
+	if cmd.Flags().Changed("strict") {
+		opts.Strict, _ = cmd.Flags().GetBool("strict")
+	}
+
+	opts.Publish = cfg.Publish.Enabled
+	if cmd.Flags().Changed("publish") {
+		opts.Publish, _ = cmd.Flags().GetBool("publish")
+	}
+
+	opts.CosmeticsAsCSS = cfg.Output.CosmeticsAsCSS
+	if cmd.Flags().Changed("cosmetics-as-css") {
+		opts.CosmeticsAsCSS, _ = cmd.Flags().GetBool("cosmetics-as-css")
+	}
+
+	opts.DNSFormats = cfg.DNS.Formats
+	if cmd.Flags().Changed("dns-format") {
+		opts.DNSFormats, _ = cmd.Flags().GetStringSlice("dns-format")
+	}
+	return opts
+}
+
+func runConvert(cmd *cobra.Command, args []string) error {
+	opts := convertOptionsFromFlags(cmd)
+	opts.Embedded, _ = cmd.Flags().GetBool("embedded")
+	opts.EmitIR, _ = cmd.Flags().GetString("emit-ir")
+	opts.FromIR, _ = cmd.Flags().GetString("from-ir")
+	if opts.EmitIR != "" && opts.FromIR != "" {
+		return errors.New("--emit-ir and --from-ir can't be combined")
+	}
+	_, err := runBuild(context.Background(), opts)
+	return err
+}
+
+// runBuild fetches, parses and converts every enabled list and writes the
+// outputs. The returned result is populated even when an error occurs.
+func runBuild(ctx context.Context, opts convertOptions) (result *buildResult, err error) {
+	result = &buildResult{
+		Started:      time.Now(),
+		Lists:        make(map[string]ListResult),
+		Errors:       make(map[string]string),
+		FetchFailed:  make(map[string]bool),
+		ParseSkips:   make(map[models.SkipReason]int),
+		ConvertSkips: make(map[models.SkipReason]int),
+	}
+	result.ID = newBuildID(result.Started)
+	defer func() { result.Duration = time.Since(result.Started) }()
+
+	// Failure hooks see the summary below, deferred after this
+	defer func() {
+		if err == nil || opts.DryRun || len(cfg.Hooks.OnFailure) == 0 {
+			return
+		}
+		if herr := hooks.Run(ctx, cfg.Hooks.OnFailure, hookVars(result, opts.OutputDir, err), cfg.Hooks.Timeout, os.Stdout); herr != nil {
+			fmt.Printf("WARNING: %v\n", herr)
+		}
+	}()
+
+	// Failed builds get a summary too, unless it was written already
+	summary := newBuildSummary(result)
+	summaryWritten := false
+	defer func() {
+		if opts.DryRun || summaryWritten {
+			return
+		}
+		summary.finish(result, err)
+		if werr := writeJSON(opts.OutputDir, SummaryFile, summary); werr != nil {
+			fmt.Printf("WARNING: writing build summary: %v\n", werr)
+		}
+	}()
+
+	// Bad URLs or settings fail before anything is downloaded
+	if problems := validateConfig(); len(problems) > 0 {
+		return result, errors.Join(problems...)
+	}
+
+	enabledLists := cfg.EnabledLists()
+	required, err := requiredLists(enabledLists, opts.Require)
+	if err != nil {
+		return result, err
+	}
+
+	fmt.Printf("Converting %d filter lists...\n", len(enabledLists))
+	if opts.DryRun {
+		fmt.Println("[DRY RUN] No files will be written")
+	}
+	if opts.Embedded {
+		fmt.Println("[EMBEDDED] Lists are read from the snapshots in the binary")
+	}
+
+	if err := loadPublicSuffixList(); err != nil {
+		return result, err
+	}
+
+	for _, format := range opts.DNSFormats {
+		if _, ok := export.DNSFormats[format]; !ok {
+			return result, fmt.Errorf("unknown DNS format %q", format)
+		}
+	}
+
+	b, err := newBuilder(opts, result, summary)
+	if err != nil {
+		return result, err
+	}
+	defer b.sp.close()
+
+	for _, list := range enabledLists {
+		fmt.Printf("\n  Processing %s...\n", list.Name)
+		entry, fetchTime, err := b.fetch(ctx, list)
+		if err != nil {
+			return result, err
+		}
+		if entry == nil {
+			continue // failed, recorded in result.Errors
+		}
+		if err := b.convert(list, entry, fetchTime); err != nil {
+			return result, err
+		}
+	}
+
+	// Outputs missing a required list are never written, the last ones stay
+	if err := checkRequired(required, result.Errors); err != nil {
+		return result, err
+	}
+
+	b.applyCosmeticExceptions()
+	reports := b.writeReports()
+
+	combineStart := time.Now()
+	if err := b.combine(enabledLists, reports); err != nil {
+		return result, err
+	}
+	summary.Stages.add("combine", combineStart)
+
+	if err := b.check(); err != nil {
+		return result, err
+	}
+
+	if !opts.DryRun {
+		// Written before the checksums so it is signed and published
+		summary.finish(result, nil)
+		if err := writeJSON(opts.OutputDir, SummaryFile, summary); err != nil {
+			fmt.Printf("WARNING: writing build summary: %v\n", err)
+		}
+		summaryWritten = true
+	}
+
+	if err := b.release(ctx); err != nil {
+		return result, err
+	}
+
+	fmt.Println("\nDone!")
+	return result, nil
+}
+
+// builder holds what the stages of a build pass on to each other: fetch and
+// convert run per list, the combined outputs and reports are written from
+// what all lists gathered
+type builder struct {
+	opts     convertOptions
+	result   *buildResult
+	summary  *BuildSummary
+	target   converter.Target
+	convOpts converter.Options
+	fetcher  *fetcher.Fetcher
+
+	// Combined outputs may be sharded by hostname; per-list files are not
+	splitter         *converter.Splitter
+	combinedSplitter *converter.Splitter
+
+	// Outputs of the last build, to clean up those this one no longer writes
+	previous map[string][]string
+
+	// Rules of the combined outputs beyond memory.limit are kept on disk
+	sp *spiller
+
+	contributions      []converter.Contribution
+	allGenericRules    []models.WebKitRule
+	allPopupRules      []models.WebKitRule
+	allTypeRules       map[string][]models.WebKitRule // by type partition
+	cosmeticExceptions []converter.CosmeticException
+	cspSuggestions     []converter.CSPSuggestion
+	hosts              *export.HostSet
+	domainStats        *converter.DomainStats
+	coverage           CoverageReport
+	exceptions         ExceptionsReport
+	interactionLists   []converter.ListRules // nil unless the interactions report is built
+	sourceLists        []listSources         // rules besides each contribution, with output.source_map
+	skipPatterns       map[string]models.SkipPatterns
+	cssRules           []models.WebKitRule // hiding rules written as stylesheets
+
+	// Rules of tagged lists, for the per-category combined outputs
+	tagContributions map[string][]converter.Contribution
+	tagGenericRules  map[string][]models.WebKitRule
+
+	// Content hashes and rule sets of earlier lists for overlap detection
+	contentHashes map[string]string
+	ruleSets      []namedRuleSet
+
+	// Filters of earlier lists, dropped from later ones with dedup_filters
+	knownFilters   parser.FilterSet
+	earlierContent []string
+
+	writtenParts   []PartInfo // every content blocker file, checked against the target's limits
+	primaryFiles   []string   // parts of the main combined output
+	safariProblems []string   // combined parts no Safari extension loads
+	manifest       *Manifest  // written once the build passed its checks
+}
+
+// reportFiles names the optional reports a build wrote, empty if not
+type reportFiles struct {
+	CSS          *CSSInfo
+	CSP          string
+	TopDomains   string
+	Coverage     string
+	Exceptions   string
+	Interactions string
+}
+
+func newBuilder(opts convertOptions, result *buildResult, summary *BuildSummary) (*builder, error) {
+	target, _ := converter.LookupTarget(cfg.Output.Target)
+	b := &builder{
+		opts:    opts,
+		result:  result,
+		summary: summary,
+		target:  target,
+		convOpts: converter.Options{
+			Target:                 target,
+			MaxSelectorComplexity:  cfg.Output.MaxSelectorComplexity,
+			RemoveParamBlock:       cfg.Output.RemoveParamBlock,
+			TopURLThreshold:        cfg.Output.TopURLThreshold,
+			TopURLChunkSize:        cfg.Output.TopURLChunkSize,
+			GenericUnlessTopURL:    cfg.Output.GenericUnlessTopURL,
+			GenericHotSelectors:    cfg.Output.GenericHotSelectors,
+			SelectorPrefix:         cfg.Output.SelectorPrefix,
+			SelectorExclude:        cfg.Output.SelectorExclude,
+			CosmeticExcludeDomains: cfg.Output.CosmeticExcludeDomains,
+			NeverBlockDomains:      cfg.Policy.NeverBlockDomains,
+		},
+		fetcher:          fetcher.New(cfg.HTTP),
+		allTypeRules:     make(map[string][]models.WebKitRule),
+		hosts:            export.NewHostSet(),
+		domainStats:      converter.NewDomainStats(),
+		coverage:         CoverageReport{Lists: make(map[string]models.Coverage)},
+		exceptions:       ExceptionsReport{Lists: make(map[string][]converter.ExceptionSource)},
+		skipPatterns:     make(map[string]models.SkipPatterns),
+		tagContributions: make(map[string][]converter.Contribution),
+		tagGenericRules:  make(map[string][]models.WebKitRule),
+		contentHashes:    make(map[string]string),
+	}
+
+	if !opts.DryRun {
+		b.previous = previousOutputs(opts.OutputDir)
+		// Interrupted downloads of large lists continue where they stopped
+		b.fetcher = b.fetcher.WithResume(filepath.Join(cfg.Cache.Dir, "partial"))
+	}
+
+	maxPerFile := cfg.Output.MaxRulesPerFile
+	if cfg.Safari.Extensions && (maxPerFile <= 0 || maxPerFile > safariMaxRules()) {
+		// Every part has to fit a single app extension
+		maxPerFile = safariMaxRules()
+	}
+	b.splitter = converter.NewSplitter(maxPerFile).WithPartName(cfg.Output.PartName)
+	b.combinedSplitter = b.splitter.WithShards(cfg.Output.Shard, cfg.Output.ShardCount)
+
+	sp, err := newSpiller()
+	if err != nil {
+		return nil, err
+	}
+	b.sp = sp
+
+	// The report needs every list's rules in memory at once
+	if cfg.Output.InteractionsReport {
+		if sp != nil {
+			fmt.Println("WARNING: interactions_report is not built with memory.limit")
+		} else {
+			b.interactionLists = []converter.ListRules{}
+		}
+	}
+
+	if cfg.Overlap.DedupFilters {
+		b.knownFilters = make(parser.FilterSet)
+	}
+	return b, nil
+}
+
+// fetch obtains the converted rules of a list: from the cache while the
+// download is fresh or unchanged, otherwise by downloading and converting
+// it. A list that fails is recorded in the result and returns nil, errors
+// fail the whole build.
+func (b *builder) fetch(ctx context.Context, list models.FilterList) (*listCache, time.Duration, error) {
+	opts, result := b.opts, b.result
+	listSummary := b.summary.list(list.Name)
+
+	// With update, lists that did not change are served from the cache
+	key := listCacheKey(list)
+	if b.knownFilters != nil {
+		key = dedupCacheKey(key, b.earlierContent)
+	}
+	var cached *listCache
+	if opts.Update {
+		cached = loadListCache(list.Name, key)
+	}
+
+	if opts.FromIR != "" {
+		// Converter-only runs: nothing is fetched, parsed or cached
+		parsed, err := ir.Read(opts.FromIR, list.Name)
+		if err != nil {
+			fmt.Printf("    ERROR: %v\n", err)
+			result.Errors[list.Name] = err.Error()
+			return nil, 0, nil
+		}
+		convertStart := time.Now()
+		entry := convertParsed(parsed, listConvertOptions(list, b.convOpts), opts.Verbose)
+		entry.ContentHash, entry.Format = parsed.ContentHash, parsed.Format
+		listSummary.Stages.add("convert", convertStart)
+		fmt.Printf("    Read %d parsed filters from the IR dump\n", len(parsed.Filters))
+		return entry, 0, nil
+	}
+	if cached != nil && !opts.Force && cached.fresh(list, time.Now()) {
+		fmt.Printf("    Up to date, using cached rules\n")
+		listSummary.Cache = cacheFresh
+		return cached, 0, nil
+	}
+
+	var prev fetcher.Info
+	if cached != nil {
+		prev = cached.Fetch
+	}
+
+	lf, err := b.fetcher.WithTLS(list.CAFile, list.Pins)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list %s: %w", list.Name, err)
+	}
+	fetchStart := time.Now()
+	var body *fetcher.Body
+	var info fetcher.Info
+	if opts.Embedded && !strings.HasPrefix(list.URL, "file://") {
+		// Offline: local files are still read, other lists need a snapshot
+		body, info, err = openEmbedded(list.URL)
+	} else {
+		body, info, err = lf.WithHeaders(list.UserAgent, list.Headers).Open(ctx, list.URL, prev)
+	}
+	listSummary.Stages.add("fetch", fetchStart)
+
+	var entry *listCache
+	var fetchTime time.Duration // request until the whole body was read
+	switch {
+	case errors.Is(err, fetcher.ErrNotModified):
+		fmt.Printf("    Not modified, using cached rules\n")
+		entry = cached
+		info.Bytes = cached.Fetch.Bytes
+		fetchTime = time.Since(fetchStart)
+		listSummary.Cache = cacheNotModified
+	case err != nil:
+		fmt.Printf("    ERROR: %v\n", err)
+		result.Errors[list.Name] = err.Error()
+		result.FetchFailed[list.Name] = true
+		return nil, 0, nil
+	default:
+		format, err := parser.ParseFormat(list.Format)
+		if err != nil {
+			body.Close()
+			return nil, 0, fmt.Errorf("list %s: %w", list.Name, err)
+		}
+
+		enc, err := parser.LookupEncoding(list.Encoding)
+		if err != nil {
+			body.Close()
+			return nil, 0, fmt.Errorf("list %s: %w", list.Name, err)
+		}
+
+		// Raw downloads are archived as served, comments included
+		var snap *snapshot
+		if cfg.Archive.Enabled && !opts.DryRun {
+			if snap, err = newSnapshot(); err != nil {
+				fmt.Printf("    WARNING: archiving list: %v\n", err)
+			}
+		}
+
+		// Lists are parsed while they download, only the beginning
+		// is buffered to detect the format. The hash covers the
+		// bytes as served, before decoding.
+		hash := sha256.New()
+		text := parser.NewTextReader(io.TeeReader(body, snap.writer(hash)), enc)
+		src := bufio.NewReaderSize(text, parser.SniffBytes)
+		if format == parser.FormatUnknown {
+			head, _ := src.Peek(parser.SniffBytes)
+			format = parser.DetectFormat(head)
+		}
+		if format == parser.FormatUnknown {
+			if opts.Strict {
+				body.Close()
+				snap.abort()
+				return nil, 0, fmt.Errorf("list %s: unrecognized format, refusing to convert in strict mode", list.Name)
+			}
+			fmt.Printf("    WARNING: list does not look like adblock syntax, hosts or WebKit JSON\n")
+		}
+
+		convertStart := time.Now()
+		var parsed *ir.List
+		entry, parsed, err = convertList(src, body.Size, format, listConvertOptions(list, b.convOpts), b.knownFilters, opts.Verbose)
+		body.Close()
+		listSummary.Stages.add("convert", convertStart)
+		fetchTime = time.Since(fetchStart)
+		info.Bytes = body.Len()
+		if body.Err() != nil {
+			fmt.Printf("    ERROR: %v\n", body.Err())
+			result.Errors[list.Name] = body.Err().Error()
+			result.FetchFailed[list.Name] = true
+			snap.abort()
+			return nil, 0, nil
+		}
+		if err != nil {
+			fmt.Printf("    ERROR parsing: %v\n", err)
+			result.Errors[list.Name] = err.Error()
+			snap.abort()
+			return nil, 0, nil
+		}
+		fmt.Printf("    Downloaded: %d bytes\n", body.Len())
+		if n := text.Transcoded(); n > 0 {
+			fmt.Printf("    WARNING: %d lines are not UTF-8 and were read as windows-1252, set encoding if that is wrong\n", n)
+		}
+
+		// Known only once the list is read, the conversion is
+		// then discarded for the identical cached one
+		contentHash := hex.EncodeToString(hash.Sum(nil))
+		if list.SHA256 != "" && !strings.EqualFold(contentHash, list.SHA256) {
+			err := fmt.Errorf("content hash %s does not match the configured sha256 %s", contentHash, list.SHA256)
+			fmt.Printf("    ERROR: %v\n", err)
+			result.Errors[list.Name] = err.Error()
+			result.FetchFailed[list.Name] = true
+			snap.abort()
+			return nil, 0, nil
+		}
+		if err := snap.commit(contentHash); err != nil {
+			fmt.Printf("    WARNING: archiving list: %v\n", err)
+		}
+		if cached != nil && cached.ContentHash == contentHash {
+			fmt.Printf("    Content unchanged, using cached rules\n")
+			entry = cached
+			listSummary.Cache = cacheUnchanged
+			break
+		}
+		entry.Key = key
+		entry.ContentHash = contentHash
+		entry.Format = format.String()
+		if opts.EmitIR != "" && parsed != nil {
+			parsed.Name, parsed.ContentHash, parsed.Format = list.Name, contentHash, entry.Format
+			if err := ir.Write(opts.EmitIR, parsed); err != nil {
+				fmt.Printf("    WARNING: writing IR: %v\n", err)
+			}
+		}
+	}
+	entry.Fetch = info
+
+	if !opts.DryRun {
+		if err := saveListCache(list.Name, entry); err != nil {
+			fmt.Printf("    WARNING: caching rules: %v\n", err)
+		}
+	}
+	return entry, fetchTime, nil
+}
+
+// convert takes the converted rules of a list into the build: it reports
+// them, checks them against the strict limits and earlier lists, writes the
+// list's own files and gathers the rules for the combined outputs
+func (b *builder) convert(list models.FilterList, entry *listCache, fetchTime time.Duration) error {
+	opts, results := b.opts, b.result.Lists
+
+	// The exact input each output was built from, also for cached lists
+	fetchInfo := newFetchInfo(entry, fetchTime)
+	if cfg.Archive.Enabled && !opts.DryRun {
+		path, err := archiveInput(opts.OutputDir, entry.ContentHash)
+		if err != nil {
+			fmt.Printf("    WARNING: archiving list: %v\n", err)
+		}
+		fetchInfo.Snapshot = path
+	}
+
+	// Identical downloads, e.g. the same list configured under two URLs
+	if other, ok := b.contentHashes[entry.ContentHash]; ok {
+		fmt.Printf("    WARNING: content is identical to %s\n", other)
+		if cfg.Overlap.Dedup {
+			fmt.Printf("    Skipped as duplicate of %s\n", other)
+			results[list.Name] = ListResult{Name: list.Name, URL: list.URL, Tags: list.Tags, DuplicateOf: other, Fetch: fetchInfo}
+			return nil
+		}
+	} else {
+		b.contentHashes[entry.ContentHash] = list.Name
+	}
+
+	rules, genericRules, popupRules := entry.Rules, entry.Generic, entry.Popups
+	pStats, cStats := entry.ParseStats, entry.ConvertStats
+	b.hosts.AddHosts(list.Name, entry.BlockedHosts, entry.AllowedHosts)
+	b.cosmeticExceptions = append(b.cosmeticExceptions, entry.CosmeticExceptions...)
+	b.cspSuggestions = append(b.cspSuggestions, entry.CSP...)
+	listCoverage := make(models.Coverage)
+	listCoverage.Merge(pStats.Coverage)
+	listCoverage.Merge(cStats.Coverage)
+	b.coverage.Lists[list.Name] = listCoverage
+	listPatterns := make(models.SkipPatterns)
+	listPatterns.Merge(pStats.Patterns)
+	listPatterns.Merge(cStats.Patterns)
+	b.skipPatterns[list.Name] = listPatterns
+	if cfg.Output.TopDomains > 0 {
+		b.domainStats.Add(list.Name, rules)
+		b.domainStats.Add(list.Name, genericRules)
+		b.domainStats.Add(list.Name, popupRules)
+		for _, name := range sortedKeys(entry.Types) {
+			b.domainStats.Add(list.Name, entry.Types[name])
+		}
+	}
+
+	// Stylesheets replace the hiding rules they can express
+	if opts.CosmeticsAsCSS {
+		var css []models.WebKitRule
+		rules, css = partitionRules(rules, export.CSSExpressible)
+		b.cssRules = append(b.cssRules, css...)
+		genericRules, css = partitionRules(genericRules, export.CSSExpressible)
+		b.cssRules = append(b.cssRules, css...)
+	}
+
+	totalSkipped := pStats.Unsupported + cStats.Skipped
+	b.reportList(list, entry, len(rules), len(genericRules), len(popupRules), totalSkipped)
+
+	if opts.Strict {
+		ratio := skipRatio(pStats, totalSkipped)
+		if ratio > cfg.Strict.MaxSkipRatio {
+			return fmt.Errorf("list %s: skip ratio %.1f%% exceeds strict limit of %.1f%%",
+				list.Name, ratio*100, cfg.Strict.MaxSkipRatio*100)
+		}
+	}
+
+	if opts.DryRun && opts.Samples > 0 {
+		printSamples(rules, opts.Samples, cStats.Samples)
+		printDiagnostics(pStats.Diagnostics, opts.Samples)
+	}
+
+	results[list.Name] = ListResult{
+		Name:         list.Name,
+		URL:          list.URL,
+		Tags:         list.Tags,
+		RulesCount:   len(rules),
+		GenericCount: len(genericRules),
+		PopupCount:   len(popupRules),
+		TypeCounts:   typeCounts(entry.Types),
+		SkippedCount: totalSkipped,
+		SkipReasons:  mergeSkipReasons(pStats.SkipReasons, cStats.SkipReasons),
+		Duplicates:   pStats.Duplicates + pStats.Known,
+		Unknown:      pStats.UnknownOptions,
+		Format:       entry.Format,
+		Fetch:        fetchInfo,
+	}
+
+	// Lists mostly made of rules an earlier list already provides,
+	// e.g. a hosts list next to its ABP mirror
+	if other, ratio := findOverlap(b.ruleSets, rules); ratio >= cfg.Overlap.Threshold && ratio > 0 {
+		fmt.Printf("    WARNING: %.1f%% of rules are already provided by %s\n", ratio*100, other)
+		if cfg.Overlap.Dedup {
+			fmt.Printf("    Skipped as duplicate of %s\n", other)
+			lr := results[list.Name]
+			lr.DuplicateOf = other
+			results[list.Name] = lr
+			return nil
+		}
+	}
+	b.ruleSets = append(b.ruleSets, namedRuleSet{list.Name, converter.NewRuleSet(rules)})
+	if b.knownFilters != nil {
+		b.knownFilters.Add(entry.FilterHashes...)
+		b.earlierContent = append(b.earlierContent, entry.ContentHash)
+	}
+
+	if !opts.DryRun {
+		if err := b.writeList(list, rules, genericRules, popupRules, entry.Types); err != nil {
+			return err
+		}
+	}
+
+	if len(entry.Exceptions) > 0 {
+		b.exceptions.Lists[list.Name] = entry.Exceptions
+	}
+
+	contribution := converter.Contribution{
+		Name:     list.Name,
+		Rules:    rules,
+		MaxRules: list.MaxRules,
+		Priority: list.Priority,
+	}
+	b.contributions = append(b.contributions, contribution)
+	if cfg.Output.SourceMap {
+		b.sourceLists = append(b.sourceLists, listSources{generic: genericRules, popups: popupRules, types: entry.Types})
+	}
+	if b.interactionLists != nil {
+		b.interactionLists = append(b.interactionLists, converter.ListRules{
+			Name:               list.Name,
+			Rules:              slices.Concat(rules, genericRules),
+			Exceptions:         entry.Exceptions,
+			CosmeticExceptions: entry.CosmeticExceptions,
+		})
+	}
+	b.allGenericRules = append(b.allGenericRules, genericRules...)
+	b.allPopupRules = append(b.allPopupRules, popupRules...)
+	for name, rules := range entry.Types {
+		b.allTypeRules[name] = append(b.allTypeRules[name], rules...)
+	}
+	for _, tag := range list.Tags {
+		b.tagContributions[tag] = append(b.tagContributions[tag], contribution)
+		b.tagGenericRules[tag] = append(b.tagGenericRules[tag], genericRules...)
+	}
+	return b.sp.hold(rules, b.contributions, b.tagContributions)
+}
+
+// reportList prints what converting a list gave and adds its skips to the
+// build's totals
+func (b *builder) reportList(list models.FilterList, entry *listCache, rules, generic, popups, skipped int) {
+	pStats, cStats := entry.ParseStats, entry.ConvertStats
+	fmt.Printf("    Converted: %d rules (skipped: %d)\n", rules, skipped)
+	if generic > 0 {
+		fmt.Printf("    Generic cosmetic: %d rules (separate output)\n", generic)
+	}
+	if popups > 0 {
+		fmt.Printf("    Popups: %d rules (separate output)\n", popups)
+	}
+	for _, name := range cfg.Output.TypePartitions {
+		if n := len(entry.Types[name]); n > 0 {
+			fmt.Printf("    Type partition %s: %d rules (separate output)\n", name, n)
+		}
+	}
+	if cStats.TopURLRestricted > 0 {
+		fmt.Printf("    Generic cosmetic: %d hot rules kept off generic_unless_top_url pages\n", cStats.TopURLRestricted)
+	}
+	if cStats.ScopeExcluded > 0 {
+		fmt.Printf("    Cosmetic scope: %d hiding rules dropped or kept off excluded domains\n", cStats.ScopeExcluded)
+	}
+	if cStats.NeverBlocked > 0 {
+		fmt.Printf("    Domain policy: %d rules dropped or restricted off never_block_domains\n", cStats.NeverBlocked)
+	}
+	if cStats.DefaultTyped > 0 {
+		fmt.Printf("    Default types: %d filters without type options limited to %s\n", cStats.DefaultTyped, strings.Join(list.DefaultTypes, ", "))
+	}
+	if cStats.RemoveParam > 0 {
+		fmt.Printf("    WARNING: %d $removeparam filters block matching requests instead of removing the parameter\n", cStats.RemoveParam)
+	}
+	if cStats.Salvaged > 0 {
+		fmt.Printf("    WARNING: %d $redirect filters block matching requests without serving a replacement\n", cStats.Salvaged)
+	}
+	if len(pStats.UnknownOptions) > 0 && cfg.Output.UnknownOptions == models.UnknownOptionWarn {
+		fmt.Printf("    WARNING: filters converted without unknown options: %s\n", formatCounts(pStats.UnknownOptions))
+	}
+
+	for reason, count := range pStats.SkipReasons {
+		b.result.ParseSkips[reason] += count
+	}
+	for reason, count := range cStats.SkipReasons {
+		b.result.ConvertSkips[reason] += count
+	}
+	if !b.opts.Verbose {
+		return
+	}
+
+	fmt.Printf("    Parsed: %d total, %d network, %d cosmetic, %d exceptions\n",
+		pStats.Total, pStats.Network, pStats.Cosmetic, pStats.Exception)
+	if pStats.Duplicates+pStats.Known > 0 {
+		fmt.Printf("    Duplicate filters dropped: %d (%d from earlier lists)\n", pStats.Duplicates+pStats.Known, pStats.Known)
+	}
+	if pStats.Excluded > 0 {
+		fmt.Printf("    Excluded by !#if: %d lines\n", pStats.Excluded)
+	}
+	if cStats.InvalidDomains > 0 {
+		fmt.Printf("    Dropped invalid domains: %d\n", cStats.InvalidDomains)
+	}
+	if cStats.Simplified > 0 {
+		fmt.Printf("    Simplified selectors: %d\n", cStats.Simplified)
+	}
+	if cStats.Transformed > 0 {
+		fmt.Printf("    Rules changed or dropped by transforms: %d\n", cStats.Transformed)
+	}
+	if cStats.Approximated > 0 {
+		fmt.Printf("    Approximated regex filters: %d\n", cStats.Approximated)
+	}
+	if len(pStats.SkipReasons) > 0 {
+		fmt.Printf("    Parse skips:\n")
+		for reason, count := range pStats.SkipReasons {
+			fmt.Printf("      - %s: %d\n", reason.Description(), count)
+		}
+	}
+	if len(cStats.SkipReasons) > 0 {
+		fmt.Printf("    Convert skips:\n")
+		for reason, count := range cStats.SkipReasons {
+			fmt.Printf("      - %s: %d\n", reason.Description(), count)
+		}
+	}
+}
+
+// writeList splits and writes the content blocker files of one list
+func (b *builder) writeList(list models.FilterList, rules, genericRules, popupRules []models.WebKitRule, types map[string][]models.WebKitRule) error {
+	writeStart := time.Now()
+	parts := b.splitter.Split(rules, list.Name)
+	if len(genericRules) > 0 {
+		parts = append(parts, b.splitter.Split(genericRules, list.Name+"-generic")...)
+	}
+	if len(popupRules) > 0 {
+		parts = append(parts, b.splitter.Split(popupRules, list.Name+"-popups")...)
+	}
+	for _, name := range cfg.Output.TypePartitions {
+		if len(types[name]) > 0 {
+			parts = append(parts, b.splitter.Split(types[name], list.Name+"-"+name)...)
+		}
+	}
+	lr := b.result.Lists[list.Name]
+	infos, err := writeParts(b.opts.OutputDir, parts)
+	if err != nil {
+		return err
+	}
+	b.writtenParts = append(b.writtenParts, infos...)
+	for _, part := range parts {
+		lr.Files = append(lr.Files, part.Name+".json")
+	}
+	b.result.Lists[list.Name] = lr
+	b.summary.list(list.Name).Stages.add("write", writeStart)
+	return nil
+}
+
+// applyCosmeticExceptions lets #@# filters also lift hiding rules of other
+// lists, e.g. unbreak lists
+func (b *builder) applyCosmeticExceptions() {
+	if len(b.cosmeticExceptions) == 0 {
+		return
+	}
+	neutralized := 0
+	for i := range b.contributions {
+		var n int
+		b.contributions[i].Rules, n = converter.NeutralizeCosmetic(b.contributions[i].Rules, b.cosmeticExceptions)
+		neutralized += n
+	}
+	for _, contribs := range b.tagContributions {
+		for i := range contribs {
+			contribs[i].Rules, _ = converter.NeutralizeCosmetic(contribs[i].Rules, b.cosmeticExceptions)
+		}
+	}
+	var n int
+	b.allGenericRules, n = converter.NeutralizeCosmetic(b.allGenericRules, b.cosmeticExceptions)
+	neutralized += n
+	for tag := range b.tagGenericRules {
+		b.tagGenericRules[tag], _ = converter.NeutralizeCosmetic(b.tagGenericRules[tag], b.cosmeticExceptions)
+	}
+	b.cssRules, n = converter.NeutralizeCosmetic(b.cssRules, b.cosmeticExceptions)
+	neutralized += n
+	fmt.Printf("\nCosmetic exceptions: %d, removed or restricted %d hiding rules\n", len(b.cosmeticExceptions), neutralized)
+}
+
+// writeReports prints the skips of the build and writes the DNS
+// blocklists, stylesheets and reports the config asks for. A report that
+// can't be written is left out of the manifest, the build goes on.
+func (b *builder) writeReports() reportFiles {
+	outputDir, dryRun, verbose := b.opts.OutputDir, b.opts.DryRun, b.opts.Verbose
+	var files reportFiles
+
+	// Show skip summary
+	if len(b.result.ParseSkips) > 0 || len(b.result.ConvertSkips) > 0 {
+		fmt.Printf("\nSkipped filters summary:\n")
+		for reason, count := range b.result.ParseSkips {
+			fmt.Printf("  %s: %d\n", reason.Description(), count)
+		}
+		for reason, count := range b.result.ConvertSkips {
+			fmt.Printf("  %s: %d\n", reason.Description(), count)
+		}
+	}
+
+	if len(b.opts.DNSFormats) > 0 {
+		blocked := b.hosts.Hosts()
+		fmt.Printf("\nDNS blocklists: %d hostnames\n", len(blocked))
+		if !dryRun {
+			if err := writeDNSExports(filepath.Join(outputDir, cfg.DNS.Dir), b.opts.DNSFormats, b.hosts); err != nil {
+				fmt.Printf("  ERROR writing DNS blocklists: %v\n", err)
+			}
+		}
+	}
+
+	if b.opts.CosmeticsAsCSS {
+		css := export.NewCosmeticCSS(b.cssRules)
+		fmt.Printf("\nCosmetic stylesheets: %d global selectors, %d domains\n", len(css.Global), len(css.Domains))
+		if !dryRun {
+			info, err := writeCSSExports(filepath.Join(outputDir, cfg.Output.CSSDir), css)
+			if err != nil {
+				fmt.Printf("  ERROR writing stylesheets: %v\n", err)
+			} else {
+				info.Dir = cfg.Output.CSSDir
+				files.CSS = &info
+			}
+		}
+	}
+
+	if cfg.Output.CSPCompanion {
+		csp := converter.MergeCSP(b.cspSuggestions)
+		fmt.Printf("\nCSP suggestions: %d domains\n", len(csp))
+		if !dryRun {
+			if err := writeJSON(outputDir, "csp.json", csp); err != nil {
+				fmt.Printf("  ERROR writing CSP suggestions: %v\n", err)
+			} else {
+				files.CSP = "csp.json"
+			}
+		}
+	}
+
+	if cfg.Output.TopDomains > 0 {
+		report := TopDomainsReport{
+			GeneratedAt:  time.Now().UTC().Format(time.RFC3339),
+			TotalDomains: b.domainStats.Len(),
+			Domains:      b.domainStats.Top(cfg.Output.TopDomains),
+		}
+		if verbose {
+			fmt.Printf("\nMost targeted domains:\n")
+			for _, dc := range report.Domains[:min(10, len(report.Domains))] {
+				fmt.Printf("  %-40s %d rules\n", dc.Domain, dc.Rules)
+			}
+		}
+		if !dryRun {
+			if err := writeJSON(outputDir, "top-domains.json", report); err != nil {
+				fmt.Printf("  ERROR writing top domains: %v\n", err)
+			} else {
+				files.TopDomains = "top-domains.json"
+			}
+		}
+	}
+
+	if cfg.Output.CoverageReport {
+		coverage := b.coverage
+		total := make(models.Coverage)
+		for _, c := range coverage.Lists {
+			total.Merge(c)
+		}
+		coverage.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+		coverage.Options = total.Sorted()
+		if verbose {
+			fmt.Printf("\nOption coverage (filters: converted/approximated/skipped):\n")
+			for _, oc := range coverage.Options[:min(10, len(coverage.Options))] {
+				fmt.Printf("  %-20s %6d: %d/%d/%d\n", oc.Option, oc.Filters, oc.Converted, oc.Approximated, oc.Skipped)
+			}
+		}
+		if !dryRun {
+			if err := writeJSON(outputDir, "coverage.json", coverage); err != nil {
+				fmt.Printf("  ERROR writing coverage report: %v\n", err)
+			} else {
+				files.Coverage = "coverage.json"
+			}
+		}
+	}
+
+	if cfg.Output.ExceptionsExport {
+		exceptions := b.exceptions
+		exceptions.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+		for _, list := range exceptions.Lists {
+			exceptions.Total += len(list)
+		}
+		fmt.Printf("\nExceptions: %d filters\n", exceptions.Total)
+		if !dryRun {
+			if err := writeJSON(outputDir, "exceptions.json", exceptions); err != nil {
+				fmt.Printf("  ERROR writing exceptions: %v\n", err)
+			} else {
+				files.Exceptions = "exceptions.json"
+			}
+		}
+	}
+
+	if b.interactionLists != nil {
+		report := InteractionsReport{
+			GeneratedAt:  time.Now().UTC().Format(time.RFC3339),
+			Interactions: converter.Interactions(b.interactionLists),
+		}
+		fmt.Printf("\nException interactions: %d between lists\n", len(report.Interactions))
+		if verbose {
+			for _, in := range report.Interactions[:min(10, len(report.Interactions))] {
+				fmt.Printf("  %s %s: lifts %d, narrows %d rules of %s\n", in.List, in.Exception, in.Lifted, in.Narrowed, in.Target)
+			}
+		}
+		if !dryRun {
+			if err := writeJSON(outputDir, "interactions.json", report); err != nil {
+				fmt.Printf("  ERROR writing interactions report: %v\n", err)
+			} else {
+				files.Interactions = "interactions.json"
+			}
+		}
+	}
+	return files
+}
+
+// combine merges the rules of every list into the combined, popup, type
+// partition and category outputs, writes them and prepares the manifest
+func (b *builder) combine(enabledLists []models.FilterList, reports reportFiles) error {
+	outputDir, results, sp := b.opts.OutputDir, b.result.Lists, b.sp
+
+	// Allowlist and domain policy entries are repeated in every combined
+	// file and count against the budget
+	allowRules := trailingRules(b.convOpts)
+	budget := cfg.Output.CombinedBudget
+	if budget > 0 {
+		budget = max(budget-len(allowRules), 1)
+	}
+
+	var allRules []models.WebKitRule
+	var dropped, sizes map[string]int
+	var err error
+	if sp.spilled() {
+		// Merged one list at a time, already deduplicated
+		if allRules, dropped, sizes, err = sp.merge(b.contributions, b.cosmeticExceptions, budget); err != nil {
+			return fmt.Errorf("merging spilled rules: %w", err)
+		}
+	} else {
+		allRules, dropped = converter.Allocate(b.contributions, budget)
+	}
+	tagRules := make(map[string][]models.WebKitRule, len(b.tagContributions))
+	tagSources := make(map[string]map[string]float64, len(b.tagContributions))
+	for tag, contribs := range b.tagContributions {
+		var tagDropped, tagSizes map[string]int
+		if sp.spilled() {
+			if tagRules[tag], tagDropped, tagSizes, err = sp.merge(contribs, b.cosmeticExceptions, budget); err != nil {
+				return fmt.Errorf("merging spilled rules of %s: %w", tag, err)
+			}
+		} else {
+			tagRules[tag], tagDropped = converter.Allocate(contribs, budget)
+		}
+		tagSources[tag] = contributionShares(contribs, tagSizes, tagDropped)
+	}
+
+	if !b.opts.Combined || len(allRules) == 0 {
+		return nil
+	}
+
+	// Deduplicate combined rules
+	fmt.Printf("\nGenerating combined output...\n")
+	for _, name := range sortedKeys(dropped) {
+		fmt.Printf("  Budget: dropped %d rules from %s\n", dropped[name], name)
+		lr := results[name]
+		lr.BudgetDropped = dropped[name]
+		results[name] = lr
+	}
+
+	if !sp.spilled() {
+		allRules = converter.Deduplicate(allRules)
+	}
+	var narrowed int
+	allRules, narrowed = converter.NarrowExceptions(allRules)
+	if narrowed > 0 {
+		fmt.Printf("  Removed %d rules negated by exceptions\n", narrowed)
+	}
+	b.result.TotalRules = len(allRules)
+	fmt.Printf("  Total rules: %d (after deduplication)\n", len(allRules))
+
+	if len(allowRules) > 0 {
+		fmt.Printf("  Allowlist and domain policy: %d trailing rules\n", len(allowRules))
+	}
+
+	allGenericRules := b.allGenericRules
+	if len(allGenericRules) > 0 {
+		allGenericRules = converter.Deduplicate(allGenericRules)
+		fmt.Printf("  Generic cosmetic rules: %d (after deduplication)\n", len(allGenericRules))
+	}
+
+	// What loading the combined output costs a device
+	compileCost := converter.EstimateCompileCost(slices.Concat(allRules, allGenericRules), worstRules)
+	reportCompileCost(compileCost, b.opts.Verbose)
+
+	allPopupRules := b.allPopupRules
+	if len(allPopupRules) > 0 {
+		allPopupRules = converter.Deduplicate(allPopupRules)
+		fmt.Printf("  Popup rules: %d (after deduplication)\n", len(allPopupRules))
+	}
+
+	allTypeRules := b.allTypeRules
+	for _, name := range cfg.Output.TypePartitions {
+		if len(allTypeRules[name]) > 0 {
+			allTypeRules[name] = converter.Deduplicate(allTypeRules[name])
+			fmt.Printf("  Type partition %s: %d rules (after deduplication)\n", name, len(allTypeRules[name]))
+		}
+	}
+
+	tagGenericRules := b.tagGenericRules
+	for _, tag := range sortedKeys(tagRules) {
+		tagRules[tag], _ = converter.NarrowExceptions(converter.Deduplicate(tagRules[tag]))
+		tagGenericRules[tag] = converter.Deduplicate(tagGenericRules[tag])
+		fmt.Printf("  Category %s: %d rules\n", tag, len(tagRules[tag]))
+	}
+
+	if b.opts.DryRun {
+		return nil
+	}
+
+	var sources *SourceMap
+	if cfg.Output.SourceMap {
+		if sources, err = newSourceMap(b.contributions, b.sourceLists, sp, b.cosmeticExceptions); err != nil {
+			return fmt.Errorf("indexing rule sources: %w", err)
+		}
+	}
+
+	combined, err := writeCombined(b.combinedSplitter, outputDir, "combined", allRules, allGenericRules, allowRules, sources)
+	if err != nil {
+		return err
+	}
+	combined.Sources = contributionShares(b.contributions, sizes, dropped)
+	combined.CompileCost = &compileCost
+	b.writtenParts = append(b.writtenParts, combined.Parts...)
+	b.primaryFiles = slices.Concat(combined.Files, combined.GenericFiles)
+
+	// Popup blocking is enabled independently by host apps
+	var popups *CombinedInfo
+	if len(allPopupRules) > 0 {
+		info, err := writeCombined(b.combinedSplitter, outputDir, "popups", allPopupRules, nil, allowRules, sources)
+		if err != nil {
+			return err
+		}
+		b.writtenParts = append(b.writtenParts, info.Parts...)
+		popups = &info
+	}
+
+	// So is blocking of each partitioned resource type
+	var types map[string]CombinedInfo
+	for _, name := range cfg.Output.TypePartitions {
+		if len(allTypeRules[name]) == 0 {
+			continue
+		}
+		if types == nil {
+			types = make(map[string]CombinedInfo)
+		}
+		info, err := writeCombined(b.combinedSplitter, outputDir, name, allTypeRules[name], nil, allowRules, sources)
+		if err != nil {
+			return err
+		}
+		b.writtenParts = append(b.writtenParts, info.Parts...)
+		types[name] = info
+	}
+
+	// One file per app extension, popups and type partitions after
+	// the combined parts
+	var safariFile string
+	if cfg.Safari.Extensions {
+		files := b.primaryFiles
+		if popups != nil {
+			files = slices.Concat(files, popups.Files)
+		}
+		for _, name := range cfg.Output.TypePartitions {
+			files = slices.Concat(files, types[name].Files)
+		}
+		mapping := mapSafariExtensions(cfg.Safari.Bundles, files, b.writtenParts)
+		b.safariProblems = mapping.problems()
+		if err := writeJSON(outputDir, "safari-extensions.json", mapping); err != nil {
+			fmt.Printf("  ERROR writing Safari extension mapping: %v\n", err)
+		} else {
+			safariFile = "safari-extensions.json"
+			fmt.Printf("  Safari extensions: %d files (max %d rules each)\n", len(mapping.Extensions), mapping.MaxRules)
+		}
+	}
+
+	categories := make(map[string]CombinedInfo)
+	for _, tag := range sortedKeys(tagRules) {
+		info, err := writeCombined(b.combinedSplitter, outputDir, "combined-"+tag, tagRules[tag], tagGenericRules[tag], allowRules, sources)
+		if err != nil {
+			return err
+		}
+		b.writtenParts = append(b.writtenParts, info.Parts...)
+		info.Sources = tagSources[tag]
+		categories[tag] = info
+	}
+
+	var sourceMapFile string
+	if sources != nil {
+		if err := writeJSON(outputDir, "source-map.json", sources); err != nil {
+			fmt.Printf("  ERROR writing source map: %v\n", err)
+		} else {
+			sourceMapFile = "source-map.json"
+			fmt.Printf("  Source map: %d files, %d lists\n", len(sources.Files), len(sources.Lists))
+		}
+	}
+
+	if !cfg.Output.GenerateManifest {
+		return nil
+	}
+	outputs := []CombinedInfo{combined}
+	if popups != nil {
+		outputs = append(outputs, *popups)
+	}
+	for _, name := range sortedKeys(types) {
+		outputs = append(outputs, types[name])
+	}
+	for _, tag := range sortedKeys(categories) {
+		outputs = append(outputs, categories[tag])
+	}
+	manifestVer, err := manifestVersion(outputDir, outputs...)
+	if err != nil {
+		return fmt.Errorf("computing manifest version: %w", err)
+	}
+
+	b.manifest = &Manifest{
+		Version:      manifestVer,
+		BuildID:      b.result.ID,
+		GeneratedAt:  time.Now().UTC().Format(time.RFC3339),
+		ToolVersion:  version,
+		ConfigHash:   configHash(),
+		Lists:        results,
+		Combined:     combined,
+		Popups:       popups,
+		Types:        types,
+		CSS:          reports.CSS,
+		CSP:          reports.CSP,
+		TopDomains:   reports.TopDomains,
+		Coverage:     reports.Coverage,
+		Exceptions:   reports.Exceptions,
+		Interactions: reports.Interactions,
+		SourceMap:    sourceMapFile,
+		Safari:       safariFile,
+	}
+	if len(categories) > 0 {
+		b.manifest.Categories = categories
+	}
+	b.manifest.Toggles = buildToggles(enabledLists, results, categories, popups, types, b.writtenParts)
+	b.manifest.Identifiers = make(map[string]string, len(b.writtenParts))
+	for _, part := range b.writtenParts {
+		b.manifest.Identifiers[part.File] = part.ID
+	}
+	return nil
+}
+
+// check fails the build on outputs the target can't load, then writes the
+// manifest and cleans up stale outputs, only once every check passed so a
+// failed build leaves the manifest and stale outputs of the last good one
+// in place
+func (b *builder) check() error {
+	outputDir, dryRun := b.opts.OutputDir, b.opts.DryRun
+
+	// Unusable outputs are never published silently
+	problems := checkLimits(b.target, cfg.Output.MaxContentBlockers, b.primaryFiles, b.writtenParts)
+	if err := reportLimits(append(problems, b.safariProblems...), b.opts.Strict); err != nil {
+		return err
+	}
+
+	if b.manifest != nil {
+		if err := writeJSON(outputDir, "manifest.json", b.manifest); err != nil {
+			fmt.Printf("  ERROR writing manifest: %v\n", err)
+		} else {
+			b.result.Manifest = b.manifest
+		}
+	}
+	if !dryRun {
+		if stale := cleanStale(outputDir, b.previous, b.writtenParts, b.result.Errors, cfg.Output.Stale); len(stale) > 0 {
+			verb := "Removed"
+			if cfg.Output.Stale == models.StaleQuarantine {
+				verb = "Quarantined"
+			}
+			fmt.Printf("%s %d stale output(s) of an earlier build: %s\n", verb, len(stale), strings.Join(stale, ", "))
+		}
+	}
+
+	newSkips, skipErr := reportNewSkips(b.skipPatterns, !dryRun)
+	if skipErr != nil {
+		fmt.Printf("WARNING: skip database: %v\n", skipErr)
+	}
+	b.result.NewSkips = newSkips
+	return nil
+}
+
+// release checksums, signs and versions the outputs of a passed build,
+// publishes them and runs the success hooks
+func (b *builder) release(ctx context.Context) error {
+	outputDir := b.opts.OutputDir
+	if b.opts.DryRun {
+		return nil
+	}
+
+	if err := artifact.WriteChecksums(outputDir); err != nil {
+		return fmt.Errorf("writing checksums: %w", err)
+	}
+	if cfg.Signing.Enabled {
+		if err := signOutput(ctx, outputDir); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Output.Versioned {
+		if err := saveVersion(outputDir, b.result.ID); err != nil {
+			return err
+		}
+		fmt.Printf("Saved build %s\n", b.result.ID)
+		if cfg.Retention.Enabled() {
+			if _, err := collectGarbage(outputDir, false, os.Stdout); err != nil {
+				fmt.Printf("WARNING: retention: %v\n", err)
+			}
+		}
+	}
+
+	if b.opts.Publish {
+		if err := publishOutput(ctx, outputDir); err != nil {
+			return err
+		}
+	}
+
+	if len(cfg.Hooks.OnSuccess) > 0 {
+		fmt.Println("\nRunning hooks...")
+		if err := hooks.Run(ctx, cfg.Hooks.OnSuccess, hookVars(b.result, outputDir, nil), cfg.Hooks.Timeout, os.Stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hookVars describes a finished build to hook commands
+func hookVars(result *buildResult, outputDir string, err error) hooks.Vars {
+	vars := hooks.Vars{OutputDir: outputDir, BuildID: result.ID, Status: notify.OnSuccess}
+	if result.Manifest != nil {
+		vars.Manifest = filepath.Join(outputDir, "manifest.json")
+	}
+	if err != nil {
+		vars.Status, vars.Error = notify.OnFailure, err.Error()
+	}
+	return vars
+}
+
+// reTag matches list tags, which become part of output filenames
+var reTag = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// trailingRules are the allowlist followed by the domain policy, written
+// after the rules of every combined file so they override them
+func trailingRules(convOpts converter.Options) []models.WebKitRule {
+	c := converter.NewWithOptions(convOpts)
+	rules := c.Allowlist(cfg.Allowlist.Domains, cfg.Allowlist.URLs)
+	return append(rules, c.DomainPolicy(cfg.Policy.NeverBlockDomains, cfg.Policy.AlwaysBlockDomains)...)
+}
+
+// writeCombined writes deduplicated rules (and generic cosmetic rules, if
+// any) as split combined files with the allowlist repeated in every part,
+// recording where their rules came from in sources unless it is nil
+func writeCombined(splitter *converter.Splitter, dir, base string, rules, generic, allow []models.WebKitRule, sources *SourceMap) (CombinedInfo, error) {
+	info := CombinedInfo{
+		TotalRules:     len(rules),
+		GenericRules:   len(generic),
+		AllowlistRules: len(allow),
+		Actions:        make(map[string]int),
+	}
+	for _, list := range [][]models.WebKitRule{rules, generic, allow} {
+		for _, r := range list {
+			info.Actions[r.Action.Type]++
+		}
+	}
+
+	// Parts stay in split order, which file names only sort in when the
+	// part name template zero-pads the index
+	parts := splitter.SplitWithTrailer(rules, allow, base)
+	for _, part := range parts {
+		info.Files = append(info.Files, part.Name+".json")
+	}
+	if len(generic) > 0 {
+		genericParts := splitter.SplitWithTrailer(generic, allow, base+"-generic")
+		for _, part := range genericParts {
+			info.GenericFiles = append(info.GenericFiles, part.Name+".json")
+		}
+		parts = append(parts, genericParts...)
+	}
+
+	var err error
+	if info.Parts, err = writeParts(dir, parts); err != nil {
+		return info, err
+	}
+	for _, part := range parts {
+		sources.record(part.Name+".json", part.Rules)
+	}
+	return info, nil
+}
+
+// writeParts writes content blocker files, output.write_workers at once,
+// and describes them in the order of parts. Serializing large parts one
+// after the other dominates build time on machines with several cores.
+// Every file is attempted; the errors of those that failed are joined.
+func writeParts(dir string, parts []converter.Part) ([]PartInfo, error) {
+	infos := make([]PartInfo, len(parts))
+	errs := make([]error, len(parts))
+	workers := cfg.Output.WriteWorkers
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(parts)) {
+		wg.Go(func() {
+			for i := range next {
+				infos[i], errs[i] = writePart(dir, parts[i])
+			}
+		})
+	}
+	for i := range parts {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return infos, errors.Join(errs...)
+}
+
+// writePart writes one content blocker file and describes it for the manifest
+func writePart(dir string, p converter.Part) (PartInfo, error) {
+	part := PartInfo{File: p.Name + ".json", Rules: len(p.Rules), Index: p.Index, Total: p.Total}
+	sum, size, err := writeRules(dir, part.File, p.Rules)
+	if err != nil {
+		return part, fmt.Errorf("writing %s: %w", part.File, err)
+	}
+	part.Bytes = size
+	part.ID = artifact.IdentifierOfSum(part.File, sum)
+	return part, nil
+}
+
+// contributionShares returns the percentage of a combined output's rules
+// each list provides, counted before deduplication. sizes holds the rules
+// of lists spilled to disk.
+func contributionShares(contribs []converter.Contribution, sizes, dropped map[string]int) map[string]float64 {
+	kept := make(map[string]int)
+	total := 0
+	for _, c := range contribs {
+		n := len(c.Rules) - dropped[c.Name]
+		if size, ok := sizes[c.Name]; ok {
+			n = size - dropped[c.Name]
+		}
+		kept[c.Name] += n
+		total += n
+	}
+	if total == 0 {
+		return nil
+	}
+
+	shares := make(map[string]float64, len(kept))
+	for name, n := range kept {
+		shares[name] = math.Round(float64(n)*10000/float64(total)) / 100
+	}
+	return shares
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// namedRuleSet is the converted rule set of a processed list
+type namedRuleSet struct {
+	name string
+	set  converter.RuleSet
+}
+
+// findOverlap returns the earlier list covering the largest share of rules
+func findOverlap(sets []namedRuleSet, rules []models.WebKitRule) (string, float64) {
+	var best string
+	var bestRatio float64
+	for _, s := range sets {
+		if ratio := s.set.Containment(rules); ratio > bestRatio {
+			best, bestRatio = s.name, ratio
+		}
+	}
+	return best, bestRatio
+}
+
+// mergeSkipReasons adds up parse and convert skip counts
+func mergeSkipReasons(counts ...map[models.SkipReason]int) map[models.SkipReason]int {
+	merged := make(map[models.SkipReason]int)
+	for _, m := range counts {
+		for reason, count := range m {
+			merged[reason] += count
+		}
+	}
+	return merged
+}
+
+// listConvertOptions returns the converter options of a list. Only trusted
+// lists get regex approximations.
+func listConvertOptions(list models.FilterList, convOpts converter.Options) converter.Options {
+	convOpts.Approximation = converter.ApproximateNone
+	if list.Trusted {
+		convOpts.Approximation = converter.ApproximateAll
+	}
+	convOpts.Transforms = cfg.TransformsFor(list.Name)
+	convOpts.DefaultResourceTypes = list.DefaultTypes
+	return convOpts
+}
+
+// convertList parses and converts a downloaded list in the given format,
+// leaving out the blocking filters in known unless it is nil. The parsed
+// filters are returned too, nil for imported WebKit JSON.
+func convertList(r io.Reader, size int64, format parser.Format, convOpts converter.Options, known parser.FilterSet, verbose bool) (*listCache, *ir.List, error) {
+	if format == parser.FormatWebKitJSON {
+		// Already in WebKit format, only validated and deduplicated
+		var entry listCache
+		c := converter.NewWithOptions(convOpts)
+		rules, err := c.ImportReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry.Rules = converter.Deduplicate(rules)
+		entry.ParseStats.Total = c.Stats().Converted + c.Stats().Skipped
+		entry.ConvertStats = c.Stats()
+		partitionList(&entry)
+		return &entry, nil, nil
+	}
+
+	// Fresh parser and converter per list for accurate stats
+	p := parser.New()
+	p.UnknownOptions(cfg.Output.UnknownOptions)
+	p.SalvageOptions(cfg.Output.SalvageOptions)
+	p.Hosts(format == parser.FormatHosts)
+	if known != nil {
+		p.SkipKnown(known)
+	}
+	filters, err := p.ParseSized(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed := &ir.List{Stats: p.Stats(), Filters: filters}
+	if known != nil {
+		parsed.FilterHashes = p.Hashes()
+	}
+	return convertParsed(parsed, convOpts, verbose), parsed, nil
+}
+
+// convertParsed converts the parsed filters of a list, freshly parsed or
+// read back from an IR dump
+func convertParsed(parsed *ir.List, convOpts converter.Options, verbose bool) *listCache {
+	entry := listCache{ParseStats: parsed.Stats, FilterHashes: parsed.FilterHashes}
+	c := converter.NewWithOptions(convOpts)
+	filters := parsed.Filters
+	entry.BlockedHosts, entry.AllowedHosts = export.PureHosts(filters)
+
+	// Generic cosmetic filters are converted separately or dropped if configured
+	var genericFilters []models.Filter
+	if cfg.Output.GenericCosmetic != models.GenericCosmeticKeep {
+		filters, genericFilters = partitionGenericCosmetic(filters)
+		if cfg.Output.GenericCosmetic == models.GenericCosmeticDrop {
+			fmt.Printf("    Dropped generic cosmetic filters: %d\n", len(genericFilters))
+			genericFilters = nil
+		}
+	}
+
+	entry.Rules = c.Convert(filters)
+	entry.Generic = c.Convert(genericFilters)
+
+	// The list's own #@# filters, those of other lists are
+	// applied to the combined output
+	entry.CosmeticExceptions = c.CosmeticExceptions()
+	entry.Rules, _ = converter.NeutralizeCosmetic(entry.Rules, entry.CosmeticExceptions)
+	entry.Generic, _ = converter.NeutralizeCosmetic(entry.Generic, entry.CosmeticExceptions)
+	entry.CSP = c.CSPSuggestions()
+	if cfg.Output.ExceptionsExport || cfg.Output.InteractionsReport {
+		entry.Exceptions = c.Exceptions()
+	}
+	entry.ConvertStats = c.Stats()
+	partitionList(&entry)
+	return &entry
+}
+
+// partitionList moves popup and type partition rules to their own outputs.
+// Negated rules are only narrowed in the combined outputs: an exception
+// also lifts the blocks of earlier lists there.
+func partitionList(entry *listCache) {
+	// Popup rules go to their own content blocker if configured
+	if cfg.Output.Popups {
+		entry.Rules, entry.Popups = partitionRules(entry.Rules, isPopupRule)
+	}
+
+	// So do block rules of the configured resource types, which host apps
+	// can then switch off without a rebuild
+	for _, name := range cfg.Output.TypePartitions {
+		var part []models.WebKitRule
+		entry.Rules, part = splitTypePartition(entry.Rules, typePartitions[name])
+		if len(part) > 0 {
+			if entry.Types == nil {
+				entry.Types = make(map[string][]models.WebKitRule)
+			}
+			entry.Types[name] = part
+		}
+	}
+}
+
+// printSamples shows the first converted rules of a list and the first raw
+// lines skipped for each reason, to sanity-check a conversion
+func printSamples(rules []models.WebKitRule, n int, skipSamples ...map[models.SkipReason][]string) {
+	if len(rules) > 0 {
+		fmt.Printf("    Sample rules:\n")
+		for _, r := range rules[:min(n, len(rules))] {
+			data, _ := json.Marshal(r)
+			fmt.Printf("      %s\n", data)
+		}
+	}
+
+	for _, samples := range skipSamples {
+		for _, reason := range sortedKeys(samples) {
+			fmt.Printf("    Skipped (%s):\n", reason.Description())
+			for _, line := range samples[reason][:min(n, len(samples[reason]))] {
+				fmt.Printf("      %s\n", line)
+			}
+		}
+	}
+}
+
+// printDiagnostics shows the first filters skipped while parsing for each
+// reason, with the option, scriptlet or operator responsible underlined
+func printDiagnostics(diags []parser.Diagnostic, n int) {
+	shown := make(map[models.SkipReason]int)
+	for _, d := range diags {
+		if shown[d.Reason] >= n {
+			continue
+		}
+		shown[d.Reason]++
+		fmt.Printf("    Skipped %s\n", d)
+		for _, line := range strings.Split(d.Caret(), "\n") {
+			fmt.Printf("      %s\n", line)
+		}
+	}
+}
+
+// formatCounts lists names with their counts, most frequent first
+func formatCounts(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s (%d)", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// partitionRules splits out the rules matching a predicate
+func partitionRules(rules []models.WebKitRule, match func(models.WebKitRule) bool) (other, matched []models.WebKitRule) {
+	for _, r := range rules {
+		if match(r) {
+			matched = append(matched, r)
+		} else {
+			other = append(other, r)
+		}
+	}
+	return other, matched
+}
+
+// isPopupRule reports whether every resource type of a rule is popup
+func isPopupRule(r models.WebKitRule) bool {
+	types := r.Trigger.ResourceType
+	if len(types) == 0 {
+		return false
+	}
+	for _, t := range types {
+		if t != models.ResourcePopup {
+			return false
+		}
+	}
+	return true
+}
+
+// partitionGenericCosmetic splits out cosmetic filters that apply on every site
+func partitionGenericCosmetic(filters []models.Filter) (specific, generic []models.Filter) {
+	for _, f := range filters {
+		if f.IsGenericCosmetic() {
+			generic = append(generic, f)
+		} else {
+			specific = append(specific, f)
+		}
+	}
+	return specific, generic
+}
+
+// skipRatio returns the share of non-comment filters that were skipped
+func skipRatio(stats parser.Stats, skipped int) float64 {
+	filters := stats.Total - stats.Comments
+	if filters <= 0 {
+		return 0
+	}
+	return float64(skipped) / float64(filters)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/health"
+	"github.com/bnema/ublock-webkit-filters/internal/metrics"
+	"github.com/bnema/ublock-webkit-filters/internal/notify"
+	"github.com/spf13/cobra"
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Rebuild filters periodically and expose Prometheus metrics",
+	RunE:  runDaemon,
+}
+
+func init() {
+	addConvertFlags(daemonCmd)
+	daemonCmd.Flags().Duration("interval", 0, "time between builds (default from daemon.interval)")
+	daemonCmd.Flags().String("listen", "", "metrics listen address (default from daemon.listen)")
+	rootCmd.AddCommand(daemonCmd)
+}
+
+// Metric names exposed in daemon mode
+const (
+	metricBuildDuration   = "uwf_build_duration_seconds"
+	metricBuilds          = "uwf_builds_total"
+	metricLastSuccess     = "uwf_last_success_timestamp_seconds"
+	metricCombinedRules   = "uwf_combined_rules"
+	metricListRules       = "uwf_list_rules"
+	metricListSkipped     = "uwf_list_skipped"
+	metricSkipReasons     = "uwf_skipped_filters"
+	metricFetchErrors     = "uwf_fetch_errors_total"
+	metricListBuildErrors = "uwf_list_errors"
+	metricListBytes       = "uwf_list_bytes"
+	metricListFailures    = "uwf_list_consecutive_failures"
+	metricListAnomalies   = "uwf_list_anomaly"
+	metricCompileFiles    = "uwf_compile_files"
+)
+
+func newDaemonMetrics() *metrics.Registry {
+	r := metrics.NewRegistry()
+	r.Register(metricBuildDuration, metrics.TypeGauge, "Duration of the last build")
+	r.Register(metricBuilds, metrics.TypeCounter, "Builds run, by result")
+	r.Register(metricLastSuccess, metrics.TypeGauge, "Unix time of the last successful build")
+	r.Register(metricCombinedRules, metrics.TypeGauge, "Rules in the combined output of the last build")
+	r.Register(metricListRules, metrics.TypeGauge, "Rules converted per list in the last build")
+	r.Register(metricListSkipped, metrics.TypeGauge, "Filters skipped per list in the last build")
+	r.Register(metricSkipReasons, metrics.TypeGauge, "Filters skipped in the last build, by stage and reason")
+	r.Register(metricFetchErrors, metrics.TypeCounter, "Failed list downloads")
+	r.Register(metricListBuildErrors, metrics.TypeGauge, "Whether a list failed in the last build")
+	r.Register(metricListBytes, metrics.TypeGauge, "Size of each list as downloaded")
+	r.Register(metricListFailures, metrics.TypeGauge, "Builds in a row each list failed in")
+	r.Register(metricListAnomalies, metrics.TypeGauge, "Anomalies of the last build, by list and kind")
+	r.Register(metricCompileFiles, metrics.TypeGauge, "Content blocker files of the last compile, by result")
+	return r
+}
+
+func runDaemon(cmd *cobra.Command, args []string) error {
+	opts := convertOptionsFromFlags(cmd)
+	opts.Update = true // only re-convert lists that changed between builds
+
+	interval := cfg.Daemon.Interval
+	if cmd.Flags().Changed("interval") {
+		interval, _ = cmd.Flags().GetDuration("interval")
+	}
+	if interval <= 0 {
+		return fmt.Errorf("daemon interval must be positive")
+	}
+
+	listen := cfg.Daemon.Listen
+	if cmd.Flags().Changed("listen") {
+		listen, _ = cmd.Flags().GetString("listen")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	reg := newDaemonMetrics()
+	if listen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", reg.Handler())
+		srv := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Fprintf(os.Stderr, "metrics server: %v\n", err)
+				stop()
+			}
+		}()
+		defer srv.Shutdown(context.Background())
+		fmt.Printf("Serving metrics on %s/metrics\n", listen)
+	}
+
+	notifier := notify.New(cfg.Webhooks)
+
+	fmt.Printf("Rebuilding every %s\n", interval)
+	for {
+		result, err := runBuild(ctx, opts)
+		recordBuild(reg, result, err)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Build failed: %v\n", err)
+		} else if cfg.Daemon.Compile && !opts.DryRun {
+			compiled, cerr := compileOutputs(ctx, opts.OutputDir, false)
+			if cerr != nil {
+				fmt.Fprintf(os.Stderr, "Compile: %v\n", cerr)
+			} else {
+				recordCompile(reg, compiled)
+			}
+		}
+
+		// Versioned builds enforce retention themselves
+		if err == nil && !opts.DryRun && cfg.Retention.Enabled() && !cfg.Output.Versioned {
+			if _, gerr := collectGarbage(opts.OutputDir, false, os.Stdout); gerr != nil {
+				fmt.Fprintf(os.Stderr, "Retention: %v\n", gerr)
+			}
+		}
+
+		ev := buildEvent(result, err)
+		if result != nil {
+			history, anomalies, herr := checkHealth(result)
+			if herr != nil {
+				fmt.Fprintf(os.Stderr, "Health history: %v\n", herr)
+			}
+			if history != nil {
+				recordHealth(reg, history, anomalies)
+			}
+			for _, a := range anomalies {
+				ev.Anomalies = append(ev.Anomalies, a.String())
+			}
+		}
+
+		for _, nerr := range notifier.Notify(ctx, ev) {
+			fmt.Fprintf(os.Stderr, "Notification failed: %v\n", nerr)
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Println("Shutting down")
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// buildEvent describes a finished build for webhooks
+func buildEvent(result *buildResult, err error) notify.Event {
+	ev := notify.Event{
+		Status:     notify.OnSuccess,
+		FinishedAt: time.Now().UTC(),
+	}
+	if err != nil {
+		ev.Status = notify.OnFailure
+		ev.Error = err.Error()
+	}
+	if result != nil {
+		ev.BuildID = result.ID
+		ev.Duration = result.Duration
+		ev.TotalRules = result.TotalRules
+		if result.Manifest != nil {
+			ev.Manifest = result.Manifest
+		}
+	}
+	return ev
+}
+
+// recordBuild updates metrics from a finished build
+func recordBuild(reg *metrics.Registry, result *buildResult, err error) {
+	status := "success"
+	if err != nil {
+		status = "failure"
+	}
+	reg.Add(metricBuilds, 1, "result", status)
+
+	if result == nil {
+		return
+	}
+	reg.Set(metricBuildDuration, result.Duration.Seconds())
+
+	reg.Reset(metricListRules)
+	reg.Reset(metricListSkipped)
+	for name, list := range result.Lists {
+		reg.Set(metricListRules, float64(list.RulesCount), "list", name)
+		reg.Set(metricListSkipped, float64(list.SkippedCount), "list", name)
+	}
+
+	reg.Reset(metricSkipReasons)
+	for reason, count := range result.ParseSkips {
+		reg.Set(metricSkipReasons, float64(count), "stage", "parse", "reason", string(reason))
+	}
+	for reason, count := range result.ConvertSkips {
+		reg.Set(metricSkipReasons, float64(count), "stage", "convert", "reason", string(reason))
+	}
+
+	reg.Reset(metricListBuildErrors)
+	for _, list := range cfg.EnabledLists() {
+		failed := 0.0
+		if _, ok := result.Errors[list.Name]; ok {
+			failed = 1
+		}
+		reg.Set(metricListBuildErrors, failed, "list", list.Name)
+	}
+	for name := range result.FetchFailed {
+		reg.Add(metricFetchErrors, 1, "list", name)
+	}
+
+	if err == nil {
+		reg.Set(metricCombinedRules, float64(result.TotalRules))
+		reg.Set(metricLastSuccess, float64(time.Now().Unix()))
+	}
+}
+
+// recordCompile updates the compile metrics after a compile run
+func recordCompile(reg *metrics.Registry, result *compileResult) {
+	reg.Set(metricCompileFiles, float64(result.Compiled), "result", "compiled")
+	reg.Set(metricCompileFiles, float64(result.Cached), "result", "unchanged")
+	reg.Set(metricCompileFiles, float64(len(result.Failed)), "result", "failed")
+}
+
+// recordHealth updates the list health metrics from the history after a
+// build and its anomalies
+func recordHealth(reg *metrics.Registry, history *health.History, anomalies []health.Anomaly) {
+	reg.Reset(metricListBytes)
+	reg.Reset(metricListFailures)
+	for _, list := range cfg.EnabledLists() {
+		samples := history.Lists[list.Name]
+		if len(samples) == 0 {
+			continue
+		}
+		if last := samples[len(samples)-1]; !last.Failed {
+			reg.Set(metricListBytes, float64(last.Bytes), "list", list.Name)
+		}
+		reg.Set(metricListFailures, float64(history.Failures(list.Name)), "list", list.Name)
+	}
+
+	reg.Reset(metricListAnomalies)
+	for _, a := range anomalies {
+		reg.Set(metricListAnomalies, 1, "list", a.List, "kind", a.Kind)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/assets"
+	"github.com/bnema/ublock-webkit-filters/internal/fetcher"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "Discover filter lists from uBlock Origin's assets.json",
+	Long: `Reads uBlock Origin's assets.json and shows the upstream filter lists that are
+not configured yet, plus configured lists whose URL is only a mirror of the
+upstream primary location. With --add the missing lists are appended to the
+config file, enabled when uBO enables them by default.`,
+	RunE: runDiscover,
+}
+
+func init() {
+	discoverCmd.Flags().String("url", assets.DefaultURL, "assets.json location")
+	discoverCmd.Flags().StringSlice("group", nil, "only consider these groups (default, ads, privacy, regions, ...)")
+	discoverCmd.Flags().String("lang", "", "only consider regional lists for this language code")
+	discoverCmd.Flags().Bool("add", false, "append discovered lists to the config file")
+	rootCmd.AddCommand(discoverCmd)
+}
+
+func runDiscover(cmd *cobra.Command, args []string) error {
+	url, _ := cmd.Flags().GetString("url")
+	groups, _ := cmd.Flags().GetStringSlice("group")
+	lang, _ := cmd.Flags().GetString("lang")
+	add, _ := cmd.Flags().GetBool("add")
+
+	data, err := fetcher.New(cfg.HTTP).Fetch(context.Background(), url)
+	if err != nil {
+		return fmt.Errorf("fetching assets.json: %w", err)
+	}
+	upstream, err := assets.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	configured := make(map[string]bool)
+	for _, l := range cfg.Lists {
+		configured[strings.ToLower(l.Name)] = true
+		configured[l.URL] = true
+	}
+
+	// Configured lists pointing at a mirror instead of the primary URL
+	var drift []string
+	for _, l := range cfg.Lists {
+		if a, ok := assets.Find(upstream, l.URL); ok && a.PrimaryURL() != l.URL {
+			drift = append(drift, fmt.Sprintf("  %s: upstream primary URL is %s", l.Name, a.PrimaryURL()))
+		}
+	}
+
+	var missing []assets.Asset
+	for _, a := range upstream {
+		if len(groups) > 0 && !containsString(groups, a.Group) {
+			continue
+		}
+		if lang != "" && !containsString(strings.Fields(a.Lang), lang) {
+			continue
+		}
+		if configured[strings.ToLower(a.Key)] || anyConfigured(a.URLs, configured) {
+			continue
+		}
+		missing = append(missing, a)
+	}
+
+	fmt.Printf("Found %d upstream filter lists, %d not configured\n", len(upstream), len(missing))
+	for _, a := range missing {
+		state := "on"
+		if a.Off {
+			state = "off"
+		}
+		fmt.Printf("\n  [%s] %s (%s, default %s)\n", a.Group, a.Key, a.Title, state)
+		fmt.Printf("         %s\n", a.PrimaryURL())
+	}
+
+	if len(drift) > 0 {
+		fmt.Printf("\nConfigured lists using a mirror URL:\n%s\n", strings.Join(drift, "\n"))
+	}
+
+	if !add || len(missing) == 0 {
+		return nil
+	}
+	return appendDiscoveredLists(missing)
+}
+
+// appendDiscoveredLists writes [[lists]] entries to the active config file
+func appendDiscoveredLists(lists []assets.Asset) error {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		return fmt.Errorf("no config file in use, run init first")
+	}
+
+	var b strings.Builder
+	b.WriteString("\n# Discovered from uBlock Origin assets.json\n")
+	for _, a := range lists {
+		fmt.Fprintf(&b, "\n# %s (%s)\n", a.Title, a.Group)
+		fmt.Fprintf(&b, "[[lists]]\nname = %q\nurl = %q\nenabled = %t\n", strings.ToLower(a.Key), a.PrimaryURL(), !a.Off)
+		if a.UpdateAfter > 0 {
+			fmt.Fprintf(&b, "update_interval = %q\n", formatInterval(a.UpdateAfter))
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(b.String()); err != nil {
+		return err
+	}
+	fmt.Printf("\nAdded %d lists to %s\n", len(lists), path)
+	return nil
+}
+
+// formatInterval renders durations as whole hours, e.g. 96h
+func formatInterval(d time.Duration) string {
+	return fmt.Sprintf("%dh", int(d.Round(time.Hour).Hours()))
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func anyConfigured(urls []string, configured map[string]bool) bool {
+	for _, u := range urls {
+		if configured[u] {
+			return true
+		}
+	}
+	return false
+}
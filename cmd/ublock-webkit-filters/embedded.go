@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/embedded"
+	"github.com/bnema/ublock-webkit-filters/internal/fetcher"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/spf13/cobra"
+)
+
+var updateEmbeddedCmd = &cobra.Command{
+	Use:   "update-embedded",
+	Short: "Download fresh snapshots of the lists embedded for offline builds",
+	Long: `Downloads the lists "convert --embedded" reads without network access and
+writes them, gzip-compressed, to the snapshot directory of the source tree.
+Rebuild the binary afterwards to embed them.`,
+	RunE: runUpdateEmbedded,
+}
+
+func init() {
+	updateEmbeddedCmd.Flags().String("dir", embedded.Dir, "snapshot directory")
+	rootCmd.AddCommand(updateEmbeddedCmd)
+}
+
+func runUpdateEmbedded(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("snapshot directory: %w (run from the repository root or set --dir)", err)
+	}
+
+	f := fetcher.New(cfg.HTTP)
+	for _, url := range embedded.URLs() {
+		data, err := f.Fetch(context.Background(), url)
+		if err != nil {
+			return fmt.Errorf("fetching %s: %w", url, err)
+		}
+		// Validate before replacing the current snapshot
+		if format := parser.DetectFormat(data); format != parser.FormatAdblock {
+			return fmt.Errorf("%s: not an adblock filter list (%s)", url, format)
+		}
+
+		name, _ := embedded.File(url)
+		var buf bytes.Buffer
+		gz, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		gz.ModTime = time.Now().UTC()
+		gz.Write(data)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Updated %s (%d bytes, %d compressed)\n", name, len(data), buf.Len())
+	}
+	return nil
+}
+
+// openEmbedded opens the embedded snapshot of a list in place of its
+// download, dated by when the snapshot was taken
+func openEmbedded(url string) (*fetcher.Body, fetcher.Info, error) {
+	snap, err := embedded.Open(url)
+	if err != nil {
+		return nil, fetcher.Info{}, err
+	}
+	info := fetcher.Info{
+		LastModified: snap.RecordedAt.Format(http.TimeFormat),
+		FetchedAt:    snap.RecordedAt,
+	}
+	return &fetcher.Body{ReadCloser: snap, Size: -1}, info, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/spf13/viper"
+)
+
+// Environment variables configuring the tool without files, e.g. as a
+// container CronJob. Any setting can also be given as UWF_<KEY>, the
+// dotted key in upper case with dots as underscores (UWF_CACHE_DIR,
+// UWF_OUTPUT_MAX_RULES_PER_FILE); lists take comma separated values.
+const (
+	envPrefix     = "UWF"
+	envOnlyVar    = "UWF_ENV_ONLY"    // read no config file, like --env-only
+	envConfigJSON = "UWF_CONFIG_JSON" // whole config as JSON, keys as in the TOML file
+	envLists      = "UWF_LISTS"       // name=url pairs replacing the configured lists
+	envOutputDir  = "UWF_OUTPUT_DIR"  // default of --output and --dir
+)
+
+// envOnlyFlag is set by --env-only
+var envOnlyFlag bool
+
+// envOnly reports whether config files are left out, so nothing but
+// defaults and the environment configures the run
+func envOnly() bool {
+	if envOnlyFlag {
+		return true
+	}
+	on, _ := strconv.ParseBool(os.Getenv(envOnlyVar))
+	return on
+}
+
+// mergeEnvConfig merges UWF_CONFIG_JSON over the config files like an
+// included fragment: its [[lists]] are appended, other settings override
+func mergeEnvConfig() error {
+	data := os.Getenv(envConfigJSON)
+	if data == "" {
+		return nil
+	}
+	var settings map[string]any
+	if err := json.Unmarshal([]byte(data), &settings); err != nil {
+		return fmt.Errorf("%s: %w", envConfigJSON, err)
+	}
+	delete(settings, "include")
+	if err := mergeSettings(settings); err != nil {
+		return fmt.Errorf("%s: %w", envConfigJSON, err)
+	}
+	return nil
+}
+
+// bindEnv lets UWF_<KEY> variables override single settings, over files,
+// UWF_CONFIG_JSON and profiles alike, and UWF_LISTS replace the lists
+func bindEnv() error {
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	for _, key := range configKeys(reflect.TypeOf(models.Config{}), "") {
+		if err := viper.BindEnv(key); err != nil {
+			return err
+		}
+	}
+
+	if value := os.Getenv(envLists); value != "" {
+		lists, err := parseEnvLists(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", envLists, err)
+		}
+		viper.Set("lists", lists)
+	}
+	return nil
+}
+
+// configKeys returns the dotted keys of the settings of a config struct
+// an environment variable can hold: arrays of tables and maps are left to
+// UWF_CONFIG_JSON
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("mapstructure")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := prefix + tag
+		switch {
+		case f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Time{}):
+			keys = append(keys, configKeys(f.Type, key+".")...)
+		case f.Type.Kind() == reflect.Map:
+		case f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Struct:
+		default:
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// parseEnvLists reads comma separated name=url pairs as enabled lists
+func parseEnvLists(value string) ([]any, error) {
+	var lists []any
+	for _, entry := range strings.Split(value, ",") {
+		name, url, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" || url == "" {
+			return nil, fmt.Errorf("%q is not name=url", entry)
+		}
+		lists = append(lists, map[string]any{"name": name, "url": url, "enabled": true})
+	}
+	return lists, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvConfig(t *testing.T) {
+	t.Setenv(envConfigJSON, `{"output": {"max_rules_per_file": 30000, "popups": true}, "lists": [{"name": "json", "url": "https://example.com/json.txt", "enabled": true}]}`)
+	t.Setenv("UWF_OUTPUT_MAX_RULES_PER_FILE", "20000")
+	t.Setenv("UWF_CACHE_DIR", "/tmp/uwf-cache")
+	t.Setenv("UWF_OUTPUT_TYPE_PARTITIONS", "scripts,images")
+	t.Setenv("UWF_HTTP_TIMEOUT", "5s")
+
+	load := func() models.Config {
+		viper.Reset()
+		viper.SetDefault("output.max_rules_per_file", 50000)
+		require.NoError(t, mergeEnvConfig())
+		require.NoError(t, bindEnv())
+		var c models.Config
+		require.NoError(t, viper.Unmarshal(&c))
+		return c
+	}
+	defer viper.Reset()
+
+	// Variables override the JSON blob, which overrides defaults
+	c := load()
+	assert.Equal(t, 20000, c.Output.MaxRulesPerFile)
+	assert.True(t, c.Output.Popups)
+	assert.Equal(t, "/tmp/uwf-cache", c.Cache.Dir)
+	assert.Equal(t, []string{"scripts", "images"}, c.Output.TypePartitions)
+	assert.Equal(t, 5*time.Second, c.HTTP.Timeout)
+	require.Len(t, c.Lists, 1)
+	assert.Equal(t, "json", c.Lists[0].Name)
+
+	// UWF_LISTS replaces the lists
+	t.Setenv(envLists, "easylist=https://easylist.to/easylist/easylist.txt, local=file:///lists/local.txt")
+	c = load()
+	require.Len(t, c.Lists, 2)
+	assert.Equal(t, models.FilterList{Name: "local", URL: "file:///lists/local.txt", Enabled: true}, c.Lists[1])
+
+	t.Setenv(envLists, "easylist")
+	viper.Reset()
+	assert.ErrorContains(t, bindEnv(), `"easylist" is not name=url`)
+}
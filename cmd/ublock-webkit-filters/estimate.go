@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bnema/ublock-webkit-filters/internal/converter"
+	"github.com/bnema/ublock-webkit-filters/internal/fetcher"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/spf13/cobra"
+)
+
+var estimateCmd = &cobra.Command{
+	Use:   "estimate",
+	Short: "Predict WebKit rule counts of the enabled lists without writing output",
+	Long: `Converts the enabled lists in memory, reusing the rules cached by earlier
+builds, and predicts how many rules each list and the combined output hold
+once lists are merged, deduplicated and split, to plan which lists fit under
+the content blocker limit. Nothing is written.`,
+	RunE: runEstimate,
+}
+
+func init() {
+	estimateCmd.Flags().Bool("fresh", false, "download every list instead of reusing cached rules")
+	addOutputFormatFlag(estimateCmd)
+	rootCmd.AddCommand(estimateCmd)
+}
+
+// listEstimate is the predicted output of one list
+type listEstimate struct {
+	Name     string `json:"name"`
+	Filters  int    `json:"filters"`  // filters parsed
+	Rules    int    `json:"rules"`    // rules of the list's own files, all outputs included
+	Cached   bool   `json:"cached"`   // rules came from the cache of an earlier build
+	Combined int    `json:"combined"` // combined rules once the list is added, after deduplication
+	Parts    int    `json:"parts"`    // combined content blocker files at that point
+	Err      error  `json:"-"`
+	Error    string `json:"error,omitempty"` // Err, for --output json and yaml
+}
+
+// estimate predicts the outputs of a build of the enabled lists
+type estimate struct {
+	Lists    []listEstimate `json:"lists"`
+	Combined int            `json:"combined"`          // rules of the combined output
+	Generic  int            `json:"generic,omitempty"` // rules of the combined generic cosmetic output
+	Popups   int            `json:"popups,omitempty"`  // rules of the combined popup output
+	Types    map[string]int `json:"types,omitempty"`   // rules of each combined type partition
+	Parts    int            `json:"parts"`             // combined content blocker files
+	Dropped  int            `json:"dropped"`           // rules left out by output.combined_budget
+	Capacity int            `json:"capacity"`          // combined rules the host can load, 0 for no limit
+}
+
+func runEstimate(cmd *cobra.Command, args []string) error {
+	fresh, _ := cmd.Flags().GetBool("fresh")
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	if problems := validateConfig(); len(problems) > 0 {
+		return errors.Join(problems...)
+	}
+	if err := loadPublicSuffixList(); err != nil {
+		return err
+	}
+
+	if format != outputTable {
+		// Conversion notes go to stderr, stdout only holds the report
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		est := estimateLists(context.Background(), fresh)
+		os.Stdout = stdout
+		return printStructured(os.Stdout, format, est)
+	}
+
+	est := estimateLists(context.Background(), fresh)
+
+	fmt.Printf("%-24s %9s %9s %10s %6s\n", "LIST", "FILTERS", "RULES", "COMBINED", "PARTS")
+	for _, le := range est.Lists {
+		if le.Err != nil {
+			fmt.Printf("%-24s ERROR: %v\n", le.Name, le.Err)
+			continue
+		}
+		note := ""
+		if le.Cached {
+			note = " (cached)"
+		}
+		if est.Capacity > 0 && le.Combined > est.Capacity {
+			note += " over capacity"
+		}
+		fmt.Printf("%-24s %9d %9d %10d %6d%s\n", le.Name, le.Filters, le.Rules, le.Combined, le.Parts, note)
+	}
+
+	fmt.Printf("\nCombined: %d rules in %d parts", est.Combined, est.Parts)
+	if est.Generic > 0 {
+		fmt.Printf(", %d generic cosmetic", est.Generic)
+	}
+	if est.Popups > 0 {
+		fmt.Printf(", %d popups", est.Popups)
+	}
+	for _, name := range cfg.Output.TypePartitions {
+		if n := est.Types[name]; n > 0 {
+			fmt.Printf(", %d %s", n, name)
+		}
+	}
+	fmt.Println()
+	if est.Dropped > 0 {
+		fmt.Printf("Budget: %d rules dropped by output.combined_budget\n", est.Dropped)
+	}
+	if est.Capacity > 0 {
+		if est.Combined > est.Capacity {
+			fmt.Printf("Over capacity by %d rules (%d loadable)\n", est.Combined-est.Capacity, est.Capacity)
+		} else {
+			fmt.Printf("Fits: %d of %d loadable rules\n", est.Combined, est.Capacity)
+		}
+	}
+	return nil
+}
+
+// estimateLists converts the enabled lists in build order and predicts the
+// combined output after each one. Lists that fail are reported in place.
+func estimateLists(ctx context.Context, fresh bool) *estimate {
+	target, _ := converter.LookupTarget(cfg.Output.Target)
+	convOpts := converter.Options{
+		Target:                 target,
+		MaxSelectorComplexity:  cfg.Output.MaxSelectorComplexity,
+		RemoveParamBlock:       cfg.Output.RemoveParamBlock,
+		TopURLThreshold:        cfg.Output.TopURLThreshold,
+		TopURLChunkSize:        cfg.Output.TopURLChunkSize,
+		GenericUnlessTopURL:    cfg.Output.GenericUnlessTopURL,
+		GenericHotSelectors:    cfg.Output.GenericHotSelectors,
+		SelectorPrefix:         cfg.Output.SelectorPrefix,
+		SelectorExclude:        cfg.Output.SelectorExclude,
+		CosmeticExcludeDomains: cfg.Output.CosmeticExcludeDomains,
+		NeverBlockDomains:      cfg.Policy.NeverBlockDomains,
+	}
+
+	maxPerFile := cfg.Output.MaxRulesPerFile
+	if cfg.Safari.Extensions && (maxPerFile <= 0 || maxPerFile > safariMaxRules()) {
+		maxPerFile = safariMaxRules()
+	}
+	splitter := converter.NewSplitter(maxPerFile).
+		WithPartName(cfg.Output.PartName).
+		WithShards(cfg.Output.Shard, cfg.Output.ShardCount)
+
+	allowRules := trailingRules(convOpts)
+	budget := cfg.Output.CombinedBudget
+	if budget > 0 {
+		budget = max(budget-len(allowRules), 1)
+	}
+
+	est := &estimate{Capacity: cfg.Output.CombinedBudget}
+	if est.Capacity == 0 && target.MaxRules > 0 {
+		est.Capacity = target.MaxRules * max(cfg.Output.MaxContentBlockers, 1)
+	}
+
+	var knownFilters parser.FilterSet
+	var earlierContent []string
+	if cfg.Overlap.DedupFilters {
+		knownFilters = make(parser.FilterSet)
+	}
+
+	f := fetcher.New(cfg.HTTP)
+	var contributions []converter.Contribution
+	var cosmeticExceptions []converter.CosmeticException
+	var generic, popups []models.WebKitRule
+	types := make(map[string][]models.WebKitRule)
+	for _, list := range cfg.EnabledLists() {
+		le := listEstimate{Name: list.Name}
+
+		key := listCacheKey(list)
+		if knownFilters != nil {
+			key = dedupCacheKey(key, earlierContent)
+		}
+		var entry *listCache
+		if !fresh {
+			entry = loadListCache(list.Name, key)
+			le.Cached = entry != nil
+		}
+		if entry == nil {
+			var err error
+			if entry, err = convertForEstimate(ctx, f, list, convOpts, knownFilters); err != nil {
+				le.Err, le.Error = err, err.Error()
+				est.Lists = append(est.Lists, le)
+				continue
+			}
+		}
+		if knownFilters != nil {
+			knownFilters.Add(entry.FilterHashes...)
+			earlierContent = append(earlierContent, entry.ContentHash)
+		}
+
+		le.Filters = entry.ParseStats.Network + entry.ParseStats.Exception + entry.ParseStats.Cosmetic
+		if le.Filters == 0 {
+			// Imported JSON rules are not parsed as filters
+			le.Filters = entry.ParseStats.Total
+		}
+		le.Rules = len(entry.Rules) + len(entry.Generic) + len(entry.Popups)
+		for _, rules := range entry.Types {
+			le.Rules += len(rules)
+		}
+
+		contributions = append(contributions, converter.Contribution{
+			Name:     list.Name,
+			Rules:    entry.Rules,
+			MaxRules: list.MaxRules,
+			Priority: list.Priority,
+		})
+		cosmeticExceptions = append(cosmeticExceptions, entry.CosmeticExceptions...)
+		generic = append(generic, entry.Generic...)
+		popups = append(popups, entry.Popups...)
+		for name, rules := range entry.Types {
+			types[name] = append(types[name], rules...)
+		}
+
+		// The combined output as if the build stopped at this list
+		rules, dropped := combineEstimate(contributions, cosmeticExceptions, budget)
+		le.Combined = len(rules)
+		le.Parts = len(splitter.SplitWithTrailer(rules, allowRules, "combined"))
+		est.Lists = append(est.Lists, le)
+
+		est.Combined, est.Parts, est.Dropped = le.Combined, le.Parts, 0
+		for _, n := range dropped {
+			est.Dropped += n
+		}
+	}
+
+	generic, _ = converter.NeutralizeCosmetic(generic, cosmeticExceptions)
+	est.Generic = len(converter.Deduplicate(generic))
+	est.Popups = len(converter.Deduplicate(popups))
+	for name, rules := range types {
+		if est.Types == nil {
+			est.Types = make(map[string]int)
+		}
+		est.Types[name] = len(converter.Deduplicate(rules))
+	}
+	return est
+}
+
+// combineEstimate merges list rules the way the combined output is built:
+// cosmetic exceptions of every list applied, the budget allocated, then
+// deduplicated and negated rules removed
+func combineEstimate(contributions []converter.Contribution, exceptions []converter.CosmeticException, budget int) ([]models.WebKitRule, map[string]int) {
+	contribs := make([]converter.Contribution, len(contributions))
+	copy(contribs, contributions)
+	for i := range contribs {
+		contribs[i].Rules, _ = converter.NeutralizeCosmetic(contribs[i].Rules, exceptions)
+	}
+	rules, dropped := converter.Allocate(contribs, budget)
+	rules, _ = converter.NarrowExceptions(converter.Deduplicate(rules))
+	return rules, dropped
+}
+
+// convertForEstimate downloads and converts a list in memory, without
+// caching or archiving it
+func convertForEstimate(ctx context.Context, f *fetcher.Fetcher, list models.FilterList, convOpts converter.Options, known parser.FilterSet) (*listCache, error) {
+	lf, err := f.WithTLS(list.CAFile, list.Pins)
+	if err != nil {
+		return nil, err
+	}
+	data, err := lf.WithHeaders(list.UserAgent, list.Headers).Fetch(ctx, list.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := parser.ParseFormat(list.Format)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := parser.LookupEncoding(list.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	src := bufio.NewReaderSize(parser.NewTextReader(bytes.NewReader(data), enc), parser.SniffBytes)
+	if format == parser.FormatUnknown {
+		head, _ := src.Peek(parser.SniffBytes)
+		format = parser.DetectFormat(head)
+	}
+
+	entry, _, err := convertList(src, int64(len(data)), format, listConvertOptions(list, convOpts), known, false)
+	return entry, err
+}
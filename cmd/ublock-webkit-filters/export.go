@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/export"
+)
+
+// writeDNSExports writes one DNS blocklist file per requested format
+func writeDNSExports(dir string, formats []string, hosts *export.HostSet) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	blocked := hosts.Hosts()
+	opts := export.DNSOptions{Sinkhole: cfg.DNS.Sinkhole}
+	for _, format := range formats {
+		path := filepath.Join(dir, export.DNSFormats[format])
+		if err := writeDNSFile(path, format, blocked, opts); err != nil {
+			return fmt.Errorf("%s: %w", format, err)
+		}
+		fmt.Printf("  Wrote %s\n", path)
+
+		if format == export.FormatPihole && cfg.DNS.PiholeMetadata {
+			adlist := export.NewPiholeAdlist(hosts, cfg.DNS.PiholeAddress)
+			if err := writeJSON(dir, "pihole-adlist.json", adlist); err != nil {
+				return fmt.Errorf("pihole metadata: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func writeDNSFile(path, format string, hosts []string, opts export.DNSOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return export.WriteDNS(f, format, hosts, opts)
+}
+
+// writeCSSExports writes the global and per-domain stylesheets
+func writeCSSExports(dir string, css export.CosmeticCSS) (CSSInfo, error) {
+	info := CSSInfo{GlobalSelectors: len(css.Global)}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return info, err
+	}
+
+	if err := writeCSSFile(filepath.Join(dir, export.GlobalCSS), css.Global); err != nil {
+		return info, err
+	}
+	info.Global = export.GlobalCSS
+
+	for _, domain := range sortedKeys(css.Domains) {
+		// Normalized domains never contain path separators, imported ones might
+		if strings.ContainsAny(domain, `/\`) || strings.HasPrefix(domain, ".") {
+			continue
+		}
+		if err := writeCSSFile(filepath.Join(dir, export.DomainFile(domain)), css.Domains[domain]); err != nil {
+			return info, err
+		}
+		info.Domains = append(info.Domains, domain)
+	}
+	return info, nil
+}
+
+func writeCSSFile(path string, selectors []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return export.WriteCSS(f, selectors)
+}
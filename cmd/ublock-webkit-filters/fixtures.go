@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/converter"
+	"github.com/bnema/ublock-webkit-filters/internal/embedded"
+	"github.com/bnema/ublock-webkit-filters/internal/fetcher"
+	"github.com/bnema/ublock-webkit-filters/internal/fixtures"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/spf13/cobra"
+)
+
+var fixturesCmd = &cobra.Command{
+	Use:   "fixtures [list...]",
+	Short: "Sample converted and skipped lines of the lists into the test corpus",
+	Long: `Development command: downloads the enabled lists (or those named) and
+writes a random sample of the lines they convert and of those they skip,
+with the skip reasons, to the regression corpus of the source tree. Tests
+check every sampled line still has the same outcome, so the corpus keeps
+up with the syntax upstream lists use. Conversion uses default settings,
+whatever the config.`,
+	RunE: runFixtures,
+}
+
+func init() {
+	fixturesCmd.Flags().String("dir", fixtures.CorpusDir, "corpus directory")
+	fixturesCmd.Flags().IntP("samples", "n", 25, "converted and skipped lines to sample from each list")
+	fixturesCmd.Flags().Int64("seed", 0, "random seed, 0 for a new one")
+	fixturesCmd.Flags().Bool("embedded", false, "sample the embedded snapshots instead of downloading")
+	rootCmd.AddCommand(fixturesCmd)
+}
+
+func runFixtures(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	n, _ := cmd.Flags().GetInt("samples")
+	seed, _ := cmd.Flags().GetInt64("seed")
+	useEmbedded, _ := cmd.Flags().GetBool("embedded")
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("corpus directory: %w (run from the repository root or set --dir)", err)
+	}
+	if n <= 0 {
+		return fmt.Errorf("--samples must be positive, got %d", n)
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	f := fetcher.New(cfg.HTTP)
+	for _, list := range cfg.Lists {
+		if len(args) > 0 && !slices.Contains(args, list.Name) || len(args) == 0 && !list.Enabled {
+			continue
+		}
+		var data []byte
+		var err error
+		if useEmbedded {
+			if _, ok := embedded.File(list.URL); !ok {
+				continue
+			}
+			data, err = readEmbedded(list.URL)
+		} else {
+			data, err = f.Fetch(context.Background(), list.URL)
+		}
+		if err != nil {
+			return fmt.Errorf("fetching %s: %w", list.Name, err)
+		}
+
+		sum := sha256.Sum256(data)
+		lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+		converted, skipped := fixtures.Take(lines, n, rand.New(rand.NewSource(seed)), classifyLine)
+		c := &fixtures.Corpus{
+			List:        list.Name,
+			URL:         list.URL,
+			ContentHash: hex.EncodeToString(sum[:]),
+			SampledAt:   time.Now().UTC().Truncate(time.Second),
+			Seed:        seed,
+			Lines:       len(lines),
+			Converted:   converted,
+			Skipped:     skipped,
+		}
+		if err := fixtures.WriteCorpus(dir, c); err != nil {
+			return err
+		}
+		fmt.Printf("Sampled %d converted and %d skipped lines of %s\n", len(converted), len(skipped), list.Name)
+	}
+	return nil
+}
+
+// readEmbedded returns the embedded snapshot of a list
+func readEmbedded(url string) ([]byte, error) {
+	snap, err := embedded.Open(url)
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Close()
+	return io.ReadAll(snap)
+}
+
+// classifyLine converts a single line with default settings, for the
+// corpus: converted, skipped with the reason, or neither for comments and
+// directives
+func classifyLine(line string) (bool, models.SkipReason) {
+	p := parser.New()
+	filters, err := p.Parse(strings.NewReader(line))
+	if err != nil {
+		return false, ""
+	}
+	if len(filters) == 0 {
+		return false, firstReason(p.Stats().SkipReasons)
+	}
+	c := converter.New()
+	if len(c.Convert(filters)) > 0 {
+		return true, ""
+	}
+	return false, firstReason(c.Stats().SkipReasons)
+}
+
+// firstReason returns the skip reason of a single filter, the first in
+// order when it was counted under several
+func firstReason(counts map[models.SkipReason]int) models.SkipReason {
+	var reasons []models.SkipReason
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	slices.Sort(reasons)
+	if len(reasons) == 0 {
+		return ""
+	}
+	return reasons[0]
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+// Output formats of the informational commands: text for people, JSON or
+// YAML for scripts and GUIs wrapping the tool
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+var outputFormats = []string{outputTable, outputJSON, outputYAML}
+
+// addOutputFormatFlag registers --output on an informational command
+func addOutputFormatFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", outputTable, "output format: table, json or yaml")
+}
+
+// outputFormat returns the --output format of the command
+func outputFormat(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("output")
+	if !slices.Contains(outputFormats, format) {
+		return "", fmt.Errorf("unknown output format %q (want table, json or yaml)", format)
+	}
+	return format, nil
+}
+
+// printStructured writes v as JSON or YAML. YAML keys are the JSON field
+// names, so both formats read the same.
+func printStructured(w io.Writer, format string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if format == outputJSON {
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(generic); err != nil {
+		return err
+	}
+	return enc.Close()
+}
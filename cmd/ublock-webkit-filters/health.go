@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/health"
+)
+
+// healthPath is where the daemon remembers lists between builds
+func healthPath() string {
+	return filepath.Join(cfg.Cache.Dir, "health.json")
+}
+
+// checkHealth records a sample of every enabled list the build reached and
+// prints the anomalies against earlier builds
+func checkHealth(result *buildResult) (*health.History, []health.Anomaly, error) {
+	history, err := health.Load(healthPath())
+	if err != nil {
+		return nil, nil, err
+	}
+	thresholds := health.Thresholds{
+		Shrink:      cfg.Daemon.Health.ShrinkRatio,
+		MaxFailures: cfg.Daemon.Health.MaxFailures,
+		Keep:        cfg.Daemon.Health.History,
+	}
+
+	now := time.Now().UTC()
+	var anomalies []health.Anomaly
+	for _, list := range cfg.EnabledLists() {
+		sample := health.Sample{At: now}
+		if _, failed := result.Errors[list.Name]; failed {
+			sample.Failed = true
+		} else if lr, ok := result.Lists[list.Name]; ok && lr.DuplicateOf == "" && lr.Fetch != nil {
+			sample.Bytes = lr.Fetch.Bytes
+			sample.Rules = lr.RulesCount + lr.GenericCount + lr.PopupCount
+			for _, n := range lr.TypeCounts {
+				sample.Rules += n
+			}
+			sample.Format = lr.Format
+		} else {
+			// Skipped as a duplicate or not reached by a failed build
+			continue
+		}
+		anomalies = append(anomalies, history.Record(list.Name, sample, thresholds)...)
+	}
+
+	for _, a := range anomalies {
+		fmt.Printf("HEALTH: %s\n", a)
+	}
+	return history, anomalies, history.Save(healthPath())
+}
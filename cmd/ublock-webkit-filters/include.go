@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// mergeIncludes merges the config fragments matched by the top-level
+// include globs (relative to the main config file) into the active config.
+// Arrays of tables such as [[lists]] and [[webhooks]] are appended, other
+// settings from later fragments override earlier ones. Fragments cannot
+// include further files.
+func mergeIncludes() error {
+	patterns := viper.GetStringSlice("include")
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	base := filepath.Dir(viper.ConfigFileUsed())
+	var files []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(base, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("include %q: %w", pattern, err)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+
+	for _, file := range files {
+		fragment := viper.New()
+		fragment.SetConfigFile(file)
+		if err := fragment.ReadInConfig(); err != nil {
+			return fmt.Errorf("include %s: %w", file, err)
+		}
+
+		settings := fragment.AllSettings()
+		delete(settings, "include")
+		if err := mergeSettings(settings); err != nil {
+			return fmt.Errorf("include %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// mergeSettings merges settings into the active config: top-level arrays
+// are appended to the existing ones, everything else overrides
+func mergeSettings(settings map[string]any) error {
+	for key, value := range settings {
+		items, ok := value.([]any)
+		if !ok {
+			continue
+		}
+		if existing, ok := viper.Get(key).([]any); ok {
+			items = append(append([]any{}, existing...), items...)
+		}
+		viper.Set(key, items)
+		delete(settings, key)
+	}
+	return viper.MergeConfigMap(settings)
+}
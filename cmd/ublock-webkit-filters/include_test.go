@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeIncludes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	}
+	write("config.toml", `
+include = ["conf.d/*.toml", "extra.toml"]
+
+[output]
+max_rules_per_file = 50000
+generate_combined = true
+
+[[lists]]
+name = "easylist"
+url = "https://example.com/easylist.txt"
+enabled = true
+
+[[webhooks]]
+type = "ntfy"
+url = "https://ntfy.example.com/builds"
+`)
+	// Matches of a glob are merged in name order, whatever order they
+	// were created in
+	write("conf.d/20-regional.toml", `
+[output]
+max_rules_per_file = 30000
+
+[[lists]]
+name = "regional"
+url = "https://example.com/regional.txt"
+`)
+	write("conf.d/10-privacy.toml", `
+include = ["nested/*.toml"]
+
+[output]
+max_rules_per_file = 40000
+popups = true
+
+[[lists]]
+name = "easyprivacy"
+url = "https://example.com/easyprivacy.txt"
+enabled = true
+
+[[webhooks]]
+type = "generic"
+url = "https://hooks.example.com/build"
+`)
+	write("conf.d/nested/ignored.toml", `
+[[lists]]
+name = "nested"
+url = "https://example.com/nested.txt"
+`)
+	write("extra.toml", `
+[output]
+max_rules_per_file = 20000
+`)
+
+	load := func() (models.Config, error) {
+		viper.Reset()
+		viper.SetConfigFile(filepath.Join(dir, "config.toml"))
+		require.NoError(t, viper.ReadInConfig())
+		var c models.Config
+		if err := mergeIncludes(); err != nil {
+			return c, err
+		}
+		require.NoError(t, viper.Unmarshal(&c))
+		return c, nil
+	}
+	defer viper.Reset()
+
+	c, err := load()
+	require.NoError(t, err)
+
+	// Arrays of tables are appended in file order, fragments do not
+	// include further files
+	var lists []string
+	for _, list := range c.Lists {
+		lists = append(lists, list.Name)
+	}
+	assert.Equal(t, []string{"easylist", "easyprivacy", "regional"}, lists)
+	require.Len(t, c.Webhooks, 2)
+	assert.Equal(t, "ntfy", c.Webhooks[0].Type)
+	assert.Equal(t, "generic", c.Webhooks[1].Type)
+
+	// The last file setting a value wins, values no fragment sets stay
+	assert.Equal(t, 20000, c.Output.MaxRulesPerFile)
+	assert.True(t, c.Output.Popups)
+	assert.True(t, c.Output.GenerateCombined)
+
+	write("conf.d/30-broken.toml", "[output\n")
+	_, err = load()
+	assert.ErrorContains(t, err, "30-broken.toml")
+}
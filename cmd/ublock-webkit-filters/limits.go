@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bnema/ublock-webkit-filters/internal/converter"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// checkLimits returns the outputs a host could not load: files holding more
+// rules than the target accepts, and a primary combined set split into more
+// parts than the host can register as content blockers (0 = no limit)
+func checkLimits(target converter.Target, maxBlockers int, primary []string, parts []PartInfo) []string {
+	var problems []string
+	for _, part := range parts {
+		if target.MaxRules > 0 && part.Rules > target.MaxRules {
+			problems = append(problems, fmt.Sprintf("%s has %d rules, %s loads at most %d per content blocker",
+				part.File, part.Rules, target.Name, target.MaxRules))
+		}
+	}
+	if maxBlockers > 0 && len(primary) > maxBlockers {
+		problems = append(problems, fmt.Sprintf("combined output needs %d content blockers (%v), the host registers %d",
+			len(primary), primary, maxBlockers))
+	}
+	return problems
+}
+
+// reportLimits prints limit problems with guidance, failing in strict mode
+func reportLimits(problems []string, strict bool) error {
+	if len(problems) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\n!!! WARNING: %d outputs cannot be loaded by the host !!!\n", len(problems))
+	for _, p := range problems {
+		fmt.Printf("  - %s\n", p)
+	}
+	fmt.Println("  Lower output.max_rules_per_file, cap the combined output with")
+	fmt.Println("  output.combined_budget (and max_rules/priority per list), or disable lists.")
+
+	if strict {
+		return fmt.Errorf("%d outputs exceed content blocker limits", len(problems))
+	}
+	return nil
+}
+
+// worstRules is how many of the most expensive rules a compile cost report
+// names
+const worstRules = 5
+
+// reportCompileCost prints the estimated compile cost of the combined
+// output, with the most expensive rules when a share is over its limit
+func reportCompileCost(cost converter.CompileCost, verbose bool) {
+	if cost.Rules == 0 {
+		return
+	}
+	fmt.Printf("  Compile cost: %d (%.1f per rule), url-filters %d literal, %d wildcard, %d complex\n",
+		cost.Score, float64(cost.Score)/float64(cost.Rules),
+		cost.Filters[converter.FilterLiteral], cost.Filters[converter.FilterWildcard], cost.Filters[converter.FilterComplex])
+
+	warnings := cost.Warnings()
+	for _, w := range warnings {
+		fmt.Printf("  WARNING: %s, slow to load on low-end devices\n", w)
+	}
+	if (len(warnings) == 0 && !verbose) || len(cost.Worst) == 0 {
+		return
+	}
+	fmt.Println("  Most expensive rules:")
+	for _, rc := range cost.Worst {
+		what := rc.Rule.Trigger.URLFilter
+		if rc.Rule.Action.Type == models.ActionCSSDisplayNone {
+			what = rc.Rule.Action.Selector
+		}
+		fmt.Printf("    %4d %-18s %s\n", rc.Score, rc.Reason, what)
+	}
+}
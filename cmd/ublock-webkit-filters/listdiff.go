@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/fetcher"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/spf13/cobra"
+)
+
+var listdiffCmd = &cobra.Command{
+	Use:   "listdiff <old> <new>",
+	Short: "Diff two versions of a filter list and tell which changed lines convert",
+	Long: `Compares two raw versions of a filter list, files, archived snapshots
+(gzip-compressed) or URLs, line by line regardless of order, and tells for
+each added and removed filter whether it converts or why it is skipped, to
+assess an upstream change before rebuilding. Lines are converted one by
+one with default settings; comments are left out.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runListdiff,
+}
+
+func init() {
+	listdiffCmd.Flags().Bool("summary", false, "print only the counts, not the lines")
+	addOutputFormatFlag(listdiffCmd)
+	rootCmd.AddCommand(listdiffCmd)
+}
+
+// listDiff are the filters one version of a list added and removed
+type listDiff struct {
+	Added   diffSide `json:"added"`
+	Removed diffSide `json:"removed"`
+}
+
+// diffSide are the added or the removed filters of a diff
+type diffSide struct {
+	Lines     []diffLine                `json:"lines,omitempty"` // left out with --summary
+	Converted int                       `json:"converted"`
+	Skipped   map[models.SkipReason]int `json:"skipped,omitempty"` // by skip reason
+}
+
+// diffLine is a changed filter and what conversion makes of it
+type diffLine struct {
+	Line      string            `json:"line"`
+	Converted bool              `json:"converted"`
+	Reason    models.SkipReason `json:"reason,omitempty"` // why it is skipped
+}
+
+func runListdiff(cmd *cobra.Command, args []string) error {
+	summary, _ := cmd.Flags().GetBool("summary")
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	oldData, err := readListVersion(args[0])
+	if err != nil {
+		return err
+	}
+	newData, err := readListVersion(args[1])
+	if err != nil {
+		return err
+	}
+	diff := diffLists(oldData, newData)
+
+	if format != outputTable {
+		if summary {
+			diff.Added.Lines, diff.Removed.Lines = nil, nil
+		}
+		return printStructured(os.Stdout, format, diff)
+	}
+
+	if !summary {
+		for _, side := range []struct {
+			mark  string
+			lines []diffLine
+		}{{"-", diff.Removed.Lines}, {"+", diff.Added.Lines}} {
+			for _, l := range side.lines {
+				if l.Converted {
+					fmt.Printf("%s %s\n", side.mark, l.Line)
+				} else {
+					fmt.Printf("%s %s  [skipped: %s]\n", side.mark, l.Line, l.Reason)
+				}
+			}
+		}
+		if len(diff.Added.Lines)+len(diff.Removed.Lines) > 0 {
+			fmt.Println()
+		}
+	}
+	fmt.Printf("Added:   %s\n", diff.Added.describe())
+	fmt.Printf("Removed: %s\n", diff.Removed.describe())
+	fmt.Printf("Converted filters: %+d\n", diff.Added.Converted-diff.Removed.Converted)
+	return nil
+}
+
+// describe sums up one side of a diff, e.g. "12 filters, 10 convert,
+// 2 skipped (scriptlet 2)"
+func (s diffSide) describe() string {
+	total := s.Converted
+	var reasons []string
+	for reason, n := range s.Skipped {
+		total += n
+		reasons = append(reasons, fmt.Sprintf("%s %d", reason, n))
+	}
+	text := fmt.Sprintf("%d filters, %d convert", total, s.Converted)
+	if len(reasons) > 0 {
+		sort.Strings(reasons)
+		text += fmt.Sprintf(", %d skipped (%s)", total-s.Converted, strings.Join(reasons, ", "))
+	}
+	return text
+}
+
+// readListVersion reads a list version from a file or URL, decompressing
+// archived snapshots
+func readListVersion(source string) ([]byte, error) {
+	var data []byte
+	var err error
+	if strings.Contains(source, "://") {
+		data, err = fetcher.New(cfg.HTTP).Fetch(context.Background(), source)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		return data, nil
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
+
+// diffLists returns the filters newData added to oldData, in the order of
+// newData, and those it removed, in the order of oldData
+func diffLists(oldData, newData []byte) listDiff {
+	oldLines, newLines := listLines(oldData), listLines(newData)
+	oldSet := make(map[string]bool, len(oldLines))
+	for _, l := range oldLines {
+		oldSet[l] = true
+	}
+	newSet := make(map[string]bool, len(newLines))
+	for _, l := range newLines {
+		newSet[l] = true
+	}
+
+	var diff listDiff
+	diff.Added = diffSideOf(newLines, oldSet)
+	diff.Removed = diffSideOf(oldLines, newSet)
+	return diff
+}
+
+// listLines returns the distinct trimmed lines of a list, in order
+func listLines(data []byte) []string {
+	seen := make(map[string]bool)
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// diffSideOf classifies the lines missing from other, leaving comments out
+func diffSideOf(lines []string, other map[string]bool) diffSide {
+	var side diffSide
+	for _, line := range lines {
+		if other[line] {
+			continue
+		}
+		converted, reason := classifyLine(line)
+		switch {
+		case converted:
+			side.Converted++
+		case reason != "":
+			if side.Skipped == nil {
+				side.Skipped = make(map[models.SkipReason]int)
+			}
+			side.Skipped[reason]++
+		default:
+			continue
+		}
+		side.Lines = append(side.Lines, diffLine{Line: line, Converted: converted, Reason: reason})
+	}
+	return side
+}
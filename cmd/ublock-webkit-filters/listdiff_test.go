@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/fixtures"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListdiff(t *testing.T) {
+	old := fixtures.List("ublock-filters")
+	updated := strings.Replace(string(old), "||popads.net^$popup\n", "", 1) +
+		"||newads.example^\nexample.org##+js(nowebrtc)\n! Version: 2\n"
+
+	// Archived snapshots are gzip-compressed
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte(updated))
+	require.NoError(t, gz.Close())
+	path := filepath.Join(dir, "new"+snapshotExt)
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	data, err := readListVersion(path)
+	require.NoError(t, err)
+
+	diff := diffLists(old, data)
+	assert.Equal(t, []diffLine{
+		{Line: "||newads.example^", Converted: true},
+		{Line: "example.org##+js(nowebrtc)", Reason: models.SkipScriptlet},
+	}, diff.Added.Lines)
+	assert.Equal(t, map[models.SkipReason]int{models.SkipScriptlet: 1}, diff.Added.Skipped)
+	assert.Equal(t, []diffLine{{Line: "||popads.net^$popup", Converted: true}}, diff.Removed.Lines)
+	assert.Equal(t, "2 filters, 1 convert, 1 skipped (scriptlet 1)", diff.Added.describe())
+	assert.Equal(t, "1 filters, 1 convert", diff.Removed.describe())
+}
@@ -1,18 +1,22 @@
 package main
 
 import (
-	"bytes"
-	"context"
+	"bufio"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/bnema/ublock-webkit-filters/internal/converter"
-	"github.com/bnema/ublock-webkit-filters/internal/fetcher"
 	"github.com/bnema/ublock-webkit-filters/internal/models"
-	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/bnema/ublock-webkit-filters/internal/psl"
+	"github.com/bnema/ublock-webkit-filters/internal/rulejson"
+	"github.com/bnema/ublock-webkit-filters/internal/smoketest"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -25,26 +29,25 @@ var (
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		if systemFlag && errors.Is(err, fs.ErrPermission) {
+			fmt.Fprintf(os.Stderr, "Run as the service user owning %s\n", filepath.Dir(systemPaths.Output))
+		}
 		os.Exit(1)
 	}
 }
 
 var rootCmd = &cobra.Command{
-	Use:   "ublock-webkit-filters",
-	Short: "Convert uBlock filter lists to WebKit content blocker format",
+	Use:     "ublock-webkit-filters",
+	Short:   "Convert uBlock filter lists to WebKit content blocker format",
+	Version: version,
 	Long: `A tool that converts uBlock Origin filter lists to Safari/WebKitGTK
 compatible content blocker JSON format.`,
-}
-
-var convertCmd = &cobra.Command{
-	Use:   "convert",
-	Short: "Convert filter lists to WebKit JSON format",
-	RunE:  runConvert,
+	PersistentPreRunE: checkSystemConfig,
 }
 
 var listCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List configured filter lists",
+	Short: "List configured filter lists with the state of their last download and build",
 	RunE:  runList,
 }
 
@@ -58,195 +61,121 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file (default: ./configs/filter_lists.toml)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "apply the [profiles.<name>] table of the config file")
+	rootCmd.PersistentFlags().BoolVar(&systemFlag, "system", false, "system-wide layout: config in /etc/ublock-webkit-filters, outputs and cache in /var/lib/ublock-webkit-filters")
+	rootCmd.PersistentFlags().BoolVar(&envOnlyFlag, "env-only", false, "read no config file, only defaults and UWF_* environment variables")
 
-	convertCmd.Flags().StringP("output", "o", "./output", "output directory")
-	convertCmd.Flags().Bool("dry-run", false, "parse and convert without writing files")
-	convertCmd.Flags().Bool("combined", true, "generate combined output file")
-	convertCmd.Flags().Bool("verbose", false, "verbose output")
+	listCmd.Flags().String("dir", defaultDirs.Output, "output directory holding the last build summary")
+	addOutputFormatFlag(listCmd)
 
-	rootCmd.AddCommand(convertCmd, listCmd, initCmd)
+	rootCmd.AddCommand(listCmd, initCmd)
 }
 
 func initConfig() {
+	if systemFlag {
+		useSystemLayout()
+	}
+
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
 	} else {
 		viper.SetConfigName("filter_lists")
 		viper.SetConfigType("toml")
-		viper.AddConfigPath("./configs")
-		viper.AddConfigPath(".")
+		for _, path := range configSearchPaths() {
+			viper.AddConfigPath(filepath.Dir(path))
+		}
 	}
 
 	// Set defaults
 	viper.SetDefault("http.timeout", "30s")
 	viper.SetDefault("http.retries", 3)
+	viper.SetDefault("http.host_interval", "1s")
+	viper.SetDefault("http.min_refetch", "1h")
 	viper.SetDefault("output.max_rules_per_file", 50000)
+	viper.SetDefault("output.part_name", converter.DefaultPartName)
+	viper.SetDefault("output.stale", models.StaleKeep)
 	viper.SetDefault("output.generate_combined", true)
 	viper.SetDefault("output.generate_manifest", true)
+	viper.SetDefault("output.generic_cosmetic", models.GenericCosmeticKeep)
+	viper.SetDefault("output.unknown_options", models.UnknownOptionSkip)
+	viper.SetDefault("output.target", converter.DefaultTarget)
+	viper.SetDefault("output.version_scheme", models.VersionSchemeDate)
+	viper.SetDefault("output.css_dir", "css")
+	viper.SetDefault("output.shard_count", 16)
+	viper.SetDefault("output.fsync", models.FsyncNone)
+	viper.SetDefault("smoke_test.content_filter_flag", smoketest.DefaultContentFilterFlag)
+	viper.SetDefault("strict.max_skip_ratio", 0.5)
+	viper.SetDefault("overlap.threshold", 0.9)
+	viper.SetDefault("psl.file", defaultDirs.PSL)
+	viper.SetDefault("psl.url", psl.DefaultURL)
+	viper.SetDefault("cache.dir", defaultDirs.Cache)
+	viper.SetDefault("archive.dir", "inputs")
+	viper.SetDefault("dns.sinkhole", "0.0.0.0")
+	viper.SetDefault("dns.dir", "dns")
+	viper.SetDefault("signing.tool", "minisign")
+	viper.SetDefault("daemon.interval", "6h")
+	viper.SetDefault("daemon.listen", ":9090")
+	viper.SetDefault("daemon.health.shrink_ratio", 0.5)
+	viper.SetDefault("daemon.health.max_failures", 3)
+	viper.SetDefault("daemon.health.history", 30)
+	viper.SetDefault("hooks.timeout", "5m")
+	viper.SetDefault("compile.timeout", "5m")
+
+	// Containers configured through the environment mount no files
+	if !envOnly() {
+		if err := viper.ReadInConfig(); err != nil {
+			if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+				fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+			}
+		}
 
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+		if err := mergeIncludes(); err != nil {
 			fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
 		}
 	}
 
-	if err := viper.Unmarshal(&cfg); err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing config: %v\n", err)
+	if err := mergeEnvConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
 	}
-}
 
-func runConvert(cmd *cobra.Command, args []string) error {
-	outputDir, _ := cmd.Flags().GetString("output")
-	dryRun, _ := cmd.Flags().GetBool("dry-run")
-	generateCombined, _ := cmd.Flags().GetBool("combined")
-	verbose, _ := cmd.Flags().GetBool("verbose")
-
-	enabledLists := cfg.EnabledLists()
-	if len(enabledLists) == 0 {
-		return fmt.Errorf("no enabled filter lists found in config")
+	if err := applyProfile(profile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
 	}
 
-	fmt.Printf("Converting %d filter lists...\n", len(enabledLists))
-	if dryRun {
-		fmt.Println("[DRY RUN] No files will be written")
+	if err := bindEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
 	}
 
-	ctx := context.Background()
-	f := fetcher.New(cfg.HTTP)
-	splitter := converter.NewSplitter(cfg.Output.MaxRulesPerFile)
-
-	var allRules []models.WebKitRule
-	results := make(map[string]ListResult)
-
-	// Aggregate skip reasons across all lists
-	totalParseSkips := make(map[string]int)
-	totalConvertSkips := make(map[string]int)
-
-	for _, list := range enabledLists {
-		fmt.Printf("\n  Processing %s...\n", list.Name)
-
-		// Fetch
-		data, err := f.Fetch(ctx, list.URL)
-		if err != nil {
-			fmt.Printf("    ERROR: %v\n", err)
-			continue
-		}
-		fmt.Printf("    Downloaded: %d bytes\n", len(data))
-
-		// Parse (fresh parser per list for accurate stats)
-		p := parser.New()
-		filters, err := p.Parse(bytes.NewReader(data))
-		if err != nil {
-			fmt.Printf("    ERROR parsing: %v\n", err)
-			continue
-		}
-		pStats := p.Stats()
-
-		// Convert (fresh converter per list for accurate stats)
-		c := converter.New()
-		rules := c.Convert(filters)
-		cStats := c.Stats()
-
-		totalSkipped := pStats.Unsupported + cStats.Skipped
-		fmt.Printf("    Converted: %d rules (skipped: %d)\n", len(rules), totalSkipped)
-
-		if verbose {
-			fmt.Printf("    Parsed: %d total, %d network, %d cosmetic, %d exceptions\n",
-				pStats.Total, pStats.Network, pStats.Cosmetic, pStats.Exception)
-			if len(pStats.SkipReasons) > 0 {
-				fmt.Printf("    Parse skips:\n")
-				for reason, count := range pStats.SkipReasons {
-					fmt.Printf("      - %s: %d\n", reason, count)
-					totalParseSkips[reason] += count
-				}
-			}
-			if len(cStats.SkipReasons) > 0 {
-				fmt.Printf("    Convert skips:\n")
-				for reason, count := range cStats.SkipReasons {
-					fmt.Printf("      - %s: %d\n", reason, count)
-					totalConvertSkips[reason] += count
-				}
-			}
-		} else {
-			// Still aggregate for summary
-			for reason, count := range pStats.SkipReasons {
-				totalParseSkips[reason] += count
-			}
-			for reason, count := range cStats.SkipReasons {
-				totalConvertSkips[reason] += count
-			}
-		}
-
-		results[list.Name] = ListResult{
-			Name:         list.Name,
-			URL:          list.URL,
-			RulesCount:   len(rules),
-			SkippedCount: totalSkipped,
-		}
-
-		if !dryRun {
-			// Split and write
-			parts := splitter.Split(rules, list.Name)
-			for name, partRules := range parts {
-				if err := writeJSON(outputDir, name+".json", partRules); err != nil {
-					fmt.Printf("    ERROR writing %s: %v\n", name, err)
-				}
-			}
-		}
-
-		allRules = append(allRules, rules...)
+	if err := viper.Unmarshal(&cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing config: %v\n", err)
 	}
+}
 
-	// Show skip summary
-	if len(totalParseSkips) > 0 || len(totalConvertSkips) > 0 {
-		fmt.Printf("\nSkipped filters summary:\n")
-		for reason, count := range totalParseSkips {
-			fmt.Printf("  %s: %d\n", reason, count)
-		}
-		for reason, count := range totalConvertSkips {
-			fmt.Printf("  %s: %d\n", reason, count)
-		}
+func runList(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
 	}
-
-	// Deduplicate combined rules
-	if generateCombined && len(allRules) > 0 {
-		fmt.Printf("\nGenerating combined output...\n")
-		allRules = converter.Deduplicate(allRules)
-		fmt.Printf("  Total rules: %d (after deduplication)\n", len(allRules))
-
-		if !dryRun {
-			parts := splitter.Split(allRules, "combined")
-			var partNames []string
-			for name, partRules := range parts {
-				if err := writeJSON(outputDir, name+".json", partRules); err != nil {
-					fmt.Printf("  ERROR writing %s: %v\n", name, err)
-				}
-				partNames = append(partNames, name+".json")
-			}
-
-			// Write manifest
-			if cfg.Output.GenerateManifest {
-				manifest := Manifest{
-					Version:     time.Now().Format("2006.01.02"),
-					GeneratedAt: time.Now().UTC().Format(time.RFC3339),
-					Lists:       results,
-					Combined: CombinedInfo{
-						TotalRules: len(allRules),
-						Files:      partNames,
-					},
-				}
-				if err := writeJSON(outputDir, "manifest.json", manifest); err != nil {
-					fmt.Printf("  ERROR writing manifest: %v\n", err)
-				}
-			}
+	problems := cfg.NormalizeURLs()
+
+	outputDir, _ := cmd.Flags().GetString("dir")
+	summary := readSummaryFile(outputDir)
+	now := time.Now()
+
+	if format != outputTable {
+		report := struct {
+			Lists    []listInfo `json:"lists"`
+			Problems []string   `json:"problems,omitempty"` // invalid list URLs
+		}{Lists: []listInfo{}}
+		for _, list := range cfg.Lists {
+			report.Lists = append(report.Lists, listState(list, summary, now))
+		}
+		for _, p := range problems {
+			report.Problems = append(report.Problems, p.Error())
 		}
+		return printStructured(os.Stdout, format, report)
 	}
 
-	fmt.Println("\nDone!")
-	return nil
-}
-
-func runList(cmd *cobra.Command, args []string) error {
 	fmt.Println("Configured filter lists:")
 	for _, list := range cfg.Lists {
 		status := "enabled"
@@ -254,13 +183,24 @@ func runList(cmd *cobra.Command, args []string) error {
 			status = "disabled"
 		}
 		fmt.Printf("  [%s] %s\n", status, list.Name)
-		fmt.Printf("         %s\n\n", list.URL)
+		fmt.Printf("         %s\n", list.URL)
+		for _, line := range listStatus(list, summary, now) {
+			fmt.Printf("         %s\n", line)
+		}
+		fmt.Println()
+	}
+
+	if len(problems) > 0 {
+		fmt.Println("URL problems (see \"config validate\"):")
+		for _, p := range problems {
+			fmt.Printf("  - %v\n", p)
+		}
 	}
 	return nil
 }
 
 func runInit(cmd *cobra.Command, args []string) error {
-	configPath := "./configs/filter_lists.toml"
+	configPath := defaultDirs.Config
 	if cfgFile != "" {
 		configPath = cfgFile
 	}
@@ -276,15 +216,348 @@ func runInit(cmd *cobra.Command, args []string) error {
 [http]
 timeout = "30s"
 retries = 3
+# Politeness: minimum time between two requests to the same host (429/503
+# Retry-After answers are honoured too), and how long a cached list is used
+# without asking its server again; "update --force" ignores min_refetch
+host_interval = "1s"
+min_refetch = "1h"
+# Some servers vary content by, or block, unknown agents; [[lists]] entries
+# can set their own user_agent and headers (merged over these)
+user_agent = ""  # empty sends ublock-webkit-filters/1.0
+headers = {}     # e.g. { "Accept-Language" = "en" }
+# Connections are reused between lists of the same host, over HTTP/2 when
+# the server offers it; connecting and the TLS handshake time out on their own
+dial_timeout = "10s"
+tls_timeout = "10s"
+idle_timeout = "90s"
+max_conns_per_host = 0  # 0 = no limit
+disable_http2 = false
+# PEM certificates trusted on top of the system roots, for lists served over
+# a private PKI; [[lists]] entries can set their own ca_file and pins
+ca_file = ""
+# Gateway ipfs://CID/path lists are fetched through
+ipfs_gateway = "https://ipfs.io"
 
 # Output settings
 [output]
 max_rules_per_file = 50000
+# File names of split parts (.json is appended): {name} is the output, e.g.
+# combined, {index} the part from 1 and {total} the number of parts; pad
+# numbers to sort by name with e.g. {index:02d}, as in
+# "{name}-{index:02d}-of-{total}". manifest.json gives each part's index
+# and total too, so consumers can tell when one is missing
+part_name = "{name}-part{index}"
 generate_combined = true
 generate_manifest = true
+# Content blocker files an earlier build wrote and this one does not, such
+# as those of a list since disabled or renamed: remove them, move them to
+# .stale/ in the output directory (quarantine, left out of checksums and
+# publishing) or keep them. Needs the manifest of the earlier build; files
+# of lists whose download failed are kept, and failed builds clean nothing
+stale = "keep"
+# Also keep a copy of every build in .versions/<build id>/ (left out of
+# checksums and publishing), pruned by [retention]
+versioned = false
+# Content blocker files written at once (0 = one per CPU), and whether each
+# output is flushed to disk before the build goes on: none, files, or full
+# (files and the directory holding them), for hooks publishing right away
+# from machines that may lose power
+write_workers = 0
+fsync = "none"
+# Generic cosmetic filters (##.ad without domains): keep, separate, drop
+generic_cosmetic = "keep"
+# Network filters with options this tool does not know (typos, newer
+# syntax): skip them like uBlock Origin does, warn and convert them without
+# the option, or ignore (convert silently). Either way they are counted per
+# option under unknown_options in manifest.json
+unknown_options = "skip"
+# Content blocker features to target: webkit (current WebKit/WebKitGTK),
+# safari15, safari14 (no load-context)
+target = "webkit"
+# Skip cosmetic filters whose selector is too expensive for WebKit's style
+# engine (roughly one point per compound selector, more for attribute
+# substring matches, :not(), :nth-*() and *), 0 for no limit
+max_selector_complexity = 0
+# Write element hiding as user stylesheets (css/global.css, css/<domain>.css)
+# instead of css-display-none rules; rules stylesheets cannot express stay
+cosmetics_as_css = false
+css_dir = "css"
+# Move $popup rules into popups.json, a separate content blocker host apps
+# can enable independently of request blocking
+popups = false
+# Move block rules limited to scripts, images or XHR/fetch ("scripts",
+# "images", "xhr") into scripts.json, images.json and xhr.json, so host apps
+# can switch e.g. image blocking off without a rebuild
+type_partitions = []
+# Lossy: turn $removeparam filters for known tracking parameters (utm_*,
+# fbclid, gclid, ...) into blocks of third-party requests carrying them,
+# instead of skipping them. Such requests fail instead of being cleaned
+removeparam_block = false
+# Lossy: convert blocking filters whose only unsupported option is
+# $redirect= (e.g. $script,redirect=noopjs) as plain blocks instead of
+# skipping them. Pages get a failed request instead of the neutered resource
+salvage_options = false
+# $inline-script/$inline-font need a Content-Security-Policy header, which
+# content blockers cannot set: write the directives per domain to csp.json
+# for host apps to apply through their own response policies
+csp_companion = false
+# Write top-domains.json, the N registrable domains converted rules target
+# most with counts per list, for auditing what the blocker focuses on (0 = off)
+top_domains = 0
+# Write coverage.json: per filter option ($third-party, $redirect, ...) how
+# many filters were converted, approximated or skipped
+coverage_report = false
+# Write exceptions.json: every converted @@ exception with the filter it came
+# from and a stable id, for host apps offering them as user overrides
+exceptions_export = false
+# Write interactions.json: which exceptions of a list (e.g. unbreak or
+# quick fixes) lift or narrow rules of the other lists in the combined build
+interactions_report = false
+# Write source-map.json: which list each rule of the combined outputs came
+# from, as rule ranges per file, so host apps can show "blocked by EasyPrivacy"
+source_map = false
+# Content blockers the host app can register for the combined output; the
+# build warns (fails with strict) when combined parts exceed it (0 = no limit)
+max_content_blockers = 0
+# Experimental: shard combined outputs by the site rules are anchored to,
+# into combined-<letter>.json (first-letter) or shard_count combined-NN.json
+# files (hash), plus combined-any.json for the rest. Smaller content
+# blockers compile faster on slow devices; exceptions are repeated in every
+# shard whose blocks they may lift. Empty keeps one ruleset split by size
+shard = ""
+shard_count = 16
+# Rewrite if-domain lists longer than this into if-top-url patterns, one per
+# domain, split into rules of top_url_chunk_size entries (0 = keep if-domain,
+# 0 chunk size = single rule); tune against WebKit compile times
+top_url_threshold = 0
+top_url_chunk_size = 0
+# Keep generic cosmetic (##) rules off pages their broad selectors break,
+# such as search engines and web apps, instead of dropping them: WebKit
+# regexes of the pages, attached as unless-top-url to the rules hiding
+# generic_hot_selectors (empty = every generic rule without a ~domain)
+generic_unless_top_url = []  # e.g. ["^https?://([^/]*\\.)?google\\.[a-z]+/search"]
+generic_hot_selectors = []   # e.g. [".ad", "#ads", ".sponsored"]
+# Scope what cosmetic rules may hide: selector_prefix nests every hiding
+# selector under it (e.g. "html:not(.uwf-off)" lets a page script switch
+# hiding off), selector_exclude drops selectors matching any of these Go
+# regexps (e.g. "^video$") and cosmetic_exclude_domains keeps every hiding
+# rule off these domains and their subdomains (e.g. your bank)
+selector_prefix = ""
+selector_exclude = []
+cosmetic_exclude_domains = []
+# Manifest version: date (2006.01.02), semver (the version below) or
+# content (hash of the combined files, changes only when rules do)
+version_scheme = "date"
+version = ""
+# Cap on combined rules (0 = unlimited, split into parts instead). Lists are
+# served by priority, see max_rules/priority on [[lists]]
+combined_budget = 0
+
+# Strict mode fails the build instead of emitting garbage rules
+[strict]
+enabled = false
+max_skip_ratio = 0.5
+
+# Warn about lists whose converted rules mostly duplicate an earlier list
+# (identical downloads are always reported); dedup skips such lists
+[overlap]
+threshold = 0.9
+dedup = false
+# Repeated filter lines are always dropped while parsing; dedup_filters also
+# drops blocking filters an earlier list has (per-list files then omit them)
+dedup_filters = false
+
+# Public Suffix List, refreshed with "update-psl" (embedded snapshot used if missing)
+[psl]
+# file = "./configs/public_suffix_list.dat"  # default: see "paths"
+
+# Per-list conversion results, reused by "update" for lists that did not change
+[cache]
+# dir = "./cache"  # default: see "paths"
+
+# Bound the rules held for the combined outputs, e.g. on small VPS or CI
+# machines: beyond limit ("512MB", "2GB"), per-list rule sets are written to
+# temporary files in spill_dir (default: system temp) and merged with an
+# external sort to deduplicate them. The merged unique rules are still held
+# in memory while the combined outputs are written. Outputs are identical,
+# builds slower.
+[memory]
+limit = ""
+spill_dir = ""
+
+# Keep the raw downloaded lists (gzip, named by content hash) in the output
+# directory, so a manifest can be traced back to its exact inputs
+[archive]
+enabled = false
+dir = "inputs"
+
+# Versioned builds and archived lists kept: the keep_builds most recent
+# builds and everything younger than keep_days (0 = no such limit, both 0
+# keeps everything). Enforced after versioned builds and daemon builds;
+# "gc --dry-run" lists what would be deleted
+[retention]
+keep_builds = 0
+keep_days = 0
+
+# Safari apps ship one content blocker extension per JSON file. With
+# extensions = true, parts are capped at max_rules (0 = 50000, what iOS
+# devices reliably compile) and safari-extensions.json maps each part to
+# the extension bundle_ids in order; parts left over are reported
+[safari]
+extensions = false
+max_rules = 0
+bundle_ids = []  # e.g. ["com.example.app.blocker1", "com.example.app.blocker2"]
+
+# DNS blocklists derived from pure-hostname rules (||example.com^)
+[dns]
+formats = []  # hosts, dnsmasq, unbound, rpz, pihole
+sinkhole = "0.0.0.0"
+dir = "dns"
+pihole_metadata = false  # write gravity-style pihole-adlist.json
+pihole_address = ""      # URL the Pi-hole adlist will be published at
+
+# Upload outputs after a successful build (or run "publish")
+# Credentials may come from AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY,
+# GOOGLE_OAUTH_ACCESS_TOKEN or WEBDAV_PASSWORD instead of this file
+[publish]
+enabled = false
+backend = "s3"  # s3, gcs, webdav
+url = ""        # S3 endpoint (https://s3.eu-west-1.amazonaws.com) or WebDAV base URL
+bucket = ""
+prefix = "filters"
+region = "us-east-1"
+
+# Sign checksums.txt and manifest.json after each build (check with "verify")
+[signing]
+enabled = false
+tool = "minisign"  # minisign, cosign
+key = ""           # secret key (minisign.key / cosign.key)
+public_key = ""    # public key used by "verify"
+password_env = ""  # environment variable holding the key password
+
+# Periodic rebuilds with the "daemon" command
+[daemon]
+interval = "6h"
+listen = ":9090"  # Prometheus /metrics endpoint, empty to disable
+compile = false   # run "compile" on the outputs after each successful build
+
+# Anomalies of lists between daemon builds, reported in the log, metrics and
+# webhooks: a list that lost shrink_ratio of its rules or bytes, stopped
+# looking like filter syntax (e.g. an HTML error page) or failed
+# max_failures builds in a row. History is kept in the cache directory.
+[daemon.health]
+shrink_ratio = 0.5
+max_failures = 3
+history = 30      # builds remembered per list
+
+# Commands run after each convert, update or daemon build, in order, e.g.
+# deployment steps. Placeholders: {output_dir}, {manifest} (path of
+# manifest.json), {build_id}, {status}, {error}. Commands are split into
+# arguments like a shell would, quotes included, but run without one (wrap
+# them in sh -c '...' for pipes); a failing on_success command makes the
+# command exit with an error, the outputs stay
+[hooks]
+on_success = []  # e.g. ["./deploy.sh {output_dir} {manifest}"]
+on_failure = []
+timeout = "5m"   # per command
+
+# "compile" checks each content blocker file against WebKit's constraints,
+# then runs command on it, e.g. a helper compiling it with
+# WebKitUserContentFilterStore. Placeholders: {file} (path of the file), {id}
+# (its identifier in manifest.json). Files that compiled before under the
+# same identifier are skipped (record in the cache directory).
+[compile]
+command = ""     # e.g. "./compile-filter {file} {id}"
+timeout = "5m"   # per file
+
+# Notifications after each daemon build
+# [[webhooks]]
+# type = "generic"  # generic (POST build JSON + manifest), ntfy, matrix
+# url = "https://example.com/hooks/filters"
+# on = ["success", "failure"]
+# token = ""        # bearer token, or Matrix access token
+# room = ""         # Matrix room ID (matrix only)
+
+# End-to-end check with "smoke-test" (requires WebKitGTK's MiniBrowser)
+[smoke_test]
+browser = "MiniBrowser"
+args = []  # e.g. ["--headless"] if supported, or run the command under xvfb-run
+content_filter_flag = "--content-filter"  # browser option taking the rules file
+rules = ["./output/combined*.json"]
+timeout = "20s"
+
+# [[smoke_test.pages]]
+# url = "https://example.com/"
+# blocked = ["doubleclick.net", "googlesyndication.com"]
+# allowed = ["example.com"]
+
+# Sites and URLs exempted from all blocking, appended as trailing exceptions
+# to every combined file
+[allowlist]
+domains = []  # e.g. ["example.com"]
+urls = []     # filter syntax, e.g. ["||cdn.example.com/player.js"]
+
+# Domains every list is overridden on, subdomains included. Rules targeting
+# never_block_domains are dropped while converting, and trailing exceptions
+# exempt their pages and requests; always_block_domains are blocked by
+# trailing rules no list exception can lift
+[policy]
+never_block_domains = []   # e.g. ["intranet.example.com"]
+always_block_domains = []  # e.g. ["telemetry.example.net"]
+
+# Rewrites of converted rules, applied in order to the lists named (every
+# list if empty), so a list can be adjusted without forking it:
+# drop rules targeting a domain or its subdomains, force the WebKit
+# resource types of request rules, or rewrite a domain to another
+# [[transforms]]
+# action = "drop"
+# domain = "example.com"
+# lists = []
+#
+# [[transforms]]
+# action = "resource-type"
+# resource_types = ["script"]  # WebKit names: script, image, style-sheet, raw, ...
+# lists = ["tracking"]
+#
+# [[transforms]]
+# action = "rewrite"
+# domain = "old.example.com"
+# to = "new.example.com"
+
+# Extra config fragments merged into this file (relative paths are resolved
+# against this file's directory); [[lists]] entries are appended
+# include = ["lists.d/*.toml"]
+
+# Named variants of this file selected with --profile <name>: settings
+# override the top-level ones, [[profiles.<name>.lists]] entries are
+# appended and enabled_lists names the only lists to build
+# [profiles.mobile]
+# enabled_lists = ["easylist", "ublock-filters"]
+# [profiles.mobile.output]
+# max_rules_per_file = 30000
 
 # Filter lists to convert
 # Set enabled = false to skip a list
+# Lists that fail to download or convert are left out with a warning, unless
+# required = true (or --require <name>): then the build fails and the last
+# outputs stay in place
+# update_interval records the upstream refresh cadence (set by "discover")
+# max_rules caps the list's share of combined files, priority (higher first)
+# decides who is served first under output.combined_budget
+# tags = ["ads"] adds the list to a combined-<tag>.json category output
+# trusted = true allows lossy regex rewrites (numeric quantifiers, splitting
+# a|b into one rule per alternative); other lists are converted strictly
+# default_types = ["script", "raw"] limits block filters without type options
+# to those WebKit resource types (raw covers xhr, fetch and websockets);
+# without it they match every type, e.g. for hosts lists
+# format is detected automatically; "webkit-json" merges existing content
+# blocker JSON (hand-written Safari rules, AdGuard output), e.g. url = "file:///path/rules.json"
+# sha256 = "<hex>" only accepts that exact content, other versions fail the
+# list; required for url = "ipfs://CID/list.txt", as gateways are not verified
+# encoding is detected (UTF-8 with or without BOM, UTF-16 with BOM, other
+# lines read as windows-1252); set a label such as "windows-1251" otherwise
+# title, description and default_off = true describe the list to host apps
+# in the manifest toggles; [categories.<tag>] does the same for a tag
 
 [[lists]]
 name = "easylist"
@@ -350,31 +623,184 @@ func writeJSON(dir, filename string, data any) error {
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	enc := json.NewEncoder(f)
+	w := bufio.NewWriterSize(f, 256<<10)
+	enc := json.NewEncoder(w)
 	enc.SetIndent("", "  ")
-	return enc.Encode(data)
+	if err := enc.Encode(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return closeOutput(f)
+}
+
+// writeRules writes a content blocker file like writeJSON would, one rule
+// at a time, and returns the sha256 and size of its content
+func writeRules(dir, filename string, rules []models.WebKitRule) ([sha256.Size]byte, int64, error) {
+	var sum [sha256.Size]byte
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return sum, 0, err
+	}
+	f, err := os.Create(filepath.Join(dir, filename))
+	if err != nil {
+		return sum, 0, err
+	}
+
+	h := sha256.New()
+	size, err := rulejson.WriteAll(io.MultiWriter(f, h), rules)
+	if err != nil {
+		f.Close()
+		return sum, 0, err
+	}
+	h.Sum(sum[:0])
+	return sum, size, closeOutput(f)
+}
+
+// closeOutput closes a written output, flushing it to disk first as
+// output.fsync asks
+func closeOutput(f *os.File) error {
+	if cfg.Output.Fsync == models.FsyncFiles || cfg.Output.Fsync == models.FsyncFull {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if cfg.Output.Fsync != models.FsyncFull {
+		return nil
+	}
+	// The directory entry of a new file is only durable once its
+	// directory is synced too
+	d, err := os.Open(filepath.Dir(f.Name()))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
 
 // ListResult contains conversion results for a single list
 type ListResult struct {
-	Name         string `json:"name"`
-	URL          string `json:"source_url"`
-	RulesCount   int    `json:"rules_count"`
-	SkippedCount int    `json:"skipped_count"`
+	Name          string                    `json:"name"`
+	URL           string                    `json:"source_url"`
+	Tags          []string                  `json:"tags,omitempty"`
+	RulesCount    int                       `json:"rules_count"`
+	GenericCount  int                       `json:"generic_rules_count,omitempty"`
+	PopupCount    int                       `json:"popup_rules_count,omitempty"`
+	TypeCounts    map[string]int            `json:"type_rules_count,omitempty"` // rules in each type partition
+	SkippedCount  int                       `json:"skipped_count"`
+	SkipReasons   map[models.SkipReason]int `json:"skip_reasons,omitempty"`      // stable reason codes
+	BudgetDropped int                       `json:"budget_dropped,omitempty"`    // left out of combined files by max_rules/budget
+	DuplicateOf   string                    `json:"duplicate_of,omitempty"`      // skipped as redundant with this list
+	Duplicates    int                       `json:"duplicate_filters,omitempty"` // repeated filters dropped while parsing
+	Unknown       map[string]int            `json:"unknown_options,omitempty"`   // unrecognized options by name
+	Format        string                    `json:"format,omitempty"`            // list syntax, unknown for e.g. an HTML page
+	Fetch         *FetchInfo                `json:"fetch,omitempty"`             // upstream version the rules come from
+	Files         []string                  `json:"files,omitempty"`             // content blocker files written for the list
+}
+
+// FetchInfo identifies the upstream version of a list a build used. Lists
+// served from the cache report the fetch that produced the cached rules.
+type FetchInfo struct {
+	Status       int    `json:"status,omitempty"` // HTTP status, 304 when revalidated, 0 for local files
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	ContentHash  string `json:"content_hash"` // sha256 of the list as downloaded
+	Bytes        int64  `json:"bytes"`
+	DurationMS   int64  `json:"duration_ms"` // 0 when no request was made
+	FetchedAt    string `json:"fetched_at"`
+	Snapshot     string `json:"snapshot,omitempty"` // archived raw list, relative to the output directory
 }
 
 // Manifest contains metadata about the conversion
 type Manifest struct {
-	Version     string                `json:"version"`
-	GeneratedAt string                `json:"generated_at"`
-	Lists       map[string]ListResult `json:"lists"`
-	Combined    CombinedInfo          `json:"combined"`
+	Version      string                  `json:"version"`
+	BuildID      string                  `json:"build_id"`
+	GeneratedAt  string                  `json:"generated_at"`
+	ToolVersion  string                  `json:"tool_version"`
+	ConfigHash   string                  `json:"config_hash"` // effective configuration the build used
+	Lists        map[string]ListResult   `json:"lists"`
+	Combined     CombinedInfo            `json:"combined"`
+	CSS          *CSSInfo                `json:"css,omitempty"`               // element hiding stylesheets, with cosmetics-as-css
+	CSP          string                  `json:"csp,omitempty"`               // policy suggestions file, with output.csp_companion
+	TopDomains   string                  `json:"top_domains,omitempty"`       // analytics file, with output.top_domains
+	Coverage     string                  `json:"coverage,omitempty"`          // option coverage file, with output.coverage_report
+	Exceptions   string                  `json:"exceptions,omitempty"`        // exception export, with output.exceptions_export
+	Interactions string                  `json:"interactions,omitempty"`      // cross-list exceptions, with output.interactions_report
+	SourceMap    string                  `json:"source_map,omitempty"`        // list of each combined rule, with output.source_map
+	Safari       string                  `json:"safari_extensions,omitempty"` // extension mapping, with safari.extensions
+	Popups       *CombinedInfo           `json:"popups,omitempty"`            // $popup rules, with output.popups
+	Types        map[string]CombinedInfo `json:"types,omitempty"`             // block rules per output.type_partitions
+	Categories   map[string]CombinedInfo `json:"categories,omitempty"`        // combined outputs per list tag
+	Toggles      []Toggle                `json:"toggles,omitempty"`           // outputs host apps can switch on and off
+	Identifiers  map[string]string       `json:"identifiers,omitempty"`       // content blocker file -> PartInfo.ID
+}
+
+// TopDomainsReport lists the registrable domains converted rules target most
+type TopDomainsReport struct {
+	GeneratedAt  string                  `json:"generated_at"`
+	TotalDomains int                     `json:"total_domains"`
+	Domains      []converter.DomainCount `json:"domains"`
+}
+
+// ExceptionsReport lists the converted exceptions of each list with the
+// filters they came from, for host apps offering them as user overrides
+type ExceptionsReport struct {
+	GeneratedAt string                                 `json:"generated_at"`
+	Total       int                                    `json:"total"` // exception filters
+	Lists       map[string][]converter.ExceptionSource `json:"lists"`
+}
+
+// InteractionsReport lists the exceptions of each list that lift rules of
+// other lists in the combined build
+type InteractionsReport struct {
+	GeneratedAt  string                  `json:"generated_at"`
+	Interactions []converter.Interaction `json:"interactions"`
+}
+
+// CoverageReport tells how filters using each option were handled, the
+// options with the most skipped filters first
+type CoverageReport struct {
+	GeneratedAt string                     `json:"generated_at"`
+	Options     []models.OptionCoverage    `json:"options"`
+	Lists       map[string]models.Coverage `json:"lists"`
 }
 
 // CombinedInfo contains combined file info
 type CombinedInfo struct {
-	TotalRules int      `json:"total_rules"`
-	Files      []string `json:"files"`
+	TotalRules     int                    `json:"total_rules"`
+	Files          []string               `json:"files"`
+	GenericRules   int                    `json:"generic_rules,omitempty"`
+	GenericFiles   []string               `json:"generic_files,omitempty"`
+	AllowlistRules int                    `json:"allowlist_rules,omitempty"`
+	Parts          []PartInfo             `json:"parts,omitempty"`
+	Actions        map[string]int         `json:"actions,omitempty"`      // rules per action type
+	Sources        map[string]float64     `json:"sources,omitempty"`      // % of rules per list, before deduplication
+	CompileCost    *converter.CompileCost `json:"compile_cost,omitempty"` // estimated WebKit compile cost, main combined output only
+}
+
+// CSSInfo lists the element hiding stylesheets: Global applies to every
+// site, <domain>.css to the domain and its subdomains
+type CSSInfo struct {
+	Dir             string   `json:"dir"`
+	Global          string   `json:"global"`
+	GlobalSelectors int      `json:"global_selectors"`
+	Domains         []string `json:"domains,omitempty"`
+}
+
+// PartInfo describes a single written content blocker file, so consumers
+// can pick parts to load on memory-constrained devices
+type PartInfo struct {
+	File  string `json:"file"`
+	ID    string `json:"id,omitempty"` // WebKitUserContentFilterStore identifier, changes with the content
+	Rules int    `json:"rules"`
+	Bytes int64  `json:"bytes"`
+	Index int    `json:"index,omitempty"` // position among the parts of a split ruleset, from 1
+	Total int    `json:"total"`           // parts of the ruleset, 1 when it was not split
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// typePartitions maps each output.type_partitions name to the resource
+// types its block rules are limited to
+var typePartitions = map[string][]string{
+	models.PartitionScripts: {models.ResourceScript},
+	models.PartitionImages:  {models.ResourceImage},
+	models.PartitionXHR:     {models.ResourceRaw},
+}
+
+// splitTypePartition moves the block rules that only apply to the given
+// resource types out of rules. Exceptions that may lift them are copied
+// along, since an exception only applies within its own content blocker.
+// Without such block rules, rules are returned unchanged.
+func splitTypePartition(rules []models.WebKitRule, types []string) (rest, part []models.WebKitRule) {
+	blocks := 0
+	for _, r := range rules {
+		rt := r.Trigger.ResourceType
+		switch {
+		case r.Action.Type == models.ActionIgnorePreviousRule:
+			rest = append(rest, r)
+			if len(rt) == 0 || slices.ContainsFunc(rt, func(t string) bool { return slices.Contains(types, t) }) {
+				part = append(part, r)
+			}
+		case r.Action.Type == models.ActionBlock && len(rt) > 0 && !slices.ContainsFunc(rt, func(t string) bool { return !slices.Contains(types, t) }):
+			part = append(part, r)
+			blocks++
+		default:
+			rest = append(rest, r)
+		}
+	}
+	if blocks == 0 {
+		return rules, nil
+	}
+	return rest, part
+}
+
+// typeCounts returns the number of rules in each type partition of a list
+func typeCounts(types map[string][]models.WebKitRule) map[string]int {
+	if len(types) == 0 {
+		return nil
+	}
+	counts := make(map[string]int, len(types))
+	for name, rules := range types {
+		counts[name] = len(rules)
+	}
+	return counts
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// appName names the per-user directories of the tool
+const appName = "ublock-webkit-filters"
+
+// appPaths are the default locations of the config file, cache, outputs
+// and Public Suffix List
+type appPaths struct {
+	Config, Cache, Output, PSL string
+}
+
+// projectPaths is the layout of a checkout or project directory, used
+// whenever the working directory has a config file of its own
+var projectPaths = appPaths{
+	Config: "./configs/filter_lists.toml",
+	Cache:  "./cache",
+	Output: "./output",
+	PSL:    "./configs/public_suffix_list.dat",
+}
+
+// defaultDirs are the locations used when neither flags nor the config
+// set them, resolved once for flag defaults
+var defaultDirs = defaultPaths()
+
+// defaultPaths returns projectPaths when the working directory holds a
+// config file, the per-user locations of the platform otherwise, and
+// projectPaths again if those can't be resolved. UWF_OUTPUT_DIR sets the
+// output directory.
+func defaultPaths() appPaths {
+	paths := projectPaths
+	if !hasProjectConfig() {
+		home, _ := os.UserHomeDir()
+		if user, err := userPaths(runtime.GOOS, os.Getenv, home); err == nil {
+			paths = user
+		}
+	}
+	if dir := os.Getenv(envOutputDir); dir != "" {
+		paths.Output = dir
+	}
+	return paths
+}
+
+// hasProjectConfig reports whether the working directory holds a config
+// file of its own
+func hasProjectConfig() bool {
+	for _, name := range []string{projectPaths.Config, "./filter_lists.toml"} {
+		if _, err := os.Stat(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// userPaths returns the per-user locations on goos: XDG base directories
+// on Linux and other Unix systems, ~/Library on macOS, %APPDATA% and
+// %LOCALAPPDATA% on Windows. Like os.UserConfigDir, relative XDG
+// variables are ignored.
+func userPaths(goos string, getenv func(string) string, home string) (appPaths, error) {
+	var config, cache, data string
+	switch goos {
+	case "windows":
+		config, cache = getenv("APPDATA"), getenv("LOCALAPPDATA")
+		if config == "" || cache == "" {
+			return appPaths{}, errors.New("%APPDATA% or %LOCALAPPDATA% is not set")
+		}
+		data = config
+	case "darwin", "ios":
+		if home == "" {
+			return appPaths{}, errors.New("no home directory")
+		}
+		config = filepath.Join(home, "Library", "Application Support")
+		cache = filepath.Join(home, "Library", "Caches")
+		data = config
+	default:
+		if home == "" {
+			return appPaths{}, errors.New("no home directory")
+		}
+		xdg := func(name string, fallback ...string) string {
+			if dir := getenv(name); filepath.IsAbs(dir) {
+				return dir
+			}
+			return filepath.Join(append([]string{home}, fallback...)...)
+		}
+		config = xdg("XDG_CONFIG_HOME", ".config")
+		cache = xdg("XDG_CACHE_HOME", ".cache")
+		data = xdg("XDG_DATA_HOME", ".local", "share")
+	}
+
+	configDir := filepath.Join(config, appName)
+	return appPaths{
+		Config: filepath.Join(configDir, "filter_lists.toml"),
+		Cache:  filepath.Join(cache, appName),
+		Output: filepath.Join(data, appName, "output"),
+		PSL:    filepath.Join(configDir, "public_suffix_list.dat"),
+	}, nil
+}
+
+var pathsCmd = &cobra.Command{
+	Use:   "paths",
+	Short: "Show where the config, cache and outputs are looked for",
+	RunE:  runPaths,
+}
+
+func init() {
+	addOutputFormatFlag(pathsCmd)
+	rootCmd.AddCommand(pathsCmd)
+}
+
+// pathsInfo are the locations a run resolved
+type pathsInfo struct {
+	Config      string   `json:"config"`       // config file read, empty if none was found
+	ConfigPaths []string `json:"config_paths"` // files looked for without --config, in order
+	Cache       string   `json:"cache"`
+	Output      string   `json:"output"` // default of --output
+	PSL         string   `json:"psl"`
+}
+
+func runPaths(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	info := pathsInfo{
+		Config:      viper.ConfigFileUsed(),
+		ConfigPaths: configSearchPaths(),
+		Cache:       cfg.Cache.Dir,
+		Output:      defaultDirs.Output,
+		PSL:         cfg.PSL.File,
+	}
+	if format != outputTable {
+		return printStructured(os.Stdout, format, info)
+	}
+
+	if info.Config != "" {
+		fmt.Printf("Config:  %s\n", info.Config)
+	} else {
+		fmt.Println("Config:  none found, looked for")
+		for _, p := range info.ConfigPaths {
+			fmt.Printf("         %s\n", p)
+		}
+	}
+	fmt.Printf("Cache:   %s\n", info.Cache)
+	fmt.Printf("Output:  %s\n", info.Output)
+	fmt.Printf("PSL:     %s\n", info.PSL)
+	return nil
+}
+
+// configSearchPaths returns the config files looked for without --config:
+// the project layout first, then the per-user config directory. With
+// --system only the system config is.
+func configSearchPaths() []string {
+	if systemFlag {
+		return []string{systemPaths.Config}
+	}
+	paths := []string{projectPaths.Config, "./filter_lists.toml"}
+	home, _ := os.UserHomeDir()
+	if user, err := userPaths(runtime.GOOS, os.Getenv, home); err == nil {
+		paths = append(paths, user.Config)
+	}
+	return paths
+}
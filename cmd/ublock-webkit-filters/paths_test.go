@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserPaths(t *testing.T) {
+	env := map[string]string{"XDG_CACHE_HOME": "/var/cache/me", "XDG_DATA_HOME": "relative", "APPDATA": `C:\AppData`, "LOCALAPPDATA": `C:\Local`}
+	getenv := func(name string) string { return env[name] }
+
+	linux, err := userPaths("linux", getenv, "/home/me")
+	require.NoError(t, err)
+	assert.Equal(t, appPaths{
+		Config: "/home/me/.config/ublock-webkit-filters/filter_lists.toml",
+		Cache:  "/var/cache/me/ublock-webkit-filters",
+		Output: "/home/me/.local/share/ublock-webkit-filters/output", // relative XDG_DATA_HOME ignored
+		PSL:    "/home/me/.config/ublock-webkit-filters/public_suffix_list.dat",
+	}, linux)
+
+	mac, err := userPaths("darwin", getenv, "/Users/me")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/Users/me/Library/Application Support", appName, "filter_lists.toml"), mac.Config)
+	assert.Equal(t, filepath.Join("/Users/me/Library/Caches", appName), mac.Cache)
+
+	windows, err := userPaths("windows", getenv, "")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(`C:\Local`, appName), windows.Cache)
+	assert.Equal(t, filepath.Join(`C:\AppData`, appName, "output"), windows.Output)
+
+	_, err = userPaths("linux", getenv, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,1110 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/artifact"
+	"github.com/bnema/ublock-webkit-filters/internal/converter"
+	"github.com/bnema/ublock-webkit-filters/internal/fixtures"
+	"github.com/bnema/ublock-webkit-filters/internal/ir"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipelineConfig points every recorded list at the fixture server
+func pipelineConfig(t *testing.T, srv *fixtures.Server) models.Config {
+	t.Helper()
+	c := models.Config{
+		HTTP: models.HTTPConfig{Retries: 1},
+		Output: models.OutputConfig{
+			MaxRulesPerFile:  40,
+			GenerateCombined: true,
+			GenerateManifest: true,
+			GenericCosmetic:  models.GenericCosmeticKeep,
+			Target:           "webkit",
+			VersionScheme:    models.VersionSchemeContent,
+		},
+		Strict:  models.StrictConfig{MaxSkipRatio: 0.5},
+		Overlap: models.OverlapConfig{Threshold: 0.9},
+		Cache:   models.CacheConfig{Dir: t.TempDir()},
+	}
+	for _, name := range fixtures.Names() {
+		c.Lists = append(c.Lists, models.FilterList{Name: name, URL: srv.ListURL(name), Enabled: true})
+	}
+	return c
+}
+
+// withPipeline serves the recorded lists and points cfg at them until the
+// test ends
+func withPipeline(t *testing.T) *fixtures.Server {
+	t.Helper()
+	srv := fixtures.NewServer()
+	saved := cfg
+	t.Cleanup(func() {
+		cfg = saved
+		srv.Close()
+	})
+	cfg = pipelineConfig(t, srv)
+	return srv
+}
+
+// runPipeline builds into a new directory and returns it with the manifest
+func runPipeline(t *testing.T, opts convertOptions) (string, Manifest) {
+	t.Helper()
+	opts.OutputDir = t.TempDir()
+	opts.Combined = true
+
+	result, err := runBuild(context.Background(), opts)
+	require.NoError(t, err)
+	require.Empty(t, result.Errors)
+
+	data, err := os.ReadFile(filepath.Join(opts.OutputDir, "manifest.json"))
+	require.NoError(t, err)
+	var manifest Manifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	return opts.OutputDir, manifest
+}
+
+// readSummary loads the build summary of an output directory
+func readSummary(t *testing.T, dir string) BuildSummary {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, SummaryFile))
+	require.NoError(t, err)
+	var summary BuildSummary
+	require.NoError(t, json.Unmarshal(data, &summary))
+	return summary
+}
+
+func TestPipelineFixtures(t *testing.T) {
+	withPipeline(t)
+
+	dir, manifest := runPipeline(t, convertOptions{})
+
+	require.Len(t, manifest.Lists, len(fixtures.Names()))
+	for _, name := range fixtures.Names() {
+		lr := manifest.Lists[name]
+		assert.Positive(t, lr.RulesCount, name)
+		assert.FileExists(t, filepath.Join(dir, name+".json"))
+	}
+	ubo := manifest.Lists["ublock-filters"]
+	assert.Positive(t, ubo.SkipReasons[models.SkipScriptlet])
+	assert.Positive(t, ubo.SkipReasons[models.SkipInlineScript])
+
+	// Every combined part is valid content blocker JSON within the size limit
+	require.Greater(t, len(manifest.Combined.Files), 1)
+	total := 0
+	for _, part := range manifest.Combined.Parts {
+		data, err := os.ReadFile(filepath.Join(dir, part.File))
+		require.NoError(t, err)
+		var rules []models.WebKitRule
+		require.NoError(t, json.Unmarshal(data, &rules), part.File)
+		assert.LessOrEqual(t, len(rules), cfg.Output.MaxRulesPerFile)
+		assert.Equal(t, part.Rules, len(rules))
+		total += len(rules)
+	}
+	assert.Equal(t, manifest.Combined.TotalRules, total)
+	require.NotNil(t, manifest.Combined.CompileCost)
+	assert.Equal(t, total, manifest.Combined.CompileCost.Rules)
+	assert.GreaterOrEqual(t, manifest.Combined.CompileCost.Score, total)
+
+	// Builds are deterministic
+	again, manifest2 := runPipeline(t, convertOptions{})
+	assert.Equal(t, manifest.Version, manifest2.Version)
+	for _, part := range manifest.Combined.Parts {
+		a, _ := os.ReadFile(filepath.Join(dir, part.File))
+		b, _ := os.ReadFile(filepath.Join(again, part.File))
+		assert.Equal(t, a, b, part.File)
+	}
+}
+
+func TestPipelineUpdate(t *testing.T) {
+	srv := withPipeline(t)
+
+	dir, first := runPipeline(t, convertOptions{Update: true})
+	summary := readSummary(t, dir)
+	assert.Equal(t, first.BuildID, summary.BuildID)
+	assert.True(t, summary.Success)
+	assert.Zero(t, summary.CacheHits)
+	for _, name := range fixtures.Names() {
+		assert.Equal(t, cacheMiss, summary.Lists[name].Cache, name)
+		assert.Equal(t, first.Lists[name].RulesCount, summary.Lists[name].Rules, name)
+
+		fetch := first.Lists[name].Fetch
+		require.NotNil(t, fetch, name)
+		assert.Equal(t, http.StatusOK, fetch.Status, name)
+		assert.NotEmpty(t, fetch.ETag, name)
+		assert.Len(t, fetch.ContentHash, 64, name)
+		assert.EqualValues(t, len(fixtures.List(name)), fetch.Bytes, name)
+		assert.NotEmpty(t, fetch.FetchedAt, name)
+	}
+
+	// Unchanged lists are revalidated and reused
+	dir, second := runPipeline(t, convertOptions{Update: true})
+	for _, name := range fixtures.Names() {
+		assert.Equal(t, 1, srv.NotModified(name), name)
+
+		// The manifest still points at the version the rules came from
+		fetch := second.Lists[name].Fetch
+		assert.Equal(t, http.StatusNotModified, fetch.Status, name)
+		assert.Equal(t, first.Lists[name].Fetch.ETag, fetch.ETag, name)
+		assert.Equal(t, first.Lists[name].Fetch.ContentHash, fetch.ContentHash, name)
+		assert.Equal(t, first.Lists[name].Fetch.Bytes, fetch.Bytes, name)
+	}
+	assert.Equal(t, first.Version, second.Version)
+	assert.Equal(t, withoutFetch(first.Lists), withoutFetch(second.Lists))
+	assert.NotEqual(t, first.BuildID, second.BuildID)
+	summary = readSummary(t, dir)
+	assert.Equal(t, len(fixtures.Names()), summary.CacheHits)
+	assert.Equal(t, cacheNotModified, summary.Lists["easylist"].Cache)
+
+	// An upstream change is converted again
+	srv.Set("easyprivacy", append(fixtures.List("easyprivacy"), "||metrics.example.com^\n"...))
+	_, third := runPipeline(t, convertOptions{Update: true})
+	assert.Equal(t, first.Lists["easyprivacy"].RulesCount+2, third.Lists["easyprivacy"].RulesCount)
+	assert.NotEqual(t, first.Version, third.Version)
+
+	// Recently fetched lists are not asked for again, unless forced
+	cfg.HTTP.MinRefetch = time.Hour
+	requests := srv.Requests("easylist")
+	dir, _ = runPipeline(t, convertOptions{Update: true})
+	assert.Equal(t, requests, srv.Requests("easylist"))
+	assert.Equal(t, cacheFresh, readSummary(t, dir).Lists["easylist"].Cache)
+	runPipeline(t, convertOptions{Update: true, Force: true})
+	assert.Equal(t, requests+1, srv.Requests("easylist"))
+}
+
+func TestPipelineVerifiesContentHash(t *testing.T) {
+	srv := withPipeline(t)
+
+	sum := sha256.Sum256(fixtures.List("easylist"))
+	cfg.Lists[0].SHA256 = strings.ToUpper(hex.EncodeToString(sum[:]))
+	_, manifest := runPipeline(t, convertOptions{})
+	assert.Equal(t, hex.EncodeToString(sum[:]), manifest.Lists["easylist"].Fetch.ContentHash)
+
+	// A list that is not the pinned version is rejected
+	srv.Set("easylist", append(fixtures.List("easylist"), "||metrics.example.com^\n"...))
+	result, err := runBuild(context.Background(), convertOptions{OutputDir: t.TempDir(), Combined: true})
+	require.NoError(t, err)
+	assert.Contains(t, result.Errors["easylist"], "does not match the configured sha256")
+	assert.True(t, result.FetchFailed["easylist"])
+}
+
+func TestPipelineDedupFilters(t *testing.T) {
+	srv := withPipeline(t)
+
+	// A mirror repeating EasyList filters, one of them twice, next to its own
+	srv.Set("easyprivacy", []byte("||adnxs.com^\n||adnxs.com^\n/adsbygoogle.\n@@||adnxs.com^$image\n||tracker.example.org^\n"))
+	_, plain := runPipeline(t, convertOptions{})
+	assert.Equal(t, 1, plain.Lists["easyprivacy"].Duplicates)
+
+	cfg.Overlap.DedupFilters = true
+	_, dedup := runPipeline(t, convertOptions{Update: true})
+	mirror := dedup.Lists["easyprivacy"]
+	assert.Equal(t, 3, mirror.Duplicates)
+	// The unique block and the exception, which is never dropped, each
+	// converted to two rules for the trailing ^
+	assert.Equal(t, 4, mirror.RulesCount)
+	assert.Equal(t, plain.Combined.TotalRules, dedup.Combined.TotalRules)
+
+	// Cached lists still provide their filters to the lists after them
+	_, cached := runPipeline(t, convertOptions{Update: true})
+	assert.Equal(t, mirror.RulesCount, cached.Lists["easyprivacy"].RulesCount)
+	assert.Equal(t, mirror.Duplicates, cached.Lists["easyprivacy"].Duplicates)
+	assert.Equal(t, 1, srv.NotModified("easylist"))
+}
+
+func TestPipelineArchivesInputs(t *testing.T) {
+	srv := withPipeline(t)
+	cfg.Archive = models.ArchiveConfig{Enabled: true, Dir: "inputs"}
+
+	// Each list is kept as served, also when its rules come from the cache
+	for range 2 {
+		dir, manifest := runPipeline(t, convertOptions{Update: true})
+		checksums, err := os.ReadFile(filepath.Join(dir, "checksums.txt"))
+		require.NoError(t, err)
+		for _, name := range fixtures.Names() {
+			fetch := manifest.Lists[name].Fetch
+			assert.Equal(t, "inputs/"+fetch.ContentHash+".txt.gz", fetch.Snapshot, name)
+			assert.Equal(t, fixtures.List(name), gunzipFile(t, filepath.Join(dir, fetch.Snapshot)), name)
+			assert.Contains(t, string(checksums), fetch.Snapshot, name)
+		}
+	}
+	assert.Equal(t, 1, srv.NotModified("easylist"))
+}
+
+func gunzipFile(t *testing.T, path string) []byte {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	return data
+}
+
+// withoutFetch returns list results without their per-build fetch details
+func withoutFetch(lists map[string]ListResult) map[string]ListResult {
+	out := make(map[string]ListResult, len(lists))
+	for name, lr := range lists {
+		lr.Fetch = nil
+		out[name] = lr
+	}
+	return out
+}
+
+func TestPipelineContentBlockerLimit(t *testing.T) {
+	withPipeline(t)
+	cfg.Output.MaxContentBlockers = 1
+	cfg.Strict.MaxSkipRatio = 1 // the uBO excerpt is mostly unsupported syntax
+
+	// Too many combined parts only warn by default
+	runPipeline(t, convertOptions{})
+
+	failed := t.TempDir()
+	_, err := runBuild(context.Background(), convertOptions{OutputDir: failed, Combined: true, Strict: true})
+	require.ErrorContains(t, err, "exceed content blocker limits")
+	summary := readSummary(t, failed)
+	assert.False(t, summary.Success)
+	assert.Contains(t, summary.Error, "exceed content blocker limits")
+
+	cfg.Output.MaxRulesPerFile = 60000
+	_, err = runBuild(context.Background(), convertOptions{OutputDir: t.TempDir(), Combined: true})
+	require.ErrorContains(t, err, "exceeds the webkit limit")
+}
+
+func TestPipelineExceptionLiftsEarlierLists(t *testing.T) {
+	srv := withPipeline(t)
+	srv.Set("b", []byte("||ads.com^\n"))
+	srv.Set("a", []byte("||ads.com^\n@@||ads.com^\n||other.net^\n"))
+	cfg.Lists = []models.FilterList{
+		{Name: "b", URL: srv.ListURL("b"), Enabled: true},
+		{Name: "a", URL: srv.ListURL("a"), Enabled: true},
+	}
+	cfg.Output.ExceptionsExport = true
+
+	dir, manifest := runPipeline(t, convertOptions{})
+
+	// The exception of a also lifts the block of b, as in uBO: the
+	// combined output must not block ads.com
+	var rules []models.WebKitRule
+	for _, file := range manifest.Combined.Files {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		require.NoError(t, err)
+		var part []models.WebKitRule
+		require.NoError(t, json.Unmarshal(data, &part))
+		rules = append(rules, part...)
+	}
+	blocked := false
+	for _, r := range rules {
+		if strings.Contains(r.Trigger.URLFilter, `ads\.com`) {
+			blocked = r.Action.Type == models.ActionBlock
+		}
+	}
+	assert.False(t, blocked, "ads.com stays blocked")
+	assert.Equal(t, 2, manifest.Combined.TotalRules, "only other.net is left, with and without a path")
+
+	// a's own file keeps its exception, and so does the export
+	assert.Equal(t, 6, manifest.Lists["a"].RulesCount)
+	data, err := os.ReadFile(filepath.Join(dir, "exceptions.json"))
+	require.NoError(t, err)
+	var exceptions ExceptionsReport
+	require.NoError(t, json.Unmarshal(data, &exceptions))
+	assert.Equal(t, 1, exceptions.Total)
+}
+
+func TestPipelineExcludedSubdomainKeepsOtherLists(t *testing.T) {
+	srv := withPipeline(t)
+	srv.Set("b", []byte("||tracker.com^\n"))
+	srv.Set("a", []byte("||tracker.com^$domain=a.com|~sub.a.com\n"))
+	cfg.Lists = []models.FilterList{
+		{Name: "b", URL: srv.ListURL("b"), Enabled: true},
+		{Name: "a", URL: srv.ListURL("a"), Enabled: true},
+	}
+
+	dir, manifest := runPipeline(t, convertOptions{})
+
+	// The exclusion in a must not lift the block of b on sub.a.com
+	blocked := false
+	for _, file := range manifest.Combined.Files {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		require.NoError(t, err)
+		var rules []models.WebKitRule
+		require.NoError(t, json.Unmarshal(data, &rules))
+		for _, r := range rules {
+			if !strings.Contains(r.Trigger.URLFilter, `tracker\.com`) {
+				continue
+			}
+			applies := len(r.Trigger.IfDomain) == 0
+			for _, d := range r.Trigger.IfDomain {
+				applies = applies || d == "*sub.a.com" || d == "*a.com"
+			}
+			if applies {
+				blocked = r.Action.Type == models.ActionBlock
+			}
+		}
+	}
+	assert.True(t, blocked, "tracker.com is no longer blocked on sub.a.com")
+}
+
+func TestPipelineHostsList(t *testing.T) {
+	srv := withPipeline(t)
+	srv.Set("hosts", []byte("# Title: Ad servers\n127.0.0.1 localhost\n0.0.0.0 ads.example.com\n0.0.0.0 tracker.example.org # trackers\n"))
+	cfg.Lists = []models.FilterList{{Name: "hosts", URL: srv.ListURL("hosts"), Enabled: true}}
+
+	// Strict builds accept hosts lists, their entries block the host
+	dir, manifest := runPipeline(t, convertOptions{Strict: true})
+	lr := manifest.Lists["hosts"]
+	assert.Equal(t, "hosts", lr.Format)
+	assert.Zero(t, lr.SkippedCount)
+	require.Len(t, lr.Files, 1)
+	data, err := os.ReadFile(filepath.Join(dir, lr.Files[0]))
+	require.NoError(t, err)
+	var rules []models.WebKitRule
+	require.NoError(t, json.Unmarshal(data, &rules))
+	hosts := make(map[string]int)
+	for _, r := range rules {
+		assert.Equal(t, models.ActionBlock, r.Action.Type)
+		for _, host := range []string{"localhost", `ads\.example\.com`, `tracker\.example\.org`} {
+			if strings.Contains(r.Trigger.URLFilter, host) {
+				hosts[host]++
+			}
+		}
+	}
+	assert.Equal(t, map[string]int{`ads\.example\.com`: 2, `tracker\.example\.org`: 2}, hosts, "two rules per host, with and without a path")
+}
+
+func TestPipelineSafariExtensions(t *testing.T) {
+	withPipeline(t)
+	cfg.Output.MaxRulesPerFile = 0
+	cfg.Safari = models.SafariConfig{Extensions: true, MaxRules: 30, Bundles: []string{"app.blocker1", "app.blocker2"}}
+	cfg.Strict.MaxSkipRatio = 1
+
+	dir, manifest := runPipeline(t, convertOptions{})
+	require.Equal(t, "safari-extensions.json", manifest.Safari)
+
+	data, err := os.ReadFile(filepath.Join(dir, manifest.Safari))
+	require.NoError(t, err)
+	var mapping SafariMapping
+	require.NoError(t, json.Unmarshal(data, &mapping))
+
+	// Parts are capped to fit an extension, files beyond the bundles are reported
+	assert.Equal(t, 30, mapping.MaxRules)
+	require.Len(t, mapping.Extensions, 2)
+	assert.Equal(t, "app.blocker1", mapping.Extensions[0].BundleID)
+	assert.Equal(t, manifest.Combined.Files[0], mapping.Extensions[0].File)
+	for _, ext := range mapping.Extensions {
+		assert.LessOrEqual(t, ext.Rules, 30)
+		assert.Positive(t, ext.Bytes)
+	}
+	require.Greater(t, len(manifest.Combined.Files), 2)
+	assert.Len(t, mapping.Unassigned, len(manifest.Combined.Files)-2)
+
+	_, err = runBuild(context.Background(), convertOptions{OutputDir: t.TempDir(), Combined: true, Strict: true})
+	require.ErrorContains(t, err, "exceed content blocker limits")
+}
+
+func TestPipelineCleansStaleOutputs(t *testing.T) {
+	srv := withPipeline(t)
+
+	dir := t.TempDir()
+	build := func() {
+		t.Helper()
+		_, err := runBuild(context.Background(), convertOptions{OutputDir: dir, Combined: true})
+		require.NoError(t, err)
+	}
+	build()
+	assert.FileExists(t, filepath.Join(dir, "easyprivacy.json"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.json"), []byte("{}"), 0644))
+
+	// Outputs stay unless a policy says otherwise
+	cfg.Lists[1].Enabled = false
+	build()
+	assert.FileExists(t, filepath.Join(dir, "easyprivacy.json"))
+
+	// A failed build cleans nothing up, not even at the next build
+	cfg.Lists[1].Enabled = true
+	build()
+	cfg.Output.Stale = models.StaleRemove
+	cfg.Lists[1].Enabled = false
+	cfg.Output.MaxContentBlockers = 1
+	cfg.Strict.MaxSkipRatio = 1
+	_, err := runBuild(context.Background(), convertOptions{OutputDir: dir, Combined: true, Strict: true})
+	require.ErrorContains(t, err, "exceed content blocker limits")
+	assert.FileExists(t, filepath.Join(dir, "easyprivacy.json"))
+	cfg.Output.MaxContentBlockers = 0
+
+	// A disabled list's files go, files the tool did not write stay
+	build()
+	assert.NoFileExists(t, filepath.Join(dir, "easyprivacy.json"))
+	assert.FileExists(t, filepath.Join(dir, "notes.json"))
+	assert.FileExists(t, filepath.Join(dir, "easylist.json"))
+
+	// A failed download keeps the list's last rules
+	cfg.Lists[1].Enabled = true
+	build()
+	cfg.Lists[1].URL = srv.URL + "/missing.txt"
+	build()
+	assert.FileExists(t, filepath.Join(dir, "easyprivacy.json"))
+
+	// Quarantined files move out of the published outputs
+	cfg.Output.Stale = models.StaleQuarantine
+	cfg.Lists[0].Enabled = false
+	build()
+	assert.NoFileExists(t, filepath.Join(dir, "easylist.json"))
+	assert.FileExists(t, filepath.Join(dir, staleDir, "easylist.json"))
+	checksums, err := os.ReadFile(filepath.Join(dir, "checksums.txt"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(checksums), "easylist.json")
+}
+
+func TestPipelineRequiredLists(t *testing.T) {
+	srv := withPipeline(t)
+	cfg.Lists[1].URL = srv.URL + "/missing.txt"
+
+	// An optional list is left out
+	dir := t.TempDir()
+	result, err := runBuild(context.Background(), convertOptions{OutputDir: dir, Combined: true})
+	require.NoError(t, err)
+	assert.Contains(t, result.Errors, "easyprivacy")
+	assert.FileExists(t, filepath.Join(dir, "manifest.json"))
+
+	// A required one fails the build before the combined outputs
+	dir = t.TempDir()
+	_, err = runBuild(context.Background(), convertOptions{OutputDir: dir, Combined: true, Require: []string{"easyprivacy"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "required list easyprivacy")
+	assert.NoFileExists(t, filepath.Join(dir, "manifest.json"))
+
+	cfg.Lists[1].Required = true
+	_, err = runBuild(context.Background(), convertOptions{OutputDir: dir, Combined: true})
+	assert.Error(t, err)
+
+	_, err = runBuild(context.Background(), convertOptions{OutputDir: dir, Require: []string{"nope"}})
+	assert.ErrorContains(t, err, "not an enabled list")
+}
+
+func TestPipelineIRRoundTrip(t *testing.T) {
+	srv := withPipeline(t)
+
+	irDir := t.TempDir()
+	dir, manifest := runPipeline(t, convertOptions{EmitIR: irDir})
+	for _, list := range cfg.Lists {
+		assert.FileExists(t, ir.Path(irDir, list.Name))
+	}
+
+	// The server is gone, the dump alone yields the same outputs
+	srv.Close()
+	irOut, irManifest := runPipeline(t, convertOptions{FromIR: irDir})
+	assert.Equal(t, manifest.Combined.Parts, irManifest.Combined.Parts)
+	for _, part := range manifest.Combined.Parts {
+		want, err := os.ReadFile(filepath.Join(dir, part.File))
+		require.NoError(t, err)
+		got, err := os.ReadFile(filepath.Join(irOut, part.File))
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	// Lists without a dump fail like downloads
+	cfg.Lists = append(cfg.Lists, models.FilterList{Name: "extra", URL: "https://example.com/extra.txt", Enabled: true})
+	result, err := runBuild(context.Background(), convertOptions{OutputDir: t.TempDir(), FromIR: irDir})
+	require.NoError(t, err)
+	assert.Contains(t, result.Errors["extra"], "no IR dump")
+}
+
+func TestPipelineHooks(t *testing.T) {
+	withPipeline(t)
+
+	deployed := filepath.Join(t.TempDir(), "deployed.json")
+	cfg.Hooks.OnSuccess = []string{"cp {manifest} " + deployed}
+	dir, manifest := runPipeline(t, convertOptions{})
+	data, err := os.ReadFile(deployed)
+	require.NoError(t, err)
+	var copied Manifest
+	require.NoError(t, json.Unmarshal(data, &copied))
+	assert.Equal(t, manifest.BuildID, copied.BuildID)
+	assert.FileExists(t, filepath.Join(dir, "manifest.json"))
+
+	// A failing deployment fails the build and runs the failure hooks
+	failed := filepath.Join(t.TempDir(), "failed")
+	cfg.Hooks.OnSuccess = []string{"false"}
+	cfg.Hooks.OnFailure = []string{"touch " + failed}
+	_, err = runBuild(context.Background(), convertOptions{OutputDir: t.TempDir(), Combined: true})
+	require.ErrorContains(t, err, `hook "false"`)
+	assert.FileExists(t, failed)
+}
+
+func TestPipelineEmbedded(t *testing.T) {
+	srv := withPipeline(t)
+	cfg.Strict.MaxSkipRatio = 1
+	cfg.Lists[0].URL = "https://easylist.to/easylist/easylist.txt"
+	cfg.Lists[1].URL = "https://easylist.to/easylist/easyprivacy.txt"
+
+	// Snapshots stand in for downloads, other lists are not fetched
+	dir := t.TempDir()
+	result, err := runBuild(context.Background(), convertOptions{OutputDir: dir, Combined: true, Embedded: true})
+	require.NoError(t, err)
+	for _, name := range []string{"easylist", "easyprivacy"} {
+		lr := result.Lists[name]
+		assert.Positive(t, lr.RulesCount, name)
+		assert.Zero(t, lr.Fetch.Status, name)
+		assert.NotEmpty(t, lr.Fetch.LastModified, name)
+	}
+	assert.Contains(t, result.Errors["ublock-filters"], "no embedded snapshot")
+	assert.Zero(t, srv.Requests("ublock-filters"))
+	require.NotNil(t, result.Manifest)
+	assert.FileExists(t, filepath.Join(dir, result.Manifest.Combined.Files[0]))
+}
+
+func TestPipelineToggles(t *testing.T) {
+	withPipeline(t)
+	cfg.Lists[0].Title = "EasyList"
+	cfg.Lists[0].Tags = []string{"ads"}
+	cfg.Lists[1].DefaultOff = true
+	cfg.Categories = map[string]models.Category{"ads": {Title: "Ads", Description: "Banners"}}
+
+	_, manifest := runPipeline(t, convertOptions{})
+	require.Len(t, manifest.Toggles, len(fixtures.Names())+1)
+
+	easylist := manifest.Toggles[0]
+	assert.Equal(t, Toggle{
+		ID: "easylist", Kind: toggleList, Title: "EasyList", Category: "ads", DefaultOn: true,
+		Rules: manifest.Lists["easylist"].RulesCount, Files: manifest.Lists["easylist"].Files,
+	}, easylist)
+	assert.Equal(t, "easyprivacy", manifest.Toggles[1].Title)
+	assert.False(t, manifest.Toggles[1].DefaultOn)
+
+	ads := manifest.Toggles[len(manifest.Toggles)-1]
+	assert.Equal(t, toggleCategory, ads.Kind)
+	assert.Equal(t, "Ads", ads.Title)
+	assert.Equal(t, "Banners", ads.Description)
+	assert.Equal(t, manifest.Categories["ads"].Files, ads.Files)
+	assert.Equal(t, manifest.Categories["ads"].TotalRules, ads.Rules)
+}
+
+func TestPipelineTagClashesWithParts(t *testing.T) {
+	withPipeline(t)
+	cfg.Lists[0].Tags = []string{"part1"}
+	_, err := runBuild(context.Background(), convertOptions{OutputDir: t.TempDir(), Combined: true})
+	require.ErrorContains(t, err, `tag "part1" would overwrite a part of the split combined output`)
+
+	// Clashes follow the part names
+	cfg.Output.PartName = "{name}-{index:02d}"
+	cfg.Lists[0].Tags = []string{"01"}
+	_, err = runBuild(context.Background(), convertOptions{OutputDir: t.TempDir(), Combined: true})
+	require.ErrorContains(t, err, `tag "01" would overwrite`)
+	cfg.Lists[0].Tags = []string{"part1"}
+	cfg.Strict.MaxSkipRatio = 1
+	runPipeline(t, convertOptions{})
+}
+
+func TestPipelineIPFSNeedsHash(t *testing.T) {
+	withPipeline(t)
+	cfg.Lists[0].URL = "ipfs://bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi/easylist.txt"
+	_, err := runBuild(context.Background(), convertOptions{OutputDir: t.TempDir(), Combined: true})
+	require.ErrorContains(t, err, "ipfs:// URLs need sha256")
+}
+
+func TestEstimate(t *testing.T) {
+	srv := withPipeline(t)
+
+	// Fresh downloads predict the build exactly
+	est := estimateLists(context.Background(), true)
+	_, manifest := runPipeline(t, convertOptions{})
+	require.Len(t, est.Lists, len(fixtures.Names()))
+	for _, le := range est.Lists {
+		require.NoError(t, le.Err, le.Name)
+		lr := manifest.Lists[le.Name]
+		assert.Equal(t, lr.RulesCount+lr.GenericCount+lr.PopupCount, le.Rules, le.Name)
+		assert.Positive(t, le.Filters, le.Name)
+		assert.False(t, le.Cached, le.Name)
+	}
+	assert.Equal(t, manifest.Combined.TotalRules, est.Combined)
+	assert.Len(t, manifest.Combined.Files, est.Parts)
+	assert.Equal(t, 50000, est.Capacity)
+
+	// Later estimates reuse the rules the build cached
+	requests := srv.Requests("easylist")
+	cached := estimateLists(context.Background(), false)
+	assert.True(t, cached.Lists[0].Cached)
+	assert.Equal(t, requests, srv.Requests("easylist"))
+	assert.Equal(t, est.Combined, cached.Combined)
+}
+
+func TestPipelineStats(t *testing.T) {
+	withPipeline(t)
+	dir, manifest := runPipeline(t, convertOptions{})
+
+	stats, err := readBuildStats(dir)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.BuildID, stats.BuildID)
+	assert.Equal(t, readSummary(t, dir).DurationMS, stats.DurationMS)
+	require.Len(t, stats.Lists, len(fixtures.Names()))
+	for _, ls := range stats.Lists {
+		lr := manifest.Lists[ls.Name]
+		assert.Equal(t, lr.RulesCount, ls.Rules, ls.Name)
+		assert.Equal(t, lr.SkippedCount, ls.Skipped, ls.Name)
+		assert.Equal(t, "miss", ls.Cache, ls.Name)
+	}
+
+	assert.Equal(t, manifest.Combined.TotalRules, stats.Combined.Rules)
+	assert.Len(t, manifest.Combined.Parts, stats.Combined.Parts)
+	var size int64
+	for _, file := range manifest.Combined.Files {
+		info, err := os.Stat(filepath.Join(dir, file))
+		require.NoError(t, err)
+		size += info.Size()
+	}
+	assert.Equal(t, size, stats.Combined.Bytes)
+	assert.Equal(t, manifest.Combined.Actions, stats.Actions)
+
+	var out bytes.Buffer
+	require.NoError(t, printStructured(&out, outputYAML, stats))
+	assert.Contains(t, out.String(), "build_id: "+manifest.BuildID+"\n")
+
+	_, err = readBuildStats(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestPipelineTypePartitions(t *testing.T) {
+	withPipeline(t)
+	cfg.Output.TypePartitions = []string{models.PartitionScripts, models.PartitionImages, models.PartitionXHR}
+
+	dir, manifest := runPipeline(t, convertOptions{})
+	for _, name := range cfg.Output.TypePartitions {
+		info, ok := manifest.Types[name]
+		require.True(t, ok, name)
+		blocks, exceptions := 0, 0
+		for _, file := range info.Files {
+			data, err := os.ReadFile(filepath.Join(dir, file))
+			require.NoError(t, err)
+			var rules []models.WebKitRule
+			require.NoError(t, json.Unmarshal(data, &rules))
+			for _, r := range rules {
+				if r.Action.Type == models.ActionBlock {
+					assert.Subset(t, typePartitions[name], r.Trigger.ResourceType, file)
+					blocks++
+				} else if r.Action.Type == models.ActionIgnorePreviousRule {
+					exceptions++
+				}
+			}
+		}
+		assert.Positive(t, blocks, name)
+		if name == models.PartitionScripts {
+			// @@||adnxs.com/ast/ast.js$script and others
+			assert.Positive(t, exceptions, name)
+		}
+	}
+
+	// Their block rules left the main output
+	data, err := os.ReadFile(filepath.Join(dir, "easylist.json"))
+	require.NoError(t, err)
+	var rules []models.WebKitRule
+	require.NoError(t, json.Unmarshal(data, &rules))
+	for _, r := range rules {
+		if r.Action.Type == models.ActionBlock && len(r.Trigger.ResourceType) == 1 {
+			assert.NotContains(t, []string{models.ResourceScript, models.ResourceImage, models.ResourceRaw}, r.Trigger.ResourceType[0])
+		}
+	}
+	assert.Positive(t, manifest.Lists["easylist"].TypeCounts[models.PartitionImages])
+	assert.FileExists(t, filepath.Join(dir, "easylist-images.json"))
+	assert.Contains(t, manifest.Lists["easylist"].Files, "easylist-images.json")
+}
+
+func TestPipelineExceptionsExport(t *testing.T) {
+	withPipeline(t)
+	cfg.Output.ExceptionsExport = true
+
+	dir, manifest := runPipeline(t, convertOptions{})
+	require.Equal(t, "exceptions.json", manifest.Exceptions)
+	data, err := os.ReadFile(filepath.Join(dir, manifest.Exceptions))
+	require.NoError(t, err)
+	var report ExceptionsReport
+	require.NoError(t, json.Unmarshal(data, &report))
+
+	found := false
+	total := 0
+	for name, exceptions := range report.Lists {
+		total += len(exceptions)
+		for _, e := range exceptions {
+			assert.True(t, strings.HasPrefix(e.Filter, "@@"), name)
+			assert.NotEmpty(t, e.Rules, e.Filter)
+			found = found || e.Filter == "@@||google-analytics.com/analytics.js$script,domain=shop.example.com"
+		}
+	}
+	assert.True(t, found)
+	assert.Equal(t, report.Total, total)
+}
+
+func TestPipelineMemorySpill(t *testing.T) {
+	withPipeline(t)
+	cfg.Output.CombinedBudget = 60
+	for i := range cfg.Lists {
+		cfg.Lists[i].Tags = []string{"ads"}
+	}
+	cfg.Lists[0].Tags = append(cfg.Lists[0].Tags, "privacy")
+
+	inMemory, want := runPipeline(t, convertOptions{})
+
+	// Every list is spilled as soon as it is added
+	spillDir := t.TempDir()
+	cfg.Memory = models.MemoryConfig{Limit: "1KB", SpillDir: spillDir}
+	spilled, got := runPipeline(t, convertOptions{})
+
+	assert.Equal(t, want.Combined.TotalRules, got.Combined.TotalRules)
+	assert.Equal(t, want.Combined.Sources, got.Combined.Sources)
+	for _, info := range []struct{ want, got CombinedInfo }{
+		{want.Combined, got.Combined},
+		{want.Categories["ads"], got.Categories["ads"]},
+		{want.Categories["privacy"], got.Categories["privacy"]},
+	} {
+		require.Equal(t, info.want.Files, info.got.Files)
+		for _, file := range info.want.Files {
+			wantData, err := os.ReadFile(filepath.Join(inMemory, file))
+			require.NoError(t, err)
+			gotData, err := os.ReadFile(filepath.Join(spilled, file))
+			require.NoError(t, err)
+			assert.JSONEq(t, string(wantData), string(gotData), file)
+		}
+	}
+
+	// Temporary files are removed after the build
+	entries, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestListStatus(t *testing.T) {
+	withPipeline(t)
+
+	dir, manifest := runPipeline(t, convertOptions{})
+	summary := readSummaryFile(dir)
+	require.NotNil(t, summary)
+	summary.Lists["easylist"].Error = "fetching: 503 Service Unavailable"
+
+	list := cfg.Lists[0]
+	require.Equal(t, "easylist", list.Name)
+	lc, err := readListCache(list.Name)
+	require.NoError(t, err)
+
+	lines := listStatus(list, summary, lc.Fetch.FetchedAt.Add(24*time.Hour))
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "version 202409011200, fetched ")
+	assert.Equal(t, "current: expires in 72h", lines[1])
+	assert.Equal(t, fmt.Sprintf("%d rules from the last conversion", manifest.Lists["easylist"].RulesCount), lines[2])
+	assert.Equal(t, "last error (build "+summary.BuildID+"): fetching: 503 Service Unavailable", lines[3])
+
+	lines = listStatus(list, nil, lc.Fetch.FetchedAt.Add(5*24*time.Hour))
+	assert.Equal(t, "stale: expired 24h ago (expires every 96h)", lines[1])
+
+	assert.Equal(t, []string{"not fetched yet"}, listStatus(models.FilterList{Name: "missing"}, nil, time.Now()))
+
+	// Scripts get the same state as JSON or YAML
+	info := listState(list, summary, lc.Fetch.FetchedAt.Add(5*24*time.Hour))
+	var out bytes.Buffer
+	require.NoError(t, printStructured(&out, outputJSON, info))
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, "202409011200", decoded["version"])
+	assert.Equal(t, true, decoded["stale"])
+	assert.Equal(t, "fetching: 503 Service Unavailable", decoded["last_error"])
+
+	out.Reset()
+	require.NoError(t, printStructured(&out, outputYAML, info))
+	assert.Contains(t, out.String(), "name: easylist\n")
+	assert.Contains(t, out.String(), "stale: true\n")
+}
+
+func TestPipelinePartIdentifiers(t *testing.T) {
+	withPipeline(t)
+
+	dir, manifest := runPipeline(t, convertOptions{})
+	require.NotEmpty(t, manifest.Combined.Parts)
+	for _, part := range manifest.Combined.Parts {
+		data, err := os.ReadFile(filepath.Join(dir, part.File))
+		require.NoError(t, err)
+		assert.Equal(t, artifact.Identifier(part.File, data), part.ID)
+		assert.Equal(t, part.ID, manifest.Identifiers[part.File])
+	}
+	for _, lr := range manifest.Lists {
+		for _, file := range lr.Files {
+			assert.NotEmpty(t, manifest.Identifiers[file], file)
+		}
+	}
+
+	// Unchanged parts keep their identifiers, changed ones get new ones
+	cfg.Lists = cfg.Lists[1:]
+	_, again := runPipeline(t, convertOptions{})
+	for _, file := range again.Lists[cfg.Lists[0].Name].Files {
+		assert.Equal(t, manifest.Identifiers[file], again.Identifiers[file], file)
+	}
+	assert.NotEqual(t, manifest.Combined.Parts[0].ID, again.Combined.Parts[0].ID)
+}
+
+func TestPipelineCompileCache(t *testing.T) {
+	withPipeline(t)
+	compiled := t.TempDir()
+	cfg.Compile.Command = "cp {file} " + compiled
+
+	dir, manifest := runPipeline(t, convertOptions{})
+	ctx := context.Background()
+	result, err := compileOutputs(ctx, dir, false)
+	require.NoError(t, err)
+	assert.Equal(t, len(manifest.Identifiers), result.Compiled)
+	assert.Empty(t, result.Failed)
+	entries, err := os.ReadDir(compiled)
+	require.NoError(t, err)
+	assert.Len(t, entries, len(manifest.Identifiers))
+
+	// Unchanged files are skipped
+	result, err = compileOutputs(ctx, dir, false)
+	require.NoError(t, err)
+	assert.Zero(t, result.Compiled)
+	assert.Equal(t, len(manifest.Identifiers), result.Cached)
+
+	// Files no longer matching their identifier fail
+	part := manifest.Combined.Parts[0].File
+	require.NoError(t, os.WriteFile(filepath.Join(dir, part), []byte("[]"), 0644))
+	result, err = compileOutputs(ctx, dir, true)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{part: "content changed since the build"}, result.Failed)
+	assert.Equal(t, len(manifest.Identifiers)-1, result.Compiled)
+}
+
+func TestPipelineRetention(t *testing.T) {
+	withPipeline(t)
+	cfg.Output.Versioned = true
+	cfg.Archive = models.ArchiveConfig{Enabled: true, Dir: "inputs"}
+	cfg.Retention.KeepBuilds = 1
+
+	dir, manifest := runPipeline(t, convertOptions{})
+	version := filepath.Join(dir, versionsDir, manifest.BuildID)
+	assert.FileExists(t, filepath.Join(version, "manifest.json"))
+	assert.FileExists(t, filepath.Join(version, artifact.ChecksumsFile))
+	assert.NoDirExists(t, filepath.Join(version, "inputs"))
+	saved := make(map[string][]byte)
+	for _, file := range manifest.Combined.Files {
+		data, err := os.ReadFile(filepath.Join(version, file))
+		require.NoError(t, err)
+		saved[file] = data
+	}
+
+	// The next build rewrites the outputs, not the saved version
+	cfg.Retention.KeepBuilds = 2
+	cfg.Allowlist.Domains = []string{"trusted.com"}
+	next, err := runBuild(context.Background(), convertOptions{OutputDir: dir, Combined: true})
+	require.NoError(t, err)
+	require.Empty(t, next.Errors)
+	for file, data := range saved {
+		current, err := os.ReadFile(filepath.Join(dir, file))
+		require.NoError(t, err)
+		require.NotEqual(t, data, current, file)
+		kept, err := os.ReadFile(filepath.Join(version, file))
+		require.NoError(t, err)
+		assert.Equal(t, data, kept, file)
+	}
+
+	// An older build and a list no build uses any more
+	old := filepath.Join(dir, versionsDir, "20200101T000000Z-00000000")
+	require.NoError(t, os.MkdirAll(old, 0755))
+	orphan := filepath.Join(dir, "inputs", "0000"+snapshotExt)
+	require.NoError(t, os.WriteFile(orphan, nil, 0644))
+
+	var out bytes.Buffer
+	plan, err := collectGarbage(dir, true, &out)
+	require.NoError(t, err)
+	assert.Equal(t, []string{old}, plan.Versions)
+	assert.Equal(t, []string{orphan}, plan.Snapshots)
+	assert.Contains(t, out.String(), "Would delete build "+old)
+	assert.DirExists(t, old)
+
+	_, err = collectGarbage(dir, false, io.Discard)
+	require.NoError(t, err)
+	assert.NoDirExists(t, old)
+	assert.NoFileExists(t, orphan)
+	assert.DirExists(t, version)
+	for _, lr := range manifest.Lists {
+		assert.FileExists(t, filepath.Join(dir, lr.Fetch.Snapshot))
+	}
+}
+
+func TestPipelineSchema(t *testing.T) {
+	withPipeline(t)
+	dir, _ := runPipeline(t, convertOptions{})
+
+	// Every key the build writes is described
+	for _, tc := range []struct {
+		file, def string
+		value     any
+	}{
+		{"manifest.json", "Manifest", Manifest{}},
+		{SummaryFile, "BuildSummary", BuildSummary{}},
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, tc.file))
+		require.NoError(t, err)
+		var written map[string]any
+		require.NoError(t, json.Unmarshal(data, &written))
+
+		def := schema.For(tc.value, "").Defs[tc.def]
+		require.NotNil(t, def, tc.def)
+		for key := range written {
+			assert.Contains(t, def.Properties, key, tc.file)
+		}
+		for _, key := range def.Required {
+			assert.Contains(t, written, key, tc.file)
+		}
+	}
+
+	out := t.TempDir()
+	require.NoError(t, schemaCmd.Flags().Set("dir", out))
+	defer func() { _ = schemaCmd.Flags().Set("dir", "") }()
+	require.NoError(t, runSchema(schemaCmd, []string{"rules"}))
+	assert.FileExists(t, filepath.Join(out, "rules.schema.json"))
+	assert.NoFileExists(t, filepath.Join(out, "manifest.schema.json"))
+}
+
+func TestFixtureCorpus(t *testing.T) {
+	corpus, err := fixtures.ReadCorpus()
+	require.NoError(t, err)
+	for _, c := range corpus {
+		for _, line := range c.Converted {
+			converted, reason := classifyLine(line)
+			assert.True(t, converted, "%s: %s no longer converts (%s)", c.List, line, reason)
+		}
+		for _, s := range c.Skipped {
+			_, reason := classifyLine(s.Line)
+			assert.Equal(t, s.Reason, reason, "%s: %s", c.List, s.Line)
+		}
+	}
+}
+
+func TestFixturesCommand(t *testing.T) {
+	srv := withPipeline(t)
+
+	dir := t.TempDir()
+	require.NoError(t, fixturesCmd.Flags().Set("dir", dir))
+	require.NoError(t, fixturesCmd.Flags().Set("seed", "7"))
+	defer func() {
+		_ = fixturesCmd.Flags().Set("dir", fixtures.CorpusDir)
+		_ = fixturesCmd.Flags().Set("seed", "0")
+	}()
+	require.NoError(t, runFixtures(fixturesCmd, []string{"ublock-filters"}))
+
+	data, err := os.ReadFile(filepath.Join(dir, "ublock-filters.json"))
+	require.NoError(t, err)
+	var c fixtures.Corpus
+	require.NoError(t, json.Unmarshal(data, &c))
+	assert.Equal(t, srv.ListURL("ublock-filters"), c.URL)
+	assert.EqualValues(t, 7, c.Seed)
+	assert.NotEmpty(t, c.Converted)
+	assert.NotEmpty(t, c.Skipped)
+	assert.NoFileExists(t, filepath.Join(dir, "easylist.json"))
+}
+
+func TestPipelineSourceMap(t *testing.T) {
+	withPipeline(t)
+	cfg.Output.SourceMap = true
+	cfg.Allowlist.Domains = []string{"trusted.com"}
+
+	dir, manifest := runPipeline(t, convertOptions{})
+	require.Equal(t, "source-map.json", manifest.SourceMap)
+	data, err := os.ReadFile(filepath.Join(dir, manifest.SourceMap))
+	require.NoError(t, err)
+	var sources SourceMap
+	require.NoError(t, json.Unmarshal(data, &sources))
+	assert.ElementsMatch(t, fixtures.Names(), sources.Lists)
+
+	// The rules of each list, as its own output holds them
+	listRules := make(map[string][]models.WebKitRule)
+	for name, lr := range manifest.Lists {
+		for _, file := range lr.Files {
+			var rules []models.WebKitRule
+			data, err := os.ReadFile(filepath.Join(dir, file))
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(data, &rules))
+			listRules[name] = append(listRules[name], rules...)
+		}
+	}
+
+	for _, file := range manifest.Combined.Files {
+		var rules []models.WebKitRule
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &rules))
+
+		ranges := sources.Files[file]
+		require.NotEmpty(t, ranges, file)
+		next := 0
+		for _, r := range ranges {
+			assert.Equal(t, next, r.First, "ranges cover every rule in order")
+			next = r.Last + 1
+			if r.List == converter.NoSource {
+				continue
+			}
+			name := sources.Lists[r.List]
+			for _, rule := range rules[r.First : r.Last+1] {
+				assert.Contains(t, listRules[name], rule, "%s rule of %s", file, name)
+			}
+		}
+		assert.Equal(t, len(rules), next)
+		// The allowlist closes every file
+		assert.Equal(t, converter.NoSource, ranges[len(ranges)-1].List)
+	}
+}
+
+func TestPipelineParallelWrites(t *testing.T) {
+	srv := withPipeline(t)
+	cfg.Output.MaxRulesPerFile = 10
+	cfg.Output.WriteWorkers = 1
+	_, sequential := runPipeline(t, convertOptions{})
+
+	cfg = pipelineConfig(t, srv)
+	cfg.Output.MaxRulesPerFile = 10
+	cfg.Output.WriteWorkers = 4
+	cfg.Output.Fsync = models.FsyncFull
+	dir, parallel := runPipeline(t, convertOptions{})
+
+	require.Greater(t, len(parallel.Combined.Parts), 4)
+	assert.Equal(t, sequential.Combined.Parts, parallel.Combined.Parts, "same parts in the same order")
+	assert.Equal(t, sequential.Combined.Files, parallel.Combined.Files)
+	for name, lr := range sequential.Lists {
+		assert.Equal(t, lr.Files, parallel.Lists[name].Files, name)
+	}
+	for _, part := range parallel.Combined.Parts {
+		data, err := os.ReadFile(filepath.Join(dir, part.File))
+		require.NoError(t, err)
+		assert.Equal(t, part.Bytes, int64(len(data)), part.File)
+		assert.Equal(t, artifact.Identifier(part.File, data), part.ID, part.File)
+	}
+}
+
+func TestPipelineWriteErrors(t *testing.T) {
+	withPipeline(t)
+	cfg.Output.MaxRulesPerFile = 10
+	cfg.Output.WriteWorkers = 4
+
+	// A directory in place of a part fails the build before the manifest
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "combined-part2.json"), 0755))
+	_, err := runBuild(context.Background(), convertOptions{OutputDir: dir, Combined: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "writing combined-part2.json")
+	assert.NoFileExists(t, filepath.Join(dir, "manifest.json"))
+	assert.FileExists(t, filepath.Join(dir, "combined-part3.json"), "other parts are still written")
+}
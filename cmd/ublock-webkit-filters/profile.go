@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/spf13/viper"
+)
+
+// profile is the [profiles.<name>] table applied over the config, set by
+// --profile
+var profile string
+
+// applyProfile merges a [profiles.<name>] table over the top-level
+// settings, after included fragments. Its [[lists]] entries are appended
+// like those of fragments, and enabled_lists names the only lists the
+// profile builds.
+func applyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	sub := viper.Sub("profiles." + name)
+	if sub == nil {
+		return fmt.Errorf("unknown profile %q (have %v)", name, profileNames())
+	}
+
+	settings := sub.AllSettings()
+	enabled, only := settings["enabled_lists"]
+	delete(settings, "enabled_lists")
+	if err := mergeSettings(settings); err != nil {
+		return fmt.Errorf("profile %s: %w", name, err)
+	}
+	if !only {
+		return nil
+	}
+
+	items, _ := enabled.([]any)
+	var names []string
+	for _, item := range items {
+		names = append(names, fmt.Sprint(item))
+	}
+	lists, _ := viper.Get("lists").([]any)
+	var found []string
+	for _, item := range lists {
+		list, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		listName, _ := list["name"].(string)
+		list["enabled"] = slices.Contains(names, listName)
+		found = append(found, listName)
+	}
+	viper.Set("lists", lists)
+	for _, n := range names {
+		if !slices.Contains(found, n) {
+			return fmt.Errorf("profile %s: enabled_lists names unknown list %q", name, n)
+		}
+	}
+	return nil
+}
+
+// profileNames returns the profiles of the config file, sorted
+func profileNames() []string {
+	return sortedKeys(viper.GetStringMap("profiles"))
+}
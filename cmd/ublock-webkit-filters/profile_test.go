@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+[output]
+max_rules_per_file = 50000
+
+[[lists]]
+name = "easylist"
+url = "https://example.com/easylist.txt"
+enabled = true
+
+[[lists]]
+name = "easyprivacy"
+url = "https://example.com/easyprivacy.txt"
+enabled = true
+
+[profiles.mobile]
+enabled_lists = ["easyprivacy", "extra"]
+
+[profiles.mobile.output]
+max_rules_per_file = 30000
+
+[[profiles.mobile.lists]]
+name = "extra"
+url = "https://example.com/extra.txt"
+`), 0644))
+
+	load := func(name string) (models.Config, error) {
+		viper.Reset()
+		viper.SetConfigFile(path)
+		require.NoError(t, viper.ReadInConfig())
+		var c models.Config
+		if err := applyProfile(name); err != nil {
+			return c, err
+		}
+		require.NoError(t, viper.Unmarshal(&c))
+		return c, nil
+	}
+	defer viper.Reset()
+
+	c, err := load("")
+	require.NoError(t, err)
+	assert.Equal(t, 50000, c.Output.MaxRulesPerFile)
+	assert.Len(t, c.EnabledLists(), 2)
+
+	c, err = load("mobile")
+	require.NoError(t, err)
+	assert.Equal(t, 30000, c.Output.MaxRulesPerFile)
+	var enabled []string
+	for _, list := range c.EnabledLists() {
+		enabled = append(enabled, list.Name)
+	}
+	assert.Equal(t, []string{"easyprivacy", "extra"}, enabled)
+
+	_, err = load("desktop")
+	assert.ErrorContains(t, err, `unknown profile "desktop" (have [mobile])`)
+}
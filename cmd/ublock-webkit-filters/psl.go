@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bnema/ublock-webkit-filters/internal/fetcher"
+	"github.com/bnema/ublock-webkit-filters/internal/psl"
+	"github.com/spf13/cobra"
+)
+
+var updatePSLCmd = &cobra.Command{
+	Use:   "update-psl",
+	Short: "Download a fresh copy of the Public Suffix List",
+	RunE:  runUpdatePSL,
+}
+
+func init() {
+	rootCmd.AddCommand(updatePSLCmd)
+}
+
+func runUpdatePSL(cmd *cobra.Command, args []string) error {
+	if cfg.PSL.File == "" {
+		return fmt.Errorf("psl.file is not configured")
+	}
+
+	f := fetcher.New(cfg.HTTP)
+	data, err := f.Fetch(context.Background(), cfg.PSL.URL)
+	if err != nil {
+		return fmt.Errorf("fetching public suffix list: %w", err)
+	}
+
+	// Validate before replacing the current copy
+	list, err := psl.Parse(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("parsing public suffix list: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.PSL.File), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(cfg.PSL.File, data, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated %s (%d suffixes)\n", cfg.PSL.File, list.Len())
+	return nil
+}
+
+// loadPublicSuffixList activates the refreshed list if one exists on disk
+func loadPublicSuffixList() error {
+	if cfg.PSL.File == "" {
+		return nil
+	}
+	if _, err := os.Stat(cfg.PSL.File); os.IsNotExist(err) {
+		return nil
+	}
+
+	list, err := psl.LoadFile(cfg.PSL.File)
+	if err != nil {
+		return fmt.Errorf("loading public suffix list %s: %w", cfg.PSL.File, err)
+	}
+	psl.SetDefault(list)
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bnema/ublock-webkit-filters/internal/publish"
+	"github.com/spf13/cobra"
+)
+
+var publishCmd = &cobra.Command{
+	Use:   "publish",
+	Short: "Upload generated filters to S3, GCS or WebDAV",
+	RunE:  runPublish,
+}
+
+func init() {
+	publishCmd.Flags().StringP("output", "o", defaultDirs.Output, "output directory to upload")
+	rootCmd.AddCommand(publishCmd)
+}
+
+func runPublish(cmd *cobra.Command, args []string) error {
+	outputDir, _ := cmd.Flags().GetString("output")
+	return publishOutput(context.Background(), outputDir)
+}
+
+// publishOutput uploads the output directory using the [publish] config
+func publishOutput(ctx context.Context, outputDir string) error {
+	p, err := publish.New(cfg.Publish)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nPublishing %s to %s...\n", outputDir, cfg.Publish.Backend)
+	uploaded, err := p.Publish(ctx, outputDir)
+	for _, key := range uploaded {
+		fmt.Printf("  Uploaded %s\n", key)
+	}
+	if err != nil {
+		return fmt.Errorf("publish failed: %w", err)
+	}
+
+	fmt.Printf("  Published %d files\n", len(uploaded))
+	return nil
+}
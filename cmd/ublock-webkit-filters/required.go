@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// requiredLists returns the enabled lists a build can't go without: those
+// marked required and those named by --require
+func requiredLists(enabled []models.FilterList, require []string) ([]string, error) {
+	var names []string
+	for _, list := range enabled {
+		if list.Required || slices.Contains(require, list.Name) {
+			names = append(names, list.Name)
+		}
+	}
+	for _, name := range require {
+		if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("--require: %q is not an enabled list", name)
+		}
+	}
+	return names, nil
+}
+
+// checkRequired fails when a required list failed. Optional lists that
+// failed are left out of the outputs with a warning.
+func checkRequired(required []string, failures map[string]string) error {
+	var errs []error
+	var optional []string
+	for _, name := range sortedKeys(failures) {
+		if slices.Contains(required, name) {
+			errs = append(errs, fmt.Errorf("required list %s: %s", name, failures[name]))
+		} else {
+			optional = append(optional, name)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if len(optional) > 0 {
+		fmt.Printf("\nWARNING: continuing without %d optional list(s) that failed: %s\n", len(optional), strings.Join(optional, ", "))
+	}
+	return nil
+}
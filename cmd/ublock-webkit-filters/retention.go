@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/artifact"
+	"github.com/spf13/cobra"
+)
+
+// versionsDir keeps a copy of every build with output.versioned, one
+// directory per build ID. Hidden, so checksums and publishing skip it.
+const versionsDir = ".versions"
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete versioned builds and archived lists past the [retention] limits",
+	RunE:  runGC,
+}
+
+func init() {
+	gcCmd.Flags().String("dir", defaultDirs.Output, "output directory to clean up")
+	gcCmd.Flags().Bool("dry-run", false, "list what would be deleted without deleting it")
+	rootCmd.AddCommand(gcCmd)
+}
+
+func runGC(cmd *cobra.Command, args []string) error {
+	outputDir, _ := cmd.Flags().GetString("dir")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	if !cfg.Retention.Enabled() {
+		return errors.New("no retention limits: set retention.keep_builds or retention.keep_days")
+	}
+	_, err := collectGarbage(outputDir, dryRun, os.Stdout)
+	return err
+}
+
+// saveVersion copies the outputs of the build just written into
+// versionsDir. Archived lists are content-addressed and shared by every
+// version, so they stay where the manifests point.
+func saveVersion(outputDir, buildID string) error {
+	files, err := artifact.List(outputDir)
+	if err != nil {
+		return err
+	}
+	top, err := os.ReadDir(outputDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range top {
+		if e.Type().IsRegular() && (e.Name() == artifact.ChecksumsFile || artifact.IsSignature(e.Name())) {
+			files = append(files, e.Name())
+		}
+	}
+
+	dst := filepath.Join(outputDir, versionsDir, buildID)
+	for _, name := range files {
+		if cfg.Archive.Dir != "" && strings.HasPrefix(name, filepath.ToSlash(cfg.Archive.Dir)+"/") {
+			continue
+		}
+		if err := copyFile(filepath.Join(outputDir, name), filepath.Join(dst, name)); err != nil {
+			return fmt.Errorf("saving version %s: %w", buildID, err)
+		}
+	}
+	return nil
+}
+
+// copyFile copies src to dst. Versions are not hard linked: builds
+// rewrite outputs in place, which would change every linked version too.
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// gcPlan lists what the retention limits delete, as paths
+type gcPlan struct {
+	Versions  []string
+	Snapshots []string
+}
+
+// planGC decides what the retention limits delete. A versioned build is
+// kept while it is one of the keep_builds most recent or younger than
+// keep_days; directories not named by a build ID are left alone. An
+// archived list is kept while the current manifest, a kept version's
+// manifest or a cached list refers to its content, or it is younger than
+// keep_days.
+func planGC(outputDir string, now time.Time) (gcPlan, error) {
+	var plan gcPlan
+	maxAge := time.Duration(cfg.Retention.KeepDays) * 24 * time.Hour
+
+	manifests := []string{filepath.Join(outputDir, "manifest.json")}
+	entries, err := os.ReadDir(filepath.Join(outputDir, versionsDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return plan, err
+	}
+	// Build IDs start with their UTC start time, newest last
+	var builds []string
+	for _, e := range entries {
+		if _, ok := buildTime(e.Name()); e.IsDir() && ok {
+			builds = append(builds, e.Name())
+		}
+	}
+	slices.Sort(builds)
+	slices.Reverse(builds)
+	for i, id := range builds {
+		started, _ := buildTime(id)
+		dir := filepath.Join(outputDir, versionsDir, id)
+		if i < cfg.Retention.KeepBuilds || (maxAge > 0 && now.Sub(started) < maxAge) {
+			manifests = append(manifests, filepath.Join(dir, "manifest.json"))
+			continue
+		}
+		plan.Versions = append(plan.Versions, dir)
+	}
+
+	used := make(map[string]bool)
+	for _, path := range manifests {
+		for _, hash := range manifestContent(path) {
+			used[hash+snapshotExt] = true
+		}
+	}
+	for _, list := range cfg.Lists {
+		if lc, err := readListCache(list.Name); err == nil && lc.ContentHash != "" {
+			used[lc.ContentHash+snapshotExt] = true
+		}
+	}
+
+	for _, dir := range []string{filepath.Join(outputDir, cfg.Archive.Dir), archiveStore()} {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return plan, err
+		}
+		for _, e := range entries {
+			if !e.Type().IsRegular() || !strings.HasSuffix(e.Name(), snapshotExt) || used[e.Name()] {
+				continue
+			}
+			if info, err := e.Info(); err != nil || (maxAge > 0 && now.Sub(info.ModTime()) < maxAge) {
+				continue
+			}
+			plan.Snapshots = append(plan.Snapshots, filepath.Join(dir, e.Name()))
+		}
+	}
+	return plan, nil
+}
+
+// buildTime returns the start time a build ID carries
+func buildTime(id string) (time.Time, bool) {
+	stamp, _, _ := strings.Cut(id, "-")
+	t, err := time.Parse("20060102T150405Z", stamp)
+	return t, err == nil
+}
+
+// manifestContent returns the content hashes of the lists a manifest was
+// built from, none if it can't be read
+func manifestContent(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil
+	}
+	var hashes []string
+	for _, lr := range manifest.Lists {
+		if lr.Fetch != nil && lr.Fetch.ContentHash != "" {
+			hashes = append(hashes, lr.Fetch.ContentHash)
+		}
+	}
+	return hashes
+}
+
+// collectGarbage deletes what the retention limits no longer keep, or only
+// lists it with dryRun, and returns the plan
+func collectGarbage(outputDir string, dryRun bool, w io.Writer) (gcPlan, error) {
+	plan, err := planGC(outputDir, time.Now())
+	if err != nil {
+		return plan, err
+	}
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+
+	var errs []error
+	for _, dir := range plan.Versions {
+		if !dryRun {
+			if err := os.RemoveAll(dir); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		fmt.Fprintf(w, "%s build %s\n", verb, dir)
+	}
+	for _, path := range plan.Snapshots {
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		fmt.Fprintf(w, "%s archived list %s\n", verb, path)
+	}
+	if len(plan.Versions)+len(plan.Snapshots) == 0 {
+		fmt.Fprintln(w, "Nothing past the retention limits")
+	}
+	return plan, errors.Join(errs...)
+}
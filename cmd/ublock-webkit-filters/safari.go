@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bnema/ublock-webkit-filters/internal/converter"
+)
+
+// SafariExtension assigns a content blocker file to an app extension
+type SafariExtension struct {
+	BundleID string `json:"bundle_id"`
+	File     string `json:"file"`
+	Rules    int    `json:"rules"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// SafariMapping tells an app with several content blocker extensions which
+// file each extension loads
+type SafariMapping struct {
+	MaxRules   int               `json:"max_rules"`
+	Extensions []SafariExtension `json:"extensions"`
+	Unassigned []string          `json:"unassigned,omitempty"` // files left without an extension
+}
+
+// safariMaxRules returns the rules allowed per extension
+func safariMaxRules() int {
+	if cfg.Safari.MaxRules > 0 {
+		return cfg.Safari.MaxRules
+	}
+	return converter.SafariExtensionMaxRules
+}
+
+// mapSafariExtensions assigns files to the configured bundle identifiers in
+// order. Without identifiers every file gets a numbered placeholder.
+func mapSafariExtensions(bundles, files []string, parts []PartInfo) SafariMapping {
+	byFile := make(map[string]PartInfo, len(parts))
+	for _, p := range parts {
+		byFile[p.File] = p
+	}
+
+	mapping := SafariMapping{MaxRules: safariMaxRules(), Extensions: []SafariExtension{}}
+	for i, file := range files {
+		bundle := fmt.Sprintf("blocker%d", i+1)
+		if len(bundles) > 0 {
+			if i >= len(bundles) {
+				mapping.Unassigned = append(mapping.Unassigned, file)
+				continue
+			}
+			bundle = bundles[i]
+		}
+		part := byFile[file]
+		mapping.Extensions = append(mapping.Extensions, SafariExtension{
+			BundleID: bundle,
+			File:     file,
+			Rules:    part.Rules,
+			Bytes:    part.Bytes,
+		})
+	}
+	return mapping
+}
+
+// problems returns the files no extension loads
+func (m SafariMapping) problems() []string {
+	if len(m.Unassigned) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("%d files have no Safari extension (%v), add bundle_ids or lower the rule count",
+		len(m.Unassigned), m.Unassigned)}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/schema"
+	"github.com/spf13/cobra"
+)
+
+// schemaDoc is a JSON output of the tool consumers can generate types for
+type schemaDoc struct {
+	Name  string
+	Title string
+	Value any
+}
+
+var schemaDocs = []schemaDoc{
+	{"rules", "WebKit content blocker rules", []models.WebKitRule{}},
+	{"manifest", "Build manifest (manifest.json)", Manifest{}},
+	{"summary", "Build summary (build-summary.json)", BuildSummary{}},
+	{"estimate", "Build estimate (estimate --output json)", estimate{}},
+	{"stats", "Build statistics (stats --output json)", buildStats{}},
+}
+
+var schemaCmd = &cobra.Command{
+	Use:       "schema [rules|manifest|summary|estimate|stats]",
+	Short:     "Print the JSON Schema of content blocker files, the manifest or build stats",
+	Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"rules", "manifest", "summary", "estimate", "stats"},
+	RunE:      runSchema,
+}
+
+func init() {
+	schemaCmd.Flags().String("dir", "", "write <name>.schema.json files to this directory instead of printing")
+	rootCmd.AddCommand(schemaCmd)
+}
+
+func runSchema(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+
+	schemas := make(map[string]*schema.Schema)
+	for _, doc := range schemaDocs {
+		if len(args) == 0 || args[0] == doc.Name {
+			schemas[doc.Name] = schema.For(doc.Value, doc.Title)
+		}
+	}
+
+	if dir != "" {
+		for _, doc := range schemaDocs {
+			s, ok := schemas[doc.Name]
+			if !ok {
+				continue
+			}
+			name := doc.Name + ".schema.json"
+			if err := writeJSON(dir, name, s); err != nil {
+				return err
+			}
+			fmt.Printf("Wrote %s\n", filepath.Join(dir, name))
+		}
+		return nil
+	}
+
+	var v any = schemas
+	if len(args) == 1 {
+		v = schemas[args[0]]
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", data)
+	return nil
+}
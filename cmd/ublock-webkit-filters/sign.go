@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/artifact"
+	"github.com/bnema/ublock-webkit-filters/internal/signing"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify signatures and checksums of generated filters",
+	RunE:  runVerify,
+}
+
+func init() {
+	verifyCmd.Flags().StringP("output", "o", defaultDirs.Output, "output directory to verify")
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// signedFiles are the artifacts that carry detached signatures; the
+// checksum listing transitively covers every other file
+var signedFiles = []string{artifact.ChecksumsFile, "manifest.json"}
+
+// signOutput signs the checksum listing and manifest in outputDir
+func signOutput(ctx context.Context, outputDir string) error {
+	signer, err := signing.New(cfg.Signing)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nSigning with %s...\n", cfg.Signing.Tool)
+	for _, name := range signedFiles {
+		path := filepath.Join(outputDir, name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		if err := signer.Sign(ctx, path); err != nil {
+			return fmt.Errorf("signing %s: %w", name, err)
+		}
+		fmt.Printf("  Signed %s\n", name)
+	}
+	return nil
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	outputDir, _ := cmd.Flags().GetString("output")
+	ctx := context.Background()
+
+	signer, err := signing.New(cfg.Signing)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range signedFiles {
+		path := filepath.Join(outputDir, name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if name == artifact.ChecksumsFile {
+				return fmt.Errorf("%s not found", path)
+			}
+			continue
+		}
+		if err := signer.Verify(ctx, path); err != nil {
+			return fmt.Errorf("signature check failed for %s: %w", name, err)
+		}
+		fmt.Printf("Signature OK: %s\n", name)
+	}
+
+	bad, err := artifact.VerifyChecksums(outputDir)
+	if err != nil {
+		return err
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("checksum mismatch: %s", strings.Join(bad, ", "))
+	}
+
+	fmt.Println("Checksums OK")
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/skipdb"
+)
+
+// skipDBPath is where skip patterns are remembered between builds
+func skipDBPath() string {
+	return filepath.Join(cfg.Cache.Dir, "skips.db.json")
+}
+
+// reportNewSkips records the skip patterns of a build per list and prints
+// those no earlier build had, e.g. a scriptlet a list just started using.
+// The database is only written when save is set.
+func reportNewSkips(lists map[string]models.SkipPatterns, save bool) ([]string, error) {
+	db, err := skipdb.Load(skipDBPath())
+	if err != nil {
+		return nil, err
+	}
+	first := len(db.Patterns) == 0
+	added := db.Update(time.Now().UTC(), lists)
+
+	switch {
+	case first && len(added) > 0:
+		// Everything is new on the first run, nothing worth listing
+		fmt.Printf("\nSkip database initialized with %d patterns\n", len(added))
+		added = nil
+	case len(added) > 0:
+		fmt.Println("\nNew skip patterns since the last build:")
+		for _, key := range added {
+			entry := db.Patterns[key]
+			fmt.Printf("  %-40s %6d  %v\n", key, entry.Count, entry.Lists)
+			fmt.Printf("    e.g. %s\n", entry.Example)
+		}
+	}
+
+	if !save {
+		return added, nil
+	}
+	return added, db.Save(skipDBPath())
+}
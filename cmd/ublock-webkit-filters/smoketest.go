@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/smoketest"
+	"github.com/spf13/cobra"
+)
+
+var smokeTestCmd = &cobra.Command{
+	Use:   "smoke-test",
+	Short: "Load generated rules in WebKitGTK and check that known trackers are blocked",
+	Long: `Launches the WebKitGTK MiniBrowser with the generated rules as content filter,
+visits the pages from [smoke_test] through a local recording proxy and checks
+which hosts were actually contacted.`,
+	RunE: runSmokeTest,
+}
+
+func init() {
+	smokeTestCmd.Flags().Bool("verbose", false, "list every contacted host")
+	rootCmd.AddCommand(smokeTestCmd)
+}
+
+func runSmokeTest(cmd *cobra.Command, args []string) error {
+	verbose, _ := cmd.Flags().GetBool("verbose")
+
+	if len(cfg.SmokeTest.Pages) == 0 {
+		return fmt.Errorf("no [[smoke_test.pages]] configured")
+	}
+
+	fmt.Printf("Smoke testing %d pages with %s...\n", len(cfg.SmokeTest.Pages), cfg.SmokeTest.Browser)
+	results, err := smoketest.Run(context.Background(), cfg.SmokeTest)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		status := "PASS"
+		if !r.Passed() {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("\n  [%s] %s (%d hosts contacted)\n", status, r.URL, len(r.Requested))
+		if len(r.LeakedBlocked) > 0 {
+			fmt.Printf("    not blocked: %s\n", strings.Join(r.LeakedBlocked, ", "))
+		}
+		if len(r.MissingAllowed) > 0 {
+			fmt.Printf("    never loaded: %s\n", strings.Join(r.MissingAllowed, ", "))
+		}
+		if verbose {
+			for _, host := range r.Requested {
+				fmt.Printf("      - %s\n", host)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d pages failed", failed, len(results))
+	}
+	fmt.Println("\nAll pages passed")
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/converter"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// SourceMap tells host apps which list each rule of the combined outputs
+// came from, e.g. to show "blocked by EasyPrivacy" next to a request a
+// rule matched. Combined outputs keep the build order of lists, so the
+// ranges of a file follow it too.
+type SourceMap struct {
+	GeneratedAt string                             `json:"generated_at"`
+	Lists       []string                           `json:"lists"` // build order, the list of a range is a position in it
+	Files       map[string][]converter.SourceRange `json:"files"` // rule ranges per content blocker file, -1 for the allowlist and domain policy
+
+	index *converter.SourceIndex
+}
+
+// listSources are the rules a list adds to the combined outputs besides
+// its contribution
+type listSources struct {
+	generic, popups []models.WebKitRule
+	types           map[string][]models.WebKitRule
+}
+
+// newSourceMap indexes the rules of every contribution, read back from
+// disk for spilled lists, and the other rules of each list in extra, with
+// cosmetic exceptions applied as in the combined outputs
+func newSourceMap(contributions []converter.Contribution, extra []listSources, sp *spiller, exceptions []converter.CosmeticException) (*SourceMap, error) {
+	m := &SourceMap{
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Files:       make(map[string][]converter.SourceRange),
+		index:       converter.NewSourceIndex(),
+	}
+	for i, c := range contributions {
+		m.Lists = append(m.Lists, c.Name)
+		rules := c.Rules
+		if sp != nil && sp.runs[c.Name] != nil {
+			run, err := sp.neutralized(c.Name, exceptions)
+			if err != nil {
+				return nil, err
+			}
+			if rules, err = run.Read(); err != nil {
+				return nil, err
+			}
+		}
+		m.index.Add(i, rules)
+
+		generic := extra[i].generic
+		if len(exceptions) > 0 {
+			generic, _ = converter.NeutralizeCosmetic(generic, exceptions)
+		}
+		m.index.Add(i, generic)
+		m.index.Add(i, extra[i].popups)
+		for _, name := range cfg.Output.TypePartitions {
+			m.index.Add(i, extra[i].types[name])
+		}
+	}
+	return m, nil
+}
+
+// record maps the rules of a written content blocker file to their lists
+func (m *SourceMap) record(file string, rules []models.WebKitRule) {
+	if m == nil {
+		return
+	}
+	m.Files[file] = m.index.Ranges(rules)
+}
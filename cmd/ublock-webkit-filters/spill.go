@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bnema/ublock-webkit-filters/internal/converter"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/spill"
+)
+
+// sortShare is the fraction of memory.limit the external sort of spilled
+// rules holds at a time
+const sortShare = 4
+
+// spiller moves the rules of combined output contributions to disk once
+// they outgrow memory.limit, and merges them back one list at a time
+type spiller struct {
+	store   *spill.Store
+	limit   int64
+	held    int64                 // estimated bytes of rules still in memory
+	runs    map[string]*spill.Run // spilled rules by list
+	neutral map[string]*spill.Run // spilled rules with cosmetic exceptions applied
+}
+
+// newSpiller returns nil without memory.limit
+func newSpiller() (*spiller, error) {
+	limit, err := cfg.Memory.LimitBytes()
+	if err != nil || limit == 0 {
+		return nil, err
+	}
+	return &spiller{limit: limit, runs: make(map[string]*spill.Run), neutral: make(map[string]*spill.Run)}, nil
+}
+
+// close removes the spilled rules
+func (sp *spiller) close() {
+	if sp != nil && sp.store != nil {
+		sp.store.Close()
+	}
+}
+
+// spilled reports whether any rules are on disk
+func (sp *spiller) spilled() bool {
+	return sp != nil && len(sp.runs) > 0
+}
+
+// hold accounts for the rules a list contributed and spills every
+// contribution still in memory once the limit is exceeded. Tag
+// contributions share the rules and are spilled along. Spilled lists are
+// never held in memory again.
+func (sp *spiller) hold(rules []models.WebKitRule, contributions []converter.Contribution, tags map[string][]converter.Contribution) error {
+	if sp == nil {
+		return nil
+	}
+	sp.held += spill.Size(rules)
+	if sp.held <= sp.limit {
+		return nil
+	}
+
+	if sp.store == nil {
+		store, err := spill.New(cfg.Memory.SpillDir)
+		if err != nil {
+			return fmt.Errorf("spilling rules: %w", err)
+		}
+		sp.store = store
+	}
+	lists, size := 0, sp.held
+	for i, c := range contributions {
+		if len(c.Rules) == 0 {
+			continue
+		}
+		run, err := sp.store.Write(c.Rules)
+		if err != nil {
+			return fmt.Errorf("spilling rules of %s: %w", c.Name, err)
+		}
+		sp.runs[c.Name] = run
+		contributions[i].Rules = nil
+		lists++
+	}
+	for _, contribs := range tags {
+		for i := range contribs {
+			if sp.runs[contribs[i].Name] != nil {
+				contribs[i].Rules = nil
+			}
+		}
+	}
+	sp.held = 0
+	fmt.Printf("    Memory: spilled %d lists (%.1f MB) to disk\n", lists, float64(size)/(1<<20))
+	return nil
+}
+
+// merge allocates and deduplicates contributions like Allocate and
+// Deduplicate, reading spilled lists one at a time. Returns the rules, the
+// rules dropped per list and the rules of each list before the budget. The
+// combined rules are held in memory once merged: the limit only bounds the
+// per-list sets kept until then.
+func (sp *spiller) merge(contributions []converter.Contribution, exceptions []converter.CosmeticException, budget int) ([]models.WebKitRule, map[string]int, map[string]int, error) {
+	sizes := make([]int, len(contributions))
+	for i, c := range contributions {
+		sizes[i] = len(c.Rules)
+		if sp.runs[c.Name] == nil {
+			continue
+		}
+		run, err := sp.neutralized(c.Name, exceptions)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		sizes[i] = run.Rules
+	}
+	keep := converter.Quotas(contributions, sizes, budget)
+
+	var runs []*spill.Run
+	dropped := make(map[string]int)
+	counts := make(map[string]int, len(contributions))
+	for i, c := range contributions {
+		counts[c.Name] += sizes[i]
+		if lost := sizes[i] - keep[i]; lost > 0 {
+			dropped[c.Name] += lost
+		}
+
+		rules := c.Rules
+		if sp.runs[c.Name] != nil {
+			run := sp.neutral[c.Name]
+			if keep[i] == run.Rules {
+				runs = append(runs, run)
+				continue
+			}
+			var err error
+			if rules, err = run.Read(); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		run, err := sp.store.Write(converter.TruncateRules(rules, keep[i]))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	rules, err := sp.store.Deduplicate(runs, sp.limit/sortShare)
+	return rules, dropped, counts, err
+}
+
+// neutralized returns the spilled rules of a list with cosmetic exceptions
+// applied, writing them once
+func (sp *spiller) neutralized(name string, exceptions []converter.CosmeticException) (*spill.Run, error) {
+	if run := sp.neutral[name]; run != nil {
+		return run, nil
+	}
+	run := sp.runs[name]
+	if len(exceptions) > 0 {
+		rules, err := run.Read()
+		if err != nil {
+			return nil, err
+		}
+		rules, _ = converter.NeutralizeCosmetic(rules, exceptions)
+		if run, err = sp.store.Write(rules); err != nil {
+			return nil, err
+		}
+	}
+	sp.neutral[name] = run
+	return run, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// staleDir receives quarantined outputs. Hidden files are left out of
+// checksums, signing and publishing, so consumers never see them.
+const staleDir = ".stale"
+
+// previousOutputs returns the content blocker files the manifest of the
+// last build in dir names, by list, "" for combined outputs; nil without one
+func previousOutputs(dir string) map[string][]string {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		fmt.Printf("WARNING: previous manifest: %v\n", err)
+		return nil
+	}
+
+	files := make(map[string][]string)
+	for name, lr := range manifest.Lists {
+		files[name] = lr.Files
+	}
+	combined := []CombinedInfo{manifest.Combined}
+	if manifest.Popups != nil {
+		combined = append(combined, *manifest.Popups)
+	}
+	for _, info := range manifest.Types {
+		combined = append(combined, info)
+	}
+	for _, info := range manifest.Categories {
+		combined = append(combined, info)
+	}
+	for _, info := range combined {
+		files[""] = append(files[""], info.Files...)
+		files[""] = append(files[""], info.GenericFiles...)
+	}
+	return files
+}
+
+// cleanStale removes the previous outputs this build did not write again,
+// such as the files of a list since disabled or renamed, or moves them to
+// staleDir with the quarantine policy. Files of lists that failed this
+// build are kept, they are still the list's latest rules. It returns the
+// files it handled.
+func cleanStale(dir string, previous map[string][]string, written []PartInfo, failed map[string]string, policy string) []string {
+	if policy == "" || policy == models.StaleKeep {
+		return nil
+	}
+	current := make(map[string]bool, len(written))
+	for _, part := range written {
+		current[part.File] = true
+	}
+
+	var names []string
+	for owner, files := range previous {
+		if _, ok := failed[owner]; !ok || owner == "" {
+			names = append(names, files...)
+		}
+	}
+	slices.Sort(names)
+
+	var stale []string
+	for _, name := range slices.Compact(names) {
+		// Names come from a file in the output directory, trust none
+		// that leaves it or is not a plain file of it
+		if current[name] || !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		var err error
+		if policy == models.StaleQuarantine {
+			if err = os.MkdirAll(filepath.Join(dir, staleDir), 0755); err == nil {
+				err = os.Rename(path, filepath.Join(dir, staleDir, name))
+			}
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			fmt.Printf("WARNING: stale output %s: %v\n", name, err)
+			continue
+		}
+		stale = append(stale, name)
+	}
+	return stale
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show rule counts, skips and output sizes of the last build",
+	Long: `Reads the manifest and build summary of the last build in --dir and
+shows the rules and skipped filters of each list, how long each list took,
+and the rules, parts and bytes of the combined output.`,
+	RunE: runStats,
+}
+
+func init() {
+	statsCmd.Flags().String("dir", defaultDirs.Output, "output directory of the build")
+	addOutputFormatFlag(statsCmd)
+	rootCmd.AddCommand(statsCmd)
+}
+
+// buildStats are the statistics of a build, as the stats command reports
+// them
+type buildStats struct {
+	BuildID     string         `json:"build_id"`
+	GeneratedAt string         `json:"generated_at"`
+	DurationMS  int64          `json:"duration_ms,omitempty"` // without a build summary, unset
+	Lists       []listStats    `json:"lists"`
+	Combined    combinedStats  `json:"combined"`
+	Actions     map[string]int `json:"actions,omitempty"` // combined rules per action type
+}
+
+// listStats are the statistics of one list of a build
+type listStats struct {
+	Name       string `json:"name"`
+	Rules      int    `json:"rules"`
+	Skipped    int    `json:"skipped"` // filters that did not convert
+	Files      int    `json:"files"`
+	Cache      string `json:"cache,omitempty"`       // how the build obtained the list
+	DurationMS int64  `json:"duration_ms,omitempty"` // fetch, convert and write
+	Error      string `json:"error,omitempty"`
+}
+
+// combinedStats sum up the combined output of a build
+type combinedStats struct {
+	Rules     int   `json:"rules"`
+	Generic   int   `json:"generic,omitempty"`
+	Allowlist int   `json:"allowlist,omitempty"` // repeated in every part
+	Parts     int   `json:"parts"`
+	Bytes     int64 `json:"bytes"`
+}
+
+func runStats(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	dir, _ := cmd.Flags().GetString("dir")
+	stats, err := readBuildStats(dir)
+	if err != nil {
+		return err
+	}
+
+	if format != outputTable {
+		return printStructured(os.Stdout, format, stats)
+	}
+
+	fmt.Printf("Build %s, generated %s", stats.BuildID, stats.GeneratedAt)
+	if stats.DurationMS > 0 {
+		fmt.Printf(" in %s", time.Duration(stats.DurationMS)*time.Millisecond)
+	}
+	fmt.Printf("\n\n%-24s %9s %9s %6s %9s\n", "LIST", "RULES", "SKIPPED", "FILES", "TIME")
+	for _, ls := range stats.Lists {
+		if ls.Error != "" {
+			fmt.Printf("%-24s ERROR: %s\n", ls.Name, ls.Error)
+			continue
+		}
+		fmt.Printf("%-24s %9d %9d %6d %9s\n", ls.Name, ls.Rules, ls.Skipped, ls.Files, time.Duration(ls.DurationMS)*time.Millisecond)
+	}
+
+	c := stats.Combined
+	fmt.Printf("\nCombined: %d rules in %d parts, %d bytes", c.Rules, c.Parts, c.Bytes)
+	if c.Generic > 0 {
+		fmt.Printf(", %d generic cosmetic", c.Generic)
+	}
+	if c.Allowlist > 0 {
+		fmt.Printf(", %d allowlist rules per part", c.Allowlist)
+	}
+	fmt.Println()
+	if len(stats.Actions) > 0 {
+		var actions []string
+		for _, action := range sortedKeys(stats.Actions) {
+			actions = append(actions, fmt.Sprintf("%s %d", action, stats.Actions[action]))
+		}
+		fmt.Printf("Actions: %s\n", strings.Join(actions, ", "))
+	}
+	return nil
+}
+
+// readBuildStats sums up the manifest and build summary in dir
+func readBuildStats(dir string) (*buildStats, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("%w (run convert first or set --dir)", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("decoding manifest: %w", err)
+	}
+	summary := readSummaryFile(dir)
+	if summary != nil && summary.BuildID != manifest.BuildID {
+		summary = nil // a later failed build, not the one of the manifest
+	}
+
+	stats := &buildStats{
+		BuildID:     manifest.BuildID,
+		GeneratedAt: manifest.GeneratedAt,
+		Lists:       []listStats{},
+		Actions:     manifest.Combined.Actions,
+		Combined: combinedStats{
+			Rules:     manifest.Combined.TotalRules,
+			Generic:   manifest.Combined.GenericRules,
+			Allowlist: manifest.Combined.AllowlistRules,
+			Parts:     len(manifest.Combined.Parts),
+		},
+	}
+	for _, part := range manifest.Combined.Parts {
+		stats.Combined.Bytes += part.Bytes
+	}
+	if summary != nil {
+		stats.DurationMS = summary.DurationMS
+	}
+
+	for _, lr := range manifest.Lists {
+		ls := listStats{Name: lr.Name, Rules: lr.RulesCount, Skipped: lr.SkippedCount, Files: len(lr.Files)}
+		if summary != nil {
+			if s := summary.Lists[lr.Name]; s != nil {
+				ls.Cache, ls.Error = s.Cache, s.Error
+				for _, ms := range s.Stages {
+					ls.DurationMS += ms
+				}
+			}
+		}
+		stats.Lists = append(stats.Lists, ls)
+	}
+	sort.Slice(stats.Lists, func(i, j int) bool { return stats.Lists[i].Name < stats.Lists[j].Name })
+	return stats, nil
+}
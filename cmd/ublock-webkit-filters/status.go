@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// readSummaryFile loads the build summary of an output directory, nil if
+// no build wrote one
+func readSummaryFile(dir string) *BuildSummary {
+	data, err := os.ReadFile(filepath.Join(dir, SummaryFile))
+	if err != nil {
+		return nil
+	}
+	var summary BuildSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil
+	}
+	return &summary
+}
+
+// listInfo is the state of a configured list, as the list command reports
+// it: the version and fetch time of its last download, when the period of
+// its Expires header runs out, the rules of its last conversion and the
+// error of the last build
+type listInfo struct {
+	Name      string     `json:"name"`
+	URL       string     `json:"url"`
+	Enabled   bool       `json:"enabled"`
+	Required  bool       `json:"required,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+	Fetched   bool       `json:"fetched"`
+	Version   string     `json:"version,omitempty"`
+	FetchedAt *time.Time `json:"fetched_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // without an Expires header, unset
+	Stale     bool       `json:"stale"`
+	Rules     int        `json:"rules"`
+	LastError string     `json:"last_error,omitempty"`
+	LastBuild string     `json:"last_build,omitempty"` // build that reported LastError
+}
+
+// listState reads the cached state of a list
+func listState(list models.FilterList, summary *BuildSummary, now time.Time) listInfo {
+	info := listInfo{Name: list.Name, URL: list.URL, Enabled: list.Enabled, Required: list.Required, Tags: list.Tags}
+	if lc, err := readListCache(list.Name); err == nil {
+		header := lc.ParseStats.Header
+		fetched := lc.Fetch.FetchedAt
+		info.Fetched = true
+		info.Version = header.Version
+		info.FetchedAt = &fetched
+		if header.Expires > 0 {
+			due := fetched.Add(header.Expires)
+			info.ExpiresAt = &due
+			info.Stale = now.After(due)
+		}
+		info.Rules = lc.ruleCount()
+	}
+
+	if summary != nil {
+		if ls := summary.Lists[list.Name]; ls != nil && ls.Error != "" {
+			info.LastError, info.LastBuild = ls.Error, summary.BuildID
+		}
+	}
+	return info
+}
+
+// lines describes the state for people
+func (info listInfo) lines(now time.Time) []string {
+	var lines []string
+	if !info.Fetched {
+		lines = append(lines, "not fetched yet")
+	} else {
+		version := info.Version
+		if version == "" {
+			version = "unknown"
+		}
+		fetched := *info.FetchedAt
+		lines = append(lines, fmt.Sprintf("version %s, fetched %s (%s ago)",
+			version, fetched.UTC().Format(time.RFC3339), formatInterval(now.Sub(fetched))))
+
+		if due := info.ExpiresAt; due != nil {
+			if info.Stale {
+				lines = append(lines, fmt.Sprintf("stale: expired %s ago (expires every %s)",
+					formatInterval(now.Sub(*due)), formatInterval(due.Sub(fetched))))
+			} else {
+				lines = append(lines, fmt.Sprintf("current: expires in %s", formatInterval(due.Sub(now))))
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%d rules from the last conversion", info.Rules))
+	}
+
+	if info.LastError != "" {
+		lines = append(lines, fmt.Sprintf("last error (build %s): %s", info.LastBuild, info.LastError))
+	}
+	return lines
+}
+
+// listStatus describes the cached state of a list for people
+func listStatus(list models.FilterList, summary *BuildSummary, now time.Time) []string {
+	return listState(list, summary, now).lines(now)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// SummaryFile is the per-run build summary written next to the manifest
+const SummaryFile = "build-summary.json"
+
+// How a list's rules were obtained
+const (
+	cacheMiss        = "miss"         // downloaded and converted
+	cacheFresh       = "fresh"        // download still fresh, not fetched
+	cacheNotModified = "not-modified" // server answered 304
+	cacheUnchanged   = "unchanged"    // downloaded, same content hash
+)
+
+// stageTimes holds milliseconds spent per build stage
+type stageTimes map[string]int64
+
+// add charges the time elapsed since start to stage
+func (s stageTimes) add(stage string, start time.Time) {
+	s[stage] += time.Since(start).Milliseconds()
+}
+
+// BuildSummary describes one run so tooling can track build health over
+// time: stage durations per list, cache hits and errors
+type BuildSummary struct {
+	BuildID    string                  `json:"build_id"`
+	StartedAt  string                  `json:"started_at"`
+	DurationMS int64                   `json:"duration_ms"`
+	Success    bool                    `json:"success"`
+	Error      string                  `json:"error,omitempty"` // why the build failed
+	CacheHits  int                     `json:"cache_hits"`
+	Stages     stageTimes              `json:"stages_ms"` // combine
+	Lists      map[string]*ListSummary `json:"lists"`
+}
+
+// ListSummary is the part of a build spent on one list
+type ListSummary struct {
+	Cache  string     `json:"cache"`     // miss, fresh, not-modified, unchanged
+	Stages stageTimes `json:"stages_ms"` // fetch (until the response), convert (streamed download included), write
+	Rules  int        `json:"rules"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// newBuildID returns a sortable identifier unique to a run, e.g.
+// 20240901T060000Z-3f9a1c2e
+func newBuildID(started time.Time) string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return started.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b[:])
+}
+
+func newBuildSummary(result *buildResult) *BuildSummary {
+	return &BuildSummary{
+		BuildID:   result.ID,
+		StartedAt: result.Started.UTC().Format(time.RFC3339),
+		Stages:    make(stageTimes),
+		Lists:     make(map[string]*ListSummary),
+	}
+}
+
+// list returns the summary of a list, creating it
+func (s *BuildSummary) list(name string) *ListSummary {
+	ls, ok := s.Lists[name]
+	if !ok {
+		ls = &ListSummary{Cache: cacheMiss, Stages: make(stageTimes)}
+		s.Lists[name] = ls
+	}
+	return ls
+}
+
+// finish completes the summary from the build result
+func (s *BuildSummary) finish(result *buildResult, err error) {
+	s.DurationMS = time.Since(result.Started).Milliseconds()
+	s.Success = err == nil && len(result.Errors) == 0
+	if err != nil {
+		s.Error = err.Error()
+	}
+	s.CacheHits = 0
+	for name, ls := range s.Lists {
+		if ls.Cache != cacheMiss {
+			s.CacheHits++
+		}
+		ls.Rules = result.Lists[name].RulesCount
+		ls.Error = result.Errors[name]
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// systemPaths is the layout of distribution packages running a system-wide
+// refresh service: the config under /etc, everything the service writes
+// under /var/lib
+var systemPaths = appPaths{
+	Config: "/etc/ublock-webkit-filters/filter_lists.toml",
+	Cache:  "/var/lib/ublock-webkit-filters/cache",
+	Output: "/var/lib/ublock-webkit-filters/output",
+	PSL:    "/var/lib/ublock-webkit-filters/public_suffix_list.dat",
+}
+
+// systemFlag is set by --system
+var systemFlag bool
+
+// useSystemLayout makes systemPaths the defaults. Output directory flags
+// still at their default move along, those given on the command line keep
+// their value.
+func useSystemLayout() {
+	previous := defaultDirs.Output
+	defaultDirs = systemPaths
+	for _, cmd := range rootCmd.Commands() {
+		for _, name := range []string{"output", "dir"} {
+			f := cmd.Flags().Lookup(name)
+			if f == nil || f.Changed || f.DefValue != previous {
+				continue
+			}
+			_ = f.Value.Set(systemPaths.Output)
+			f.DefValue = systemPaths.Output
+		}
+	}
+}
+
+// checkSystemConfig runs before every command with --system. Hooks,
+// compile and smoke test commands of the config run as the service user,
+// so a config others than its owner can modify is refused.
+func checkSystemConfig(cmd *cobra.Command, args []string) error {
+	if !systemFlag {
+		return nil
+	}
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s is writable by group or others (mode %04o): run chmod go-w on it", path, info.Mode().Perm())
+	}
+	return nil
+}
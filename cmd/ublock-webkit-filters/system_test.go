@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemLayout(t *testing.T) {
+	savedDirs := defaultDirs
+	gcDir, listDir := gcCmd.Flags().Lookup("dir"), listCmd.Flags().Lookup("dir")
+	savedGC, savedList := *gcDir, *listDir
+	defer func() {
+		defaultDirs = savedDirs
+		*gcDir, *listDir = savedGC, savedList
+		_ = gcDir.Value.Set(savedGC.DefValue)
+		_ = listDir.Value.Set(savedList.DefValue)
+	}()
+
+	// Flags given on the command line keep their value
+	require.NoError(t, listCmd.Flags().Set("dir", "/srv/filters"))
+	useSystemLayout()
+	assert.Equal(t, systemPaths, defaultDirs)
+	assert.Equal(t, systemPaths.Output, gcDir.Value.String())
+	assert.Equal(t, "/srv/filters", listDir.Value.String())
+
+	systemFlag = true
+	defer func() { systemFlag = false }()
+	path := filepath.Join(t.TempDir(), "filter_lists.toml")
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+	viper.Reset()
+	viper.SetConfigFile(path)
+	defer viper.Reset()
+	assert.NoError(t, checkSystemConfig(rootCmd, nil))
+
+	require.NoError(t, os.Chmod(path, 0666))
+	assert.ErrorContains(t, checkSystemConfig(rootCmd, nil), "writable by group or others")
+}
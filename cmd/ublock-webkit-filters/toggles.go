@@ -0,0 +1,118 @@
+package main
+
+import (
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// Kinds of toggleable outputs
+const (
+	toggleList     = "list"
+	toggleCategory = "category"
+	togglePopups   = "popups"
+	toggleType     = "type"
+)
+
+// typeTitles name the type partitions in toggles
+var typeTitles = map[string]string{
+	models.PartitionScripts: "Script blocking",
+	models.PartitionImages:  "Image blocking",
+	models.PartitionXHR:     "XHR and fetch blocking",
+}
+
+// Toggle describes an output a host app can let users switch on and off,
+// so a settings page can be rendered from the manifest alone
+type Toggle struct {
+	ID          string   `json:"id"`   // list name, category tag, "popups" or type partition
+	Kind        string   `json:"kind"` // list, category, popups, type
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Category    string   `json:"category,omitempty"` // first tag of a list
+	DefaultOn   bool     `json:"default_on"`
+	Rules       int      `json:"rules"` // across Files
+	Files       []string `json:"files"` // content blocker files to load when on
+}
+
+// buildToggles describes the per-list outputs, then the per-category, popup
+// and type partition combined outputs, in configuration order
+func buildToggles(lists []models.FilterList, results map[string]ListResult, categories map[string]CombinedInfo, popups *CombinedInfo, types map[string]CombinedInfo, parts []PartInfo) []Toggle {
+	rules := make(map[string]int, len(parts))
+	for _, part := range parts {
+		rules[part.File] = part.Rules
+	}
+	count := func(files []string) int {
+		n := 0
+		for _, f := range files {
+			n += rules[f]
+		}
+		return n
+	}
+
+	var toggles []Toggle
+	for _, list := range lists {
+		lr, ok := results[list.Name]
+		if !ok || len(lr.Files) == 0 {
+			continue
+		}
+		t := Toggle{
+			ID:          list.Name,
+			Kind:        toggleList,
+			Title:       list.Title,
+			Description: list.Description,
+			DefaultOn:   !list.DefaultOff,
+			Rules:       count(lr.Files),
+			Files:       lr.Files,
+		}
+		if t.Title == "" {
+			t.Title = list.Name
+		}
+		if len(list.Tags) > 0 {
+			t.Category = list.Tags[0]
+		}
+		toggles = append(toggles, t)
+	}
+
+	for _, tag := range sortedKeys(categories) {
+		info := categories[tag]
+		meta := cfg.Categories[tag]
+		t := Toggle{
+			ID:          tag,
+			Kind:        toggleCategory,
+			Title:       meta.Title,
+			Description: meta.Description,
+			DefaultOn:   !meta.DefaultOff,
+			Files:       append(append([]string(nil), info.Files...), info.GenericFiles...),
+		}
+		t.Rules = count(t.Files)
+		if t.Title == "" {
+			t.Title = tag
+		}
+		toggles = append(toggles, t)
+	}
+
+	if popups != nil {
+		toggles = append(toggles, Toggle{
+			ID:        togglePopups,
+			Kind:      togglePopups,
+			Title:     "Popups",
+			DefaultOn: true,
+			Rules:     count(popups.Files),
+			Files:     popups.Files,
+		})
+	}
+
+	for _, name := range cfg.Output.TypePartitions {
+		info, ok := types[name]
+		if !ok {
+			continue
+		}
+		toggles = append(toggles, Toggle{
+			ID:        name,
+			Kind:      toggleType,
+			Title:     typeTitles[name],
+			DefaultOn: true,
+			Rules:     count(info.Files),
+			Files:     info.Files,
+		})
+	}
+	return toggles
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/converter"
+	"github.com/bnema/ublock-webkit-filters/internal/fetcher"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/spf13/cobra"
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Rebuild outputs, re-converting only lists that changed",
+	Long: `Like convert, but lists whose cached download is still fresh (Cache-Control,
+Expires, update_interval or http.min_refetch), that the server reports as
+unmodified (ETag, Last-Modified) or whose content hash is unchanged are not
+converted again. Combined outputs are regenerated from the cached per-list
+rules. --force asks the servers again regardless of freshness.`,
+	RunE: runUpdate,
+}
+
+func init() {
+	addConvertFlags(updateCmd)
+	updateCmd.Flags().Bool("force", false, "check every list upstream, ignoring freshness and http.min_refetch")
+	rootCmd.AddCommand(updateCmd)
+}
+
+func runUpdate(cmd *cobra.Command, args []string) error {
+	opts := convertOptionsFromFlags(cmd)
+	opts.Update = true
+	opts.Force, _ = cmd.Flags().GetBool("force")
+	_, err := runBuild(context.Background(), opts)
+	return err
+}
+
+// listCache is the conversion output of one list, kept between builds in
+// the cache directory
+type listCache struct {
+	Key                string                         `json:"key"` // settings the rules were converted with
+	Fetch              fetcher.Info                   `json:"fetch"`
+	ContentHash        string                         `json:"content_hash"`
+	Format             string                         `json:"format,omitempty"` // detected or configured list syntax
+	ParseStats         parser.Stats                   `json:"parse_stats"`
+	ConvertStats       converter.Stats                `json:"convert_stats"`
+	Rules              []models.WebKitRule            `json:"rules"`
+	Generic            []models.WebKitRule            `json:"generic,omitempty"`
+	Popups             []models.WebKitRule            `json:"popups,omitempty"`
+	Types              map[string][]models.WebKitRule `json:"types,omitempty"` // by output.type_partitions
+	CosmeticExceptions []converter.CosmeticException  `json:"cosmetic_exceptions,omitempty"`
+	CSP                []converter.CSPSuggestion      `json:"csp,omitempty"`
+	Exceptions         []converter.ExceptionSource    `json:"exceptions,omitempty"` // with output.exceptions_export or interactions_report
+	BlockedHosts       []string                       `json:"blocked_hosts,omitempty"`
+	AllowedHosts       []string                       `json:"allowed_hosts,omitempty"`
+	FilterHashes       []uint64                       `json:"filter_hashes,omitempty"` // with overlap.dedup_filters
+}
+
+// newFetchInfo describes the fetch behind a list's rules
+func newFetchInfo(entry *listCache, d time.Duration) *FetchInfo {
+	return &FetchInfo{
+		Status:       entry.Fetch.Status,
+		ETag:         entry.Fetch.ETag,
+		LastModified: entry.Fetch.LastModified,
+		ContentHash:  entry.ContentHash,
+		Bytes:        entry.Fetch.Bytes,
+		DurationMS:   d.Milliseconds(),
+		FetchedAt:    entry.Fetch.FetchedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// dedupCacheKey extends a list's cache key with the content of the lists
+// before it, whose filters overlap.dedup_filters dropped from its rules
+func dedupCacheKey(key string, earlier []string) string {
+	sum := sha256.Sum256([]byte(key + "|" + strings.Join(earlier, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheVersion changes whenever the conversion or the cache layout does for
+// unchanged settings. The tool version alone misses such changes in
+// development builds, which are all "dev".
+const cacheVersion = 3
+
+// listCacheKey identifies the settings a list's cached rules depend on, so
+// changing them forces a new conversion
+func listCacheKey(list models.FilterList) string {
+	data, _ := json.Marshal(struct {
+		Cache      int
+		Version    string
+		Output     models.OutputConfig
+		List       models.FilterList
+		Transforms []models.Transform
+		Policy     models.PolicyConfig
+	}{cacheVersion, version, cfg.Output, list, cfg.TransformsFor(list.Name), cfg.Policy})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fresh reports whether the cached download can be used without asking the
+// server again
+func (lc *listCache) fresh(list models.FilterList, now time.Time) bool {
+	if lc.recent(now, cfg.HTTP.MinRefetch) {
+		return true
+	}
+	if !lc.Fetch.Expires.IsZero() {
+		return now.Before(lc.Fetch.Expires)
+	}
+	return list.UpdateInterval > 0 && now.Before(lc.Fetch.FetchedAt.Add(list.UpdateInterval))
+}
+
+// recent reports whether the list was fetched less than minRefetch ago,
+// servers are not asked again that soon whatever their caching headers say
+func (lc *listCache) recent(now time.Time, minRefetch time.Duration) bool {
+	return minRefetch > 0 && now.Before(lc.Fetch.FetchedAt.Add(minRefetch))
+}
+
+func listCachePath(name string) string {
+	return filepath.Join(cfg.Cache.Dir, name+".json")
+}
+
+// loadListCache returns the cached output of a list, nil if there is none
+// or it was made with other settings
+func loadListCache(name, key string) *listCache {
+	lc, err := readListCache(name)
+	if err != nil || lc.Key != key {
+		return nil
+	}
+	return lc
+}
+
+// readListCache returns the cached output of a list whatever its settings
+func readListCache(name string) (*listCache, error) {
+	data, err := os.ReadFile(listCachePath(name))
+	if err != nil {
+		return nil, err
+	}
+	var lc listCache
+	if err := json.Unmarshal(data, &lc); err != nil {
+		return nil, err
+	}
+	return &lc, nil
+}
+
+// ruleCount returns the rules of every output the list contributes to
+func (lc *listCache) ruleCount() int {
+	n := len(lc.Rules) + len(lc.Generic) + len(lc.Popups)
+	for _, rules := range lc.Types {
+		n += len(rules)
+	}
+	return n
+}
+
+// saveListCache stores the output of a list for later updates
+func saveListCache(name string, lc *listCache) error {
+	data, err := json.Marshal(lc)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.Cache.Dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(listCachePath(name), data, 0644)
+}
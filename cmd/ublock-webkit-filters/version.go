@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// version is the tool version, set at build time with
+// -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// reSemver matches the versions accepted for the semver scheme
+var reSemver = regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+(?:-[0-9A-Za-z.-]+)?$`)
+
+// validateVersionScheme checks output.version_scheme and output.version
+func validateVersionScheme(out models.OutputConfig) error {
+	switch out.VersionScheme {
+	case models.VersionSchemeDate, models.VersionSchemeContent:
+		return nil
+	case models.VersionSchemeSemver:
+		if !reSemver.MatchString(out.Version) {
+			return fmt.Errorf("output.version %q is not a semantic version (e.g. 1.4.0)", out.Version)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid output.version_scheme %q (want date, semver or content)", out.VersionScheme)
+}
+
+// manifestVersion returns the manifest version for the configured scheme.
+// The content scheme hashes the written combined files, so the version only
+// changes when the rules consumers download do.
+func manifestVersion(dir string, infos ...CombinedInfo) (string, error) {
+	switch cfg.Output.VersionScheme {
+	case models.VersionSchemeSemver:
+		return cfg.Output.Version, nil
+	case models.VersionSchemeContent:
+		return contentHash(dir, infos...)
+	}
+	return time.Now().Format("2006.01.02"), nil
+}
+
+// contentHash hashes the parts of the given outputs in filename order
+func contentHash(dir string, infos ...CombinedInfo) (string, error) {
+	var files []string
+	for _, info := range infos {
+		for _, part := range info.Parts {
+			files = append(files, part.File)
+		}
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, name := range files {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\n", name)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// configHash identifies the effective configuration (including merged
+// fragments and defaults) a build was made with
+func configHash() string {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/spf13/cobra"
+)
+
+var whyCmd = &cobra.Command{
+	Use:   "why [skip-reason]",
+	Short: "Explain why filters with a skip reason are not converted",
+	Long: `Explain a skip reason code from the build output, stats.json or metrics:
+the uBO feature concerned, whether WebKit could ever support it and the
+workarounds. Without a code, lists every known skip reason.`,
+	Args:         cobra.MaximumNArgs(1),
+	ValidArgs:    skipReasonCodes(),
+	RunE:         runWhy,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(whyCmd)
+}
+
+// skipReasonCodes returns the codes of every skip reason
+func skipReasonCodes() []string {
+	var codes []string
+	for _, r := range models.SkipReasons() {
+		codes = append(codes, string(r))
+	}
+	return codes
+}
+
+// supportText spells out whether WebKit could ever support a skip reason
+var supportText = map[models.Support]string{
+	models.SupportNever:    "no, this is outside what content blockers can do",
+	models.SupportPossible: "possibly, with a newer WebKit or converter",
+	models.SupportInput:    "not applicable, the filter or rule itself is invalid",
+}
+
+func runWhy(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		fmt.Println("Skip reasons (run \"why <reason>\" for details):")
+		for _, r := range models.SkipReasons() {
+			fmt.Printf("  %-24s %s\n", r, r.Description())
+		}
+		return nil
+	}
+
+	reason := models.SkipReason(args[0])
+	doc, ok := reason.Doc()
+	if !ok {
+		return fmt.Errorf("unknown skip reason %q, run \"why\" to list them", args[0])
+	}
+
+	fmt.Printf("%s: %s\n\n", reason, reason.Description())
+	fmt.Printf("Feature:  %s\n", doc.Feature)
+	fmt.Printf("Support:  %s\n\n", supportText[doc.Support])
+	fmt.Println(doc.Explanation)
+	if len(doc.Workarounds) > 0 {
+		fmt.Println("\nWorkarounds:")
+		for _, w := range doc.Workarounds {
+			fmt.Printf("  - %s\n", w)
+		}
+	}
+	return nil
+}
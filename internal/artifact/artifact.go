@@ -0,0 +1,133 @@
+package artifact
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChecksumsFile is the sha256sum-compatible checksum listing
+const ChecksumsFile = "checksums.txt"
+
+// Signature file extensions, excluded from checksums since they sign them
+var signatureExts = []string{".minisig", ".sig"}
+
+// List returns sorted regular files below dir, relative to it, excluding
+// hidden files and directories, the checksum listing and signatures
+func List(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") || d.Name() == ChecksumsFile || IsSignature(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// IsSignature reports whether name is a detached signature file
+func IsSignature(name string) bool {
+	for _, ext := range signatureExts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteChecksums writes checksums.txt covering every artifact in dir
+func WriteChecksums(dir string) error {
+	files, err := List(dir)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, rel := range files {
+		sum, err := fileSHA256(filepath.Join(dir, rel))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "%s  %s\n", sum, rel)
+	}
+	return os.WriteFile(filepath.Join(dir, ChecksumsFile), buf.Bytes(), 0644)
+}
+
+// VerifyChecksums checks every entry of checksums.txt and returns the
+// files that are missing or do not match
+func VerifyChecksums(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ChecksumsFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var bad []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		expected, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			continue
+		}
+		sum, err := fileSHA256(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || sum != expected {
+			bad = append(bad, name)
+		}
+	}
+	return bad, scanner.Err()
+}
+
+// identifierNamespace is the UUID namespace of content blocker identifiers
+var identifierNamespace = [16]byte{
+	0x5f, 0x1c, 0x9e, 0x3a, 0x7b, 0x2d, 0x4c, 0x61,
+	0x9a, 0x0e, 0x83, 0xd4, 0x26, 0xb7, 0x5c, 0x18,
+}
+
+// Identifier returns a name-based (version 5) UUID for a content blocker
+// file, derived from its name and the sha256 of its content. It stays the
+// same across builds until the file changes, so host apps can use it as the
+// WebKitUserContentFilterStore identifier and only compile changed parts.
+func Identifier(name string, content []byte) string {
+	return IdentifierOfSum(name, sha256.Sum256(content))
+}
+
+// IdentifierOfSum is Identifier for content hashed while it was written
+func IdentifierOfSum(name string, sum [sha256.Size]byte) string {
+	h := sha1.New()
+	h.Write(identifierNamespace[:])
+	h.Write([]byte(name + ":" + hex.EncodeToString(sum[:])))
+
+	var u [16]byte
+	copy(u[:], h.Sum(nil))
+	u[6] = u[6]&0x0f | 0x50 // version 5
+	u[8] = u[8]&0x3f | 0x80 // RFC 9562 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+func fileSHA256(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
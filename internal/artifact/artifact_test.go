@@ -0,0 +1,41 @@
+package artifact
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksumsRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "combined.json"), []byte("[]"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "manifest.json.minisig"), []byte("sig"), 0644))
+
+	require.NoError(t, WriteChecksums(dir))
+
+	files, err := List(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"combined.json"}, files)
+
+	bad, err := VerifyChecksums(dir)
+	require.NoError(t, err)
+	assert.Empty(t, bad)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "combined.json"), []byte("[{}]"), 0644))
+	bad, err = VerifyChecksums(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"combined.json"}, bad)
+}
+
+func TestIdentifier(t *testing.T) {
+	id := Identifier("combined.json", []byte("[]"))
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+	assert.Equal(t, id, Identifier("combined.json", []byte("[]")))
+	assert.NotEqual(t, id, Identifier("combined-002.json", []byte("[]")))
+	assert.NotEqual(t, id, Identifier("combined.json", []byte("[{}]")))
+	assert.Equal(t, id, IdentifierOfSum("combined.json", sha256.Sum256([]byte("[]"))))
+}
@@ -0,0 +1,124 @@
+package assets
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultURL is uBlock Origin's asset manifest
+const DefaultURL = "https://raw.githubusercontent.com/gorhill/uBlock/master/assets/assets.json"
+
+// Asset is a filter list entry of uBO's assets.json
+type Asset struct {
+	Key         string
+	Title       string
+	Group       string // default, ads, privacy, malware, multipurpose, regions, ...
+	Lang        string
+	Off         bool // disabled by default in uBO
+	URLs        []string
+	UpdateAfter time.Duration
+	SupportURL  string
+}
+
+// PrimaryURL returns the preferred absolute download URL
+func (a Asset) PrimaryURL() string {
+	if len(a.URLs) == 0 {
+		return ""
+	}
+	return a.URLs[0]
+}
+
+// rawAsset mirrors the JSON layout; contentURL may be a string or an array
+type rawAsset struct {
+	Content     string          `json:"content"`
+	Group       string          `json:"group"`
+	Title       string          `json:"title"`
+	Lang        string          `json:"lang"`
+	Off         bool            `json:"off"`
+	ContentURL  json.RawMessage `json:"contentURL"`
+	CDNURLs     []string        `json:"cdnURLs"`
+	UpdateAfter float64         `json:"updateAfter"` // days
+	SupportURL  string          `json:"supportURL"`
+}
+
+// Parse decodes assets.json and returns the filter list assets sorted by
+// group and key. Relative URLs (bundled copies) are dropped.
+func Parse(data []byte) ([]Asset, error) {
+	var raw map[string]rawAsset
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing assets.json: %w", err)
+	}
+
+	var result []Asset
+	for key, r := range raw {
+		if r.Content != "filters" {
+			continue
+		}
+
+		var urls []string
+		for _, u := range append(contentURLs(r.ContentURL), r.CDNURLs...) {
+			if strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://") {
+				urls = appendUnique(urls, u)
+			}
+		}
+		if len(urls) == 0 {
+			continue
+		}
+
+		result = append(result, Asset{
+			Key:         key,
+			Title:       r.Title,
+			Group:       r.Group,
+			Lang:        r.Lang,
+			Off:         r.Off,
+			URLs:        urls,
+			UpdateAfter: time.Duration(r.UpdateAfter * float64(24*time.Hour)),
+			SupportURL:  r.SupportURL,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Group != result[j].Group {
+			return result[i].Group < result[j].Group
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
+
+// Find returns the asset that lists url among its download locations
+func Find(assets []Asset, url string) (Asset, bool) {
+	for _, a := range assets {
+		for _, u := range a.URLs {
+			if u == url {
+				return a, true
+			}
+		}
+	}
+	return Asset{}, false
+}
+
+func contentURLs(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}
+	}
+	var list []string
+	json.Unmarshal(raw, &list)
+	return list
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,109 @@
+package assets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const assetsJSON = `{
+	"assets.json": {
+		"content": "internal",
+		"contentURL": "https://raw.githubusercontent.com/gorhill/uBlock/master/assets/assets.json"
+	},
+	"ublock-filters": {
+		"content": "filters",
+		"group": "default",
+		"title": "uBlock filters – Ads",
+		"contentURL": [
+			"https://ublockorigin.github.io/uAssets/filters/filters.txt",
+			"assets/ublock/filters.min.txt"
+		],
+		"cdnURLs": [
+			"https://ublockorigin.github.io/uAssets/filters/filters.txt",
+			"https://cdn.jsdelivr.net/gh/uBlockOrigin/uAssetsCDN@main/filters/filters.min.txt"
+		],
+		"updateAfter": 1.5,
+		"supportURL": "https://github.com/uBlockOrigin/uAssets"
+	},
+	"easylist": {
+		"content": "filters",
+		"group": "ads",
+		"title": "EasyList",
+		"contentURL": "https://easylist.to/easylist/easylist.txt",
+		"updateAfter": 5
+	},
+	"DEU-0": {
+		"content": "filters",
+		"group": "regions",
+		"off": true,
+		"lang": "de",
+		"title": "DEU: EasyList Germany",
+		"contentURL": "http://easylist.to/easylistgermany/easylistgermany.txt"
+	},
+	"bundled-only": {
+		"content": "filters",
+		"group": "default",
+		"contentURL": "assets/thirdparties/bundled.txt"
+	}
+}`
+
+func TestParse(t *testing.T) {
+	assets, err := Parse([]byte(assetsJSON))
+	require.NoError(t, err)
+
+	// Filter lists only, by group then key, without bundled-only ones
+	var keys []string
+	for _, a := range assets {
+		keys = append(keys, a.Key)
+	}
+	assert.Equal(t, []string{"easylist", "ublock-filters", "DEU-0"}, keys)
+
+	// contentURL as a string
+	assert.Equal(t, Asset{
+		Key:         "easylist",
+		Title:       "EasyList",
+		Group:       "ads",
+		URLs:        []string{"https://easylist.to/easylist/easylist.txt"},
+		UpdateAfter: 5 * 24 * time.Hour,
+	}, assets[0])
+
+	// contentURL as an array, followed by the CDNs, relative URLs dropped
+	ubo := assets[1]
+	assert.Equal(t, []string{
+		"https://ublockorigin.github.io/uAssets/filters/filters.txt",
+		"https://cdn.jsdelivr.net/gh/uBlockOrigin/uAssetsCDN@main/filters/filters.min.txt",
+	}, ubo.URLs)
+	assert.Equal(t, "https://ublockorigin.github.io/uAssets/filters/filters.txt", ubo.PrimaryURL())
+	assert.Equal(t, 36*time.Hour, ubo.UpdateAfter)
+	assert.Equal(t, "https://github.com/uBlockOrigin/uAssets", ubo.SupportURL)
+
+	assert.True(t, assets[2].Off)
+	assert.Equal(t, "de", assets[2].Lang)
+	assert.Empty(t, Asset{}.PrimaryURL())
+
+	_, err = Parse([]byte(`["not", "an", "object"]`))
+	assert.ErrorContains(t, err, "parsing assets.json")
+}
+
+func TestFind(t *testing.T) {
+	assets, err := Parse([]byte(assetsJSON))
+	require.NoError(t, err)
+
+	// Any download location matches, not only the primary one
+	a, ok := Find(assets, "https://cdn.jsdelivr.net/gh/uBlockOrigin/uAssetsCDN@main/filters/filters.min.txt")
+	assert.True(t, ok)
+	assert.Equal(t, "ublock-filters", a.Key)
+
+	a, ok = Find(assets, "http://easylist.to/easylistgermany/easylistgermany.txt")
+	assert.True(t, ok)
+	assert.Equal(t, "DEU-0", a.Key)
+
+	// Dropped relative URLs are not found
+	_, ok = Find(assets, "assets/ublock/filters.min.txt")
+	assert.False(t, ok)
+	_, ok = Find(assets, "https://example.com/list.txt")
+	assert.False(t, ok)
+}
@@ -0,0 +1,78 @@
+// Package compilecache remembers which content blocker files compiled
+// successfully, by the identifier derived from their name and content, so
+// refreshes only validate and compile the parts that changed
+package compilecache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Entry is a content blocker file that compiled
+type Entry struct {
+	File       string    `json:"file"`
+	Command    string    `json:"command,omitempty"` // compiler run on it, empty when only checked
+	CompiledAt time.Time `json:"compiled_at"`
+}
+
+// Cache maps content blocker identifiers to the files compiled under them
+type Cache struct {
+	Parts map[string]Entry `json:"parts"`
+}
+
+// Load reads a cache, returning an empty one if the file does not exist
+func Load(path string) (*Cache, error) {
+	c := &Cache{Parts: make(map[string]Entry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("decoding compile cache %s: %w", path, err)
+	}
+	if c.Parts == nil {
+		c.Parts = make(map[string]Entry)
+	}
+	return c, nil
+}
+
+// Save writes the cache, creating its directory if needed
+func (c *Cache) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Compiled reports whether the file with this identifier compiled before
+// with command
+func (c *Cache) Compiled(id, command string) bool {
+	e, ok := c.Parts[id]
+	return ok && e.Command == command
+}
+
+// Record remembers that file compiled under id with command
+func (c *Cache) Record(id, file, command string, at time.Time) {
+	c.Parts[id] = Entry{File: file, Command: command, CompiledAt: at}
+}
+
+// Keep forgets every identifier not in ids, such as those of files a later
+// build replaced
+func (c *Cache) Keep(ids map[string]bool) {
+	for id := range c.Parts {
+		if !ids[id] {
+			delete(c.Parts, id)
+		}
+	}
+}
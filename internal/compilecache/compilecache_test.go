@@ -0,0 +1,34 @@
+package compilecache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "compiled.json")
+	c, err := Load(path)
+	require.NoError(t, err)
+	assert.False(t, c.Compiled("a", ""))
+
+	at := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	c.Record("a", "combined.json", "", at)
+	c.Record("b", "easylist.json", "compile {file}", at)
+	require.NoError(t, c.Save(path))
+
+	c, err = Load(path)
+	require.NoError(t, err)
+	assert.True(t, c.Compiled("a", ""))
+	assert.Equal(t, Entry{File: "easylist.json", Command: "compile {file}", CompiledAt: at}, c.Parts["b"])
+
+	// Another compiler has not seen the file
+	assert.False(t, c.Compiled("a", "compile {file}"))
+
+	c.Keep(map[string]bool{"b": true})
+	assert.False(t, c.Compiled("a", ""))
+	assert.True(t, c.Compiled("b", "compile {file}"))
+}
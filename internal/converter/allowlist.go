@@ -0,0 +1,36 @@
+package converter
+
+import (
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// Allowlist converts user allowlist entries into ignore-previous-rules rules.
+// Domains disable every rule on pages of that site (subdomains included);
+// URL patterns use filter syntax (||example.com/login) and exempt matching
+// requests. The rules only take effect when placed after everything they
+// should override, within the same content blocker.
+func (c *Converter) Allowlist(domains, patterns []string) []models.WebKitRule {
+	var rules []models.WebKitRule
+
+	if len(domains) > 0 {
+		if resolved := c.resolveDomains(domains); len(resolved) > 0 {
+			rules = c.sanitize([]models.WebKitRule{{
+				Trigger: models.WebKitTrigger{URLFilter: ".*", IfDomain: resolved},
+				Action:  models.WebKitAction{Type: models.ActionIgnorePreviousRule},
+			}}, strings.Join(domains, ","))
+			c.stats.Converted += len(rules)
+		}
+	}
+
+	filters := make([]models.Filter, 0, len(patterns))
+	for _, p := range patterns {
+		filters = append(filters, models.Filter{
+			Type:    models.FilterTypeException,
+			Raw:     "@@" + p,
+			Pattern: p,
+		})
+	}
+	return append(rules, c.Convert(filters)...)
+}
@@ -0,0 +1,44 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowlist(t *testing.T) {
+	c := New()
+	rules := c.Allowlist([]string{"Example.com", "not a domain"}, []string{"||cdn.example.org/player.js"})
+
+	require.NotEmpty(t, rules)
+	assert.Equal(t, ".*", rules[0].Trigger.URLFilter)
+	assert.Equal(t, []string{"*example.com"}, rules[0].Trigger.IfDomain)
+	for _, r := range rules {
+		assert.Equal(t, models.ActionIgnorePreviousRule, r.Action.Type)
+	}
+	assert.Contains(t, rules[1].Trigger.URLFilter, `cdn\.example\.org`)
+	assert.Equal(t, 1, c.Stats().InvalidDomains)
+}
+
+func TestSplitWithTrailer(t *testing.T) {
+	rule := func(filter string) models.WebKitRule {
+		return models.WebKitRule{
+			Trigger: models.WebKitTrigger{URLFilter: filter},
+			Action:  models.WebKitAction{Type: models.ActionBlock},
+		}
+	}
+	rules := []models.WebKitRule{rule("a"), rule("b"), rule("c"), rule("d")}
+	trailer := []models.WebKitRule{{
+		Trigger: models.WebKitTrigger{URLFilter: ".*", IfDomain: []string{"*example.com"}},
+		Action:  models.WebKitAction{Type: models.ActionIgnorePreviousRule},
+	}}
+
+	parts := NewSplitter(3).SplitWithTrailer(rules, trailer, "combined")
+	require.Len(t, parts, 2)
+	for _, part := range parts {
+		assert.LessOrEqual(t, len(part.Rules), 3, part.Name)
+		assert.Equal(t, trailer[0], part.Rules[len(part.Rules)-1], part.Name)
+	}
+}
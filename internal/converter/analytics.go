@@ -0,0 +1,94 @@
+package converter
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/psl"
+)
+
+// DomainCount is how many converted rules target a registrable domain, in
+// total and per list
+type DomainCount struct {
+	Domain string         `json:"domain"`
+	Rules  int            `json:"rules"`
+	Lists  map[string]int `json:"lists"`
+}
+
+// DomainStats tallies the registrable domains rules are aimed at: the host
+// a block rule's url-filter is anchored to, or the if-domain sites of a
+// hiding rule. Exceptions and rules without a domain are not counted.
+type DomainStats struct {
+	counts map[string]*DomainCount
+}
+
+// NewDomainStats creates an empty tally
+func NewDomainStats() *DomainStats {
+	return &DomainStats{counts: make(map[string]*DomainCount)}
+}
+
+// Add counts the rules of one list
+func (s *DomainStats) Add(list string, rules []models.WebKitRule) {
+	for _, r := range rules {
+		for _, domain := range targetDomains(r) {
+			dc, ok := s.counts[domain]
+			if !ok {
+				dc = &DomainCount{Domain: domain, Lists: make(map[string]int)}
+				s.counts[domain] = dc
+			}
+			dc.Rules++
+			dc.Lists[list]++
+		}
+	}
+}
+
+// Len returns the number of distinct domains counted
+func (s *DomainStats) Len() int {
+	return len(s.counts)
+}
+
+// Top returns the n most targeted domains, most rules first (all if n <= 0)
+func (s *DomainStats) Top(n int) []DomainCount {
+	top := make([]DomainCount, 0, len(s.counts))
+	for _, dc := range s.counts {
+		top = append(top, *dc)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Rules != top[j].Rules {
+			return top[i].Rules > top[j].Rules
+		}
+		return top[i].Domain < top[j].Domain
+	})
+	if n > 0 && len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// targetDomains returns the distinct registrable domains a rule targets
+func targetDomains(r models.WebKitRule) []string {
+	var hosts []string
+	switch r.Action.Type {
+	case models.ActionBlock, models.ActionBlockCookies:
+		if host, ok := anchoredHost(r.Trigger.URLFilter); ok {
+			hosts = append(hosts, host)
+		}
+	case models.ActionCSSDisplayNone:
+		for _, d := range r.Trigger.IfDomain {
+			hosts = append(hosts, strings.TrimPrefix(d, "*"))
+		}
+	}
+
+	var domains []string
+	seen := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		domain, ok := psl.Default().RegistrableDomain(host)
+		if !ok || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		domains = append(domains, domain)
+	}
+	return domains
+}
@@ -0,0 +1,32 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainStats(t *testing.T) {
+	stats := NewDomainStats()
+	stats.Add("easylist", convertList(t, `||ads.example.com^$script
+||cdn.example.com/ad.js
+||tracker.example.org^$third-party
+@@||ok.example.org^
+/banner/*
+example.com,shop.example.com##.ad
+##.sponsor
+`))
+	stats.Add("privacy", convertList(t, "||pixel.example.org^\n"))
+
+	assert.Equal(t, 2, stats.Len())
+	top := stats.Top(0)
+	require.Len(t, top, 2)
+
+	// Subdomains count towards their registrable domain, a hiding rule once
+	// however many of its sites share it. A trailing ^ converts to two rules
+	assert.Equal(t, DomainCount{Domain: "example.com", Rules: 4, Lists: map[string]int{"easylist": 4}}, top[0])
+	assert.Equal(t, DomainCount{Domain: "example.org", Rules: 4, Lists: map[string]int{"easylist": 2, "privacy": 2}}, top[1])
+
+	assert.Len(t, stats.Top(1), 1)
+}
@@ -0,0 +1,298 @@
+package converter
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// Approximation controls how far regex filters WebKit cannot express as-is
+// are rewritten
+type Approximation int
+
+const (
+	// ApproximateDefault turns {n,} into + and skips everything else
+	ApproximateDefault Approximation = iota
+	// ApproximateNone converts strictly, for lists that are not trusted:
+	// filters needing any rewrite are skipped
+	ApproximateNone
+	// ApproximateAll also expands bounded quantifiers and splits
+	// disjunctions into one rule per alternative, for trusted lists
+	ApproximateAll
+)
+
+const (
+	// maxRegexVariants caps the url-filters one filter may be split into
+	maxRegexVariants = 8
+	// maxQuantifierRepeat caps how often a quantified atom is repeated;
+	// larger counts are approximated with *
+	maxQuantifierRepeat = 16
+)
+
+// patternRegexes converts a filter pattern into the url-filters expressing
+// it under the configured approximation level
+func (c *Converter) patternRegexes(pattern string) ([]string, models.SkipReason) {
+	// Emitting such a regex would silently match something else
+	if isRegexFilter(pattern) && regexAnchorConflict(pattern) != "" {
+		return nil, models.SkipRegexAnchor
+	}
+	regex := PatternToRegex(pattern)
+
+	if ValidateRegex(regex) {
+		// PatternToRegex already approximated {n,} in regex filters
+		if c.opts.Approximation == ApproximateNone && isRegexFilter(pattern) && reNumericQuantifierOpen.MatchString(pattern) {
+			return nil, models.SkipNeedsApproximation
+		}
+		return []string{regex}, ""
+	}
+	if c.opts.Approximation == ApproximateDefault {
+		return nil, models.SkipInvalidRegex
+	}
+
+	variants, ok := approximateRegex(regex)
+	if !ok {
+		return nil, models.SkipInvalidRegex
+	}
+	if c.opts.Approximation == ApproximateNone {
+		return nil, models.SkipNeedsApproximation
+	}
+	c.stats.Approximated++
+	return variants, ""
+}
+
+// isRegexFilter reports whether a pattern is a /regex/ filter
+func isRegexFilter(pattern string) bool {
+	s := strings.Trim(pattern, "|")
+	return len(s) > 2 && s[0] == '/' && s[len(s)-1] == '/'
+}
+
+// approximateRegex rewrites numeric quantifiers and splits disjunctions,
+// returning the WebKit-compatible variants or false if some feature is
+// still unsupported
+func approximateRegex(regex string) ([]string, bool) {
+	rewritten, ok := rewriteQuantifiers(regex)
+	if !ok {
+		return nil, false
+	}
+	variants, ok := splitDisjunctions(rewritten)
+	if !ok {
+		return nil, false
+	}
+	for _, v := range variants {
+		if !ValidateRegex(v) {
+			return nil, false
+		}
+	}
+	return variants, true
+}
+
+// rewriteQuantifiers expands {n} and {n,m} into repetitions of their atom:
+// a{2,3} becomes aaa?. Counts above maxQuantifierRepeat are widened with *,
+// so the result may match more than the original.
+func rewriteQuantifiers(re string) (string, bool) {
+	var out strings.Builder
+	atomStart := -1 // offset of the last quantifiable atom in out
+
+	for i := 0; i < len(re); {
+		if re[i] == '{' && atomStart >= 0 {
+			if n, m, end, ok := parseQuantifier(re, i); ok {
+				written := out.String()
+				out.Reset()
+				out.WriteString(written[:atomStart])
+				out.WriteString(repeatAtom(written[atomStart:], n, m))
+				i = end
+				if i < len(re) && re[i] == '?' {
+					i++ // laziness does not change what matches
+				}
+				atomStart = -1
+				continue
+			}
+		}
+
+		j, ok := tokenEnd(re, i)
+		if !ok {
+			return "", false
+		}
+		switch re[i] {
+		case '*', '+', '?', '|', '^', '$':
+			out.WriteString(re[i:j])
+			atomStart = -1
+		case '(':
+			prefix := "("
+			inner := re[i+1 : j-1]
+			if strings.HasPrefix(inner, "?:") {
+				prefix, inner = "(?:", inner[2:]
+			}
+			rewritten, ok := rewriteQuantifiers(inner)
+			if !ok {
+				return "", false
+			}
+			atomStart = out.Len()
+			out.WriteString(prefix + rewritten + ")")
+		default:
+			atomStart = out.Len()
+			out.WriteString(re[i:j])
+		}
+		i = j
+	}
+	return out.String(), true
+}
+
+// parseQuantifier parses {n}, {n,} or {n,m} at re[i]; m is -1 when unbounded
+func parseQuantifier(re string, i int) (n, m, end int, ok bool) {
+	closing := strings.IndexByte(re[i:], '}')
+	if closing == -1 {
+		return 0, 0, 0, false
+	}
+	body := re[i+1 : i+closing]
+	lo, hi, ranged := strings.Cut(body, ",")
+
+	n, err := strconv.Atoi(lo)
+	if err != nil || n < 0 {
+		return 0, 0, 0, false
+	}
+	m = n
+	if ranged {
+		m = -1
+		if hi != "" {
+			if m, err = strconv.Atoi(hi); err != nil || m < n {
+				return 0, 0, 0, false
+			}
+		}
+	}
+	return n, m, i + closing + 1, true
+}
+
+// repeatAtom writes atom{n,m} without numeric quantifiers
+func repeatAtom(atom string, n, m int) string {
+	if n > maxQuantifierRepeat {
+		n, m = maxQuantifierRepeat, -1
+	}
+	if m > maxQuantifierRepeat {
+		m = -1
+	}
+
+	switch {
+	case m == -1 && n == 0:
+		return atom + "*"
+	case m == -1:
+		return strings.Repeat(atom, n-1) + atom + "+"
+	default:
+		return strings.Repeat(atom, n) + strings.Repeat(atom+"?", m-n)
+	}
+}
+
+// splitDisjunctions expands alternatives into separate regexes: a|b gives
+// a and b, x(a|b)y gives xay and xby. Quantified groups with alternatives
+// cannot be split.
+func splitDisjunctions(re string) ([]string, bool) {
+	alternatives, ok := topLevelAlternatives(re)
+	if !ok {
+		return nil, false
+	}
+	if len(alternatives) > 1 {
+		return expandAlternatives(alternatives, func(alt string) string { return alt })
+	}
+
+	for i := 0; i < len(re); {
+		j, ok := tokenEnd(re, i)
+		if !ok {
+			return nil, false
+		}
+		if re[i] == '(' && containsDisjunction(re[i:j]) {
+			if j < len(re) && strings.IndexByte("*+?{", re[j]) != -1 {
+				return nil, false
+			}
+			inner := strings.TrimPrefix(re[i+1:j-1], "?:")
+			alternatives, ok := topLevelAlternatives(inner)
+			if !ok {
+				return nil, false
+			}
+			// Without a quantifier the group only scoped the alternatives
+			return expandAlternatives(alternatives, func(alt string) string { return re[:i] + alt + re[j:] })
+		}
+		i = j
+	}
+	return []string{re}, true
+}
+
+// expandAlternatives splits each alternative placed into its context further,
+// up to maxRegexVariants results
+func expandAlternatives(alternatives []string, place func(string) string) ([]string, bool) {
+	var variants []string
+	for _, alt := range alternatives {
+		split, ok := splitDisjunctions(place(alt))
+		if !ok {
+			return nil, false
+		}
+		variants = append(variants, split...)
+		if len(variants) > maxRegexVariants {
+			return nil, false
+		}
+	}
+	return variants, true
+}
+
+// topLevelAlternatives splits re at | outside groups and character classes
+func topLevelAlternatives(re string) ([]string, bool) {
+	var alternatives []string
+	start := 0
+	for i := 0; i < len(re); {
+		j, ok := tokenEnd(re, i)
+		if !ok {
+			return nil, false
+		}
+		if re[i] == '|' {
+			alternatives = append(alternatives, re[start:i])
+			start = j
+		}
+		i = j
+	}
+	return append(alternatives, re[start:]), true
+}
+
+// tokenEnd returns the end of the regex token at re[i]: an escape, a whole
+// character class or group, or a single character
+func tokenEnd(re string, i int) (int, bool) {
+	switch re[i] {
+	case '\\':
+		return i + 2, i+1 < len(re)
+	case '[':
+		j := i + 1
+		if j < len(re) && re[j] == '^' {
+			j++
+		}
+		if j < len(re) && re[j] == ']' {
+			j++
+		}
+		for j < len(re) {
+			switch re[j] {
+			case '\\':
+				j += 2
+			case ']':
+				return j + 1, true
+			default:
+				j++
+			}
+		}
+		return 0, false
+	case '(':
+		for j := i + 1; j < len(re); {
+			switch re[j] {
+			case ')':
+				return j + 1, true
+			case '\\', '[', '(':
+				k, ok := tokenEnd(re, j)
+				if !ok {
+					return 0, false
+				}
+				j = k
+			default:
+				j++
+			}
+		}
+		return 0, false
+	}
+	return i + 1, true
+}
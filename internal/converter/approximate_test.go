@@ -0,0 +1,81 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApproximateRegex(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"exact quantifier", `ad[0-9]{3}\.js`, []string{`ad[0-9][0-9][0-9]\.js`}},
+		{"range quantifier", `a{1,3}b`, []string{`aa?a?b`}},
+		{"open quantifier", `a{2,}`, []string{`aa+`}},
+		{"quantified group", `(ab){2}`, []string{`(ab)(ab)`}},
+		{"lazy quantifier", `a{2}?b`, []string{`aab`}},
+		{"large count widened", `a{40}`, []string{`aaaaaaaaaaaaaaaa+`}},
+		{"top-level disjunction", `^foo|bar$`, []string{`^foo`, `bar$`}},
+		{"group disjunction", `/(ads|track)/[0-9]{2}`, []string{`/ads/[0-9][0-9]`, `/track/[0-9][0-9]`}},
+		{"nested groups", `x(?:a|b(c|d))y`, []string{`xay`, `xbcy`, `xbdy`}},
+		{"pipe in class", `[a|b]|c`, []string{`[a|b]`, `c`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, ok := approximateRegex(tt.input)
+			require.True(t, ok)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	for _, input := range []string{`(a|b)+`, `(a|b)(c|d)(e|f)(g|h)`, `(?=a|b)`} {
+		_, ok := approximateRegex(input)
+		assert.False(t, ok, input)
+	}
+}
+
+func TestConvertApproximation(t *testing.T) {
+	filters := []models.Filter{
+		{Type: models.FilterTypeNetwork, Raw: "/ad(s|v)[0-9]{2}/", Pattern: "/ad(s|v)[0-9]{2}/"},
+		{Type: models.FilterTypeNetwork, Raw: `/\w{30,}\.me/`, Pattern: `/\w{30,}\.me/`},
+		{Type: models.FilterTypeNetwork, Raw: "||example.com^", Pattern: "||example.com^"},
+	}
+
+	// The historical default only approximates {n,}
+	c := New()
+	assert.Len(t, c.Convert(filters), 3)
+	assert.Equal(t, 1, c.Stats().SkipReasons[models.SkipInvalidRegex])
+
+	trusted := NewWithOptions(Options{Approximation: ApproximateAll})
+	rules := trusted.Convert(filters)
+	require.Len(t, rules, 5)
+	assert.Equal(t, "ads[0-9][0-9]", rules[0].Trigger.URLFilter)
+	assert.Equal(t, "adv[0-9][0-9]", rules[1].Trigger.URLFilter)
+	assert.Equal(t, 1, trusted.Stats().Approximated)
+
+	strict := NewWithOptions(Options{Approximation: ApproximateNone})
+	assert.Len(t, strict.Convert(filters), 2)
+	assert.Equal(t, 2, strict.Stats().SkipReasons[models.SkipNeedsApproximation])
+}
+
+func TestConvertRegexAnchors(t *testing.T) {
+	filters := []models.Filter{
+		{Type: models.FilterTypeNetwork, Raw: `|/Ads[0-9]\.js/|$match-case`, Pattern: `|/Ads[0-9]\.js/|`, Options: models.FilterOptions{MatchCase: true}},
+		{Type: models.FilterTypeNetwork, Raw: `/ads^banner/`, Pattern: `/ads^banner/`},
+		{Type: models.FilterTypeNetwork, Raw: `||/^https:\/\/ads\./`, Pattern: `||/^https:\/\/ads\./`},
+	}
+
+	c := New()
+	rules := c.Convert(filters)
+	require.Len(t, rules, 1)
+	assert.Equal(t, `^Ads[0-9]\.js$`, rules[0].Trigger.URLFilter)
+	require.NotNil(t, rules[0].Trigger.URLFilterIsCaseSensitive)
+	assert.True(t, *rules[0].Trigger.URLFilterIsCaseSensitive)
+	assert.Equal(t, 2, c.Stats().SkipReasons[models.SkipRegexAnchor])
+}
@@ -0,0 +1,103 @@
+package converter
+
+import (
+	"sort"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// Contribution is the set of rules one list adds to a combined output
+type Contribution struct {
+	Name     string
+	Rules    []models.WebKitRule
+	MaxRules int // per-list cap, 0 for none
+	Priority int // higher priorities are served first when the budget is tight
+}
+
+// Allocate merges contributions into a single rule set of at most budget
+// rules (0 for unlimited). Lists are served in priority order, ties in the
+// order given, so critical lists are never crowded out by large generic
+// ones, but the result keeps the original list order since exceptions only
+// override rules placed before them. Returns the merged rules and the number
+// of rules dropped per list.
+func Allocate(contributions []Contribution, budget int) ([]models.WebKitRule, map[string]int) {
+	sizes := make([]int, len(contributions))
+	for i, c := range contributions {
+		sizes[i] = len(c.Rules)
+	}
+	keep := Quotas(contributions, sizes, budget)
+
+	var result []models.WebKitRule
+	dropped := make(map[string]int)
+	for i, c := range contributions {
+		result = append(result, TruncateRules(c.Rules, keep[i])...)
+		if lost := len(c.Rules) - keep[i]; lost > 0 {
+			dropped[c.Name] += lost
+		}
+	}
+	return result, dropped
+}
+
+// Quotas returns how many rules of each contribution Allocate keeps, given
+// the number of rules of each. Rule sets held outside the contributions,
+// e.g. spilled to disk, are allocated this way one at a time.
+func Quotas(contributions []Contribution, sizes []int, budget int) []int {
+	order := make([]int, len(contributions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return contributions[order[a]].Priority > contributions[order[b]].Priority
+	})
+
+	keep := make([]int, len(contributions))
+	remaining := budget
+	for _, i := range order {
+		n := sizes[i]
+		if max := contributions[i].MaxRules; max > 0 && n > max {
+			n = max
+		}
+		if budget > 0 {
+			if n > remaining {
+				n = remaining
+			}
+			remaining -= n
+		}
+		keep[i] = n
+	}
+	return keep
+}
+
+// TruncateRules keeps n rules, preferring exceptions since dropping one can
+// break a site while dropping a block rule only lets something through.
+// Relative order is preserved.
+func TruncateRules(rules []models.WebKitRule, n int) []models.WebKitRule {
+	if n >= len(rules) {
+		return rules
+	}
+
+	exceptions := 0
+	for _, r := range rules {
+		if r.Action.Type == models.ActionIgnorePreviousRule {
+			exceptions++
+		}
+	}
+	others := n - exceptions
+	if others < 0 {
+		others = 0
+	}
+
+	result := make([]models.WebKitRule, 0, n)
+	for _, r := range rules {
+		if len(result) == n {
+			break
+		}
+		if r.Action.Type == models.ActionIgnorePreviousRule {
+			result = append(result, r)
+		} else if others > 0 {
+			result = append(result, r)
+			others--
+		}
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func budgetRules(n int, action string) []models.WebKitRule {
+	rules := make([]models.WebKitRule, n)
+	for i := range rules {
+		rules[i] = models.WebKitRule{
+			Trigger: models.WebKitTrigger{URLFilter: string(rune('a' + i))},
+			Action:  models.WebKitAction{Type: action},
+		}
+	}
+	return rules
+}
+
+func TestAllocate(t *testing.T) {
+	contributions := []Contribution{
+		{Name: "huge", Rules: budgetRules(8, models.ActionBlock)},
+		{Name: "capped", Rules: budgetRules(5, models.ActionBlock), MaxRules: 2},
+		{Name: "unbreak", Rules: budgetRules(3, models.ActionIgnorePreviousRule), Priority: 10},
+	}
+
+	rules, dropped := Allocate(contributions, 10)
+
+	assert.Len(t, rules, 10)
+	assert.Equal(t, map[string]int{"huge": 1, "capped": 5}, dropped)
+	// Original list order is kept so exceptions still come last
+	for _, r := range rules[7:] {
+		assert.Equal(t, models.ActionIgnorePreviousRule, r.Action.Type)
+	}
+}
+
+func TestAllocateUnlimited(t *testing.T) {
+	rules, dropped := Allocate([]Contribution{{Name: "a", Rules: budgetRules(4, models.ActionBlock)}}, 0)
+	assert.Len(t, rules, 4)
+	assert.Empty(t, dropped)
+}
+
+func TestTruncateRulesKeepsExceptions(t *testing.T) {
+	rules := append(budgetRules(4, models.ActionBlock), budgetRules(2, models.ActionIgnorePreviousRule)...)
+
+	kept := TruncateRules(rules, 3)
+
+	assert.Len(t, kept, 3)
+	assert.Equal(t, models.ActionBlock, kept[0].Action.Type)
+	assert.Equal(t, models.ActionIgnorePreviousRule, kept[1].Action.Type)
+	assert.Equal(t, models.ActionIgnorePreviousRule, kept[2].Action.Type)
+}
@@ -0,0 +1,169 @@
+package converter
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// Kinds of url-filter in a CompileCost distribution
+const (
+	FilterLiteral  = "literal"  // anchors, separators and literal text only
+	FilterWildcard = "wildcard" // also .* wildcards
+	FilterComplex  = "complex"  // also classes, groups or quantifiers, from /regex/ filters
+)
+
+// Shares of a ruleset above which loading it is likely slow on low-end
+// devices
+const (
+	MaxComplexShare     = 0.05 // url-filters with regex constructs
+	MaxMidWildcardShare = 0.10 // url-filters with .* between literal parts
+	MaxCosmeticShare    = 0.60 // css-display-none rules
+)
+
+// Points a rule scores beyond 1
+const (
+	midWildcardCost      = 6  // per .* between literal parts
+	regexConstructCost   = 2  // per class, group or quantifier
+	domainsPerCostPoint  = 10 // if-domain and unless-domain entries
+	selectorPerCostPoint = 4  // SelectorComplexity of a hiding rule
+)
+
+// RuleCost is the estimated compile cost of one rule and what drives it
+type RuleCost struct {
+	Score  int               `json:"score"`
+	Reason string            `json:"reason"`
+	Rule   models.WebKitRule `json:"rule"`
+}
+
+// CompileCost estimates how long WebKit takes to compile a ruleset. The
+// content blocker compiler merges url-filters into shared automata: literal
+// prefixes are cheap, a .* in the middle of a pattern and regex constructs
+// multiply states, every if-domain/unless-domain entry is matched on its
+// own and hiding rules are turned into stylesheets.
+type CompileCost struct {
+	Rules        int            `json:"rules"`
+	Score        int            `json:"score"`         // sum of rule scores, 1 for the cheapest rule
+	Filters      map[string]int `json:"filters"`       // url-filters by kind
+	MidWildcards int            `json:"mid_wildcards"` // url-filters with .* between literal parts
+	Cosmetic     int            `json:"cosmetic"`      // css-display-none rules
+	Worst        []RuleCost     `json:"worst,omitempty"`
+}
+
+// EstimateCompileCost scores rules and keeps the n most expensive
+func EstimateCompileCost(rules []models.WebKitRule, n int) CompileCost {
+	cost := CompileCost{Rules: len(rules), Filters: make(map[string]int)}
+	var scored []RuleCost
+	for _, r := range rules {
+		kind, mid := classifyURLFilter(r.Trigger.URLFilter)
+		cost.Filters[kind]++
+		if mid > 0 {
+			cost.MidWildcards++
+		}
+		if r.Action.Type == models.ActionCSSDisplayNone {
+			cost.Cosmetic++
+		}
+
+		rc := ruleCost(r)
+		cost.Score += rc.Score
+		if rc.Score > 1 {
+			scored = append(scored, rc)
+		}
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
+	cost.Worst = scored[:min(n, len(scored))]
+	return cost
+}
+
+// Warnings describes the shares of the ruleset above the Max*Share limits
+func (c CompileCost) Warnings() []string {
+	if c.Rules == 0 {
+		return nil
+	}
+	var warnings []string
+	share := func(n int) float64 { return float64(n) / float64(c.Rules) }
+	if s := share(c.Filters[FilterComplex]); s > MaxComplexShare {
+		warnings = append(warnings, fmt.Sprintf("%.1f%% of rules use regex classes, groups or quantifiers (over %.0f%%)", s*100, MaxComplexShare*100))
+	}
+	if s := share(c.MidWildcards); s > MaxMidWildcardShare {
+		warnings = append(warnings, fmt.Sprintf("%.1f%% of rules have a .* between literal parts (over %.0f%%)", s*100, MaxMidWildcardShare*100))
+	}
+	if s := share(c.Cosmetic); s > MaxCosmeticShare {
+		warnings = append(warnings, fmt.Sprintf("%.1f%% of rules are element hiding (over %.0f%%)", s*100, MaxCosmeticShare*100))
+	}
+	return warnings
+}
+
+// ruleCost scores a rule and names its most expensive part
+func ruleCost(r models.WebKitRule) RuleCost {
+	rc := RuleCost{Score: 1, Rule: r}
+	worst := 0
+	add := func(score int, reason string) {
+		rc.Score += score
+		if score > worst {
+			worst, rc.Reason = score, reason
+		}
+	}
+
+	filters := slices.Concat([]string{r.Trigger.URLFilter}, r.Trigger.IfTopURL, r.Trigger.UnlessTopURL)
+	for _, filter := range filters {
+		_, mid := classifyURLFilter(filter)
+		add(mid*midWildcardCost, "mid-pattern .*")
+		add(regexConstructs(filter)*regexConstructCost, "regex constructs")
+	}
+	add((len(r.Trigger.IfDomain)+len(r.Trigger.UnlessDomain))/domainsPerCostPoint, "domain list")
+	if r.Action.Type == models.ActionCSSDisplayNone {
+		add(SelectorComplexity(r.Action.Selector)/selectorPerCostPoint, "selector")
+	}
+	return rc
+}
+
+// cheapParts are the regex parts of converted patterns WebKit shares
+// across rules: hostname anchors and the separator class
+var cheapParts = []string{
+	restrHostnameAnchor1, restrHostnameAnchor2, restrSubdomainAnchor, restrExactHostAnchor, restrSeparator,
+}
+
+// stripCheapParts removes hostname anchors and separators from a url-filter
+func stripCheapParts(filter string) string {
+	for _, part := range cheapParts {
+		filter = strings.ReplaceAll(filter, part, "")
+	}
+	return filter
+}
+
+// classifyURLFilter returns the kind of a url-filter and its number of .*
+// between literal parts
+func classifyURLFilter(filter string) (kind string, mid int) {
+	s := stripCheapParts(filter)
+	inner := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(s, "^"), ".*"), ".*")
+	mid = strings.Count(inner, ".*")
+
+	switch {
+	case regexConstructs(filter) > 0:
+		return FilterComplex, mid
+	case strings.Contains(s, ".*"):
+		return FilterWildcard, mid
+	}
+	return FilterLiteral, mid
+}
+
+// regexConstructs counts the classes, groups and quantifiers of a url-filter
+// other than hostname anchors, separators and .* wildcards
+func regexConstructs(filter string) int {
+	s := strings.ReplaceAll(stripCheapParts(filter), ".*", "")
+	n := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++ // escaped literal
+		case '[', '(', '+', '?', '*':
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,48 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateCompileCost(t *testing.T) {
+	block := func(filter string) models.WebKitRule {
+		return models.WebKitRule{
+			Trigger: models.WebKitTrigger{URLFilter: filter},
+			Action:  models.WebKitAction{Type: models.ActionBlock},
+		}
+	}
+	rules := []models.WebKitRule{
+		block(PatternToRegex("||ads.example.com^")),
+		block(PatternToRegex("/banner/*")),
+		block(PatternToRegex("/ads/*/track*.js")),
+		block(PatternToRegex("/\\/[a-z]+\\/pixel\\.gif/")),
+		{
+			Trigger: models.WebKitTrigger{URLFilter: ".*", IfDomain: []string{"*example.com"}},
+			Action:  models.WebKitAction{Type: models.ActionCSSDisplayNone, Selector: ".ad"},
+		},
+	}
+
+	cost := EstimateCompileCost(rules, 2)
+	assert.Equal(t, 5, cost.Rules)
+	assert.Equal(t, map[string]int{FilterLiteral: 2, FilterWildcard: 2, FilterComplex: 1}, cost.Filters)
+	assert.Equal(t, 1, cost.MidWildcards)
+	assert.Equal(t, 1, cost.Cosmetic)
+
+	// Hostname anchors and separators are free, the mid .* is the worst
+	require.Len(t, cost.Worst, 2)
+	assert.Equal(t, "mid-pattern .*", cost.Worst[0].Reason)
+	assert.Equal(t, rules[2], cost.Worst[0].Rule)
+	assert.Equal(t, "regex constructs", cost.Worst[1].Reason)
+	assert.Equal(t, 1, ruleCost(rules[0]).Score)
+
+	// One complex filter in five is over the limit, as is the mid .*
+	warnings := cost.Warnings()
+	require.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "regex")
+	assert.Contains(t, warnings[1], ".*")
+	assert.Empty(t, EstimateCompileCost(rules[:2], 2).Warnings())
+}
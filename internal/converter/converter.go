@@ -1,43 +1,112 @@
 package converter
 
 import (
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/psl"
 )
 
 // Converter converts parsed filters to WebKit rules
 type Converter struct {
-	stats Stats
+	stats    Stats
+	suffixes *psl.List
+	opts     Options
+	tldExprs []string        // cached wildcard TLD expansions
+	hot      map[string]bool // simplified Options.GenericHotSelectors
+
+	exclude        []*regexp.Regexp // compiled Options.SelectorExclude
+	excludeDomains []string         // resolved Options.CosmeticExcludeDomains
+
+	cosmeticExceptions []CosmeticException
+	cspSuggestions     []CSPSuggestion
+	exceptions         []ExceptionSource
 }
 
 // Stats tracks conversion statistics
 type Stats struct {
-	Converted   int
-	Skipped     int
-	SkipReasons map[string]int
+	Converted        int
+	Skipped          int
+	InvalidDomains   int // domain entries dropped because they are not registrable
+	Simplified       int // selectors shortened by SimplifySelector
+	RemoveParam      int // $removeparam filters turned into (lossy) block rules
+	Approximated     int // regex filters rewritten by ApproximateAll
+	Salvaged         int // filters converted without an unsupported option
+	Transformed      int // rules changed or dropped by Options.Transforms
+	TopURLRestricted int // generic cosmetic rules kept off Options.GenericUnlessTopURL pages
+	DefaultTyped     int // typeless block filters given Options.DefaultResourceTypes
+	ScopeExcluded    int // hiding rules dropped or restricted by the selector scope options
+	NeverBlocked     int // rules dropped or restricted by Options.NeverBlockDomains
+	SkipReasons      map[models.SkipReason]int
+	Samples          map[models.SkipReason][]string // first raw lines per skip reason
+	Coverage         models.Coverage                // outcome per filter option
+	Patterns         models.SkipPatterns            // skips by reason
 }
 
-// Skip reason constants
-const (
-	SkipInvalidRegex      = "invalid-regex"
-	SkipCosmeticException = "cosmetic-exception"
-	SkipEmptySelector     = "empty-selector"
-)
+// Options tunes the conversion
+type Options struct {
+	Target                 Target             // WebKit features rules may use
+	MaxSelectorComplexity  int                // skip selectors scoring higher, 0 for no limit
+	RemoveParamBlock       bool               // block requests carrying known tracking parameters
+	TopURLThreshold        int                // rewrite longer if-domain lists to if-top-url, 0 to keep them
+	TopURLChunkSize        int                // if-top-url entries per rule, 0 for a single rule
+	GenericUnlessTopURL    []string           // unless-top-url patterns of hot generic cosmetic rules
+	GenericHotSelectors    []string           // selectors of the hot generic rules, empty for all
+	Approximation          Approximation      // lossy regex rewrites allowed for the list
+	DefaultResourceTypes   []string           // resource-type of block filters without type options, empty for all
+	Transforms             []models.Transform // configured rewrites of the list's rules
+	SelectorPrefix         string             // selector every emitted hiding selector is nested under
+	SelectorExclude        []string           // Go regexps of selectors never hidden
+	CosmeticExcludeDomains []string           // domains no hiding rule applies on
+	NeverBlockDomains      []string           // domains no rule may target, subdomains included
+}
 
-// New creates a new converter
+// New creates a new converter for the default target
 func New() *Converter {
-	return &Converter{
+	return NewForTarget(Targets[DefaultTarget])
+}
+
+// NewForTarget creates a converter emitting only trigger fields the target
+// WebKit version understands
+func NewForTarget(target Target) *Converter {
+	return NewWithOptions(Options{Target: target})
+}
+
+// NewWithOptions creates a converter with the given options
+func NewWithOptions(opts Options) *Converter {
+	hot := make(map[string]bool, len(opts.GenericHotSelectors))
+	for _, s := range opts.GenericHotSelectors {
+		hot[SimplifySelector(s)] = true
+	}
+	c := &Converter{
 		stats: Stats{
-			SkipReasons: make(map[string]int),
+			SkipReasons: make(map[models.SkipReason]int),
+			Samples:     make(map[models.SkipReason][]string),
+			Coverage:    make(models.Coverage),
+			Patterns:    make(models.SkipPatterns),
 		},
+		suffixes: psl.Default(),
+		opts:     opts,
+		hot:      hot,
+		exclude:  compileSelectorExclude(opts.SelectorExclude),
 	}
+	c.excludeDomains = c.resolveDomains(opts.CosmeticExcludeDomains)
+	return c
 }
 
 // skip records a skipped filter with reason
-func (c *Converter) skip(reason string) {
+func (c *Converter) skip(reason models.SkipReason, raw string) {
+	c.skipDetail(reason, "", raw)
+}
+
+// skipDetail records a skipped filter with reason and what caused it
+func (c *Converter) skipDetail(reason models.SkipReason, detail, raw string) {
 	c.stats.Skipped++
 	c.stats.SkipReasons[reason]++
+	models.AddSkipSample(c.stats.Samples, reason, raw)
+	c.stats.Patterns.Add(reason, detail, raw)
 }
 
 // Stats returns conversion statistics
@@ -51,28 +120,54 @@ func (c *Converter) Convert(filters []models.Filter) []models.WebKitRule {
 
 	for _, f := range filters {
 		var convertedRules []models.WebKitRule
-		var skipReason string
+		var skipReason models.SkipReason
+		lossy := c.stats.Approximated + c.stats.RemoveParam
 
 		switch f.Type {
-		case models.FilterTypeNetwork:
-			convertedRules, skipReason = c.convertNetwork(f, false)
-		case models.FilterTypeException:
-			convertedRules, skipReason = c.convertNetwork(f, true)
+		case models.FilterTypeNetwork, models.FilterTypeException:
+			isException := f.Type == models.FilterTypeException
+			if f.Options.InlineScript || f.Options.InlineFont {
+				skipReason = c.recordInline(f, isException)
+			} else if f.Options.RemoveParam != "" {
+				convertedRules, skipReason = c.convertRemoveParam(f, isException)
+			} else if star, ok := wildcardTLDHost(f.Pattern); ok {
+				convertedRules, skipReason = c.convertWildcardTLD(f, isException, star)
+			} else {
+				convertedRules, skipReason = c.convertNetwork(f, isException)
+			}
 		case models.FilterTypeCosmetic:
-			convertedRules, skipReason = c.convertCosmetic(f, false)
+			convertedRules, skipReason = c.convertCosmetic(f)
 		case models.FilterTypeCosmeticException:
-			convertedRules, skipReason = c.convertCosmetic(f, true)
+			skipReason = c.recordCosmeticException(f)
 		default:
 			continue
 		}
 
 		if len(convertedRules) == 0 {
 			if skipReason != "" {
-				c.skip(skipReason)
+				c.skip(skipReason, f.Raw)
 			}
+			c.stats.Coverage.Record(f.Options.Names, models.OutcomeSkipped)
 			continue
 		}
 
+		convertedRules = c.sanitize(c.substituteTopURL(c.scopeCosmetic(c.neverBlock(c.transform(convertedRules)))), f.Raw)
+
+		outcome := models.OutcomeConverted
+		if len(convertedRules) == 0 {
+			outcome = models.OutcomeSkipped
+		} else if c.stats.Approximated+c.stats.RemoveParam > lossy || f.Options.Salvaged {
+			outcome = models.OutcomeApproximated
+		}
+		if f.Options.Salvaged && len(convertedRules) > 0 {
+			c.stats.Salvaged++
+		}
+		c.stats.Coverage.Record(f.Options.Names, outcome)
+
+		if f.Type == models.FilterTypeException {
+			c.recordException(f.Raw, convertedRules)
+		}
+
 		c.stats.Converted += len(convertedRules)
 		rules = append(rules, convertedRules...)
 	}
@@ -80,15 +175,35 @@ func (c *Converter) Convert(filters []models.Filter) []models.WebKitRule {
 	return rules
 }
 
+// sanitize runs every rule through SanitizeRule and LintRule, dropping and
+// recording unsafe or invalid ones as skips of the raw line they came from.
+// It is the last step of every rule the converter emits, so WebKit never
+// gets a rule it refuses to compile.
+func (c *Converter) sanitize(rules []models.WebKitRule, raw string) []models.WebKitRule {
+	result := rules[:0]
+	for _, r := range rules {
+		clean, reason := SanitizeRule(r)
+		if reason != "" {
+			c.skip(reason, raw)
+			continue
+		}
+		if problem := LintRule(clean, c.opts.Target); problem != "" {
+			c.skipDetail(models.SkipInvalidTrigger, problem, raw)
+			continue
+		}
+		result = append(result, clean)
+	}
+	return result
+}
+
 // convertNetwork converts a network filter to WebKit rules
 // Returns multiple rules if splitting is needed (e.g., both if-domain and unless-domain,
 // or patterns ending with ^ separator which need both separator-char and end-of-string variants)
-func (c *Converter) convertNetwork(f models.Filter, isException bool) ([]models.WebKitRule, string) {
-	regex := PatternToRegex(f.Pattern)
-
-	// Validate the regex is WebKit-compatible
-	if !ValidateRegex(regex) {
-		return nil, SkipInvalidRegex
+func (c *Converter) convertNetwork(f models.Filter, isException bool) ([]models.WebKitRule, models.SkipReason) {
+	// WebKit-compatible url-filters, several if a disjunction was split
+	regexes, reason := c.patternRegexes(f.Pattern)
+	if reason != "" {
+		return nil, reason
 	}
 
 	// Check if we need an end-anchor variant (pattern ends with ^ separator)
@@ -118,191 +233,242 @@ func (c *Converter) convertNetwork(f models.Filter, isException bool) ([]models.
 	var resourceType []string
 	if len(f.Options.ResourceTypes) > 0 {
 		resourceType = f.Options.ResourceTypes
+	} else if !isException && len(f.Options.LoadContexts) == 0 && len(c.opts.DefaultResourceTypes) > 0 {
+		// Exceptions keep every type, so they still lift the rules of
+		// lists without defaults
+		resourceType = c.opts.DefaultResourceTypes
+		c.stats.DefaultTyped++
 	}
 
-	var loadType []string
-	if f.Options.ThirdParty != nil {
-		if *f.Options.ThirdParty {
-			loadType = []string{models.LoadThirdParty}
-		} else {
-			loadType = []string{models.LoadFirstParty}
-		}
+	includeDomains := c.resolveDomains(f.Options.Domains)
+	excludeDomains := c.resolveDomains(f.Options.ExcludeDomains)
+
+	// Dropping every included domain would turn the filter into a global one
+	if len(f.Options.Domains) > 0 && len(includeDomains) == 0 {
+		return nil, models.SkipInvalidDomain
 	}
 
-	hasDomains := len(f.Options.Domains) > 0
-	hasExcludeDomains := len(f.Options.ExcludeDomains) > 0
-
-	// WebKit only allows ONE of: if-domain, unless-domain, if-top-url, unless-top-url
-	// If both domain types are present, we need to split into separate rules
-	if hasDomains && hasExcludeDomains {
-		var rules []models.WebKitRule
-
-		// Rule 1: Apply to included domains only (separator char variant)
-		rule1 := models.WebKitRule{
-			Trigger: models.WebKitTrigger{
-				URLFilter:                regex,
-				URLFilterIsCaseSensitive: caseSensitive,
-				ResourceType:             resourceType,
-				LoadType:                 loadType,
-				IfDomain:                 normalizeDomains(f.Options.Domains),
-			},
-			Action: models.WebKitAction{Type: actionType},
-		}
-		rules = append(rules, rule1)
-
-		// Rule 1b: End-anchor variant for included domains
-		if needsEndAnchorVariant {
-			rule1b := models.WebKitRule{
-				Trigger: models.WebKitTrigger{
-					URLFilter:                endAnchorRegex,
-					URLFilterIsCaseSensitive: caseSensitive,
-					ResourceType:             resourceType,
-					LoadType:                 loadType,
-					IfDomain:                 normalizeDomains(f.Options.Domains),
-				},
-				Action: models.WebKitAction{Type: actionType},
-			}
-			rules = append(rules, rule1b)
+	// Every variant of the filter shares everything but the url-filter,
+	// the frame group and the party and domain conditions
+	trigger := func(v partyVariant, g triggerGroup) models.WebKitTrigger {
+		return models.WebKitTrigger{
+			URLFilter:                v.urlFilter,
+			URLFilterIsCaseSensitive: caseSensitive,
+			ResourceType:             g.resourceType,
+			LoadType:                 v.loadType,
+			LoadContext:              g.loadContext,
 		}
+	}
+	urlFilters := regexes
+	if needsEndAnchorVariant {
+		urlFilters = append(urlFilters, endAnchorRegex)
+	}
 
-		// Rule 2: Apply everywhere except excluded domains (separator char variant)
-		rule2 := models.WebKitRule{
-			Trigger: models.WebKitTrigger{
-				URLFilter:                regex,
-				URLFilterIsCaseSensitive: caseSensitive,
-				ResourceType:             resourceType,
-				LoadType:                 loadType,
-				UnlessDomain:             normalizeDomains(f.Options.ExcludeDomains),
-			},
-			Action: models.WebKitAction{Type: actionType},
-		}
-		rules = append(rules, rule2)
-
-		// Rule 2b: End-anchor variant for excluded domains
-		if needsEndAnchorVariant {
-			rule2b := models.WebKitRule{
-				Trigger: models.WebKitTrigger{
-					URLFilter:                endAnchorRegex,
-					URLFilterIsCaseSensitive: caseSensitive,
-					ResourceType:             resourceType,
-					LoadType:                 loadType,
-					UnlessDomain:             normalizeDomains(f.Options.ExcludeDomains),
-				},
-				Action: models.WebKitAction{Type: actionType},
+	// Exclusions only matter inside the included domains
+	// (domain=a.com|~b.com is just domain=a.com)
+	if len(includeDomains) > 0 && len(excludeDomains) > 0 {
+		excludeDomains = nestedDomains(excludeDomains, includeDomains)
+	}
+
+	subdocException := isException && slices.Equal(f.Options.LoadContexts, []string{models.LoadContextChildFrame})
+
+	var rules []models.WebKitRule
+	for _, urlFilter := range urlFilters {
+		for _, v := range partyVariants(urlFilter, f.Options, includeDomains, excludeDomains) {
+			for _, g := range c.frameGroups(resourceType, f.Options.LoadContexts) {
+				include, exclude := v.include, v.exclude
+				if subdocException && slices.Equal(g.resourceType, []string{models.ResourceDocument}) {
+					include, exclude = frameAncestors(v.urlFilter, len(g.loadContext) > 0, include, exclude)
+				}
+				rules = append(rules, domainRules(trigger(v, g), actionType, include, exclude)...)
 			}
-			rules = append(rules, rule2b)
 		}
-
-		return rules, ""
 	}
 
-	// Single rule case - only one or no domain condition
-	var rules []models.WebKitRule
+	return rules, ""
+}
 
-	// Main rule with separator char matching
-	rule := models.WebKitRule{
-		Trigger: models.WebKitTrigger{
-			URLFilter:                regex,
-			URLFilterIsCaseSensitive: caseSensitive,
-			ResourceType:             resourceType,
-			LoadType:                 loadType,
-		},
-		Action: models.WebKitAction{Type: actionType},
+// partyVariant is a url-filter with the party and domain conditions it
+// applies under
+type partyVariant struct {
+	urlFilter        string
+	loadType         []string
+	include, exclude []string
+}
+
+// partyVariants maps a filter's party option to load-type. WebKit compares
+// sites, while $strict1p and $strict3p compare the request's hostname to the
+// page's: for a ||host filter without domain= the host is matched exactly and
+// required (1p) or excluded (3p) as the page's domain. Subdomains of the host
+// can't be compared to the page, so $strict1p drops them and $strict3p only
+// matches them from other sites. Other strict filters fall back to the
+// site-level load-type.
+func partyVariants(urlFilter string, opts models.FilterOptions, include, exclude []string) []partyVariant {
+	plain := partyVariant{urlFilter: urlFilter, include: include, exclude: exclude}
+	if opts.ThirdParty == nil {
+		return []partyVariant{plain}
+	}
+	firstParty, thirdParty := []string{models.LoadFirstParty}, []string{models.LoadThirdParty}
+	plain.loadType = firstParty
+	if *opts.ThirdParty {
+		plain.loadType = thirdParty
 	}
 
-	if hasDomains {
-		rule.Trigger.IfDomain = normalizeDomains(f.Options.Domains)
+	host, ok := anchoredHost(urlFilter)
+	if !opts.StrictParty || !ok || len(include) > 0 || len(exclude) > 0 {
+		return []partyVariant{plain}
+	}
+	rest := strings.TrimPrefix(urlFilter, restrHostnameAnchor1)
+	if !*opts.ThirdParty {
+		return []partyVariant{
+			{urlFilter: restrExactHostAnchor + rest, loadType: firstParty, include: []string{host}},
+		}
 	}
-	if hasExcludeDomains {
-		rule.Trigger.UnlessDomain = normalizeDomains(f.Options.ExcludeDomains)
+	return []partyVariant{
+		{urlFilter: restrExactHostAnchor + rest, exclude: []string{host}},
+		{urlFilter: restrSubdomainAnchor + rest, loadType: thirdParty},
 	}
+}
 
-	rules = append(rules, rule)
+// triggerGroup is a resource-type/load-context combination a filter maps to
+type triggerGroup struct {
+	resourceType []string
+	loadContext  []string
+}
 
-	// Add end-anchor variant if pattern ends with separator
-	if needsEndAnchorVariant {
-		endRule := models.WebKitRule{
-			Trigger: models.WebKitTrigger{
-				URLFilter:                endAnchorRegex,
-				URLFilterIsCaseSensitive: caseSensitive,
-				ResourceType:             resourceType,
-				LoadType:                 loadType,
-			},
-			Action: models.WebKitAction{Type: actionType},
+// frameGroups splits frame-targeted resource types ($subdocument,
+// $document, $popup) into their own group restricted by load-context, so
+// $subdocument only blocks iframes instead of every document. Targets
+// without load-context keep the broader single trigger.
+func (c *Converter) frameGroups(resourceType, contexts []string) []triggerGroup {
+	all := []triggerGroup{{resourceType: resourceType}}
+	if !c.opts.Target.LoadContext || len(contexts) != 1 {
+		return all
+	}
+
+	var frame, other []string
+	for _, rt := range resourceType {
+		if rt == models.ResourceDocument || rt == models.ResourcePopup {
+			frame = append(frame, rt)
+		} else {
+			other = append(other, rt)
 		}
+	}
+	if len(frame) == 0 {
+		return all
+	}
 
-		if hasDomains {
-			endRule.Trigger.IfDomain = normalizeDomains(f.Options.Domains)
+	groups := []triggerGroup{{resourceType: frame, loadContext: contexts}}
+	if len(other) > 0 {
+		groups = append([]triggerGroup{{resourceType: other}}, groups...)
+	}
+	return groups
+}
+
+// frameAncestors scopes a $subdocument exception to the pages allowed to
+// embed the frame, like a frame-ancestors policy. An exception can't be
+// both limited to domain= and lifted on its ~exclusions, so included
+// domains with an excluded subdomain only keep the domain itself, rather
+// than allowing the frame in the excluded pages too. Without load-context
+// the exception would also lift blocks of the framed host's own pages, so
+// an exception for every page leaves out the host's.
+func frameAncestors(urlFilter string, childFrame bool, include, exclude []string) ([]string, []string) {
+	if len(include) > 0 {
+		if len(exclude) == 0 {
+			return include, nil
 		}
-		if hasExcludeDomains {
-			endRule.Trigger.UnlessDomain = normalizeDomains(f.Options.ExcludeDomains)
+		scoped := make([]string, 0, len(include))
+		for _, in := range include {
+			if len(nestedDomains(exclude, []string{in})) > 0 {
+				in = strings.TrimPrefix(in, "*")
+			}
+			scoped = append(scoped, in)
 		}
+		return scoped, nil
+	}
 
-		rules = append(rules, endRule)
+	if host, ok := anchoredHost(urlFilter); ok && !childFrame && !slices.Contains(exclude, "*"+host) {
+		exclude = append(slices.Clip(exclude), "*"+host)
 	}
+	return nil, exclude
+}
 
-	return rules, ""
+// domainRules applies the domain conditions to a trigger. WebKit only
+// allows ONE of if-domain, unless-domain, if-top-url and unless-top-url:
+// with both include and exclude domains the rule is narrowed to the included
+// domains. Lifting it on excluded subdomains would need an
+// ignore-previous-rules entry that also lifts the rules of every other list
+// there.
+func domainRules(base models.WebKitTrigger, actionType string, includeDomains, excludeDomains []string) []models.WebKitRule {
+	rule := models.WebKitRule{
+		Trigger: base,
+		Action:  models.WebKitAction{Type: actionType},
+	}
+
+	switch {
+	case len(includeDomains) > 0:
+		rule.Trigger.IfDomain = includeDomains
+	case len(excludeDomains) > 0:
+		rule.Trigger.UnlessDomain = excludeDomains
+	}
+	return []models.WebKitRule{rule}
+}
+
+// nestedDomains returns the domains of excludes that lie within one of the
+// includes (all entries carry the * subdomain prefix)
+func nestedDomains(excludes, includes []string) []string {
+	var result []string
+	for _, ex := range excludes {
+		name := strings.TrimPrefix(ex, "*")
+		for _, in := range includes {
+			parent := strings.TrimPrefix(in, "*")
+			if name == parent || strings.HasSuffix(name, "."+parent) {
+				result = append(result, ex)
+				break
+			}
+		}
+	}
+	return result
 }
 
 // convertCosmetic converts a cosmetic filter to WebKit rules
 // Returns multiple rules if splitting is needed (e.g., both if-domain and unless-domain)
-func (c *Converter) convertCosmetic(f models.Filter, isException bool) ([]models.WebKitRule, string) {
+func (c *Converter) convertCosmetic(f models.Filter) ([]models.WebKitRule, models.SkipReason) {
 	if f.Selector == "" {
-		return nil, SkipEmptySelector
+		return nil, models.SkipEmptySelector
 	}
 
-	// Exception cosmetic filters - WebKit doesn't have a direct equivalent
-	if isException {
-		return nil, SkipCosmeticException
+	selector := SimplifySelector(f.Selector)
+	if selector != f.Selector {
+		c.stats.Simplified++
+	}
+	if max := c.opts.MaxSelectorComplexity; max > 0 && SelectorComplexity(selector) > max {
+		return nil, models.SkipComplexSelector
 	}
 
 	// Parse domains into include/exclude lists
-	var include, exclude []string
+	var rawInclude, rawExclude []string
 	for _, d := range f.Domains {
 		if strings.HasPrefix(d, "~") {
-			exclude = append(exclude, normalizeDomain(d[1:]))
+			rawExclude = append(rawExclude, d[1:])
 		} else {
-			include = append(include, normalizeDomain(d))
+			rawInclude = append(rawInclude, d)
 		}
 	}
+	include := c.resolveDomains(rawInclude)
+	exclude := c.resolveDomains(rawExclude)
 
-	hasInclude := len(include) > 0
-	hasExclude := len(exclude) > 0
-
-	// WebKit only allows ONE of: if-domain, unless-domain, if-top-url, unless-top-url
-	// If both domain types are present, we need to split into separate rules
-	if hasInclude && hasExclude {
-		var rules []models.WebKitRule
-
-		// Rule 1: Apply to included domains only
-		rule1 := models.WebKitRule{
-			Trigger: models.WebKitTrigger{
-				URLFilter: ".*",
-				IfDomain:  include,
-			},
-			Action: models.WebKitAction{
-				Type:     models.ActionCSSDisplayNone,
-				Selector: f.Selector,
-			},
-		}
-		rules = append(rules, rule1)
-
-		// Rule 2: Apply everywhere except excluded domains
-		rule2 := models.WebKitRule{
-			Trigger: models.WebKitTrigger{
-				URLFilter:    ".*",
-				UnlessDomain: exclude,
-			},
-			Action: models.WebKitAction{
-				Type:     models.ActionCSSDisplayNone,
-				Selector: f.Selector,
-			},
-		}
-		rules = append(rules, rule2)
-
-		return rules, ""
+	if len(rawInclude) > 0 && len(include) == 0 {
+		return nil, models.SkipInvalidDomain
 	}
 
+	// WebKit only allows ONE of: if-domain, unless-domain, if-top-url,
+	// unless-top-url. With both, the rule is narrowed to the included
+	// domains: lifting it on excluded subdomains would need an
+	// ignore-previous-rules entry that also lifts every other rule there.
+	hasInclude := len(include) > 0
+	hasExclude := len(exclude) > 0 && !hasInclude
+
 	// Single rule case
 	rule := models.WebKitRule{
 		Trigger: models.WebKitTrigger{
@@ -310,7 +476,7 @@ func (c *Converter) convertCosmetic(f models.Filter, isException bool) ([]models
 		},
 		Action: models.WebKitAction{
 			Type:     models.ActionCSSDisplayNone,
-			Selector: f.Selector,
+			Selector: selector,
 		},
 	}
 
@@ -320,15 +486,43 @@ func (c *Converter) convertCosmetic(f models.Filter, isException bool) ([]models
 	if hasExclude {
 		rule.Trigger.UnlessDomain = exclude
 	}
+	if !hasInclude && !hasExclude && c.hotGeneric(selector) {
+		rule.Trigger.UnlessTopURL = c.opts.GenericUnlessTopURL
+		c.stats.TopURLRestricted++
+	}
 
 	return []models.WebKitRule{rule}, ""
 }
 
-// normalizeDomains adds * prefix for wildcard matching
-func normalizeDomains(domains []string) []string {
-	result := make([]string, len(domains))
-	for i, d := range domains {
-		result[i] = normalizeDomain(d)
+// resolveDomains normalizes filter domains for WebKit: entities (example.*)
+// are expanded via the public suffix list, internationalized names are
+// converted to punycode and entries that are not registrable domains are
+// dropped. The result carries the * prefix for subdomain matching.
+func (c *Converter) resolveDomains(domains []string) []string {
+	if len(domains) == 0 {
+		return nil
+	}
+
+	result := make([]string, 0, len(domains))
+	for _, d := range domains {
+		name, err := psl.Normalize(d)
+		if err != nil {
+			c.stats.InvalidDomains++
+			continue
+		}
+
+		if psl.IsEntity(name) {
+			for _, expanded := range c.suffixes.ExpandEntity(name) {
+				result = append(result, normalizeDomain(expanded))
+			}
+			continue
+		}
+
+		if !c.suffixes.IsValidDomain(name) {
+			c.stats.InvalidDomains++
+			continue
+		}
+		result = append(result, normalizeDomain(name))
 	}
 	return result
 }
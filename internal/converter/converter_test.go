@@ -0,0 +1,432 @@
+package converter
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertDomainResolution(t *testing.T) {
+	tests := []struct {
+		name          string
+		filter        models.Filter
+		expectSkipped bool
+		contains      []string
+		notContains   []string
+	}{
+		{
+			name: "entity domain expanded via public suffix list",
+			filter: models.Filter{
+				Type:     models.FilterTypeCosmetic,
+				Selector: ".ad",
+				Domains:  []string{"google.*"},
+			},
+			contains: []string{"*google.com", "*google.co.uk", "*google.de"},
+		},
+		{
+			name: "internationalized domain converted to punycode",
+			filter: models.Filter{
+				Type:    models.FilterTypeNetwork,
+				Pattern: "||ads.example.com^",
+				Options: models.FilterOptions{Domains: []string{"bücher.de"}},
+			},
+			contains: []string{"*xn--bcher-kva.de"},
+		},
+		{
+			name: "garbage domain tokens dropped",
+			filter: models.Filter{
+				Type:     models.FilterTypeCosmetic,
+				Selector: ".ad",
+				Domains:  []string{"example.com", "com", "not a domain"},
+			},
+			contains:    []string{"*example.com"},
+			notContains: []string{"*com", "*not a domain"},
+		},
+		{
+			name: "only garbage include domains skips the filter",
+			filter: models.Filter{
+				Type:    models.FilterTypeNetwork,
+				Pattern: "/ads.js",
+				Options: models.FilterOptions{Domains: []string{"localhost"}},
+			},
+			expectSkipped: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			rules := c.Convert([]models.Filter{tt.filter})
+
+			if tt.expectSkipped {
+				assert.Empty(t, rules)
+				assert.Equal(t, 1, c.stats.SkipReasons[models.SkipInvalidDomain])
+				return
+			}
+
+			assert.NotEmpty(t, rules)
+			for _, d := range tt.contains {
+				assert.Contains(t, rules[0].Trigger.IfDomain, d)
+			}
+			for _, d := range tt.notContains {
+				assert.NotContains(t, rules[0].Trigger.IfDomain, d)
+			}
+		})
+	}
+}
+
+func TestConvertWildcardTLD(t *testing.T) {
+	c := New()
+	rules := c.Convert([]models.Filter{{Type: models.FilterTypeNetwork, Pattern: "||example.*^"}})
+	assert.NotEmpty(t, rules)
+
+	urls := []string{
+		"https://example.com/ads.js",
+		"https://www.example.de/",
+		"https://example.co.uk/x",
+		"https://example.com.br/",
+	}
+	for _, u := range urls {
+		assert.True(t, anyRuleMatches(t, rules, u), u)
+	}
+	// A plain .* TLD conversion would also match these
+	for _, u := range []string{"https://example.evil.net/", "https://example.website.org/"} {
+		assert.False(t, anyRuleMatches(t, rules, u), u)
+	}
+
+	for _, r := range rules {
+		assert.True(t, ValidateRegex(r.Trigger.URLFilter), r.Trigger.URLFilter)
+		assert.NotContains(t, r.Trigger.URLFilter, tldPlaceholder)
+	}
+}
+
+func TestWildcardTLDHost(t *testing.T) {
+	for pattern, expected := range map[string]bool{
+		"||example.*^":       true,
+		"||example.*/ads":    true,
+		"||example.*":        true,
+		"||example.com^":     false,
+		"||*.example.*^":     false,
+		"example.*^":         false,
+		"||example.com/*.js": false,
+	} {
+		_, ok := wildcardTLDHost(pattern)
+		assert.Equal(t, expected, ok, pattern)
+	}
+}
+
+func anyRuleMatches(t *testing.T, rules []models.WebKitRule, url string) bool {
+	t.Helper()
+	for _, r := range rules {
+		if regexp.MustCompile(r.Trigger.URLFilter).MatchString(url) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestConvertMixedDomainConditions(t *testing.T) {
+	thirdParty := true
+	c := New()
+	rules := c.Convert([]models.Filter{{
+		Type:    models.FilterTypeNetwork,
+		Pattern: "/ads.js",
+		Options: models.FilterOptions{
+			ThirdParty:     &thirdParty,
+			Domains:        []string{"example.com"},
+			ExcludeDomains: []string{"sub.example.com", "other.org"},
+		},
+	}})
+
+	// Narrowed to example.com: lifting the nested exclusion would also lift
+	// the rules of other lists there
+	assert.Len(t, rules, 1)
+	assert.Equal(t, models.ActionBlock, rules[0].Action.Type)
+	assert.Equal(t, []string{"*example.com"}, rules[0].Trigger.IfDomain)
+	for _, r := range rules {
+		assert.Empty(t, r.Trigger.UnlessDomain)
+		assert.Equal(t, []string{models.LoadThirdParty}, r.Trigger.LoadType)
+	}
+}
+
+func TestConvertMixedDomainCosmetic(t *testing.T) {
+	rules := New().Convert([]models.Filter{{
+		Type:     models.FilterTypeCosmetic,
+		Selector: ".ad",
+		Domains:  []string{"example.com", "~sub.example.com"},
+	}})
+
+	assert.Len(t, rules, 1)
+	assert.Equal(t, []string{"*example.com"}, rules[0].Trigger.IfDomain)
+	assert.Empty(t, rules[0].Trigger.UnlessDomain)
+}
+
+func TestConvertLoadContext(t *testing.T) {
+	p := parser.New()
+	filters, err := p.Parse(strings.NewReader("||ads.example.com^$subdocument,script\n||popup.example.com^$popup\n"))
+	assert.NoError(t, err)
+
+	rules := New().Convert(filters)
+	var frameRules, scriptRules, popupRules int
+	for _, r := range rules {
+		switch {
+		case slices.Contains(r.Trigger.ResourceType, models.ResourceDocument):
+			assert.Equal(t, []string{models.LoadContextChildFrame}, r.Trigger.LoadContext)
+			frameRules++
+		case slices.Contains(r.Trigger.ResourceType, models.ResourceScript):
+			assert.Empty(t, r.Trigger.LoadContext)
+			scriptRules++
+		case slices.Contains(r.Trigger.ResourceType, models.ResourcePopup):
+			assert.Equal(t, []string{models.LoadContextTopFrame}, r.Trigger.LoadContext)
+			popupRules++
+		}
+	}
+	assert.Positive(t, frameRules)
+	assert.Positive(t, scriptRules)
+	assert.Positive(t, popupRules)
+
+	// Targets without load-context keep a single broader trigger
+	for _, r := range NewForTarget(Targets["safari14"]).Convert(filters) {
+		assert.Empty(t, r.Trigger.LoadContext)
+	}
+}
+
+func TestConvertSubdocumentException(t *testing.T) {
+	convert := func(c *Converter, line string) []models.WebKitRule {
+		filters, err := parser.New().Parse(strings.NewReader(line))
+		require.NoError(t, err)
+		return c.Convert(filters)
+	}
+
+	// Excluded embedding pages keep the frame blocked: only the included
+	// domain itself stays allowed, not all its subdomains
+	rules := convert(New(), "@@||embed.example.com/player$subdocument,domain=site.com|~sub.site.com|other.org")
+	require.Len(t, rules, 1)
+	assert.Equal(t, []string{"site.com", "*other.org"}, rules[0].Trigger.IfDomain)
+	assert.Empty(t, rules[0].Trigger.UnlessDomain)
+	assert.Equal(t, []string{models.ResourceDocument}, rules[0].Trigger.ResourceType)
+	assert.Equal(t, []string{models.LoadContextChildFrame}, rules[0].Trigger.LoadContext)
+
+	// Other types of the same exception keep the broader domain scope
+	rules = convert(New(), "@@||embed.example.com/player$subdocument,script,domain=site.com|~sub.site.com")
+	require.Len(t, rules, 2)
+	assert.Equal(t, []string{models.ResourceScript}, rules[0].Trigger.ResourceType)
+	assert.Equal(t, []string{"*site.com"}, rules[0].Trigger.IfDomain)
+	assert.Equal(t, []string{"site.com"}, rules[1].Trigger.IfDomain)
+
+	// Without load-context, framing pages must differ from the framed host
+	safari14 := NewForTarget(Targets["safari14"])
+	rules = convert(safari14, "@@||embed.example.com/player$subdocument,domain=~blog.example.org")
+	require.Len(t, rules, 1)
+	assert.Equal(t, []string{"*blog.example.org", "*embed.example.com"}, rules[0].Trigger.UnlessDomain)
+	rules = convert(safari14, "@@||embed.example.com/player$subdocument,domain=site.com")
+	require.Len(t, rules, 1)
+	assert.Equal(t, []string{"*site.com"}, rules[0].Trigger.IfDomain)
+	assert.Empty(t, rules[0].Trigger.UnlessDomain)
+
+	// Blocks are narrowed to the included domains without a lift
+	rules = convert(New(), "||embed.example.com/player$subdocument,domain=site.com|~sub.site.com")
+	require.Len(t, rules, 1)
+	assert.Equal(t, models.ActionBlock, rules[0].Action.Type)
+	assert.Equal(t, []string{"*site.com"}, rules[0].Trigger.IfDomain)
+}
+
+func TestConvertTopURLSubstitution(t *testing.T) {
+	filter := models.Filter{
+		Type:     models.FilterTypeCosmetic,
+		Selector: ".ad",
+		Domains:  []string{"a.com", "b.com", "c.org"},
+	}
+
+	c := NewWithOptions(Options{Target: Targets[DefaultTarget], TopURLThreshold: 2, TopURLChunkSize: 2})
+	rules := c.Convert([]models.Filter{filter})
+
+	assert.Len(t, rules, 2)
+	assert.Empty(t, rules[0].Trigger.IfDomain)
+	assert.Len(t, rules[0].Trigger.IfTopURL, 2)
+	assert.Len(t, rules[1].Trigger.IfTopURL, 1)
+	for _, r := range rules {
+		assert.Equal(t, ".ad", r.Action.Selector)
+		for _, topURL := range r.Trigger.IfTopURL {
+			assert.True(t, ValidateRegex(topURL), topURL)
+		}
+	}
+
+	top := regexp.MustCompile(rules[0].Trigger.IfTopURL[0])
+	assert.True(t, top.MatchString("https://www.a.com/page"))
+	assert.True(t, top.MatchString("https://a.com/"))
+	assert.False(t, top.MatchString("https://evila.com/"))
+	assert.False(t, top.MatchString("https://a.com.evil.net/"))
+
+	// Short lists keep if-domain
+	rules = NewWithOptions(Options{Target: Targets[DefaultTarget], TopURLThreshold: 3}).Convert([]models.Filter{filter})
+	assert.Len(t, rules, 1)
+	assert.Len(t, rules[0].Trigger.IfDomain, 3)
+}
+
+func TestConvertDefaultResourceTypes(t *testing.T) {
+	filters, err := parser.New().Parse(strings.NewReader("||ads.example.com^\n||cdn.example.com/a$image\n@@||ads.example.com/ok\n##.ad\n"))
+	require.NoError(t, err)
+
+	defaults := []string{models.ResourceScript, models.ResourceRaw}
+	c := NewWithOptions(Options{Target: Targets[DefaultTarget], DefaultResourceTypes: defaults})
+	rules := c.Convert(filters)
+	require.Len(t, rules, 5)
+	// Both variants of the ^ filter get the defaults, typed filters and
+	// exceptions keep their own
+	assert.Equal(t, defaults, rules[0].Trigger.ResourceType)
+	assert.Equal(t, defaults, rules[1].Trigger.ResourceType)
+	assert.Equal(t, []string{models.ResourceImage}, rules[2].Trigger.ResourceType)
+	assert.Empty(t, rules[3].Trigger.ResourceType)
+	assert.Empty(t, rules[4].Trigger.ResourceType)
+	assert.Equal(t, 1, c.Stats().DefaultTyped)
+
+	assert.NoError(t, ValidateDefaultTypes(defaults))
+	assert.Error(t, ValidateDefaultTypes([]string{"xhr"}))
+	assert.Error(t, ValidateDefaultTypes([]string{models.ResourceDocument}))
+}
+
+func TestConvertGenericUnlessTopURL(t *testing.T) {
+	filters, err := parser.New().Parse(strings.NewReader("##.ad\n##.banner\n~example.org##.ad\nexample.com##.ad\n"))
+	require.NoError(t, err)
+	search := "^https?://([^/]*\\.)?google\\.[a-z]+/search"
+	require.True(t, ValidateRegex(search))
+
+	// Only generic rules hiding a hot selector, without domain conditions
+	c := NewWithOptions(Options{Target: Targets[DefaultTarget], GenericUnlessTopURL: []string{search}, GenericHotSelectors: []string{".ad"}})
+	rules := c.Convert(filters)
+	require.Len(t, rules, 4)
+	assert.Equal(t, []string{search}, rules[0].Trigger.UnlessTopURL)
+	assert.Empty(t, rules[1].Trigger.UnlessTopURL)
+	assert.Empty(t, rules[2].Trigger.UnlessTopURL)
+	assert.Equal(t, []string{"*example.org"}, rules[2].Trigger.UnlessDomain)
+	assert.Empty(t, rules[3].Trigger.UnlessTopURL)
+	assert.Equal(t, 1, c.Stats().TopURLRestricted)
+
+	// Every generic rule without hot selectors
+	c = NewWithOptions(Options{Target: Targets[DefaultTarget], GenericUnlessTopURL: []string{search}})
+	rules = c.Convert(filters)
+	assert.Equal(t, 2, c.Stats().TopURLRestricted)
+	for _, r := range rules {
+		assert.Empty(t, LintRule(r, Targets[DefaultTarget]))
+	}
+
+	// Exceptions add pages instead of unless-domain
+	result, changed := NeutralizeCosmetic(rules[:1], []CosmeticException{{Selector: ".ad", Domains: []string{"*example.com"}}})
+	assert.Equal(t, 1, changed)
+	assert.Equal(t, []string{search, TopURLPattern("*example.com")}, result[0].Trigger.UnlessTopURL)
+	assert.Empty(t, result[0].Trigger.UnlessDomain)
+}
+
+func TestConvertRemoveParam(t *testing.T) {
+	p := parser.New()
+	filters, err := p.Parse(strings.NewReader("$removeparam=utm_source\n||example.com^$removeparam=fbclid\n$removeparam=page\n@@||example.org^$removeparam=gclid\n"))
+	assert.NoError(t, err)
+
+	// Skipped unless enabled
+	c := New()
+	assert.Empty(t, c.Convert(filters))
+	assert.Equal(t, 4, c.Stats().SkipReasons[models.SkipUnsupportedOption])
+
+	c = NewWithOptions(Options{Target: Targets[DefaultTarget], RemoveParamBlock: true})
+	rules := c.Convert(filters)
+	assert.Equal(t, 2, c.Stats().RemoveParam)
+	assert.Equal(t, 2, c.Stats().SkipReasons[models.SkipRemoveParam])
+
+	var matched []string
+	for _, r := range rules {
+		assert.Equal(t, []string{models.LoadThirdParty}, r.Trigger.LoadType)
+		assert.NotContains(t, r.Trigger.ResourceType, models.ResourceDocument)
+		re := regexp.MustCompile(r.Trigger.URLFilter)
+		for _, u := range []string{"https://cdn.net/a.js?utm_source=x", "https://cdn.net/a.js?x=1&utm_source=y", "https://example.com/p?fbclid=1", "https://cdn.net/a.js?page=2"} {
+			if re.MatchString(u) {
+				matched = append(matched, u)
+			}
+		}
+	}
+	assert.ElementsMatch(t, []string{"https://cdn.net/a.js?utm_source=x", "https://cdn.net/a.js?x=1&utm_source=y", "https://example.com/p?fbclid=1"}, matched)
+}
+
+func TestConvertSkipSamples(t *testing.T) {
+	filters, err := parser.New().Parse(strings.NewReader("##\n/[/\n/(/\n/)/\n/*/\n"))
+	require.NoError(t, err)
+
+	c := New()
+	c.Convert(filters)
+	stats := c.Stats()
+	assert.Equal(t, []string{"/[/", "/(/", "/)/"}, stats.Samples[models.SkipInvalidRegex])
+	assert.Equal(t, 4, stats.SkipReasons[models.SkipInvalidRegex])
+	assert.Equal(t, []string{"##"}, stats.Samples[models.SkipEmptySelector])
+}
+
+func TestConvertMatchCaseRegex(t *testing.T) {
+	tests := []struct {
+		name          string
+		filter        string
+		urlFilters    []string
+		caseSensitive bool
+	}{
+		{"regex keeps its case", `/Tracker[A-Z]+\.js/$match-case`, []string{`Tracker[A-Z]+\.js`}, true},
+		{"regex without match-case", `/Tracker[A-Z]+\.js/`, []string{`Tracker[A-Z]+\.js`}, false},
+		{"approximated variants", `/Ad{2}[0-9]|AdTrack/$match-case`, []string{`Add[0-9]`, `AdTrack`}, true},
+		{"only the hostname is lowercased", `||CDN.Example.com/Pixel.GIF$match-case`, []string{`^[a-z-]+://(?:[^/?#]+\.)?cdn\.example\.com/Pixel\.GIF`}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := parser.New().Parse(strings.NewReader(tt.filter))
+			require.NoError(t, err)
+			rules := NewWithOptions(Options{Approximation: ApproximateAll}).Convert(filters)
+			require.Len(t, rules, len(tt.urlFilters))
+			for i, r := range rules {
+				assert.Equal(t, tt.urlFilters[i], r.Trigger.URLFilter)
+				assert.Equal(t, tt.caseSensitive, isCaseSensitive(r.Trigger))
+			}
+		})
+	}
+}
+
+func TestConvertStrictParty(t *testing.T) {
+	convert := func(line string) []models.WebKitRule {
+		filters, err := parser.New().Parse(strings.NewReader(line))
+		require.NoError(t, err)
+		require.Len(t, filters, 1)
+		assert.True(t, filters[0].Options.StrictParty)
+		return New().Convert(filters)
+	}
+
+	// Only the host itself, from a page on that very host
+	rules := convert("||cdn.example.com/ads.js$strict1p")
+	require.Len(t, rules, 1)
+	assert.Equal(t, `^[a-z-]+://cdn\.example\.com/ads\.js`, rules[0].Trigger.URLFilter)
+	assert.Equal(t, []string{"cdn.example.com"}, rules[0].Trigger.IfDomain)
+	assert.Equal(t, []string{models.LoadFirstParty}, rules[0].Trigger.LoadType)
+
+	// The host from any other page, same site included, and its subdomains
+	// from other sites
+	rules = convert("||cdn.example.com/ads.js$strict3p")
+	require.Len(t, rules, 2)
+	assert.Equal(t, `^[a-z-]+://cdn\.example\.com/ads\.js`, rules[0].Trigger.URLFilter)
+	assert.Equal(t, []string{"cdn.example.com"}, rules[0].Trigger.UnlessDomain)
+	assert.Empty(t, rules[0].Trigger.LoadType)
+	assert.Equal(t, `^[a-z-]+://[^/?#]+\.cdn\.example\.com/ads\.js`, rules[1].Trigger.URLFilter)
+	assert.Equal(t, []string{models.LoadThirdParty}, rules[1].Trigger.LoadType)
+	assert.True(t, anyRuleMatches(t, rules, "https://cdn.example.com/ads.js"))
+	assert.True(t, anyRuleMatches(t, rules, "https://eu.cdn.example.com/ads.js"))
+
+	// Without a host to compare, the site-level load-type
+	rules = convert("/ads.js$strict3p")
+	require.Len(t, rules, 1)
+	assert.Equal(t, []string{models.LoadThirdParty}, rules[0].Trigger.LoadType)
+	assert.Empty(t, rules[0].Trigger.UnlessDomain)
+	rules = convert("||cdn.example.com/ads.js$strict1p,domain=example.com")
+	require.Len(t, rules, 1)
+	assert.Equal(t, []string{models.LoadFirstParty}, rules[0].Trigger.LoadType)
+	assert.Equal(t, []string{"*example.com"}, rules[0].Trigger.IfDomain)
+}
@@ -0,0 +1,147 @@
+package converter
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// CosmeticException is a #@# filter: hiding Selector is disabled on
+// Domains (normalized like if-domain entries), or everywhere when empty
+type CosmeticException struct {
+	Selector string
+	Domains  []string
+}
+
+// CosmeticExceptions returns the #@# filters seen by Convert. WebKit has no
+// cosmetic exception action, so they are applied to the generated hiding
+// rules with NeutralizeCosmetic instead.
+func (c *Converter) CosmeticExceptions() []CosmeticException {
+	return c.cosmeticExceptions
+}
+
+// recordCosmeticException normalizes and stores a #@# filter
+func (c *Converter) recordCosmeticException(f models.Filter) models.SkipReason {
+	if f.Selector == "" {
+		return models.SkipEmptySelector
+	}
+	// ~domain in an exception has no well-defined meaning
+	for _, d := range f.Domains {
+		if strings.HasPrefix(d, "~") {
+			return models.SkipCosmeticException
+		}
+	}
+
+	domains := c.resolveDomains(f.Domains)
+	if len(f.Domains) > 0 && len(domains) == 0 {
+		return models.SkipInvalidDomain
+	}
+
+	// Scoped like the hiding rules, an excluded selector has none to lift
+	selector, ok := c.scopeSelector(SimplifySelector(f.Selector))
+	if !ok {
+		return ""
+	}
+	c.cosmeticExceptions = append(c.cosmeticExceptions, CosmeticException{
+		Selector: selector,
+		Domains:  domains,
+	})
+	return ""
+}
+
+// NeutralizeCosmetic applies cosmetic exceptions to css-display-none rules:
+// a generic exception removes every rule hiding its selector, a domain
+// exception removes the domain from if-domain conditions (dropping rules
+// left without domains) or adds it to unless-domain. Rules restricted with
+// if-top-url are left alone. Returns the new rules and how many rules were
+// removed or restricted. The input rules are not modified.
+func NeutralizeCosmetic(rules []models.WebKitRule, exceptions []CosmeticException) ([]models.WebKitRule, int) {
+	if len(exceptions) == 0 {
+		return rules, 0
+	}
+
+	type lifted struct {
+		everywhere bool
+		domains    []string
+	}
+	bySelector := make(map[string]*lifted)
+	for _, e := range exceptions {
+		l := bySelector[e.Selector]
+		if l == nil {
+			l = &lifted{}
+			bySelector[e.Selector] = l
+		}
+		if len(e.Domains) == 0 {
+			l.everywhere = true
+		}
+		l.domains = append(l.domains, e.Domains...)
+	}
+
+	changed := 0
+	result := make([]models.WebKitRule, 0, len(rules))
+	for _, r := range rules {
+		l := bySelector[r.Action.Selector]
+		if r.Action.Type != models.ActionCSSDisplayNone || l == nil || len(r.Trigger.IfTopURL) > 0 {
+			result = append(result, r)
+			continue
+		}
+
+		if l.everywhere {
+			changed++
+			continue
+		}
+
+		r, lifted, keep := liftDomains(r, l.domains)
+		if lifted {
+			changed++
+		}
+		if keep {
+			result = append(result, r)
+		}
+	}
+	return result, changed
+}
+
+// liftDomains keeps a hiding rule off the pages of domains (normalized
+// like if-domain entries): they are removed from its if-domain condition,
+// dropping the rule when none is left, or added to unless-domain, or to
+// unless-top-url for rules kept off some pages already. Returns the rule,
+// whether it changed and whether it is kept.
+func liftDomains(r models.WebKitRule, domains []string) (models.WebKitRule, bool, bool) {
+	if len(r.Trigger.IfDomain) > 0 {
+		kept := slices.DeleteFunc(slices.Clone(r.Trigger.IfDomain), func(d string) bool {
+			return len(nestedDomains([]string{d}, domains)) > 0
+		})
+		if len(kept) == len(r.Trigger.IfDomain) {
+			return r, false, true
+		}
+		r.Trigger.IfDomain = kept
+		return r, true, len(kept) > 0
+	}
+
+	// Rules kept off some pages already cannot have unless-domain too
+	if len(r.Trigger.UnlessTopURL) > 0 {
+		unless := slices.Clone(r.Trigger.UnlessTopURL)
+		for _, d := range domains {
+			if p := TopURLPattern(d); !slices.Contains(unless, p) {
+				unless = append(unless, p)
+			}
+		}
+		changed := len(unless) != len(r.Trigger.UnlessTopURL)
+		r.Trigger.UnlessTopURL = unless
+		return r, changed, true
+	}
+
+	unless := slices.Clone(r.Trigger.UnlessDomain)
+	for _, d := range domains {
+		if !slices.Contains(unless, d) {
+			unless = append(unless, d)
+		}
+	}
+	changed := len(unless) != len(r.Trigger.UnlessDomain)
+	if changed {
+		r.Trigger.UnlessDomain = unless
+	}
+	return r, changed, true
+}
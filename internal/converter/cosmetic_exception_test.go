@@ -0,0 +1,57 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeutralizeCosmetic(t *testing.T) {
+	list := `##.ad
+example.com,example.org##.banner
+##.sponsor
+example.com#@#.ad
+example.com#@#.banner
+#@#.sponsor
+~example.net#@#.ad
+`
+	filters, err := parser.New().Parse(strings.NewReader(list))
+	require.NoError(t, err)
+
+	c := New()
+	rules := c.Convert(filters)
+	require.Len(t, rules, 3)
+	exceptions := c.CosmeticExceptions()
+	require.Len(t, exceptions, 3)
+	assert.Equal(t, 1, c.Stats().SkipReasons[models.SkipCosmeticException])
+
+	result, changed := NeutralizeCosmetic(rules, exceptions)
+	assert.Equal(t, 3, changed)
+	require.Len(t, result, 2)
+
+	assert.Equal(t, ".ad", result[0].Action.Selector)
+	assert.Equal(t, []string{"*example.com"}, result[0].Trigger.UnlessDomain)
+	assert.Equal(t, ".banner", result[1].Action.Selector)
+	assert.Equal(t, []string{"*example.org"}, result[1].Trigger.IfDomain)
+
+	// Inputs are left untouched, so applying again is harmless
+	assert.Empty(t, rules[0].Trigger.UnlessDomain)
+	again, _ := NeutralizeCosmetic(result, exceptions)
+	assert.Equal(t, result, again)
+}
+
+func TestNeutralizeCosmeticSubdomain(t *testing.T) {
+	rules := []models.WebKitRule{{
+		Trigger: models.WebKitTrigger{URLFilter: ".*", IfDomain: []string{"*shop.example.com", "*example.org"}},
+		Action:  models.WebKitAction{Type: models.ActionCSSDisplayNone, Selector: ".ad"},
+	}}
+
+	result, changed := NeutralizeCosmetic(rules, []CosmeticException{{Selector: ".ad", Domains: []string{"*example.com"}}})
+	assert.Equal(t, 1, changed)
+	require.Len(t, result, 1)
+	assert.Equal(t, []string{"*example.org"}, result[0].Trigger.IfDomain)
+}
@@ -0,0 +1,57 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertCoverage(t *testing.T) {
+	list := `||ads.example.com^$script,third-party
+||cdn.example.com^$~third-party,domain=example.org
+/ad(s|v)[0-9]{2}/$script
+||example.com^$removeparam=utm_source
+||example.com^$redirect=noopjs,script
+||example.net^$inline-script
+`
+	p := parser.New()
+	filters, err := p.Parse(strings.NewReader(list))
+	require.NoError(t, err)
+
+	c := NewWithOptions(Options{Approximation: ApproximateAll, RemoveParamBlock: true})
+	c.Convert(filters)
+
+	coverage := make(models.Coverage)
+	coverage.Merge(p.Stats().Coverage)
+	coverage.Merge(c.Stats().Coverage)
+
+	assert.Equal(t, models.OptionCoverage{Option: "script", Filters: 3, Converted: 1, Approximated: 1, Skipped: 1}, coverage["script"])
+	assert.Equal(t, models.OptionCoverage{Option: "third-party", Filters: 2, Converted: 2}, coverage["third-party"])
+	assert.Equal(t, models.OptionCoverage{Option: "removeparam", Filters: 1, Approximated: 1}, coverage["removeparam"])
+	assert.Equal(t, models.OptionCoverage{Option: "redirect", Filters: 1, Skipped: 1}, coverage["redirect"])
+	assert.Equal(t, models.OptionCoverage{Option: "inline-script", Filters: 1, Skipped: 1}, coverage["inline-script"])
+
+	// Most skipped first, then most approximated
+	sorted := coverage.Sorted()
+	assert.Equal(t, "script", sorted[0].Option)
+	assert.Equal(t, "inline-script", sorted[1].Option)
+	assert.Equal(t, "redirect", sorted[2].Option)
+}
+
+func TestConvertCoverageSalvaged(t *testing.T) {
+	p := parser.New()
+	p.SalvageOptions(true)
+	filters, err := p.Parse(strings.NewReader("||example.com/ad.js$redirect=noopjs,script\n"))
+	require.NoError(t, err)
+
+	c := New()
+	rules := c.Convert(filters)
+	require.Len(t, rules, 1)
+	assert.Equal(t, models.ActionBlock, rules[0].Action.Type)
+	assert.Equal(t, 1, c.Stats().Salvaged)
+	assert.Equal(t, models.OptionCoverage{Option: "redirect", Filters: 1, Approximated: 1}, c.Stats().Coverage["redirect"])
+}
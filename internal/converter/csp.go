@@ -0,0 +1,95 @@
+package converter
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/psl"
+)
+
+// Content-Security-Policy directives uBO injects for $inline-script and
+// $inline-font: only sources from the network are allowed, not inline ones
+const (
+	CSPInlineScript = "script-src 'unsafe-eval' * blob: data:"
+	CSPInlineFont   = "font-src *"
+)
+
+// CSPAllSites is the CSPSuggestion domain of filters without a domain
+const CSPAllSites = "*"
+
+// CSPSuggestion is a policy directive a filter asks for on a domain (and its
+// subdomains). Content blockers cannot set response headers, so host apps
+// may apply these through their own response policies.
+type CSPSuggestion struct {
+	Domain    string `json:"domain"`
+	Directive string `json:"directive"`
+	Exception bool   `json:"exception,omitempty"`
+}
+
+// CSPSuggestions returns the $inline-script/$inline-font filters seen by
+// Convert
+func (c *Converter) CSPSuggestions() []CSPSuggestion {
+	return c.cspSuggestions
+}
+
+// recordInline stores the CSP suggestions of an $inline-script or
+// $inline-font filter and returns the reason it is not converted
+func (c *Converter) recordInline(f models.Filter, isException bool) models.SkipReason {
+	reason := models.SkipInlineFont
+	var directives []string
+	if f.Options.InlineScript {
+		reason = models.SkipInlineScript
+		directives = append(directives, CSPInlineScript)
+	}
+	if f.Options.InlineFont {
+		directives = append(directives, CSPInlineFont)
+	}
+
+	var domains []string
+	switch pattern := strings.TrimSuffix(f.Pattern, "^"); {
+	case len(f.Options.Domains) > 0:
+		for _, d := range c.resolveDomains(f.Options.Domains) {
+			domains = append(domains, strings.TrimPrefix(d, "*"))
+		}
+	case pattern == "" || pattern == "*":
+		domains = []string{CSPAllSites}
+	case strings.HasPrefix(pattern, "||") && !strings.ContainsAny(pattern[2:], "*/^|"):
+		// The policy applies to documents from the filter's host
+		if host, err := psl.Normalize(pattern[2:]); err == nil {
+			domains = []string{host}
+		}
+	}
+
+	for _, d := range domains {
+		for _, directive := range directives {
+			c.cspSuggestions = append(c.cspSuggestions, CSPSuggestion{Domain: d, Directive: directive, Exception: isException})
+		}
+	}
+	return reason
+}
+
+// MergeCSP combines suggestions into the directives per domain, with
+// exceptions removing a directive from their domain (or every domain)
+func MergeCSP(suggestions []CSPSuggestion) map[string][]string {
+	result := make(map[string][]string)
+	for _, s := range suggestions {
+		if !s.Exception && !slices.Contains(result[s.Domain], s.Directive) {
+			result[s.Domain] = append(result[s.Domain], s.Directive)
+		}
+	}
+	for _, s := range suggestions {
+		if !s.Exception {
+			continue
+		}
+		for domain, directives := range result {
+			if s.Domain == CSPAllSites || domain == s.Domain {
+				result[domain] = slices.DeleteFunc(directives, func(d string) bool { return d == s.Directive })
+			}
+			if len(result[domain]) == 0 {
+				delete(result, domain)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertInlineScript(t *testing.T) {
+	list := `||Example.com^$inline-script
+*$inline-font,domain=example.org|~shop.example.org
+$inline-script
+||example.net/path$inline-script
+@@||example.com^$inline-script
+@@$inline-font,domain=example.org
+`
+	filters, err := parser.New().Parse(strings.NewReader(list))
+	require.NoError(t, err)
+
+	c := New()
+	assert.Empty(t, c.Convert(filters))
+	stats := c.Stats()
+	assert.Equal(t, 4, stats.SkipReasons[models.SkipInlineScript])
+	assert.Equal(t, 2, stats.SkipReasons[models.SkipInlineFont])
+
+	// Negated domains cannot be expressed and paths do not name a document
+	assert.Equal(t, []CSPSuggestion{
+		{Domain: "example.com", Directive: CSPInlineScript},
+		{Domain: "example.org", Directive: CSPInlineFont},
+		{Domain: CSPAllSites, Directive: CSPInlineScript},
+		{Domain: "example.com", Directive: CSPInlineScript, Exception: true},
+		{Domain: "example.org", Directive: CSPInlineFont, Exception: true},
+	}, c.CSPSuggestions())
+
+	assert.Equal(t, map[string][]string{CSPAllSites: {CSPInlineScript}}, MergeCSP(c.CSPSuggestions()))
+}
+
+func TestMergeCSPGlobalException(t *testing.T) {
+	merged := MergeCSP([]CSPSuggestion{
+		{Domain: "example.com", Directive: CSPInlineScript},
+		{Domain: "example.com", Directive: CSPInlineFont},
+		{Domain: "example.org", Directive: CSPInlineScript},
+		{Domain: CSPAllSites, Directive: CSPInlineScript, Exception: true},
+	})
+	assert.Equal(t, map[string][]string{"example.com": {CSPInlineFont}}, merged)
+}
@@ -0,0 +1,44 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// ExceptionSource is an @@ filter with the ignore-previous-rules rules it
+// was converted to, so host apps can show and apply exceptions one by one
+type ExceptionSource struct {
+	ID     string              `json:"id"` // stable across builds while the filter is unchanged
+	Filter string              `json:"filter"`
+	Rules  []models.WebKitRule `json:"rules"`
+}
+
+// Exceptions returns the exception filters converted by Convert, in list
+// order
+func (c *Converter) Exceptions() []ExceptionSource {
+	return c.exceptions
+}
+
+// recordException stores the exception rules converted from a filter
+func (c *Converter) recordException(raw string, rules []models.WebKitRule) {
+	var exceptions []models.WebKitRule
+	for _, r := range rules {
+		if r.Action.Type == models.ActionIgnorePreviousRule {
+			exceptions = append(exceptions, r)
+		}
+	}
+	if len(exceptions) == 0 {
+		return
+	}
+	// The parser keeps exception lines without their @@
+	filter := "@@" + raw
+	c.exceptions = append(c.exceptions, ExceptionSource{ID: ExceptionID(filter), Filter: filter, Rules: exceptions})
+}
+
+// ExceptionID identifies an exception filter by its text
+func ExceptionID(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,38 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExceptions(t *testing.T) {
+	list := `||ads.example.com^
+@@||ads.example.com/ok.js$script,domain=shop.example.com
+@@||cdn.example.net^$image
+@@||example.org^$inline-script
+`
+	filters, err := parser.New().Parse(strings.NewReader(list))
+	require.NoError(t, err)
+
+	c := New()
+	c.Convert(filters)
+	exceptions := c.Exceptions()
+
+	// Filters that convert to no rule are left out
+	require.Len(t, exceptions, 2)
+	assert.Equal(t, "@@||ads.example.com/ok.js$script,domain=shop.example.com", exceptions[0].Filter)
+	assert.Equal(t, "@@||cdn.example.net^$image", exceptions[1].Filter)
+	for _, e := range exceptions {
+		assert.Equal(t, ExceptionID(e.Filter), e.ID)
+		require.NotEmpty(t, e.Rules)
+		for _, r := range e.Rules {
+			assert.Equal(t, models.ActionIgnorePreviousRule, r.Action.Type)
+		}
+	}
+	assert.NotEqual(t, exceptions[0].ID, exceptions[1].ID)
+}
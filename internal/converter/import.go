@@ -0,0 +1,101 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// validActions are the action types the output format can represent
+var validActions = map[string]bool{
+	models.ActionBlock:              true,
+	models.ActionBlockCookies:       true,
+	models.ActionCSSDisplayNone:     true,
+	models.ActionIgnorePreviousRule: true,
+}
+
+// Import reads an existing WebKit content blocker JSON file (hand-written
+// Safari rules, AdGuard's converter output, ...) so it can be merged with
+// converted lists. Rules using fields or actions this tool cannot represent
+// are skipped rather than silently stripped, and every kept rule goes
+// through the same validation and sanitizing as converted ones.
+func (c *Converter) Import(data []byte) ([]models.WebKitRule, error) {
+	return c.ImportReader(bytes.NewReader(data))
+}
+
+// ImportReader is Import reading the JSON array as it arrives, one rule at
+// a time, so the whole document is never held in memory
+func (c *Converter) ImportReader(r io.Reader) ([]models.WebKitRule, error) {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, fmt.Errorf("decoding content blocker JSON: %w", errNotArray(err))
+	}
+
+	var rules []models.WebKitRule
+	for dec.More() {
+		var msg json.RawMessage
+		if err := dec.Decode(&msg); err != nil {
+			return nil, fmt.Errorf("decoding content blocker JSON: %w", err)
+		}
+		rule, reason := c.decodeRule(msg)
+		if reason != "" {
+			c.skip(reason, string(msg))
+			continue
+		}
+		rules = append(rules, c.sanitize(c.scopeCosmetic(c.neverBlock(c.transform([]models.WebKitRule{rule}))), string(msg))...)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("decoding content blocker JSON: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("decoding content blocker JSON: data after the rule array")
+	}
+
+	c.stats.Converted += len(rules)
+	return rules, nil
+}
+
+// errNotArray explains a document that does not start with an array
+func errNotArray(err error) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("expected an array of rules")
+}
+
+// decodeRule strictly decodes and validates a single rule
+func (c *Converter) decodeRule(msg json.RawMessage) (models.WebKitRule, models.SkipReason) {
+	var r models.WebKitRule
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&r); err != nil {
+		return r, models.SkipUnsupportedField
+	}
+
+	if !validActions[r.Action.Type] {
+		return r, models.SkipInvalidAction
+	}
+	if r.Action.Type == models.ActionCSSDisplayNone && r.Action.Selector == "" {
+		return r, models.SkipEmptySelector
+	}
+	if r.Trigger.URLFilter == "" {
+		return r, models.SkipEmptyURLFilter
+	}
+	if !ValidateRegex(r.Trigger.URLFilter) {
+		return r, models.SkipInvalidRegex
+	}
+	for _, topURL := range slices.Concat(r.Trigger.IfTopURL, r.Trigger.UnlessTopURL) {
+		if !ValidateRegex(topURL) {
+			return r, models.SkipInvalidRegex
+		}
+	}
+	// Dropping the condition would widen the rule
+	if len(r.Trigger.LoadContext) > 0 && !c.opts.Target.LoadContext {
+		return r, models.SkipUnsupportedByTarget
+	}
+	return r, ""
+}
@@ -0,0 +1,73 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImport(t *testing.T) {
+	data := []byte(`[
+		{"trigger": {"url-filter": "ads\\.example\\.com", "resource-type": ["script"]}, "action": {"type": "block"}},
+		{"trigger": {"url-filter": ".*", "if-domain": ["*example.org"]}, "action": {"type": "css-display-none", "selector": ".banner"}},
+		{"trigger": {"url-filter": ".*", "if-top-url": ["^https://example\\.net/"]}, "action": {"type": "block"}},
+		{"trigger": {"url-filter": ".*", "if-frame-url": ["https://example.net"]}, "action": {"type": "block"}},
+		{"trigger": {"url-filter": ".*"}, "action": {"type": "make-https"}},
+		{"trigger": {"url-filter": ""}, "action": {"type": "block"}},
+		{"trigger": {"url-filter": "a|b"}, "action": {"type": "block"}},
+		{"trigger": {"url-filter": ".*"}, "action": {"type": "css-display-none", "selector": ".a\n.b"}}
+	]`)
+
+	c := New()
+	rules, err := c.Import(data)
+	require.NoError(t, err)
+
+	require.Len(t, rules, 4)
+	assert.Equal(t, []string{models.ResourceScript}, rules[0].Trigger.ResourceType)
+	assert.Equal(t, []string{"*example.org"}, rules[1].Trigger.IfDomain)
+	assert.Equal(t, []string{`^https://example\.net/`}, rules[2].Trigger.IfTopURL)
+	assert.Equal(t, ".a .b", rules[3].Action.Selector)
+
+	stats := c.Stats()
+	assert.Equal(t, 4, stats.Converted)
+	assert.Equal(t, 1, stats.SkipReasons[models.SkipUnsupportedField])
+	assert.Equal(t, 1, stats.SkipReasons[models.SkipInvalidAction])
+	assert.Equal(t, 1, stats.SkipReasons[models.SkipEmptyURLFilter])
+	assert.Equal(t, 1, stats.SkipReasons[models.SkipInvalidRegex])
+}
+
+func TestImportInvalidJSON(t *testing.T) {
+	_, err := New().Import([]byte(`{"trigger": {}}`))
+	assert.Error(t, err)
+}
+
+func TestImportTargetFeatures(t *testing.T) {
+	data := []byte(`[{"trigger": {"url-filter": ".*", "load-context": ["child-frame"]}, "action": {"type": "block"}}]`)
+
+	rules, err := New().Import(data)
+	require.NoError(t, err)
+	assert.Len(t, rules, 1)
+
+	c := NewForTarget(Targets["safari14"])
+	rules, err = c.Import(data)
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+	assert.Equal(t, 1, c.Stats().SkipReasons[models.SkipUnsupportedByTarget])
+}
+
+func TestImportReaderRejectsTrailingData(t *testing.T) {
+	rule := `{"trigger": {"url-filter": "ads"}, "action": {"type": "block"}}`
+
+	rules, err := New().ImportReader(strings.NewReader("[" + rule + "]\n"))
+	require.NoError(t, err)
+	assert.Len(t, rules, 1)
+
+	_, err = New().ImportReader(strings.NewReader("[" + rule + "] [" + rule + "]"))
+	assert.ErrorContains(t, err, "data after the rule array")
+
+	_, err = New().ImportReader(strings.NewReader("[" + rule))
+	assert.Error(t, err)
+}
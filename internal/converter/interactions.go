@@ -0,0 +1,163 @@
+package converter
+
+import (
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// maxInteractionSamples is the number of lifted url-filters kept per
+// interaction
+const maxInteractionSamples = 3
+
+// ListRules are the rules a list contributes to the combined output, in
+// combined order, with the exception filters they were converted from
+type ListRules struct {
+	Name               string
+	Rules              []models.WebKitRule // block, exception and hiding rules, generic ones included
+	Exceptions         []ExceptionSource
+	CosmeticExceptions []CosmeticException
+}
+
+// Interaction is an exception filter of one list lifting rules of another
+type Interaction struct {
+	List      string   `json:"list"`      // list of the exception
+	Exception string   `json:"exception"` // the @@ or #@# filter
+	Target    string   `json:"target"`    // list whose rules it lifts
+	Lifted    int      `json:"lifted"`    // rules it lifts entirely
+	Narrowed  int      `json:"narrowed"`  // rules it lifts on some requests or pages
+	Samples   []string `json:"samples,omitempty"`
+}
+
+// interactionIndex finds the rules of a list an exception can apply to
+type interactionIndex struct {
+	byFilter   map[string][]int // block rules by url-filter
+	byHost     map[string][]int // block rules by anchored hostname
+	bySelector map[string][]models.WebKitRule
+}
+
+func newInteractionIndex(rules []models.WebKitRule) interactionIndex {
+	idx := interactionIndex{
+		byFilter:   make(map[string][]int),
+		byHost:     make(map[string][]int),
+		bySelector: make(map[string][]models.WebKitRule),
+	}
+	for i, r := range rules {
+		switch r.Action.Type {
+		case models.ActionBlock:
+			idx.byFilter[r.Trigger.URLFilter] = append(idx.byFilter[r.Trigger.URLFilter], i)
+			if host, ok := anchoredHost(r.Trigger.URLFilter); ok {
+				idx.byHost[host] = append(idx.byHost[host], i)
+			}
+		case models.ActionCSSDisplayNone:
+			idx.bySelector[r.Action.Selector] = append(idx.bySelector[r.Action.Selector], r)
+		}
+	}
+	return idx
+}
+
+// Interactions reports which exceptions of each list lift rules of other
+// lists. A @@ exception only lifts block rules placed before it, so those
+// of earlier lists: entirely when it negates the rule like
+// NarrowExceptions decides, partly when it is anchored to the rule's host
+// or a subdomain of it with a different url-filter. A #@# exception
+// applies to the hiding rules of every list, removing or restricting them
+// like NeutralizeCosmetic. Interactions are in list and exception order.
+func Interactions(lists []ListRules) []Interaction {
+	indexes := make([]interactionIndex, len(lists))
+	for i, l := range lists {
+		indexes[i] = newInteractionIndex(l.Rules)
+	}
+
+	var result []Interaction
+	for i, l := range lists {
+		for _, src := range l.Exceptions {
+			for j := range i {
+				if in, ok := networkInteraction(src, lists[j].Rules, indexes[j]); ok {
+					in.List, in.Target = l.Name, lists[j].Name
+					result = append(result, in)
+				}
+			}
+		}
+		for _, e := range l.CosmeticExceptions {
+			for j := range lists {
+				if j == i {
+					continue
+				}
+				rules := indexes[j].bySelector[e.Selector]
+				kept, changed := NeutralizeCosmetic(rules, []CosmeticException{e})
+				if changed == 0 {
+					continue
+				}
+				removed := len(rules) - len(kept)
+				result = append(result, Interaction{
+					List:      l.Name,
+					Exception: cosmeticExceptionFilter(e),
+					Target:    lists[j].Name,
+					Lifted:    removed,
+					Narrowed:  changed - removed,
+				})
+			}
+		}
+	}
+	return result
+}
+
+// networkInteraction counts the block rules of an earlier list the
+// exception rules of a filter lift
+func networkInteraction(src ExceptionSource, rules []models.WebKitRule, idx interactionIndex) (Interaction, bool) {
+	lifted := make(map[int]bool)
+	narrowed := make(map[int]bool)
+	for _, e := range src.Rules {
+		if e.Action.Type != models.ActionIgnorePreviousRule {
+			continue
+		}
+		for _, b := range idx.byFilter[e.Trigger.URLFilter] {
+			if negates(rules[b].Trigger, e.Trigger) {
+				lifted[b] = true
+			}
+		}
+		host, ok := anchoredHost(e.Trigger.URLFilter)
+		if !ok {
+			continue
+		}
+		for d := host; ; {
+			for _, b := range idx.byHost[d] {
+				if rules[b].Trigger.URLFilter != e.Trigger.URLFilter {
+					narrowed[b] = true
+				}
+			}
+			dot := strings.IndexByte(d, '.')
+			if dot == -1 {
+				break
+			}
+			d = d[dot+1:]
+		}
+	}
+	for b := range lifted {
+		delete(narrowed, b)
+	}
+	if len(lifted)+len(narrowed) == 0 {
+		return Interaction{}, false
+	}
+
+	in := Interaction{Exception: src.Filter, Lifted: len(lifted), Narrowed: len(narrowed)}
+	for i, r := range rules {
+		if len(in.Samples) == maxInteractionSamples {
+			break
+		}
+		if lifted[i] || narrowed[i] {
+			in.Samples = append(in.Samples, r.Trigger.URLFilter)
+		}
+	}
+	return in, true
+}
+
+// cosmeticExceptionFilter writes a cosmetic exception back as a filter
+func cosmeticExceptionFilter(e CosmeticException) string {
+	domains := make([]string, len(e.Domains))
+	for i, d := range e.Domains {
+		domains[i] = strings.TrimPrefix(d, "*")
+	}
+	return strings.Join(domains, ",") + "#@#" + e.Selector
+}
@@ -0,0 +1,39 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func interactionList(t *testing.T, name, list string) ListRules {
+	t.Helper()
+	filters, err := parser.New().Parse(strings.NewReader(list))
+	require.NoError(t, err)
+	c := New()
+	rules := c.Convert(filters)
+	return ListRules{Name: name, Rules: rules, Exceptions: c.Exceptions(), CosmeticExceptions: c.CosmeticExceptions()}
+}
+
+func TestInteractions(t *testing.T) {
+	ads := interactionList(t, "easylist", "||ads.example.com^\n||cdn.example.com/banner.js\n||other.org^\nnews.com##.ad\n##.promo\n")
+	unbreak := interactionList(t, "unbreak", "@@||ads.example.com^\n@@||img.cdn.example.com/logo.png\nnews.com#@#.ad\n#@#.promo\n")
+	later := interactionList(t, "later", "||ads.example.com^$script\n")
+
+	got := Interactions([]ListRules{ads, unbreak, later})
+	require.Len(t, got, 4)
+
+	// Both variants of the ^ filter are lifted
+	assert.Equal(t, Interaction{List: "unbreak", Exception: "@@||ads.example.com^", Target: "easylist", Lifted: 2,
+		Samples: []string{ads.Rules[0].Trigger.URLFilter, ads.Rules[1].Trigger.URLFilter}}, got[0])
+	// A subdomain exception narrows the parent's block
+	assert.Equal(t, "@@||img.cdn.example.com/logo.png", got[1].Exception)
+	assert.Equal(t, 0, got[1].Lifted)
+	assert.Equal(t, 1, got[1].Narrowed)
+	// Cosmetic exceptions remove hiding rules of every list
+	assert.Equal(t, Interaction{List: "unbreak", Exception: "news.com#@#.ad", Target: "easylist", Lifted: 1}, got[2])
+	assert.Equal(t, Interaction{List: "unbreak", Exception: "#@#.promo", Target: "easylist", Lifted: 1}, got[3])
+}
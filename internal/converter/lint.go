@@ -0,0 +1,108 @@
+package converter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// Trigger values WebKit's content blocker compiler accepts
+var (
+	lintResourceTypes = []string{
+		models.ResourceDocument, models.ResourceImage, models.ResourceStyleSheet,
+		models.ResourceScript, models.ResourceFont, models.ResourceRaw,
+		models.ResourceSVG, models.ResourceMedia, models.ResourcePopup,
+	}
+	lintLoadTypes    = []string{models.LoadFirstParty, models.LoadThirdParty}
+	lintLoadContexts = []string{models.LoadContextTopFrame, models.LoadContextChildFrame}
+)
+
+// LintRule checks a finished rule against the constraints WebKit enforces
+// when compiling a content blocker, where a single violation rejects the
+// whole file, such as a trigger with both if-domain and unless-domain. It
+// returns the first violation, "" if the rule is valid for the target.
+func LintRule(r models.WebKitRule, target Target) string {
+	t := r.Trigger
+
+	conditions := 0
+	for _, list := range [][]string{t.IfDomain, t.UnlessDomain, t.IfTopURL, t.UnlessTopURL} {
+		if len(list) > 0 {
+			conditions++
+		}
+	}
+	if conditions > 1 {
+		return "more than one of if-domain, unless-domain, if-top-url and unless-top-url"
+	}
+
+	if t.URLFilter == "" {
+		return "empty url-filter"
+	}
+	if !ValidateRegex(t.URLFilter) {
+		return "url-filter is not a WebKit regex"
+	}
+	for _, u := range t.IfTopURL {
+		if !ValidateRegex(u) {
+			return "if-top-url is not a WebKit regex"
+		}
+	}
+	for _, u := range t.UnlessTopURL {
+		if !ValidateRegex(u) {
+			return "unless-top-url is not a WebKit regex"
+		}
+	}
+	for _, d := range slices.Concat(t.IfDomain, t.UnlessDomain) {
+		if !lintDomain(d) {
+			return fmt.Sprintf("domain %q is not lowercase ASCII", d)
+		}
+	}
+
+	if v, ok := unknownValue(t.ResourceType, lintResourceTypes); ok {
+		return fmt.Sprintf("unknown resource-type %q", v)
+	}
+	if v, ok := unknownValue(t.LoadType, lintLoadTypes); ok {
+		return fmt.Sprintf("unknown load-type %q", v)
+	}
+	if v, ok := unknownValue(t.LoadContext, lintLoadContexts); ok {
+		return fmt.Sprintf("unknown load-context %q", v)
+	}
+	if len(t.LoadContext) > 0 && !target.LoadContext {
+		return "load-context not supported by the target"
+	}
+
+	switch {
+	case !validActions[r.Action.Type]:
+		return fmt.Sprintf("unknown action %q", r.Action.Type)
+	case r.Action.Type == models.ActionCSSDisplayNone && r.Action.Selector == "":
+		return "css-display-none without a selector"
+	case r.Action.Type != models.ActionCSSDisplayNone && r.Action.Selector != "":
+		return "selector on a " + r.Action.Type + " action"
+	}
+	return ""
+}
+
+// lintDomain reports whether d is a non-empty lowercase ASCII domain,
+// optionally with the * subdomain prefix
+func lintDomain(d string) bool {
+	d = strings.TrimPrefix(d, "*")
+	if d == "" {
+		return false
+	}
+	for i := 0; i < len(d); i++ {
+		if c := d[i]; c >= 0x80 || (c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// unknownValue returns the first of values not in known
+func unknownValue(values, known []string) (string, bool) {
+	for _, v := range values {
+		if !slices.Contains(known, v) {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,60 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintRule(t *testing.T) {
+	block := func(trigger models.WebKitTrigger) models.WebKitRule {
+		if trigger.URLFilter == "" {
+			trigger.URLFilter = ".*"
+		}
+		return models.WebKitRule{Trigger: trigger, Action: models.WebKitAction{Type: models.ActionBlock}}
+	}
+
+	tests := []struct {
+		name    string
+		rule    models.WebKitRule
+		problem string
+	}{
+		{"valid", block(models.WebKitTrigger{IfDomain: []string{"*example.com"}, LoadContext: []string{models.LoadContextChildFrame}}), ""},
+		{"if-domain and unless-domain", block(models.WebKitTrigger{IfDomain: []string{"*a.com"}, UnlessDomain: []string{"*b.a.com"}}), "more than one of if-domain, unless-domain, if-top-url and unless-top-url"},
+		{"unless-domain and if-top-url", block(models.WebKitTrigger{UnlessDomain: []string{"*a.com"}, IfTopURL: []string{"^https://b\\.com/"}}), "more than one of if-domain, unless-domain, if-top-url and unless-top-url"},
+		{"if-domain and unless-top-url", block(models.WebKitTrigger{IfDomain: []string{"*a.com"}, UnlessTopURL: []string{"^https://b\\.com/"}}), "more than one of if-domain, unless-domain, if-top-url and unless-top-url"},
+		{"invalid unless-top-url", block(models.WebKitTrigger{UnlessTopURL: []string{"a|b"}}), "unless-top-url is not a WebKit regex"},
+		{"disjunction", block(models.WebKitTrigger{URLFilter: "ads|track"}), "url-filter is not a WebKit regex"},
+		{"invalid if-top-url", block(models.WebKitTrigger{IfTopURL: []string{"a{2}"}}), "if-top-url is not a WebKit regex"},
+		{"uppercase domain", block(models.WebKitTrigger{IfDomain: []string{"*Example.com"}}), `domain "*Example.com" is not lowercase ASCII`},
+		{"bare wildcard domain", block(models.WebKitTrigger{UnlessDomain: []string{"*"}}), `domain "*" is not lowercase ASCII`},
+		{"resource type", block(models.WebKitTrigger{ResourceType: []string{"xhr"}}), `unknown resource-type "xhr"`},
+		{"load type", block(models.WebKitTrigger{LoadType: []string{"1p"}}), `unknown load-type "1p"`},
+		{"css without selector", models.WebKitRule{Trigger: models.WebKitTrigger{URLFilter: ".*"}, Action: models.WebKitAction{Type: models.ActionCSSDisplayNone}}, "css-display-none without a selector"},
+		{"selector on block", models.WebKitRule{Trigger: models.WebKitTrigger{URLFilter: ".*"}, Action: models.WebKitAction{Type: models.ActionBlock, Selector: ".ad"}}, "selector on a block action"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.problem, LintRule(tt.rule, Targets[DefaultTarget]))
+		})
+	}
+
+	// load-context only where the target has it
+	rule := block(models.WebKitTrigger{LoadContext: []string{models.LoadContextTopFrame}})
+	assert.Equal(t, "load-context not supported by the target", LintRule(rule, Targets["safari14"]))
+}
+
+func TestImportRejectsConflictingConditions(t *testing.T) {
+	c := New()
+	rules, err := c.Import([]byte(`[
+		{"trigger": {"url-filter": ".*", "if-domain": ["*a.com"], "unless-domain": ["*b.a.com"]}, "action": {"type": "block"}},
+		{"trigger": {"url-filter": ".*", "if-domain": ["*a.com"]}, "action": {"type": "block"}}
+	]`))
+	require.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, 1, c.Stats().SkipReasons[models.SkipInvalidTrigger])
+	assert.Equal(t, 1, c.Stats().Patterns[models.SkipPatternKey(models.SkipInvalidTrigger, "more than one of if-domain, unless-domain, if-top-url and unless-top-url")].Count)
+}
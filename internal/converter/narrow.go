@@ -0,0 +1,183 @@
+package converter
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// NarrowExceptions removes block rules that a later exception fully negates
+// (same url-filter, exception conditions covering the block's), which are
+// dead weight in the compiled content blocker. An exception that negated a
+// rule is removed as well when it cannot lift any other rule of rules, i.e.
+// every remaining rule is anchored to an unrelated hostname. Since an
+// ignore-previous-rules entry lifts every earlier rule it matches, that is
+// rare on lists with generic rules; the exception is kept then. rules must
+// be a whole content blocker: the exceptions of one list also lift the
+// blocks of the lists before it. Returns the remaining rules in order and
+// the number of rules removed.
+func NarrowExceptions(rules []models.WebKitRule) ([]models.WebKitRule, int) {
+	blocks := make(map[string][]int)
+	removed := make([]bool, len(rules))
+	var negating []int
+
+	for i, r := range rules {
+		switch r.Action.Type {
+		case models.ActionBlock:
+			blocks[r.Trigger.URLFilter] = append(blocks[r.Trigger.URLFilter], i)
+		case models.ActionIgnorePreviousRule:
+			found := false
+			for _, b := range blocks[r.Trigger.URLFilter] {
+				if !removed[b] && negates(rules[b].Trigger, r.Trigger) {
+					removed[b] = true
+					found = true
+				}
+			}
+			if found {
+				negating = append(negating, i)
+			}
+		}
+	}
+	if len(negating) == 0 {
+		return rules, 0
+	}
+
+	// Hostnames of the rules left, and every domain they lie within
+	hosts := make(map[string]bool)
+	within := make(map[string]bool)
+	anchored := true
+	for i, r := range rules {
+		if removed[i] || r.Action.Type == models.ActionIgnorePreviousRule {
+			continue
+		}
+		host, ok := anchoredHost(r.Trigger.URLFilter)
+		if !ok {
+			anchored = false
+			break
+		}
+		hosts[host] = true
+		for d := host; ; {
+			within[d] = true
+			dot := strings.IndexByte(d, '.')
+			if dot == -1 {
+				break
+			}
+			d = d[dot+1:]
+		}
+	}
+
+	if anchored {
+		for _, i := range negating {
+			host, ok := anchoredHost(rules[i].Trigger.URLFilter)
+			if ok && !within[host] && !hasParent(host, hosts) {
+				removed[i] = true
+			}
+		}
+	}
+
+	result := make([]models.WebKitRule, 0, len(rules))
+	for i, r := range rules {
+		if !removed[i] {
+			result = append(result, r)
+		}
+	}
+	return result, len(rules) - len(result)
+}
+
+// negates reports whether exception e applies to every request block b
+// applies to
+func negates(b, e models.WebKitTrigger) bool {
+	// A case-insensitive exception also lifts a $match-case block, a
+	// $match-case exception only matches part of a case-insensitive one
+	if b.URLFilter != e.URLFilter || (isCaseSensitive(e) && !isCaseSensitive(b)) {
+		return false
+	}
+	if !coversList(e.ResourceType, b.ResourceType) || !coversList(e.LoadType, b.LoadType) ||
+		!coversList(e.LoadContext, b.LoadContext) {
+		return false
+	}
+	if len(e.IfTopURL) > 0 && !slices.Equal(e.IfTopURL, b.IfTopURL) {
+		return false
+	}
+
+	switch {
+	case len(e.IfDomain) > 0:
+		return len(b.IfDomain) > 0 && len(nestedDomains(b.IfDomain, e.IfDomain)) == len(b.IfDomain)
+	case len(e.UnlessDomain) > 0:
+		// The exception must not exclude a domain the block applies on
+		for _, d := range e.UnlessDomain {
+			if !slices.Contains(b.UnlessDomain, d) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// coversList reports whether condition values e include all of b, an
+// empty list meaning any value
+func coversList(e, b []string) bool {
+	if len(e) == 0 {
+		return true
+	}
+	if len(b) == 0 {
+		return false
+	}
+	for _, v := range b {
+		if !slices.Contains(e, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func isCaseSensitive(t models.WebKitTrigger) bool {
+	return t.URLFilterIsCaseSensitive != nil && *t.URLFilterIsCaseSensitive
+}
+
+// anchoredHost returns the hostname of a url-filter generated from a
+// ||host^, ||host/ or ||host| pattern; other url-filters may match any host
+func anchoredHost(urlFilter string) (string, bool) {
+	rest, ok := strings.CutPrefix(urlFilter, restrHostnameAnchor1)
+	if !ok {
+		return "", false
+	}
+
+	var host strings.Builder
+	for rest != "" {
+		switch c := rest[0]; {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-':
+			host.WriteByte(c)
+			rest = rest[1:]
+			continue
+		case strings.HasPrefix(rest, `\.`):
+			host.WriteByte('.')
+			rest = rest[2:]
+			continue
+		}
+		break
+	}
+
+	// The hostname must end here, not continue with a wildcard
+	complete := strings.HasPrefix(rest, restrSeparator) || rest == "$" ||
+		strings.HasPrefix(rest, "/") || strings.HasPrefix(rest, ":")
+	if host.Len() == 0 || !complete {
+		return "", false
+	}
+	return host.String(), true
+}
+
+// hasParent reports whether a parent domain of host is in hosts
+func hasParent(host string, hosts map[string]bool) bool {
+	for {
+		dot := strings.IndexByte(host, '.')
+		if dot == -1 {
+			return false
+		}
+		host = host[dot+1:]
+		if hosts[host] {
+			return true
+		}
+	}
+}
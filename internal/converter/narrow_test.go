@@ -0,0 +1,69 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func convertList(t *testing.T, list string) []models.WebKitRule {
+	t.Helper()
+	filters, err := parser.New().Parse(strings.NewReader(list))
+	require.NoError(t, err)
+	return New().Convert(filters)
+}
+
+func TestNarrowExceptions(t *testing.T) {
+	rules := convertList(t, "||ads.example.com^$script\n||tracker.example.org^\n@@||ads.example.com^\n")
+	require.Len(t, rules, 6)
+
+	// Only hostname-anchored rules for unrelated hosts are left, so the
+	// exception can go as well
+	result, removed := NarrowExceptions(rules)
+	assert.Equal(t, 4, removed)
+	require.Len(t, result, 2)
+	for _, r := range result {
+		assert.Equal(t, models.ActionBlock, r.Action.Type)
+		assert.Contains(t, r.Trigger.URLFilter, "tracker")
+	}
+}
+
+func TestNarrowExceptionsKeepsShadowingException(t *testing.T) {
+	// The exception also lifts the broader /banner rule on ads.example.com
+	rules := convertList(t, "/banner\n||ads.example.com^\n@@||ads.example.com^\n")
+	result, removed := NarrowExceptions(rules)
+	assert.Equal(t, 2, removed)
+	require.Len(t, result, 3)
+	assert.Equal(t, models.ActionIgnorePreviousRule, result[2].Action.Type)
+
+	// Parent domain rules are lifted on the subdomain too
+	rules = convertList(t, "||example.com^\n||ads.example.com^\n@@||ads.example.com^\n")
+	result, _ = NarrowExceptions(rules)
+	assert.Equal(t, models.ActionIgnorePreviousRule, result[len(result)-1].Action.Type)
+}
+
+func TestNarrowExceptionsConditions(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		removed int
+	}{
+		{"narrower exception", "||ads.example.com^\n@@||ads.example.com^$script\n", 0},
+		{"exception before block", "@@||ads.example.com^\n||ads.example.com^\n", 0},
+		{"covering domains", "||ads.example.com^$domain=shop.example.net\n@@||ads.example.com^$domain=example.net\n", 4},
+		{"other domains", "||ads.example.com^$domain=example.net\n@@||ads.example.com^$domain=example.org\n", 0},
+		{"case-insensitive exception", "||ads.example.com/Ad.js$match-case\n@@||ads.example.com/Ad.js\n", 2},
+		{"match-case exception", "||ads.example.com/Ad.js\n@@||ads.example.com/Ad.js$match-case\n", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, removed := NarrowExceptions(convertList(t, tt.list))
+			assert.Equal(t, tt.removed, removed)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package converter
+
+import "github.com/bnema/ublock-webkit-filters/internal/models"
+
+// RuleSet is a set of converted rules used to compare lists
+type RuleSet map[string]struct{}
+
+// NewRuleSet builds a set from rules
+func NewRuleSet(rules []models.WebKitRule) RuleSet {
+	set := make(RuleSet, len(rules))
+	for _, r := range rules {
+		if key, ok := ruleKey(r); ok {
+			set[key] = struct{}{}
+		}
+	}
+	return set
+}
+
+// Containment returns the share of rules that are already in the set, i.e.
+// how redundant a list would be next to the one the set was built from
+func (s RuleSet) Containment(rules []models.WebKitRule) float64 {
+	if len(rules) == 0 {
+		return 0
+	}
+	found := 0
+	for _, r := range rules {
+		if key, ok := ruleKey(r); ok {
+			if _, ok := s[key]; ok {
+				found++
+			}
+		}
+	}
+	return float64(found) / float64(len(rules))
+}
@@ -0,0 +1,23 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleSetContainment(t *testing.T) {
+	rule := func(filter string) models.WebKitRule {
+		return models.WebKitRule{
+			Trigger: models.WebKitTrigger{URLFilter: filter},
+			Action:  models.WebKitAction{Type: models.ActionBlock},
+		}
+	}
+
+	set := NewRuleSet([]models.WebKitRule{rule("a"), rule("b"), rule("c")})
+
+	assert.Equal(t, 1.0, set.Containment([]models.WebKitRule{rule("a"), rule("b")}))
+	assert.Equal(t, 0.5, set.Containment([]models.WebKitRule{rule("a"), rule("z")}))
+	assert.Equal(t, 0.0, set.Containment(nil))
+}
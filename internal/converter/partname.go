@@ -0,0 +1,86 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultPartName names split parts combined-part1, combined-part2, ...
+const DefaultPartName = "{name}-part{index}"
+
+// rePartField matches the fields of a part name template: {name}, {index}
+// and {total}, the numbers optionally zero-padded as in {index:02d}
+var rePartField = regexp.MustCompile(`\{(name|index|total)(?::0(\d)d)?\}`)
+
+// WithPartName returns a copy of the splitter naming the parts of split
+// rulesets after template, e.g. "{name}-{index:02d}-of-{total}". A trailing
+// .json is ignored, an empty template keeps DefaultPartName.
+func (s *Splitter) WithPartName(template string) *Splitter {
+	c := *s
+	if template = strings.TrimSuffix(template, ".json"); template != "" {
+		c.partName = template
+	}
+	return &c
+}
+
+// ValidatePartName checks that a part name template tells parts apart and
+// yields plain file names
+func ValidatePartName(template string) error {
+	template = strings.TrimSuffix(template, ".json")
+	if !strings.Contains(template, "{name}") {
+		return errors.New("missing {name}")
+	}
+	if !strings.Contains(template, "{index") {
+		return errors.New("missing {index}")
+	}
+	rest := rePartField.ReplaceAllString(template, "")
+	if i := strings.IndexAny(rest, "{}"); i != -1 {
+		return fmt.Errorf("unknown field near %q (want {name}, {index} or {total}, numbers as {index:02d})", rest[i:])
+	}
+	if strings.ContainsAny(rest, `/\`) {
+		return errors.New("must not contain path separators")
+	}
+	return nil
+}
+
+// formatPartName fills a part name template for part index of total
+func formatPartName(template, name string, index, total int) string {
+	return rePartField.ReplaceAllStringFunc(template, func(field string) string {
+		m := rePartField.FindStringSubmatch(field)
+		n := total
+		switch m[1] {
+		case "name":
+			return name
+		case "index":
+			n = index
+		}
+		width, _ := strconv.Atoi(m[2])
+		return fmt.Sprintf("%0*d", width, n)
+	})
+}
+
+// IsPartName reports whether file is a name template gives the parts of
+// name, such as combined-part2 for combined and DefaultPartName. An empty
+// template is DefaultPartName.
+func IsPartName(template, name, file string) bool {
+	if template = strings.TrimSuffix(template, ".json"); template == "" {
+		template = DefaultPartName
+	}
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, m := range rePartField.FindAllStringSubmatchIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:m[0]]))
+		if template[m[2]:m[3]] == "name" {
+			pattern.WriteString(regexp.QuoteMeta(name))
+		} else {
+			pattern.WriteString(`\d+`)
+		}
+		last = m[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]) + "$")
+	return regexp.MustCompile(pattern.String()).MatchString(strings.TrimSuffix(file, ".json"))
+}
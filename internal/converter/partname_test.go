@@ -0,0 +1,60 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitPartNames(t *testing.T) {
+	rules := make([]models.WebKitRule, 25)
+
+	parts := NewSplitter(2).WithPartName("{name}-{index:02d}-of-{total}.json").Split(rules, "combined")
+	require.Len(t, parts, 13)
+	assert.Equal(t, Part{Name: "combined-01-of-13", Index: 1, Total: 13, Rules: rules[:2]}, parts[0])
+	assert.Equal(t, "combined-13-of-13", parts[12].Name)
+	assert.Len(t, parts[12].Rules, 1)
+
+	// The default names parts as before, a ruleset in one file keeps its name
+	assert.Equal(t, "combined-part10", NewSplitter(2).Split(rules, "combined")[9].Name)
+	assert.Equal(t, []Part{{Name: "combined", Total: 1, Rules: rules}}, NewSplitter(50).Split(rules, "combined"))
+}
+
+func TestValidatePartName(t *testing.T) {
+	for _, template := range []string{DefaultPartName, "{name}-{index:03d}-of-{total:03d}.json", "{index}_{name}"} {
+		assert.NoError(t, ValidatePartName(template), template)
+	}
+	for template, want := range map[string]string{
+		"combined-{index}":         "missing {name}",
+		"{name}-{total}":           "missing {index}",
+		"{name}-{part}":            "missing {index}",
+		"{name}-{index}-{count}":   "unknown field",
+		"{name}-{index:2d}":        "unknown field",
+		"{name}/{index}":           "path separators",
+		"{name}-{index}-of-{total": "unknown field",
+	} {
+		assert.ErrorContains(t, ValidatePartName(template), want, template)
+	}
+}
+
+func TestIsPartName(t *testing.T) {
+	for _, tc := range []struct {
+		template, file string
+		want           bool
+	}{
+		{"", "combined-part1.json", true},
+		{"", "combined-part12", true},
+		{"", "combined-part", false},
+		{"", "combined-parts", false},
+		{"", "combined-ads", false},
+		{"", "combined-ads-part1", false},
+		{"{name}-{index:02d}-of-{total}", "combined-03-of-12.json", true},
+		{"{name}-{index:02d}-of-{total}", "combined-ads", false},
+		{"{index}.{name}", "1.combined", true},
+		{"{index}.{name}", "1xcombined", false}, // literals are not patterns
+	} {
+		assert.Equal(t, tc.want, IsPartName(tc.template, "combined", tc.file), "%s %s", tc.template, tc.file)
+	}
+}
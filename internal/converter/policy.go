@@ -0,0 +1,73 @@
+package converter
+
+import (
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// neverBlock is the converter pass enforcing Options.NeverBlockDomains:
+// rules anchored to one of the domains are dropped and the domains are
+// removed from if-domain conditions, like a drop transform
+func (c *Converter) neverBlock(rules []models.WebKitRule) []models.WebKitRule {
+	if len(c.opts.NeverBlockDomains) == 0 {
+		return rules
+	}
+
+	result := rules[:0]
+	for _, r := range rules {
+		keep, changed := true, false
+		for _, d := range c.opts.NeverBlockDomains {
+			var ok bool
+			r, ok, keep = applyTransform(r, models.Transform{Action: models.TransformDrop, Domain: d})
+			changed = changed || ok
+			if !keep {
+				break
+			}
+		}
+		if changed || !keep {
+			c.stats.NeverBlocked++
+		}
+		if keep {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// DomainPolicy returns the rules enforcing the domain policy at the end of
+// a combined output, after every rule they override: never-blocked domains
+// get ignore-previous-rules entries for their pages and for requests to
+// them, which also cover generic rules the neverBlock pass cannot tell
+// apart, and always-blocked domains a block rule no list exception before
+// it can lift. The rules are built directly, outside of the conversion
+// passes the policy would otherwise apply to them.
+func (c *Converter) DomainPolicy(never, always []string) []models.WebKitRule {
+	var rules []models.WebKitRule
+	if resolved := c.resolveDomains(never); len(resolved) > 0 {
+		rules = append(rules, c.sanitize([]models.WebKitRule{{
+			Trigger: models.WebKitTrigger{URLFilter: ".*", IfDomain: resolved},
+			Action:  models.WebKitAction{Type: models.ActionIgnorePreviousRule},
+		}}, "never_block_domains")...)
+	}
+	for _, d := range never {
+		rules = append(rules, c.policyRules("@@||"+d+"^", true)...)
+	}
+	for _, d := range always {
+		rules = append(rules, c.policyRules("||"+d+"^", false)...)
+	}
+	c.stats.Converted += len(rules)
+	return rules
+}
+
+// policyRules converts a domain policy filter on its own
+func (c *Converter) policyRules(raw string, isException bool) []models.WebKitRule {
+	f := models.Filter{Type: models.FilterTypeNetwork, Raw: raw, Pattern: raw}
+	if isException {
+		f.Type, f.Pattern = models.FilterTypeException, raw[2:]
+	}
+	rules, reason := c.convertNetwork(f, isException)
+	if reason != "" {
+		c.skip(reason, raw)
+		return nil
+	}
+	return c.sanitize(rules, raw)
+}
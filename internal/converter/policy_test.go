@@ -0,0 +1,49 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeverBlockDomains(t *testing.T) {
+	filters, err := parser.New().Parse(strings.NewReader(
+		"||intranet.corp.com/ads.js\n||corp.com^$script\n||ads.example.com^$domain=intranet.corp.com|news.com\nintranet.corp.com##.banner\n||other.org/a.js\n"))
+	require.NoError(t, err)
+	c := NewWithOptions(Options{Target: Targets[DefaultTarget], NeverBlockDomains: []string{"corp.com"}})
+	rules := c.Convert(filters)
+
+	// Both variants of the ^ filter stay on news.com only
+	require.Len(t, rules, 3)
+	assert.Equal(t, []string{"*news.com"}, rules[0].Trigger.IfDomain)
+	assert.Equal(t, []string{"*news.com"}, rules[1].Trigger.IfDomain)
+	assert.Contains(t, rules[2].Trigger.URLFilter, `other\.org`)
+	assert.Equal(t, 6, c.Stats().NeverBlocked)
+}
+
+func TestDomainPolicy(t *testing.T) {
+	c := NewWithOptions(Options{Target: Targets[DefaultTarget], NeverBlockDomains: []string{"corp.com"}})
+	rules := c.DomainPolicy([]string{"corp.com"}, []string{"telemetry.example.net"})
+	require.NotEmpty(t, rules)
+
+	// Pages of the never-blocked domain, then requests to it, then blocks
+	assert.Equal(t, []string{"*corp.com"}, rules[0].Trigger.IfDomain)
+	var exempt, blocked int
+	for _, r := range rules[1:] {
+		switch r.Action.Type {
+		case models.ActionIgnorePreviousRule:
+			assert.Contains(t, r.Trigger.URLFilter, `corp\.com`)
+			assert.Zero(t, blocked, "exceptions come before the always blocked domains")
+			exempt++
+		case models.ActionBlock:
+			assert.Contains(t, r.Trigger.URLFilter, `telemetry\.example\.net`)
+			blocked++
+		}
+	}
+	assert.Positive(t, exempt)
+	assert.Positive(t, blocked)
+}
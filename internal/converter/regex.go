@@ -2,6 +2,7 @@ package converter
 
 import (
 	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -13,6 +14,10 @@ const (
 	restrHostnameAnchor1 = `^[a-z-]+://(?:[^/?#]+\.)?`
 	// Hostname anchor for patterns starting with ||.
 	restrHostnameAnchor2 = `^[a-z-]+://(?:[^/?#]+)?`
+	// Hostname anchor matching only the host itself
+	restrExactHostAnchor = `^[a-z-]+://`
+	// Hostname anchor matching only subdomains of the host
+	restrSubdomainAnchor = `^[a-z-]+://[^/?#]+\.`
 )
 
 var (
@@ -35,7 +40,10 @@ var (
 	reNumericQuantifierOpen = regexp.MustCompile(`\{[0-9]+,\}`)
 )
 
-// PatternToRegex converts an ABP/uBlock pattern to a WebKit-compatible regex
+// PatternToRegex converts an ABP/uBlock pattern to a WebKit-compatible regex.
+// Only hostnames of plain patterns are lowercased: /regex/ filters are kept
+// as written, their case matters once $match-case makes the rule
+// url-filter-is-case-sensitive.
 func PatternToRegex(pattern string) string {
 	if pattern == "" || pattern == "*" {
 		return ".*"
@@ -61,9 +69,26 @@ func PatternToRegex(pattern string) string {
 
 	// Handle regex patterns (enclosed in /.../)
 	if strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") && len(s) > 2 {
-		// It's already a regex, remove the slashes and expand character classes
-		regex := s[1 : len(s)-1]
-		return expandCharacterClasses(regex)
+		// It's already a regex, remove the slashes and expand character
+		// classes. ABP anchors around it still apply, without repeating
+		// the regex's own ^ and $.
+		regex := expandCharacterClasses(s[1 : len(s)-1])
+		if anchor&0b100 != 0 {
+			regex = restrHostnameAnchor1 + regex
+		} else if anchor&0b010 != 0 && !strings.HasPrefix(regex, "^") {
+			regex = "^" + regex
+		}
+		if anchor&0b001 != 0 && !endsWithAnchor(regex) {
+			regex += "$"
+		}
+		return regex
+	}
+
+	// Hostnames are case-insensitive, paths are not
+	if anchor&0b100 != 0 {
+		s = lowercaseHost(s, 0)
+	} else if idx := strings.Index(s, "://"); anchor&0b010 != 0 && idx != -1 && idx < strings.IndexByte(s, '/') {
+		s = lowercaseHost(s, idx+3)
 	}
 
 	// Escape special regex characters (except * and ^)
@@ -156,6 +181,11 @@ func ValidateRegex(pattern string) bool {
 		return false
 	}
 
+	// ^ and $ only assert the start and end of the whole URL
+	if misplacedAnchor(pattern) != "" {
+		return false
+	}
+
 	// WebKit doesn't support shorthand character classes \w, \d, \s, etc.
 	// These should have been expanded by expandCharacterClasses
 	if reWordChar.MatchString(pattern) || reNonWordChar.MatchString(pattern) ||
@@ -196,6 +226,18 @@ func containsDisjunction(pattern string) bool {
 	return false
 }
 
+// lowercaseHost lowercases s from the host start up to the end of the
+// hostname (first /, ^, ?, # or | after it), preserving the path case
+func lowercaseHost(s string, start int) string {
+	end := strings.IndexAny(s[start:], "/^?#|")
+	if end == -1 {
+		end = len(s)
+	} else {
+		end += start
+	}
+	return strings.ToLower(s[:end]) + s[end:]
+}
+
 // PatternEndsWithSeparator checks if the original pattern ends with ^ separator
 func PatternEndsWithSeparator(pattern string) bool {
 	// Strip right anchor first
@@ -237,3 +279,131 @@ func expandCharacterClasses(pattern string) string {
 
 	return pattern
 }
+
+// endsWithAnchor reports whether a regex ends with an unescaped $
+func endsWithAnchor(re string) bool {
+	if !strings.HasSuffix(re, "$") {
+		return false
+	}
+	escapes := len(re) - 1 - len(strings.TrimRight(re[:len(re)-1], `\`))
+	return escapes%2 == 0
+}
+
+// Regex tokens misplacedAnchor tells apart
+const (
+	tokAtom = iota // literal, escape, class or .
+	tokOpen
+	tokClose
+	tokAlt
+	tokStart // ^
+	tokEnd   // $
+	tokQuantifier
+)
+
+// regexTokens splits a regex into the tokens that decide where its
+// anchors are
+func regexTokens(re string) []int {
+	var tokens []int
+	for i := 0; i < len(re); i++ {
+		switch re[i] {
+		case '\\':
+			i++
+			tokens = append(tokens, tokAtom)
+		case '[':
+			// Up to the unescaped ], a leading ] or ^] is part of the class
+			j := i + 1
+			if j < len(re) && re[j] == '^' {
+				j++
+			}
+			if j < len(re) && re[j] == ']' {
+				j++
+			}
+			for j < len(re) && re[j] != ']' {
+				if re[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			i = j
+			tokens = append(tokens, tokAtom)
+		case '(':
+			tokens = append(tokens, tokOpen)
+		case ')':
+			tokens = append(tokens, tokClose)
+		case '|':
+			tokens = append(tokens, tokAlt)
+		case '^':
+			tokens = append(tokens, tokStart)
+		case '$':
+			tokens = append(tokens, tokEnd)
+		case '*', '+', '?', '{':
+			if re[i] == '{' {
+				if end := strings.IndexByte(re[i:], '}'); end != -1 {
+					i += end
+				}
+			}
+			tokens = append(tokens, tokQuantifier)
+		default:
+			tokens = append(tokens, tokAtom)
+		}
+	}
+	return tokens
+}
+
+// misplacedAnchor describes a ^ or $ of a regex that does not assert the
+// start or end of the URL, e.g. /ads^banner/ or /a$|b/, which WebKit
+// refuses to compile. A ^ may start the regex, an alternative of it or a
+// group at its start; $ likewise at the end.
+func misplacedAnchor(re string) string {
+	tokens := regexTokens(re)
+	if edgeAnchorsOnly(tokens, tokStart, tokOpen, tokClose) {
+		reversed := slices.Clone(tokens)
+		slices.Reverse(reversed)
+		if edgeAnchorsOnly(reversed, tokEnd, tokClose, tokOpen) {
+			return ""
+		}
+		return "$ before the end of the regex"
+	}
+	return "^ after the start of the regex"
+}
+
+// edgeAnchorsOnly reports whether every anchor token comes first in the
+// token sequence, an alternative or a group that itself comes first
+func edgeAnchorsOnly(tokens []int, anchor, open, close int) bool {
+	atEdge := true
+	var groups []bool // atEdge where each open group started
+	for _, tok := range tokens {
+		switch tok {
+		case anchor:
+			if !atEdge {
+				return false
+			}
+		case open:
+			groups = append(groups, atEdge)
+		case close:
+			if len(groups) > 0 {
+				groups = groups[:len(groups)-1]
+			}
+			atEdge = false
+		case tokAlt:
+			atEdge = len(groups) == 0 || groups[len(groups)-1]
+		case tokAtom:
+			atEdge = false
+		}
+	}
+	return true
+}
+
+// regexAnchorConflict describes why the anchors of a /regex/ filter cannot
+// be kept, e.g. a || hostname anchor before a regex starting with ^
+func regexAnchorConflict(pattern string) string {
+	s := strings.TrimSuffix(pattern, "|")
+	hostname := strings.HasPrefix(s, "||")
+	s = strings.TrimLeft(s, "|")
+	regex := s[1 : len(s)-1]
+
+	if hostname && strings.HasPrefix(regex, "^") {
+		return "|| hostname anchor before a regex starting with ^"
+	}
+	return misplacedAnchor(regex)
+}
@@ -148,6 +148,21 @@ func TestPatternToRegex(t *testing.T) {
 			input:    `/[a-z]+\.example\.com/`,
 			expected: `[a-z]+\.example\.com`,
 		},
+		{
+			name:     "mixed-case hostname keeps path case",
+			input:    "||Ads.Example.COM/Banner.JS",
+			expected: `^[a-z-]+://(?:[^/?#]+\.)?ads\.example\.com/Banner\.JS`,
+		},
+		{
+			name:     "mixed-case left anchored URL",
+			input:    "|HTTP://Example.com/Path",
+			expected: `^http://example\.com/Path`,
+		},
+		{
+			name:     "left anchored path keeps case",
+			input:    "|/Redirect?u=http://Example.com",
+			expected: `^/Redirect\?u=http://Example\.com`,
+		},
 		{
 			name:     "wildcard in middle",
 			input:    "||example.com^*path",
@@ -381,3 +396,34 @@ func TestContainsDisjunction(t *testing.T) {
 		})
 	}
 }
+
+func TestRegexFilterAnchors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"left anchor", `|/ads?[0-9]/`, `^ads?[0-9]`},
+		{"left anchor not repeated", `|/^https?:\/\/ads\./`, `^https?:\/\/ads\.`},
+		{"right anchor", `/\.gif\?track=/|`, `\.gif\?track=$`},
+		{"right anchor not repeated", `/\.gif$/|`, `\.gif$`},
+		{"escaped dollar is no anchor", `/price\$/|`, `price\$$`},
+		{"hostname anchor", `||/ads[0-9]+\./`, `^[a-z-]+://(?:[^/?#]+\.)?ads[0-9]+\.`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, PatternToRegex(tt.input))
+		})
+	}
+}
+
+func TestMisplacedAnchor(t *testing.T) {
+	for _, re := range []string{`^ads$`, `^a|^b`, `(^|\.)ads\.`, `a(b|c$)`, `[^a]$`, `a\^b\$c`, `(ab)?$`, `a$|b`} {
+		assert.Empty(t, misplacedAnchor(re), re)
+		assert.True(t, ValidateRegex(re) || containsDisjunction(re), re)
+	}
+	for _, re := range []string{`ads^banner`, `a$b`, `(a$)b`, `x(^a)`, `(a$|b)c`} {
+		assert.NotEmpty(t, misplacedAnchor(re), re)
+		assert.False(t, ValidateRegex(re), re)
+	}
+}
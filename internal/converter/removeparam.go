@@ -0,0 +1,88 @@
+package converter
+
+import (
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// TrackingParams are query parameters that only carry tracking data, so
+// blocking a request that contains one should not break anything the user
+// asked for
+var TrackingParams = map[string]bool{
+	"utm_source": true, "utm_medium": true, "utm_campaign": true,
+	"utm_term": true, "utm_content": true, "utm_id": true,
+	"fbclid": true, "gclid": true, "dclid": true, "gbraid": true,
+	"wbraid": true, "msclkid": true, "yclid": true, "twclid": true,
+	"ttclid": true, "igshid": true, "mc_cid": true, "mc_eid": true,
+	"_hsenc": true, "_hsmi": true, "mkt_tok": true, "oly_anon_id": true,
+	"oly_enc_id": true, "vero_id": true, "wickedid": true, "s_cid": true,
+}
+
+// subresourceTypes are the resource types removeparam block rules apply to:
+// blocking a navigation would break the page instead of cleaning its URL
+var subresourceTypes = []string{
+	models.ResourceImage, models.ResourceStyleSheet, models.ResourceScript,
+	models.ResourceFont, models.ResourceRaw, models.ResourceSVG, models.ResourceMedia,
+}
+
+// convertRemoveParam approximates $removeparam=<param>, which WebKit cannot
+// express, by blocking third-party subresource requests that carry the
+// parameter. This is lossy: uBO strips the parameter and lets the request
+// through, so it is only done for known tracking parameters and only when
+// enabled.
+func (c *Converter) convertRemoveParam(f models.Filter, isException bool) ([]models.WebKitRule, models.SkipReason) {
+	if !c.opts.RemoveParamBlock {
+		return nil, models.SkipUnsupportedOption
+	}
+
+	// Exceptions would lift every rule on the URL, not just ours
+	param := f.Options.RemoveParam
+	if isException || !TrackingParams[param] {
+		return nil, models.SkipRemoveParam
+	}
+	if f.Options.ThirdParty != nil && !*f.Options.ThirdParty {
+		return nil, models.SkipRemoveParam
+	}
+
+	var types []string
+	for _, rt := range f.Options.ResourceTypes {
+		if rt != models.ResourceDocument && rt != models.ResourcePopup {
+			types = append(types, rt)
+		}
+	}
+	if len(f.Options.ResourceTypes) == 0 {
+		types = subresourceTypes
+	} else if len(types) == 0 {
+		return nil, models.SkipRemoveParam
+	}
+
+	prefix := f.Pattern
+	if strings.HasSuffix(prefix, "|") {
+		return nil, models.SkipRemoveParam
+	}
+	if strings.Trim(prefix, "*") != "" {
+		prefix += "*"
+	}
+
+	thirdParty := true
+	opts := f.Options
+	opts.RemoveParam = ""
+	opts.ThirdParty = &thirdParty
+	opts.ResourceTypes = types
+	opts.LoadContexts = nil
+
+	// No disjunction in WebKit regexes: one rule per query separator
+	var rules []models.WebKitRule
+	for _, sep := range []string{"?", "&"} {
+		variant := models.Filter{Type: f.Type, Raw: f.Raw, Pattern: prefix + sep + param + "=", Options: opts}
+		converted, reason := c.convertNetwork(variant, false)
+		if reason != "" {
+			return nil, reason
+		}
+		rules = append(rules, converted...)
+	}
+
+	c.stats.RemoveParam++
+	return rules, ""
+}
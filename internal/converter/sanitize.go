@@ -0,0 +1,67 @@
+package converter
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// SanitizeRule checks a rule for characters that break WebKit's JSON parser
+// or rule compiler. Whitespace control characters in selectors are folded to
+// plain spaces (they are equivalent in CSS); any other NUL, control character
+// or invalid UTF-8 sequence (e.g. an unpaired surrogate) rejects the rule.
+// Returns the sanitized rule and a skip reason, which is empty on success.
+func SanitizeRule(r models.WebKitRule) (models.WebKitRule, models.SkipReason) {
+	if reason := checkString(r.Trigger.URLFilter); reason != "" {
+		return r, reason
+	}
+
+	for _, list := range [][]string{r.Trigger.IfDomain, r.Trigger.UnlessDomain, r.Trigger.IfTopURL, r.Trigger.UnlessTopURL} {
+		for _, d := range list {
+			if reason := checkString(d); reason != "" {
+				return r, reason
+			}
+		}
+	}
+
+	if r.Action.Selector != "" {
+		selector := foldSelectorWhitespace(r.Action.Selector)
+		if reason := checkString(selector); reason != "" {
+			return r, reason
+		}
+		r.Action.Selector = selector
+	}
+
+	return r, ""
+}
+
+// checkString returns a skip reason if s contains unsafe characters
+func checkString(s string) models.SkipReason {
+	if !utf8.ValidString(s) {
+		return models.SkipInvalidUTF8
+	}
+	for _, ch := range s {
+		if ch == 0 {
+			return models.SkipNULByte
+		}
+		if ch < 0x20 || ch == 0x7f || (ch >= 0x80 && ch < 0xa0) {
+			return models.SkipControlChars
+		}
+	}
+	return ""
+}
+
+// foldSelectorWhitespace replaces CSS whitespace control characters with spaces
+func foldSelectorWhitespace(s string) string {
+	if !strings.ContainsAny(s, "\t\n\r\f") {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\t', '\n', '\r', '\f':
+			return ' '
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,75 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeRule(t *testing.T) {
+	tests := []struct {
+		name             string
+		rule             models.WebKitRule
+		expectedReason   models.SkipReason
+		expectedSelector string
+	}{
+		{
+			name: "clean network rule",
+			rule: models.WebKitRule{
+				Trigger: models.WebKitTrigger{URLFilter: `example\.com`},
+				Action:  models.WebKitAction{Type: models.ActionBlock},
+			},
+		},
+		{
+			name: "NUL in url-filter",
+			rule: models.WebKitRule{
+				Trigger: models.WebKitTrigger{URLFilter: "ads\x00.js"},
+				Action:  models.WebKitAction{Type: models.ActionBlock},
+			},
+			expectedReason: models.SkipNULByte,
+		},
+		{
+			name: "control character in url-filter",
+			rule: models.WebKitRule{
+				Trigger: models.WebKitTrigger{URLFilter: "ads\x1b.js"},
+				Action:  models.WebKitAction{Type: models.ActionBlock},
+			},
+			expectedReason: models.SkipControlChars,
+		},
+		{
+			name: "unpaired surrogate in selector",
+			rule: models.WebKitRule{
+				Trigger: models.WebKitTrigger{URLFilter: ".*"},
+				Action:  models.WebKitAction{Type: models.ActionCSSDisplayNone, Selector: ".ad\xed\xa0\x80"},
+			},
+			expectedReason: models.SkipInvalidUTF8,
+		},
+		{
+			name: "control character in domain",
+			rule: models.WebKitRule{
+				Trigger: models.WebKitTrigger{URLFilter: ".*", IfDomain: []string{"*exa\x07mple.com"}},
+				Action:  models.WebKitAction{Type: models.ActionCSSDisplayNone, Selector: ".ad"},
+			},
+			expectedReason: models.SkipControlChars,
+		},
+		{
+			name: "tab in selector folded to space",
+			rule: models.WebKitRule{
+				Trigger: models.WebKitTrigger{URLFilter: ".*"},
+				Action:  models.WebKitAction{Type: models.ActionCSSDisplayNone, Selector: "div\t> .ad"},
+			},
+			expectedSelector: "div > .ad",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, reason := SanitizeRule(tt.rule)
+			assert.Equal(t, tt.expectedReason, reason)
+			if tt.expectedSelector != "" {
+				assert.Equal(t, tt.expectedSelector, result.Action.Selector)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// ValidateSelectorPrefix checks an Options.SelectorPrefix: a single
+// selector that compound selectors can be nested under
+func ValidateSelectorPrefix(prefix string) error {
+	if strings.TrimSpace(prefix) != prefix {
+		return fmt.Errorf("%q has leading or trailing spaces", prefix)
+	}
+	parts := splitSelectorList(prefix)
+	if len(parts) != 1 || parts[0] == "" {
+		return fmt.Errorf("%q is not a single selector", prefix)
+	}
+	if strings.Contains(prefix, "::") {
+		return fmt.Errorf("%q has a pseudo-element, nothing can be nested under it", prefix)
+	}
+	return nil
+}
+
+// ValidateDomain checks a configured domain, such as an
+// Options.CosmeticExcludeDomains entry
+func ValidateDomain(domain string) error {
+	if !lintDomain(domain) || strings.HasPrefix(domain, "*") || strings.HasPrefix(domain, "~") {
+		return fmt.Errorf("%q is not a lowercase domain", domain)
+	}
+	return nil
+}
+
+// compileSelectorExclude compiles Options.SelectorExclude, leaving out
+// patterns that do not compile; the CLI refuses them before converting
+func compileSelectorExclude(patterns []string) []*regexp.Regexp {
+	var result []*regexp.Regexp
+	for _, p := range patterns {
+		if re, err := regexp.Compile(p); err == nil {
+			result = append(result, re)
+		}
+	}
+	return result
+}
+
+// scopeSelector applies Options.SelectorExclude and SelectorPrefix to a
+// simplified selector: the selectors of the list matching an exclude
+// pattern are left out and the others nested under the prefix. Returns
+// false when nothing is left. Hiding rules and cosmetic exceptions go
+// through it alike, so exceptions keep matching the rules they lift.
+func (c *Converter) scopeSelector(selector string) (string, bool) {
+	if len(c.exclude) == 0 && c.opts.SelectorPrefix == "" {
+		return selector, true
+	}
+
+	parts := splitSelectorList(selector)
+	kept := parts[:0]
+	for _, p := range parts {
+		if !c.excludedSelector(p) {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == 0 {
+		return "", false
+	}
+	if prefix := c.opts.SelectorPrefix; prefix != "" {
+		for i, p := range kept {
+			kept[i] = prefix + " " + p
+		}
+	}
+	return strings.Join(kept, ", "), true
+}
+
+func (c *Converter) excludedSelector(selector string) bool {
+	for _, re := range c.exclude {
+		if re.MatchString(selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeCosmetic is the converter pass enforcing the cosmetic scope
+// options on css-display-none rules: excluded selectors are removed,
+// the others prefixed, and the rules kept off
+// Options.CosmeticExcludeDomains like a #@# exception would.
+func (c *Converter) scopeCosmetic(rules []models.WebKitRule) []models.WebKitRule {
+	if len(c.exclude) == 0 && c.opts.SelectorPrefix == "" && len(c.excludeDomains) == 0 {
+		return rules
+	}
+
+	result := rules[:0]
+	for _, r := range rules {
+		if r.Action.Type != models.ActionCSSDisplayNone {
+			result = append(result, r)
+			continue
+		}
+
+		selector, ok := c.scopeSelector(r.Action.Selector)
+		if !ok {
+			c.stats.ScopeExcluded++
+			continue
+		}
+		r.Action.Selector = selector
+
+		if len(c.excludeDomains) > 0 {
+			var lifted, keep bool
+			r, lifted, keep = liftDomains(r, c.excludeDomains)
+			if lifted {
+				c.stats.ScopeExcluded++
+			}
+			if !keep {
+				continue
+			}
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// splitSelectorList splits a selector list at its top-level commas,
+// outside parentheses, attribute selectors and strings
+func splitSelectorList(selector string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(selector); i++ {
+		ch := selector[i]
+		switch {
+		case ch == '\\':
+			i++
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(' || ch == '[':
+			depth++
+		case ch == ')' || ch == ']':
+			depth--
+		case ch == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(selector[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(selector[start:]))
+}
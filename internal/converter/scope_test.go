@@ -0,0 +1,50 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopeCosmetic(t *testing.T) {
+	filters, err := parser.New().Parse(strings.NewReader(
+		"##video\n##.ad, video, a[title=\"x,y\"]\nnews.com,bank.com##.promo\n##.banner\n~bank.com##.sidebar\nbank.com##.only\n##.lifted\n#@#.lifted\n||ads.example.com^\n"))
+	require.NoError(t, err)
+	c := NewWithOptions(Options{
+		Target:                 Targets[DefaultTarget],
+		SelectorPrefix:         "html:not(.off)",
+		SelectorExclude:        []string{"^video$"},
+		CosmeticExcludeDomains: []string{"bank.com"},
+	})
+	rules := c.Convert(filters)
+
+	selectors := make(map[string][]string)
+	for _, r := range rules {
+		if r.Action.Selector != "" {
+			selectors[r.Action.Selector] = append(r.Trigger.IfDomain, r.Trigger.UnlessDomain...)
+		}
+	}
+	assert.Equal(t, map[string][]string{
+		`html:not(.off) .ad, html:not(.off) a[title="x,y"]`: {"*bank.com"},
+		"html:not(.off) .promo":                             {"*news.com"},
+		"html:not(.off) .banner":                            {"*bank.com"},
+		"html:not(.off) .sidebar":                           {"*bank.com"},
+		"html:not(.off) .lifted":                            {"*bank.com"},
+	}, selectors)
+	// The exception is scoped like the rule it lifts
+	assert.Equal(t, "html:not(.off) .lifted", c.CosmeticExceptions()[0].Selector)
+	// ##video dropped, the others restricted or dropped off bank.com
+	assert.Equal(t, 6, c.Stats().ScopeExcluded)
+}
+
+func TestValidateSelectorPrefix(t *testing.T) {
+	assert.NoError(t, ValidateSelectorPrefix("html:not(.a, .b)"))
+	assert.Error(t, ValidateSelectorPrefix("html, body"))
+	assert.Error(t, ValidateSelectorPrefix(" html"))
+	assert.Error(t, ValidateSelectorPrefix("div::before"))
+	assert.Error(t, ValidateDomain("*.bank.com"))
+	assert.NoError(t, ValidateDomain("bank.com"))
+}
@@ -0,0 +1,95 @@
+package converter
+
+import (
+	"strings"
+)
+
+// SimplifySelector removes prefixes that every hidden element matches
+// anyway: "html body .ad" and "html > body .ad" become ".ad". Only
+// descendant combinators are dropped, "body > .ad" keeps its meaning.
+func SimplifySelector(selector string) string {
+	s := strings.TrimSpace(selector)
+	for {
+		rest, ok := trimRootPrefix(s)
+		if !ok {
+			return s
+		}
+		s = rest
+	}
+}
+
+// trimRootPrefix strips one leading html/body compound selector
+func trimRootPrefix(s string) (string, bool) {
+	for _, root := range []string{"html", "body"} {
+		if !strings.HasPrefix(s, root) || len(s) == len(root) {
+			continue
+		}
+		rest := s[len(root):]
+		trimmed := strings.TrimLeft(rest, " \t")
+		switch {
+		case trimmed == "" || trimmed == rest && trimmed[0] != '>':
+			// part of a longer compound (html.dark, bodyx) or nothing left
+			continue
+		case trimmed[0] == '>':
+			// html > body ... is always true, body > x is not
+			next := strings.TrimLeft(trimmed[1:], " \t")
+			if root == "html" && strings.HasPrefix(next, "body") {
+				return next, true
+			}
+			continue
+		case trimmed[0] == '+' || trimmed[0] == '~' || trimmed[0] == ',':
+			continue
+		}
+		return trimmed, true
+	}
+	return s, false
+}
+
+// SelectorComplexity estimates how expensive a selector is for WebKit's
+// style engine. Each compound selector costs 1, attribute selectors 1 more
+// (3 with substring matching), :not()/:nth-*() 2, universal selectors 2
+// and every 64 characters 1, summed over a selector list.
+func SelectorComplexity(selector string) int {
+	score := len(selector) / 64
+	inAttr, inString := false, byte(0)
+	compound := false
+
+	for i := 0; i < len(selector); i++ {
+		ch := selector[i]
+		if inString != 0 {
+			if ch == '\\' {
+				i++
+			} else if ch == inString {
+				inString = 0
+			}
+			continue
+		}
+
+		switch {
+		case ch == '"' || ch == '\'':
+			inString = ch
+		case ch == '[':
+			inAttr = true
+			score++
+		case ch == ']':
+			inAttr = false
+		case inAttr:
+			if (ch == '*' || ch == '^' || ch == '$') && i+1 < len(selector) && selector[i+1] == '=' {
+				score += 2
+			}
+		case ch == ' ' || ch == '>' || ch == '+' || ch == '~' || ch == ',' || ch == '\t':
+			compound = false
+			continue
+		case ch == '*':
+			score += 2
+		case ch == ':' && (strings.HasPrefix(selector[i:], ":not(") || strings.HasPrefix(selector[i:], ":nth-")):
+			score += 2
+		}
+
+		if !compound {
+			compound = true
+			score++
+		}
+	}
+	return score
+}
@@ -0,0 +1,50 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimplifySelector(t *testing.T) {
+	tests := map[string]string{
+		"html body .ad":            ".ad",
+		"html > body .ad":          ".ad",
+		"html > body > .ad":        "body > .ad",
+		"body .ad":                 ".ad",
+		"body > .ad":               "body > .ad",
+		"html.dark .ad":            "html.dark .ad",
+		"bodyguard .ad":            "bodyguard .ad",
+		"body + .ad":               "body + .ad",
+		".ad":                      ".ad",
+		"  html   body   div.ad  ": "div.ad",
+	}
+	for input, expected := range tests {
+		assert.Equal(t, expected, SimplifySelector(input), input)
+	}
+}
+
+func TestSelectorComplexity(t *testing.T) {
+	assert.Equal(t, 1, SelectorComplexity(".ad"))
+	assert.Equal(t, 2, SelectorComplexity("div.ad, .banner"))
+	assert.Equal(t, 3, SelectorComplexity("div > .a .b"))
+	assert.Equal(t, 4, SelectorComplexity(`a[href*="ads"]`))
+	assert.Equal(t, 3, SelectorComplexity("*.ad"))
+	assert.Greater(t, SelectorComplexity(`div:not(.a) > span:nth-child(2) ~ p [class^="x"] *`), 10)
+}
+
+func TestConvertCosmeticSelectorLimits(t *testing.T) {
+	filters := []models.Filter{
+		{Type: models.FilterTypeCosmetic, Selector: "html body .ad"},
+		{Type: models.FilterTypeCosmetic, Selector: `div:not(.a) > span:nth-child(2) ~ p [class^="x"] *`},
+	}
+
+	c := NewWithOptions(Options{Target: Targets[DefaultTarget], MaxSelectorComplexity: 8})
+	rules := c.Convert(filters)
+
+	assert.Len(t, rules, 1)
+	assert.Equal(t, ".ad", rules[0].Action.Selector)
+	assert.Equal(t, 1, c.Stats().Simplified)
+	assert.Equal(t, 1, c.Stats().SkipReasons[models.SkipComplexSelector])
+}
@@ -0,0 +1,76 @@
+package converter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/psl"
+)
+
+// shardUnkeyed names the shard of rules not anchored to a hostname
+const shardUnkeyed = "any"
+
+// WithShards returns a copy of the splitter that shards the rules of
+// SplitWithTrailer by the registrable domain their url-filter is anchored
+// to, so WebKit compiles several smaller content blockers instead of one
+// large one. mode is models.ShardFirstLetter or models.ShardHash, count the
+// number of hash shards; an empty mode disables sharding.
+func (s *Splitter) WithShards(mode string, count int) *Splitter {
+	c := *s
+	c.shard, c.shards = mode, max(count, 1)
+	return &c
+}
+
+// splitShards divides rules into shards, then each shard into parts of at
+// most maxRules with the trailer appended.
+//
+// An exception only lifts blocks before it in its own content blocker, so
+// it is copied to every shard holding such a block: an anchored one to its
+// own shard and the unanchored one, an unanchored one to all shards started
+// so far. Exceptions never start a shard of their own.
+func (s *Splitter) splitShards(rules, trailer []models.WebKitRule, baseName string) []Part {
+	shards := make(map[string][]models.WebKitRule)
+	for _, r := range rules {
+		key := s.shardKey(r)
+		if r.Action.Type != models.ActionIgnorePreviousRule {
+			shards[key] = append(shards[key], r)
+			continue
+		}
+		for k := range shards {
+			if key == shardUnkeyed || k == key || k == shardUnkeyed {
+				shards[k] = append(shards[k], r)
+			}
+		}
+	}
+
+	plain := &Splitter{maxRules: s.maxRules, partName: s.partName}
+	var result []Part
+	for _, key := range slices.Sorted(maps.Keys(shards)) {
+		result = append(result, plain.SplitWithTrailer(shards[key], trailer, baseName+"-"+key)...)
+	}
+	return result
+}
+
+// shardKey names the shard of a rule after the registrable domain of the
+// hostname its url-filter is anchored to, keeping a site and its
+// subdomains together
+func (s *Splitter) shardKey(r models.WebKitRule) string {
+	host, ok := anchoredHost(r.Trigger.URLFilter)
+	if !ok {
+		return shardUnkeyed
+	}
+	domain, ok := psl.Default().RegistrableDomain(host)
+	if !ok {
+		return shardUnkeyed
+	}
+
+	if s.shard == models.ShardHash {
+		h := fnv.New32a()
+		h.Write([]byte(domain))
+		return fmt.Sprintf("%02d", h.Sum32()%uint32(s.shards))
+	}
+	return domain[:1]
+}
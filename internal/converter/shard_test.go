@@ -0,0 +1,57 @@
+package converter
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitShards(t *testing.T) {
+	convert := func(lines ...string) []models.WebKitRule {
+		filters, err := parser.New().Parse(strings.NewReader(strings.Join(lines, "\n")))
+		require.NoError(t, err)
+		return New().Convert(filters)
+	}
+	rules := convert("||ads.example.com^", "||banner.example.com^", "||tracker.org^", "/adframe.", "@@||cdn.example.com^", "@@/adframe.$domain=news.org")
+	trailer := []models.WebKitRule{{
+		Trigger: models.WebKitTrigger{URLFilter: ".*", IfDomain: []string{"*allowed.net"}},
+		Action:  models.WebKitAction{Type: models.ActionIgnorePreviousRule},
+	}}
+
+	parts := make(map[string][]models.WebKitRule)
+	for _, part := range NewSplitter(100).WithShards(models.ShardFirstLetter, 0).SplitWithTrailer(rules, trailer, "combined") {
+		parts[part.Name] = part.Rules
+	}
+	require.ElementsMatch(t, []string{"combined-e", "combined-t", "combined-any"}, slices.Collect(maps.Keys(parts)))
+
+	// A site and its subdomains share a shard with the exceptions lifting them
+	assert.Equal(t, convert("||ads.example.com^", "||banner.example.com^", "@@||cdn.example.com^", "@@/adframe.$domain=news.org"), withoutTrailer(t, parts["combined-e"], trailer))
+	assert.Equal(t, convert("||tracker.org^", "@@/adframe.$domain=news.org"), withoutTrailer(t, parts["combined-t"], trailer))
+	// Unanchored blocks may match any host, so anchored exceptions go there too
+	assert.Equal(t, convert("/adframe.", "@@||cdn.example.com^", "@@/adframe.$domain=news.org"), withoutTrailer(t, parts["combined-any"], trailer))
+
+	// Hash shards are stable and still capped per part
+	hashed := NewSplitter(3).WithShards(models.ShardHash, 4).SplitWithTrailer(rules, trailer, "combined")
+	assert.Equal(t, hashed, NewSplitter(3).WithShards(models.ShardHash, 4).SplitWithTrailer(rules, trailer, "combined"))
+	total := 0
+	for _, part := range hashed {
+		assert.LessOrEqual(t, len(part.Rules), 3, part.Name)
+		assert.Regexp(t, `^combined-(\d\d|any)(-part\d+)?$`, part.Name)
+		total += len(part.Rules)
+	}
+	assert.GreaterOrEqual(t, total, len(rules))
+}
+
+// withoutTrailer checks a shard ends in the trailer and returns the rest
+func withoutTrailer(t *testing.T, part, trailer []models.WebKitRule) []models.WebKitRule {
+	t.Helper()
+	require.GreaterOrEqual(t, len(part), len(trailer))
+	assert.Equal(t, trailer, part[len(part)-len(trailer):])
+	return part[:len(part)-len(trailer)]
+}
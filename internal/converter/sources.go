@@ -0,0 +1,84 @@
+package converter
+
+import (
+	"hash/fnv"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// NoSource marks rules of no list in a SourceRange: the allowlist and
+// domain policy, or rules a list contributed in a form the index was not
+// given
+const NoSource = -1
+
+// SourceRange is a run of consecutive rules of a content blocker file
+// coming from the same list, First and Last included
+type SourceRange struct {
+	List  int `json:"list"` // position of the list in build order, NoSource for none
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+// SourceIndex remembers which list each rule came from, so host apps can
+// tell which list blocked a request. Like Deduplicate, the first list with
+// a rule keeps it.
+type SourceIndex struct {
+	first map[uint64]int
+}
+
+// NewSourceIndex returns an empty index
+func NewSourceIndex() *SourceIndex {
+	return &SourceIndex{first: make(map[uint64]int)}
+}
+
+// Add records rules of the list at position list in build order
+func (s *SourceIndex) Add(list int, rules []models.WebKitRule) {
+	for _, r := range rules {
+		key, ok := sourceKey(r)
+		if !ok {
+			continue
+		}
+		if _, seen := s.first[key]; !seen {
+			s.first[key] = list
+		}
+	}
+}
+
+// Source returns the list a rule came from, NoSource if none
+func (s *SourceIndex) Source(r models.WebKitRule) int {
+	key, ok := sourceKey(r)
+	if !ok {
+		return NoSource
+	}
+	if list, found := s.first[key]; found {
+		return list
+	}
+	return NoSource
+}
+
+// Ranges returns the lists the rules of a content blocker file came from,
+// as runs of consecutive rules. Combined outputs keep the build order of
+// lists, so a file usually holds one run per list.
+func (s *SourceIndex) Ranges(rules []models.WebKitRule) []SourceRange {
+	var ranges []SourceRange
+	for i, r := range rules {
+		list := s.Source(r)
+		if n := len(ranges); n > 0 && ranges[n-1].List == list {
+			ranges[n-1].Last = i
+			continue
+		}
+		ranges = append(ranges, SourceRange{List: list, First: i, Last: i})
+	}
+	return ranges
+}
+
+// sourceKey hashes the identity ruleKey gives a rule
+func sourceKey(r models.WebKitRule) (uint64, bool) {
+	key, ok := ruleKey(r)
+	if !ok {
+		return 0, false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64(), true
+}
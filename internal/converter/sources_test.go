@@ -0,0 +1,29 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceIndexRanges(t *testing.T) {
+	block := func(filter string) models.WebKitRule {
+		return models.WebKitRule{Trigger: models.WebKitTrigger{URLFilter: filter}, Action: models.WebKitAction{Type: models.ActionBlock}}
+	}
+	a, b, c, allow := block("a"), block("b"), block("c"), block("allow")
+
+	idx := NewSourceIndex()
+	idx.Add(0, []models.WebKitRule{a, b})
+	idx.Add(1, []models.WebKitRule{b, c}) // b stays with the first list
+	assert.Equal(t, 1, idx.Source(c))
+	assert.Equal(t, NoSource, idx.Source(allow))
+
+	ranges := idx.Ranges(Deduplicate([]models.WebKitRule{a, b, b, c, allow}))
+	assert.Equal(t, []SourceRange{
+		{List: 0, First: 0, Last: 1},
+		{List: 1, First: 2, Last: 2},
+		{List: NoSource, First: 3, Last: 3},
+	}, ranges)
+	assert.Empty(t, idx.Ranges(nil))
+}
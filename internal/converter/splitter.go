@@ -1,7 +1,7 @@
 package converter
 
 import (
-	"fmt"
+	"encoding/json"
 
 	"github.com/bnema/ublock-webkit-filters/internal/models"
 )
@@ -12,6 +12,17 @@ const MaxRulesPerFile = 50000
 // Splitter splits rules into chunks respecting the 50k limit
 type Splitter struct {
 	maxRules int
+	partName string // template naming the parts of a split ruleset
+	shard    string // shard mode of SplitWithTrailer, "" for none
+	shards   int    // shards of the hash mode
+}
+
+// Part is one content blocker file of a split ruleset
+type Part struct {
+	Name  string // file name without .json
+	Index int    // position from 1, 0 when the ruleset fit a single file
+	Total int    // parts the ruleset was split into
+	Rules []models.WebKitRule
 }
 
 // NewSplitter creates a splitter with the given max rules per file
@@ -19,21 +30,18 @@ func NewSplitter(maxRules int) *Splitter {
 	if maxRules <= 0 {
 		maxRules = MaxRulesPerFile
 	}
-	return &Splitter{maxRules: maxRules}
+	return &Splitter{maxRules: maxRules, partName: DefaultPartName}
 }
 
-// Split divides rules into multiple files if needed
-// Returns a map of filename suffix -> rules
-func (s *Splitter) Split(rules []models.WebKitRule, baseName string) map[string][]models.WebKitRule {
-	result := make(map[string][]models.WebKitRule)
-
+// Split divides rules into multiple files if needed, named after baseName
+// and the part name template. A ruleset that fits one file keeps baseName.
+func (s *Splitter) Split(rules []models.WebKitRule, baseName string) []Part {
 	if len(rules) <= s.maxRules {
-		result[baseName] = rules
-		return result
+		return []Part{{Name: baseName, Total: 1, Rules: rules}}
 	}
 
 	numParts := (len(rules) + s.maxRules - 1) / s.maxRules
-
+	parts := make([]Part, 0, numParts)
 	for i := 0; i < numParts; i++ {
 		start := i * s.maxRules
 		end := start + s.maxRules
@@ -41,11 +49,15 @@ func (s *Splitter) Split(rules []models.WebKitRule, baseName string) map[string]
 			end = len(rules)
 		}
 
-		filename := fmt.Sprintf("%s-part%d", baseName, i+1)
-		result[filename] = rules[start:end]
+		parts = append(parts, Part{
+			Name:  formatPartName(s.partName, baseName, i+1, numParts),
+			Index: i + 1,
+			Total: numParts,
+			Rules: rules[start:end],
+		})
 	}
 
-	return result
+	return parts
 }
 
 // Deduplicate removes duplicate rules based on their JSON representation
@@ -54,12 +66,10 @@ func Deduplicate(rules []models.WebKitRule) []models.WebKitRule {
 	result := make([]models.WebKitRule, 0, len(rules))
 
 	for _, r := range rules {
-		// Create a key from trigger and action
-		key := fmt.Sprintf("%s|%s|%s",
-			r.Trigger.URLFilter,
-			r.Action.Type,
-			r.Action.Selector,
-		)
+		key, ok := ruleKey(r)
+		if !ok {
+			continue
+		}
 
 		if !seen[key] {
 			seen[key] = true
@@ -69,3 +79,39 @@ func Deduplicate(rules []models.WebKitRule) []models.WebKitRule {
 
 	return result
 }
+
+// ruleKey identifies a rule by its JSON representation. Keying on the whole
+// rule keeps rules that only differ in their domain or resource-type
+// conditions apart.
+func ruleKey(r models.WebKitRule) (string, bool) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// SplitWithTrailer divides rules like Split but appends trailer to every
+// part. Exceptions only override rules of the same content blocker, so
+// trailing ignore-previous-rules entries must be repeated in each file.
+// A splitter made WithShards shards the rules first.
+func (s *Splitter) SplitWithTrailer(rules, trailer []models.WebKitRule, baseName string) []Part {
+	if s.shard != "" {
+		return s.splitShards(rules, trailer, baseName)
+	}
+	if len(trailer) == 0 {
+		return s.Split(rules, baseName)
+	}
+
+	limit := s.maxRules - len(trailer)
+	if limit < 1 {
+		limit = 1
+	}
+	parts := (&Splitter{maxRules: limit, partName: s.partName}).Split(rules, baseName)
+	for i, part := range parts {
+		withTrailer := make([]models.WebKitRule, 0, len(part.Rules)+len(trailer))
+		withTrailer = append(withTrailer, part.Rules...)
+		parts[i].Rules = append(withTrailer, trailer...)
+	}
+	return parts
+}
@@ -0,0 +1,37 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeduplicateKeepsDistinctConditions(t *testing.T) {
+	caseSensitive := true
+	rule := func(trigger models.WebKitTrigger, action models.WebKitAction) models.WebKitRule {
+		trigger.URLFilter = `^https?://ads\.example\.com[/:]`
+		return models.WebKitRule{Trigger: trigger, Action: action}
+	}
+	block := models.WebKitAction{Type: models.ActionBlock}
+	hide := models.WebKitAction{Type: models.ActionCSSDisplayNone, Selector: ".ad"}
+
+	// Deduplication used to key on url-filter, action type and selector
+	// only, keeping the first of each of these groups and silently dropping
+	// the conditions of the others
+	collapsed := [][]models.WebKitRule{
+		{rule(models.WebKitTrigger{IfDomain: []string{"*a.com"}}, hide), rule(models.WebKitTrigger{IfDomain: []string{"*b.com"}}, hide)},
+		{rule(models.WebKitTrigger{IfDomain: []string{"*a.com"}}, hide), rule(models.WebKitTrigger{UnlessDomain: []string{"*a.com"}}, hide)},
+		{rule(models.WebKitTrigger{ResourceType: []string{"script"}}, block), rule(models.WebKitTrigger{ResourceType: []string{"image"}}, block)},
+		{rule(models.WebKitTrigger{}, block), rule(models.WebKitTrigger{LoadType: []string{"third-party"}}, block)},
+		{rule(models.WebKitTrigger{}, block), rule(models.WebKitTrigger{URLFilterIsCaseSensitive: &caseSensitive}, block)},
+	}
+	for _, rules := range collapsed {
+		assert.Equal(t, rules, Deduplicate(rules))
+	}
+
+	// Identical rules are still merged, the first one kept
+	a := rule(models.WebKitTrigger{IfDomain: []string{"*a.com"}}, hide)
+	b := rule(models.WebKitTrigger{IfDomain: []string{"*b.com"}}, hide)
+	assert.Equal(t, []models.WebKitRule{a, b}, Deduplicate([]models.WebKitRule{a, b, a}))
+}
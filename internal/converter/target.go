@@ -0,0 +1,45 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Target describes the content blocker features of a WebKit version
+type Target struct {
+	Name        string
+	LoadContext bool // load-context trigger (Safari 15, WebKitGTK 2.34)
+	MaxRules    int  // rules a single content blocker may hold
+}
+
+// DefaultTarget is the target used when none is configured
+const DefaultTarget = "webkit"
+
+// SafariExtensionMaxRules is the practical size of one iOS content blocker
+// extension: larger files fail to compile on older devices
+const SafariExtensionMaxRules = 50000
+
+// Targets lists the supported target profiles by name
+var Targets = map[string]Target{
+	"webkit":   {Name: "webkit", LoadContext: true, MaxRules: 50000},
+	"safari15": {Name: "safari15", LoadContext: true, MaxRules: 50000},
+	"safari14": {Name: "safari14", MaxRules: 50000},
+}
+
+// LookupTarget returns the named target profile, the default for ""
+func LookupTarget(name string) (Target, error) {
+	if name == "" {
+		name = DefaultTarget
+	}
+	if t, ok := Targets[name]; ok {
+		return t, nil
+	}
+
+	names := make([]string, 0, len(Targets))
+	for n := range Targets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return Target{}, fmt.Errorf("unknown target %q (want %s)", name, strings.Join(names, ", "))
+}
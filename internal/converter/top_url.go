@@ -0,0 +1,70 @@
+package converter
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// substituteTopURL rewrites if-domain conditions longer than the configured
+// threshold into if-top-url patterns. WebKit regexes have no alternation, so
+// each domain becomes its own array entry; the entries are spread over
+// several copies of the rule when a chunk size is set, trading rule count
+// for shorter arrays in WebKit's rule compiler.
+func (c *Converter) substituteTopURL(rules []models.WebKitRule) []models.WebKitRule {
+	threshold := c.opts.TopURLThreshold
+	if threshold <= 0 {
+		return rules
+	}
+
+	var result []models.WebKitRule
+	for _, r := range rules {
+		if len(r.Trigger.IfDomain) <= threshold {
+			result = append(result, r)
+			continue
+		}
+
+		patterns := make([]string, 0, len(r.Trigger.IfDomain))
+		for _, d := range r.Trigger.IfDomain {
+			patterns = append(patterns, TopURLPattern(d))
+		}
+
+		size := c.opts.TopURLChunkSize
+		if size <= 0 {
+			size = len(patterns)
+		}
+		for start := 0; start < len(patterns); start += size {
+			end := min(start+size, len(patterns))
+			chunk := r
+			chunk.Trigger.IfDomain = nil
+			chunk.Trigger.IfTopURL = patterns[start:end]
+			result = append(result, chunk)
+		}
+	}
+	return result
+}
+
+// hotGeneric reports whether a generic cosmetic rule hiding selector gets
+// the Options.GenericUnlessTopURL patterns, keeping it off pages such as
+// search engines and web apps its broad selector tends to break
+func (c *Converter) hotGeneric(selector string) bool {
+	if len(c.opts.GenericUnlessTopURL) == 0 {
+		return false
+	}
+	if len(c.opts.GenericHotSelectors) == 0 {
+		return true
+	}
+	return c.hot[selector]
+}
+
+// TopURLPattern converts an if-domain entry (*example.com matches
+// subdomains too) into an if-top-url regex matching the same documents
+func TopURLPattern(domain string) string {
+	anchor := "^[a-z-]+://"
+	if name, ok := strings.CutPrefix(domain, "*"); ok {
+		domain = name
+		anchor = restrHostnameAnchor1
+	}
+	return anchor + regexp.QuoteMeta(domain) + restrSeparator
+}
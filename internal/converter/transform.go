@@ -0,0 +1,177 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// ValidateTransform checks a configured transform before any list uses it
+func ValidateTransform(t models.Transform) error {
+	switch t.Action {
+	case models.TransformDrop:
+		if !lintDomain(t.Domain) || strings.HasPrefix(t.Domain, "*") {
+			return fmt.Errorf("drop: domain %q is not a lowercase domain", t.Domain)
+		}
+	case models.TransformRewrite:
+		for _, d := range []string{t.Domain, t.To} {
+			if !lintDomain(d) || strings.HasPrefix(d, "*") {
+				return fmt.Errorf("rewrite: domain %q is not a lowercase domain", d)
+			}
+		}
+	case models.TransformResourceType:
+		if len(t.ResourceTypes) == 0 {
+			return errors.New("resource-type: resource_types is empty")
+		}
+		if v, ok := unknownValue(t.ResourceTypes, lintResourceTypes); ok {
+			return fmt.Errorf("resource-type: unknown WebKit resource type %q", v)
+		}
+	default:
+		return fmt.Errorf("unknown action %q (want drop, resource-type or rewrite)", t.Action)
+	}
+	return nil
+}
+
+// ValidateDefaultTypes checks the default_types of a list. Document and
+// popup need a load-context to stay off top-level navigations, which a
+// filter without type options never asked for, so only subresource types
+// are accepted.
+func ValidateDefaultTypes(types []string) error {
+	for _, t := range types {
+		if !slices.Contains(lintResourceTypes, t) {
+			return fmt.Errorf("unknown WebKit resource type %q", t)
+		}
+		if t == models.ResourceDocument || t == models.ResourcePopup {
+			return fmt.Errorf("%q is not a subresource type", t)
+		}
+	}
+	return nil
+}
+
+// transform applies the configured transforms, in order, to the rules of
+// one filter or imported rule
+func (c *Converter) transform(rules []models.WebKitRule) []models.WebKitRule {
+	if len(c.opts.Transforms) == 0 {
+		return rules
+	}
+
+	result := rules[:0]
+	for _, r := range rules {
+		keep, changed := true, false
+		for _, t := range c.opts.Transforms {
+			var ok bool
+			r, ok, keep = applyTransform(r, t)
+			changed = changed || ok
+			if !keep {
+				break
+			}
+		}
+		if changed || !keep {
+			c.stats.Transformed++
+		}
+		if keep {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// applyTransform returns the rule as the transform leaves it, whether it
+// changed and whether it is kept at all
+func applyTransform(r models.WebKitRule, t models.Transform) (models.WebKitRule, bool, bool) {
+	switch t.Action {
+	case models.TransformDrop:
+		if host, ok := anchoredHost(r.Trigger.URLFilter); ok && withinDomain(host, t.Domain) {
+			return r, true, false
+		}
+		if len(r.Trigger.IfDomain) == 0 {
+			return r, false, true
+		}
+		kept := slices.DeleteFunc(slices.Clone(r.Trigger.IfDomain), func(d string) bool {
+			return withinDomain(strings.TrimPrefix(d, "*"), t.Domain)
+		})
+		if len(kept) == len(r.Trigger.IfDomain) {
+			return r, false, true
+		}
+		r.Trigger.IfDomain = kept
+		return r, true, len(kept) > 0
+
+	case models.TransformResourceType:
+		// Hiding rules apply to pages, not requests
+		if r.Action.Type == models.ActionCSSDisplayNone || slices.Equal(r.Trigger.ResourceType, t.ResourceTypes) {
+			return r, false, true
+		}
+		r.Trigger.ResourceType = slices.Clone(t.ResourceTypes)
+		return r, true, true
+
+	case models.TransformRewrite:
+		before := r.Trigger
+		r.Trigger.URLFilter = rewriteRegexHost(r.Trigger.URLFilter, t.Domain, t.To)
+		r.Trigger.IfDomain = rewriteDomains(r.Trigger.IfDomain, t.Domain, t.To)
+		r.Trigger.UnlessDomain = rewriteDomains(r.Trigger.UnlessDomain, t.Domain, t.To)
+		changed := r.Trigger.URLFilter != before.URLFilter ||
+			!slices.Equal(r.Trigger.IfDomain, before.IfDomain) ||
+			!slices.Equal(r.Trigger.UnlessDomain, before.UnlessDomain)
+		return r, changed, true
+	}
+	return r, false, true
+}
+
+// withinDomain reports whether host is domain or one of its subdomains
+func withinDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// rewriteDomains replaces from and its subdomains in a domain condition,
+// keeping the * subdomain prefix
+func rewriteDomains(domains []string, from, to string) []string {
+	var result []string
+	for i, d := range domains {
+		name := strings.TrimPrefix(d, "*")
+		if !withinDomain(name, from) {
+			continue
+		}
+		if result == nil {
+			result = slices.Clone(domains)
+		}
+		result[i] = d[:len(d)-len(name)] + strings.TrimSuffix(name, from) + to
+	}
+	if result == nil {
+		return domains
+	}
+	return result
+}
+
+// rewriteRegexHost replaces the hostname from, escaped as url-filters write
+// it, with to wherever it is a whole hostname or its parent domain: not
+// part of a longer label (ba.com) or followed by more labels (a.com.evil)
+func rewriteRegexHost(re, from, to string) string {
+	escFrom, escTo := regexp.QuoteMeta(from), regexp.QuoteMeta(to)
+	var b strings.Builder
+	for {
+		i := strings.Index(re, escFrom)
+		if i == -1 {
+			b.WriteString(re)
+			return b.String()
+		}
+		end := i + len(escFrom)
+		whole := (i == 0 || !isHostByte(re[i-1])) &&
+			(end == len(re) || !isHostByte(re[end])) && !strings.HasPrefix(re[end:], `\.`)
+		b.WriteString(re[:i])
+		if whole {
+			b.WriteString(escTo)
+		} else {
+			b.WriteString(escFrom)
+		}
+		re = re[end:]
+	}
+}
+
+// isHostByte reports whether c can appear in a hostname label
+func isHostByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-'
+}
@@ -0,0 +1,66 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func convertWithTransforms(t *testing.T, list string, transforms ...models.Transform) ([]models.WebKitRule, Stats) {
+	t.Helper()
+	filters, err := parser.New().Parse(strings.NewReader(list))
+	require.NoError(t, err)
+	c := NewWithOptions(Options{Target: Targets[DefaultTarget], Transforms: transforms})
+	rules := c.Convert(filters)
+	return rules, c.Stats()
+}
+
+func TestTransformDrop(t *testing.T) {
+	list := "||ads.example.com/a.js\n||example.community/a.js\n/banner.$domain=example.com|other.org\nexample.com##.ad\n"
+	rules, stats := convertWithTransforms(t, list, models.Transform{Action: models.TransformDrop, Domain: "example.com"})
+
+	require.Len(t, rules, 2)
+	assert.Contains(t, rules[0].Trigger.URLFilter, `example\.community`)
+	assert.Equal(t, []string{"*other.org"}, rules[1].Trigger.IfDomain)
+	assert.Equal(t, 3, stats.Transformed)
+}
+
+func TestTransformResourceType(t *testing.T) {
+	rules, stats := convertWithTransforms(t, "||ads.example.com/a\n||cdn.example.com/b$script\n##.ad\n",
+		models.Transform{Action: models.TransformResourceType, ResourceTypes: []string{models.ResourceScript}})
+
+	require.Len(t, rules, 3)
+	assert.Equal(t, []string{models.ResourceScript}, rules[0].Trigger.ResourceType)
+	assert.Equal(t, []string{models.ResourceScript}, rules[1].Trigger.ResourceType)
+	assert.Empty(t, rules[2].Trigger.ResourceType)
+	assert.Equal(t, 1, stats.Transformed)
+}
+
+func TestTransformRewrite(t *testing.T) {
+	list := "||cdn.old.com/a.js\n||bold.com/a.js\n||old.com.evil.net/a.js\n/ad.$domain=old.com\n/pop.$domain=~www.old.com\n"
+	rules, stats := convertWithTransforms(t, list, models.Transform{Action: models.TransformRewrite, Domain: "old.com", To: "new.org"})
+
+	require.Len(t, rules, 5)
+	assert.Equal(t, `^[a-z-]+://(?:[^/?#]+\.)?cdn\.new\.org/a\.js`, rules[0].Trigger.URLFilter)
+	assert.Equal(t, `^[a-z-]+://(?:[^/?#]+\.)?bold\.com/a\.js`, rules[1].Trigger.URLFilter)
+	assert.Equal(t, `^[a-z-]+://(?:[^/?#]+\.)?old\.com\.evil\.net/a\.js`, rules[2].Trigger.URLFilter)
+	assert.Equal(t, []string{"*new.org"}, rules[3].Trigger.IfDomain)
+	assert.Equal(t, []string{"*www.new.org"}, rules[4].Trigger.UnlessDomain)
+	assert.Equal(t, 3, stats.Transformed)
+}
+
+func TestValidateTransform(t *testing.T) {
+	assert.NoError(t, ValidateTransform(models.Transform{Action: models.TransformDrop, Domain: "example.com"}))
+	assert.NoError(t, ValidateTransform(models.Transform{Action: models.TransformRewrite, Domain: "a.com", To: "b.com"}))
+	assert.NoError(t, ValidateTransform(models.Transform{Action: models.TransformResourceType, ResourceTypes: []string{"script", "raw"}}))
+
+	assert.Error(t, ValidateTransform(models.Transform{Action: models.TransformDrop}))
+	assert.Error(t, ValidateTransform(models.Transform{Action: models.TransformDrop, Domain: "Example.com"}))
+	assert.Error(t, ValidateTransform(models.Transform{Action: models.TransformRewrite, Domain: "a.com"}))
+	assert.Error(t, ValidateTransform(models.Transform{Action: models.TransformResourceType, ResourceTypes: []string{"xhr"}}))
+	assert.Error(t, ValidateTransform(models.Transform{Action: "replace"}))
+}
@@ -0,0 +1,83 @@
+package converter
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// tldPlaceholder stands in for a wildcard TLD while a pattern is converted.
+// It only contains characters PatternToRegex leaves untouched.
+const tldPlaceholder = "__tld__"
+
+// ccTLDExpr matches two-letter country-code TLDs and their co./com. second
+// level domains (example.de, example.co.uk, example.com.br) without using a
+// disjunction, which WebKit does not support
+const ccTLDExpr = `(?:com?\.)?[a-z][a-z]`
+
+// wildcardTLDHost returns the position of the ".*" TLD wildcard in a
+// hostname-anchored pattern such as ||example.*^ or ||example.*/ads
+func wildcardTLDHost(pattern string) (int, bool) {
+	if !strings.HasPrefix(pattern, "||") {
+		return 0, false
+	}
+	host := pattern[2:]
+	if end := strings.IndexAny(host, "^/|"); end != -1 {
+		host = host[:end]
+	}
+	if !strings.HasSuffix(host, ".*") || len(host) < 3 || strings.Count(host, "*") != 1 {
+		return 0, false
+	}
+	return 2 + len(host) - 1, true
+}
+
+// tldExpressions returns the regex fragments a wildcard TLD expands to:
+// one covering country codes and one literal per generic TLD of the public
+// suffix list's entity suffixes
+func (c *Converter) tldExpressions() []string {
+	if c.tldExprs != nil {
+		return c.tldExprs
+	}
+
+	hasCC := false
+	var generic []string
+	for _, suffix := range c.suffixes.EntitySuffixes() {
+		switch {
+		case strings.Contains(suffix, "."):
+			// second-level domains are covered by ccTLDExpr
+		case len(suffix) == 2:
+			hasCC = true
+		default:
+			generic = append(generic, regexp.QuoteMeta(suffix))
+		}
+	}
+
+	if hasCC {
+		c.tldExprs = append(c.tldExprs, ccTLDExpr)
+	}
+	c.tldExprs = append(c.tldExprs, generic...)
+	return c.tldExprs
+}
+
+// convertWildcardTLD converts ||example.*^ style filters. A plain conversion
+// would turn the TLD into .* and match example.anything/...; instead the
+// filter is converted once with a placeholder TLD and the rules are repeated
+// for every TLD expression.
+func (c *Converter) convertWildcardTLD(f models.Filter, isException bool, star int) ([]models.WebKitRule, models.SkipReason) {
+	f.Pattern = f.Pattern[:star] + tldPlaceholder + f.Pattern[star+1:]
+
+	base, reason := c.convertNetwork(f, isException)
+	if len(base) == 0 {
+		return nil, reason
+	}
+
+	var rules []models.WebKitRule
+	for _, expr := range c.tldExpressions() {
+		for _, r := range base {
+			r.Trigger.URLFilter = strings.Replace(r.Trigger.URLFilter, tldPlaceholder, expr, 1)
+			rules = append(rules, r)
+		}
+	}
+	return rules, ""
+}
@@ -0,0 +1,80 @@
+// Package embedded ships gzip-compressed snapshots of the core filter
+// lists in the binary, so a baseline blocker can be built without network
+// access and replaced by fresh downloads once there is connectivity
+package embedded
+
+import (
+	"compress/gzip"
+	"embed"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+)
+
+// Dir is where the snapshots live in the source tree, relative to the
+// repository root, for update-embedded
+const Dir = "internal/embedded/lists"
+
+//go:embed lists/*.txt.gz
+var snapshots embed.FS
+
+// files maps the upstream URL of each snapshot to its file, so lists match
+// by URL whatever their configured name
+var files = map[string]string{
+	"https://easylist.to/easylist/easylist.txt":                  "easylist.txt.gz",
+	"https://easylist.to/easylist/easyprivacy.txt":               "easyprivacy.txt.gz",
+	"https://ublockorigin.github.io/uAssets/filters/filters.txt": "ublock-filters.txt.gz",
+}
+
+// Snapshot is an embedded list being read
+type Snapshot struct {
+	io.ReadCloser
+	RecordedAt time.Time // when the snapshot was downloaded
+}
+
+// URLs returns the upstream URLs with an embedded snapshot, sorted
+func URLs() []string {
+	urls := make([]string, 0, len(files))
+	for url := range files {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// File returns the snapshot file name of an upstream URL
+func File(url string) (string, bool) {
+	name, ok := files[url]
+	return name, ok
+}
+
+// Open returns the decompressed snapshot of the list at url
+func Open(url string) (*Snapshot, error) {
+	name, ok := files[url]
+	if !ok {
+		return nil, fmt.Errorf("no embedded snapshot of %s", url)
+	}
+	f, err := snapshots.Open(path.Join("lists", name))
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("snapshot %s: %w", name, err)
+	}
+	return &Snapshot{ReadCloser: readCloser{gz, f}, RecordedAt: gz.ModTime.UTC()}, nil
+}
+
+// readCloser reads the decompressed stream and closes both layers
+type readCloser struct {
+	*gzip.Reader
+	file io.Closer
+}
+
+func (r readCloser) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
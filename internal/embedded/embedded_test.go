@@ -0,0 +1,26 @@
+package embedded
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshots(t *testing.T) {
+	// Every mapped snapshot is embedded and readable
+	require.NotEmpty(t, URLs())
+	for _, url := range URLs() {
+		s, err := Open(url)
+		require.NoError(t, err, url)
+		data, err := io.ReadAll(s)
+		require.NoError(t, err, url)
+		require.NoError(t, s.Close())
+		assert.Contains(t, string(data), "[Adblock Plus", url)
+		assert.False(t, s.RecordedAt.IsZero(), url)
+	}
+
+	_, err := Open("https://example.com/list.txt")
+	assert.ErrorContains(t, err, "no embedded snapshot")
+}
@@ -0,0 +1,87 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// GlobalCSS is the stylesheet name for selectors hidden on every site
+const GlobalCSS = "global.css"
+
+// CosmeticCSS groups element hiding selectors into user stylesheets, an
+// alternative to css-display-none rules that some embedders inject faster
+type CosmeticCSS struct {
+	Global  []string            // selectors hidden on every site
+	Domains map[string][]string // domain -> selectors hidden on it and its subdomains
+}
+
+// CSSExpressible reports whether a rule can be written as a stylesheet:
+// css-display-none on every URL, either everywhere or on if-domain sites
+func CSSExpressible(r models.WebKitRule) bool {
+	t := r.Trigger
+	return r.Action.Type == models.ActionCSSDisplayNone && t.URLFilter == ".*" &&
+		len(t.UnlessDomain) == 0 && len(t.IfTopURL) == 0 && len(t.UnlessTopURL) == 0 &&
+		len(t.LoadType) == 0 && len(t.ResourceType) == 0 && len(t.LoadContext) == 0
+}
+
+// NewCosmeticCSS collects the selectors of expressible rules, others are
+// ignored
+func NewCosmeticCSS(rules []models.WebKitRule) CosmeticCSS {
+	global := make(map[string]bool)
+	domains := make(map[string]map[string]bool)
+
+	for _, r := range rules {
+		if !CSSExpressible(r) {
+			continue
+		}
+		if len(r.Trigger.IfDomain) == 0 {
+			global[r.Action.Selector] = true
+			continue
+		}
+		for _, d := range r.Trigger.IfDomain {
+			d = strings.TrimPrefix(d, "*")
+			if domains[d] == nil {
+				domains[d] = make(map[string]bool)
+			}
+			domains[d][r.Action.Selector] = true
+		}
+	}
+
+	css := CosmeticCSS{
+		Global:  sortedSet(global),
+		Domains: make(map[string][]string, len(domains)),
+	}
+	for d, selectors := range domains {
+		css.Domains[d] = sortedSet(selectors)
+	}
+	return css
+}
+
+// DomainFile returns the stylesheet name for a domain
+func DomainFile(domain string) string {
+	return domain + ".css"
+}
+
+// WriteCSS writes selectors as a stylesheet. Each selector gets its own
+// rule, since one invalid selector would void a whole selector list.
+func WriteCSS(w io.Writer, selectors []string) error {
+	bw := bufio.NewWriter(w)
+	for _, s := range selectors {
+		fmt.Fprintf(bw, "%s { display: none !important; }\n", s)
+	}
+	return bw.Flush()
+}
+
+func sortedSet(set map[string]bool) []string {
+	result := make([]string, 0, len(set))
+	for s := range set {
+		result = append(result, s)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,39 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCosmeticCSS(t *testing.T) {
+	hide := func(selector string, trigger models.WebKitTrigger) models.WebKitRule {
+		return models.WebKitRule{
+			Trigger: trigger,
+			Action:  models.WebKitAction{Type: models.ActionCSSDisplayNone, Selector: selector},
+		}
+	}
+	rules := []models.WebKitRule{
+		hide(".ad", models.WebKitTrigger{URLFilter: ".*"}),
+		hide(".banner", models.WebKitTrigger{URLFilter: ".*", IfDomain: []string{"*example.com", "*example.org"}}),
+		hide(".promo", models.WebKitTrigger{URLFilter: ".*", UnlessDomain: []string{"*example.com"}}),
+		hide(".ad", models.WebKitTrigger{URLFilter: ".*"}),
+		{Trigger: models.WebKitTrigger{URLFilter: "ads"}, Action: models.WebKitAction{Type: models.ActionBlock}},
+	}
+
+	assert.False(t, CSSExpressible(rules[2]))
+	assert.False(t, CSSExpressible(rules[4]))
+
+	css := NewCosmeticCSS(rules)
+	assert.Equal(t, []string{".ad"}, css.Global)
+	assert.Equal(t, map[string][]string{
+		"example.com": {".banner"},
+		"example.org": {".banner"},
+	}, css.Domains)
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteCSS(&buf, []string{".a", "#b"}))
+	assert.Equal(t, ".a { display: none !important; }\n#b { display: none !important; }\n", buf.String())
+}
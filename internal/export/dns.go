@@ -0,0 +1,222 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/psl"
+)
+
+// DNS blocklist formats
+const (
+	FormatHosts   = "hosts"
+	FormatDnsmasq = "dnsmasq"
+	FormatUnbound = "unbound"
+	FormatRPZ     = "rpz"
+	FormatPihole  = "pihole"
+)
+
+// DNSFormats lists every supported DNS format with its output filename
+var DNSFormats = map[string]string{
+	FormatHosts:   "hosts.txt",
+	FormatDnsmasq: "dnsmasq.conf",
+	FormatUnbound: "unbound.conf",
+	FormatRPZ:     "rpz.zone",
+	FormatPihole:  "pihole.txt",
+}
+
+// HostSet collects hostnames from pure-hostname block filters (||example.com^
+// without options) minus those re-allowed by equally pure exceptions
+type HostSet struct {
+	blocked map[string]string // host -> first list that blocked it
+	allowed map[string]bool
+	order   []string // list names in the order they were added
+}
+
+// NewHostSet creates an empty host set
+func NewHostSet() *HostSet {
+	return &HostSet{
+		blocked: make(map[string]string),
+		allowed: make(map[string]bool),
+	}
+}
+
+// Add extracts hostnames from the parsed filters of one list
+func (h *HostSet) Add(list string, filters []models.Filter) {
+	blocked, allowed := PureHosts(filters)
+	h.AddHosts(list, blocked, allowed)
+}
+
+// AddHosts adds the hostnames one list blocks and re-allows, as returned by
+// PureHosts
+func (h *HostSet) AddHosts(list string, blocked, allowed []string) {
+	h.order = append(h.order, list)
+
+	for _, host := range allowed {
+		h.allowed[host] = true
+	}
+	for _, host := range blocked {
+		if _, ok := h.blocked[host]; !ok {
+			h.blocked[host] = list
+		}
+	}
+}
+
+// PureHosts returns the hostnames of pure-hostname block filters and
+// exceptions
+func PureHosts(filters []models.Filter) (blocked, allowed []string) {
+	for _, f := range filters {
+		if f.Type != models.FilterTypeNetwork && f.Type != models.FilterTypeException {
+			continue
+		}
+		host, ok := PureHostname(f)
+		if !ok {
+			continue
+		}
+		if f.Type == models.FilterTypeException {
+			allowed = append(allowed, host)
+		} else {
+			blocked = append(blocked, host)
+		}
+	}
+	return blocked, allowed
+}
+
+// Hosts returns the sorted blocked hostnames
+func (h *HostSet) Hosts() []string {
+	hosts := make([]string, 0, len(h.blocked))
+	for host := range h.blocked {
+		if !h.allowed[host] {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Sources returns how many blocked hosts each list contributed first
+func (h *HostSet) Sources() map[string]int {
+	counts := make(map[string]int, len(h.order))
+	for _, list := range h.order {
+		counts[list] = 0
+	}
+	for host, list := range h.blocked {
+		if !h.allowed[host] {
+			counts[list]++
+		}
+	}
+	return counts
+}
+
+// PureHostname returns the hostname of a ||host^ filter that blocks every
+// request to that host, which is the only kind DNS blocking can express
+func PureHostname(f models.Filter) (string, bool) {
+	opts := f.Options
+	opts.Important = false
+	if !opts.IsEmpty() {
+		return "", false
+	}
+
+	p := strings.TrimSuffix(f.Pattern, "|")
+	if !strings.HasPrefix(p, "||") || !strings.HasSuffix(p, "^") {
+		return "", false
+	}
+	host := p[2 : len(p)-1]
+	if strings.ContainsAny(host, "*^/|:") {
+		return "", false
+	}
+
+	host, err := psl.Normalize(host)
+	if err != nil || !psl.Default().IsValidDomain(host) {
+		return "", false
+	}
+	return host, true
+}
+
+// DNSOptions tunes the generated DNS blocklists
+type DNSOptions struct {
+	Sinkhole string // address returned for blocked hosts in hosts/dnsmasq format
+}
+
+// WriteDNS writes hosts in the given format
+func WriteDNS(w io.Writer, format string, hosts []string, opts DNSOptions) error {
+	sinkhole := opts.Sinkhole
+	if sinkhole == "" {
+		sinkhole = "0.0.0.0"
+	}
+
+	bw := bufio.NewWriter(w)
+	header := fmt.Sprintf("Generated by ublock-webkit-filters on %s, %d hosts",
+		time.Now().UTC().Format(time.RFC3339), len(hosts))
+
+	switch format {
+	case FormatHosts:
+		fmt.Fprintf(bw, "# %s\n", header)
+		for _, host := range hosts {
+			fmt.Fprintf(bw, "%s %s\n", sinkhole, host)
+		}
+	case FormatDnsmasq:
+		fmt.Fprintf(bw, "# %s\n", header)
+		for _, host := range hosts {
+			fmt.Fprintf(bw, "address=/%s/%s\n", host, sinkhole)
+		}
+	case FormatUnbound:
+		fmt.Fprintf(bw, "# %s\nserver:\n", header)
+		for _, host := range hosts {
+			fmt.Fprintf(bw, "  local-zone: \"%s\" always_nxdomain\n", host)
+		}
+	case FormatPihole:
+		// Pi-hole adlists accept one plain domain per line
+		fmt.Fprintf(bw, "# %s\n", header)
+		for _, host := range hosts {
+			fmt.Fprintln(bw, host)
+		}
+	case FormatRPZ:
+		serial := time.Now().UTC().Unix()
+		fmt.Fprintf(bw, "; %s\n$TTL 300\n", header)
+		fmt.Fprintf(bw, "@ IN SOA localhost. root.localhost. (%d 3600 600 86400 300)\n", serial)
+		fmt.Fprintf(bw, "  IN NS localhost.\n")
+		for _, host := range hosts {
+			fmt.Fprintf(bw, "%s CNAME .\n*.%s CNAME .\n", host, host)
+		}
+	default:
+		return fmt.Errorf("unknown DNS format %q", format)
+	}
+
+	return bw.Flush()
+}
+
+// PiholeAdlist mirrors the columns of Pi-hole's gravity adlist table so the
+// generated list can be registered with matching metadata
+type PiholeAdlist struct {
+	Address     string         `json:"address"`
+	Enabled     bool           `json:"enabled"`
+	Comment     string         `json:"comment"`
+	DateUpdated int64          `json:"date_updated"`
+	Number      int            `json:"number"`
+	Sources     map[string]int `json:"sources"`
+}
+
+// NewPiholeAdlist builds gravity-style metadata for the host set
+func NewPiholeAdlist(h *HostSet, address string) PiholeAdlist {
+	sources := h.Sources()
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return PiholeAdlist{
+		Address:     address,
+		Enabled:     true,
+		Comment:     "ublock-webkit-filters: " + strings.Join(names, ", "),
+		DateUpdated: time.Now().UTC().Unix(),
+		Number:      len(h.Hosts()),
+		Sources:     sources,
+	}
+}
@@ -0,0 +1,59 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostSet(t *testing.T) {
+	list := strings.Join([]string{
+		"||ads.example.com^",
+		"||tracker.net^|",
+		"||Mixed.Example.org^$important",
+		"||cdn.example.com^$script",
+		"||example.com/ads^",
+		"||*.wild.com^",
+		"||allowed.com^",
+		"@@||allowed.com^",
+		"example.com##.ad",
+	}, "\n")
+
+	p := parser.New()
+	filters, err := p.Parse(strings.NewReader(list))
+	assert.NoError(t, err)
+
+	hosts := NewHostSet()
+	hosts.Add("test", filters)
+
+	assert.Equal(t, []string{"ads.example.com", "mixed.example.org", "tracker.net"}, hosts.Hosts())
+	assert.Equal(t, map[string]int{"test": 3}, hosts.Sources())
+}
+
+func TestWriteDNS(t *testing.T) {
+	hosts := []string{"ads.example.com"}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{FormatHosts, "0.0.0.0 ads.example.com\n"},
+		{FormatDnsmasq, "address=/ads.example.com/0.0.0.0\n"},
+		{FormatUnbound, "local-zone: \"ads.example.com\" always_nxdomain\n"},
+		{FormatPihole, "\nads.example.com\n"},
+		{FormatRPZ, "ads.example.com CNAME .\n*.ads.example.com CNAME .\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, WriteDNS(&buf, tt.format, hosts, DNSOptions{}))
+			assert.Contains(t, buf.String(), tt.expected)
+		})
+	}
+
+	assert.Error(t, WriteDNS(&bytes.Buffer{}, "bind", hosts, DNSOptions{}))
+}
@@ -1,19 +1,94 @@
 package fetcher
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bnema/ublock-webkit-filters/internal/models"
 )
 
+// ErrNotModified is returned by FetchIfModified when the content has not
+// changed since the previous download
+var ErrNotModified = errors.New("not modified")
+
+// Info is the caching metadata of a download
+type Info struct {
+	Status       int       `json:"status,omitempty"` // HTTP status, 0 for local files
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Expires      time.Time `json:"expires,omitzero"` // from Cache-Control max-age or Expires
+	FetchedAt    time.Time `json:"fetched_at"`
+	Bytes        int64     `json:"bytes,omitempty"` // set by the caller for streamed bodies
+}
+
+// DefaultUserAgent identifies the tool when no user agent is configured
+const DefaultUserAgent = "ublock-webkit-filters/1.0"
+
 // Fetcher downloads filter lists
 type Fetcher struct {
-	client  *http.Client
-	retries int
+	client    *http.Client
+	cfg       models.HTTPConfig
+	retries   int
+	hosts     *hostLimiter
+	userAgent string
+	headers   map[string]string
+	err       error // invalid TLS settings, returned by every request
+
+	partialDir string // where interrupted downloads are kept, "" for nowhere
+}
+
+// maxRetryAfter caps how long a Retry-After header can delay a retry
+const maxRetryAfter = 5 * time.Minute
+
+// hostLimiter spaces out requests to the same host, some list servers
+// (pgl.yoyo.org) ban clients that fetch too often
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time // earliest time of the next request per host
+}
+
+// wait blocks until a request to host is allowed and reserves the slot
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay := at.Sub(now); delay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return nil
+}
+
+// backOff keeps requests away from host until d has passed, as asked by a
+// Retry-After header
+func (l *hostLimiter) backOff(host string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if at := time.Now().Add(min(d, maxRetryAfter)); at.After(l.next[host]) {
+		l.next[host] = at
+	}
 }
 
 // New creates a new fetcher from config
@@ -28,16 +103,215 @@ func New(cfg models.HTTPConfig) *Fetcher {
 		retries = 3
 	}
 
+	transport := newTransport(cfg)
+	tlsConfig, err := newTLSConfig(cfg.CAFile, nil)
+	transport.TLSClientConfig = tlsConfig
+
 	return &Fetcher{
 		client: &http.Client{
-			Timeout: timeout,
+			Timeout:   timeout,
+			Transport: transport,
 		},
-		retries: retries,
+		cfg:       cfg,
+		err:       err,
+		retries:   retries,
+		hosts:     &hostLimiter{interval: cfg.HostInterval, next: make(map[string]time.Time)},
+		userAgent: cmp.Or(cfg.UserAgent, DefaultUserAgent),
+		headers:   addHeaders(nil, cfg.Headers),
 	}
 }
 
-// Fetch downloads content from a URL with retries
+// Transport defaults. Connecting and the TLS handshake get their own
+// timeouts, so a stalled handshake fails fast instead of using up the
+// overall request timeout.
+const (
+	defaultDialTimeout = 10 * time.Second
+	defaultTLSTimeout  = 10 * time.Second
+	defaultIdleTimeout = 90 * time.Second
+	idleConnsPerHost   = 4 // lists often share a host (easylist.to, uAssets)
+	maxDrainBytes      = 64 << 10
+)
+
+// newTransport returns a transport reusing connections between the lists
+// of a host, over HTTP/2 where the server supports it
+func newTransport(cfg models.HTTPConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{
+		Timeout:   cmp.Or(cfg.DialTimeout, defaultDialTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+	t.DialContext = dialer.DialContext
+	t.TLSHandshakeTimeout = cmp.Or(cfg.TLSTimeout, defaultTLSTimeout)
+	t.IdleConnTimeout = cmp.Or(cfg.IdleTimeout, defaultIdleTimeout)
+	t.MaxIdleConnsPerHost = idleConnsPerHost
+	t.MaxConnsPerHost = cfg.MaxConnsPerHost
+
+	t.Protocols = new(http.Protocols)
+	t.Protocols.SetHTTP1(true)
+	t.Protocols.SetHTTP2(!cfg.DisableHTTP2)
+	return t
+}
+
+// discard drains what is left of a small response body before closing it,
+// so its connection can be reused
+func discard(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, maxDrainBytes))
+	body.Close()
+}
+
+// WithHeaders returns a fetcher sending another user agent (unless empty)
+// and extra headers, overriding same-named defaults. The client and the
+// per-host rate limits are shared.
+func (f *Fetcher) WithHeaders(userAgent string, headers map[string]string) *Fetcher {
+	c := *f
+	c.userAgent = cmp.Or(userAgent, f.userAgent)
+	if len(headers) > 0 {
+		c.headers = addHeaders(maps.Clone(f.headers), headers)
+	}
+	return &c
+}
+
+// addHeaders sets headers in dst under their canonical names, config keys
+// being case-insensitive
+func addHeaders(dst, headers map[string]string) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string, len(headers))
+	}
+	for name, value := range headers {
+		dst[http.CanonicalHeaderKey(name)] = value
+	}
+	return dst
+}
+
+// Body is a download being read. Lists are parsed while they arrive
+// instead of being buffered whole.
+type Body struct {
+	io.ReadCloser
+	Size int64 // announced length, -1 if unknown
+
+	n   int64
+	err error
+
+	resume  func(offset int64) (io.ReadCloser, error) // nil if the server cannot resume
+	resumes int
+	part    *partial // copy kept for resuming in a later run, nil if none
+}
+
+// maxResumes is how often one download is resumed after interruptions
+const maxResumes = 3
+
+// Read reads from the download, remembering how much was read and the
+// first failure. An interrupted transfer is resumed where it stopped when
+// the server supports ranges, invisibly to the reader.
+func (b *Body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.part.write(b.n, p[:n])
+		b.n += int64(n)
+	}
+	if err != nil && err != io.EOF && b.resume != nil && b.resumes < maxResumes {
+		b.resumes++
+		if rc, rerr := b.resume(b.n); rerr == nil {
+			b.ReadCloser.Close()
+			b.ReadCloser = rc
+			if n == 0 {
+				return b.Read(p)
+			}
+			return n, nil
+		}
+	}
+	if err == io.EOF && (b.Size < 0 || b.n == b.Size) {
+		b.part.complete()
+	}
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// Close ends the download. An incomplete one stays in the cache directory
+// to be resumed by the next run.
+func (b *Body) Close() error {
+	b.part.close()
+	return b.ReadCloser.Close()
+}
+
+// Len returns the number of bytes read so far
+func (b *Body) Len() int64 {
+	return b.n
+}
+
+// Err returns the error the download failed with, nil while it succeeds.
+// Unlike errors of the consumer (a parser), these are network failures.
+func (b *Body) Err() error {
+	return b.err
+}
+
+// Fetch downloads content from a URL with retries. file:// URLs are read
+// from disk, which is handy for hand-written rule files.
 func (f *Fetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	data, _, err := f.FetchIfModified(ctx, url, Info{})
+	return data, err
+}
+
+// FetchIfModified downloads content like Fetch, but sends the validators of
+// a previous download and returns ErrNotModified if the server says the
+// content is unchanged
+func (f *Fetcher) FetchIfModified(ctx context.Context, url string, prev Info) ([]byte, Info, error) {
+	if path, ok := strings.CutPrefix(url, "file://"); ok {
+		body, info, err := openFile(path)
+		if err != nil {
+			return nil, info, err
+		}
+		defer body.Close()
+		data, err := readAll(body)
+		info.Bytes = int64(len(data))
+		return data, info, err
+	}
+	url = f.resolve(url)
+
+	var data []byte
+	var info Info
+	err := f.retry(ctx, func() error {
+		body, i, err := f.open(ctx, url, prev)
+		if err != nil {
+			info = i
+			return err
+		}
+		defer body.Close()
+		data, err = readAll(body)
+		info = i
+		info.Bytes = int64(len(data))
+		return err
+	})
+	return data, info, err
+}
+
+// Open starts a download like FetchIfModified and returns the body to be
+// streamed. Only establishing the response is retried; the caller closes
+// the body and checks Body.Err once done reading.
+func (f *Fetcher) Open(ctx context.Context, url string, prev Info) (*Body, Info, error) {
+	if path, ok := strings.CutPrefix(url, "file://"); ok {
+		return openFile(path)
+	}
+	url = f.resolve(url)
+
+	var body *Body
+	var info Info
+	err := f.retry(ctx, func() error {
+		var err error
+		body, info, err = f.open(ctx, url, prev)
+		return err
+	})
+	return body, info, err
+}
+
+// retry runs fn until it succeeds, the server reports the content as
+// unmodified or the retries are exhausted
+func (f *Fetcher) retry(ctx context.Context, fn func() error) error {
+	if f.err != nil {
+		return f.err // retrying cannot fix the settings
+	}
 	var lastErr error
 
 	for i := 0; i < f.retries; i++ {
@@ -45,38 +319,166 @@ func (f *Fetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
 			// Exponential backoff
 			select {
 			case <-ctx.Done():
-				return nil, ctx.Err()
+				return ctx.Err()
 			case <-time.After(time.Duration(i) * time.Second):
 			}
 		}
 
-		data, err := f.doFetch(ctx, url)
-		if err == nil {
-			return data, nil
+		err := fn()
+		if err == nil || errors.Is(err, ErrNotModified) {
+			return err
 		}
 		lastErr = err
 	}
 
-	return nil, fmt.Errorf("failed after %d retries: %w", f.retries, lastErr)
+	return fmt.Errorf("failed after %d retries: %w", f.retries, lastErr)
 }
 
-func (f *Fetcher) doFetch(ctx context.Context, url string) ([]byte, error) {
+// newRequest returns a GET request with the configured headers, once the
+// host's rate limit allows it
+func (f *Fetcher) newRequest(ctx context.Context, url string) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
+	if err := f.hosts.wait(ctx, req.URL.Host); err != nil {
+		return nil, err
+	}
 
-	req.Header.Set("User-Agent", "ublock-webkit-filters/1.0")
+	for name, value := range f.headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	return req, nil
+}
+
+// open issues a single request, continuing an interrupted download of an
+// earlier run if one is kept
+func (f *Fetcher) open(ctx context.Context, url string, prev Info) (*Body, Info, error) {
+	req, err := f.newRequest(ctx, url)
+	if err != nil {
+		return nil, Info{}, err
+	}
+	if prev.ETag != "" {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+	if prev.LastModified != "" {
+		req.Header.Set("If-Modified-Since", prev.LastModified)
+	}
+	part := loadPartial(f.partialDir, url)
+	if part != nil {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", part.saved))
+		req.Header.Set("If-Range", part.meta.Validator)
+	}
 
 	resp, err := f.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, Info{}, err
+	}
+
+	info := responseInfo(resp)
+	if resp.StatusCode == http.StatusNotModified {
+		discard(resp.Body)
+		part.remove()
+		// Validators may be omitted from a 304
+		if info.ETag == "" {
+			info.ETag = prev.ETag
+		}
+		if info.LastModified == "" {
+			info.LastModified = prev.LastModified
+		}
+		return nil, info, ErrNotModified
+	}
+
+	if resp.StatusCode == http.StatusPartialContent && part != nil {
+		body, err := part.resumeWith(resp)
+		if err != nil {
+			discard(resp.Body)
+			part.remove() // the next attempt starts over
+			return nil, Info{}, err
+		}
+		body.resume = f.resumer(ctx, url, part.meta.Validator)
+		return body, info, nil
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		discard(resp.Body)
+		// Rate limited or overloaded servers say when to come back
+		if d, ok := retryAfter(resp); ok {
+			f.hosts.backOff(req.URL.Host, d)
+		}
+		return nil, Info{}, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	// A full response replaces whatever was kept
+	part.remove()
+	body := &Body{ReadCloser: resp.Body, Size: resp.ContentLength}
+	if validator := rangeValidator(resp); validator != "" {
+		body.resume = f.resumer(ctx, url, validator)
+		body.part = newPartial(f.partialDir, url, validator, resp.ContentLength)
+	}
+	return body, info, nil
+}
+
+// readAll reads a whole body, sized from its announced length
+func readAll(body *Body) ([]byte, error) {
+	var buf bytes.Buffer
+	if body.Size > 0 {
+		buf.Grow(int(body.Size))
+	}
+	_, err := buf.ReadFrom(body)
+	return buf.Bytes(), err
+}
+
+// responseInfo extracts the caching metadata of a response
+func responseInfo(resp *http.Response) Info {
+	now := time.Now()
+	info := Info{
+		Status:       resp.StatusCode,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    now,
+	}
+
+	for _, directive := range strings.Split(resp.Header.Get("Cache-Control"), ",") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(directive), "max-age="); ok {
+			if secs, err := strconv.Atoi(v); err == nil {
+				info.Expires = now.Add(time.Duration(secs) * time.Second)
+				return info
+			}
+		}
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Expires")); err == nil {
+		info.Expires = t
 	}
+	return info
+}
 
-	return io.ReadAll(resp.Body)
+// retryAfter parses the Retry-After header of a 429 or 503 response
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
+
+// openFile opens a local list. Reading is cheap, so it is never reported
+// as unmodified; callers compare content hashes instead.
+func openFile(path string) (*Body, Info, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, Info{}, err
+	}
+	size := int64(-1)
+	if st, err := file.Stat(); err == nil {
+		size = st.Size()
+	}
+	return &Body{ReadCloser: file, Size: size}, Info{FetchedAt: time.Now()}, nil
 }
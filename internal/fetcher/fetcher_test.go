@@ -0,0 +1,157 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostInterval(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("||ads.example.com^\n"))
+	}))
+	defer srv.Close()
+
+	f := New(models.HTTPConfig{Retries: 1, HostInterval: 100 * time.Millisecond})
+	start := time.Now()
+	for range 3 {
+		_, err := f.Fetch(context.Background(), srv.URL+"/list.txt")
+		require.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	var retried time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		retried = time.Now()
+		w.Write([]byte("||ads.example.com^\n"))
+	}))
+	defer srv.Close()
+
+	// The 1s retry backoff is stretched to what the server asked for
+	f := New(models.HTTPConfig{Retries: 2})
+	start := time.Now()
+	_, err := f.Fetch(context.Background(), srv.URL)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, retried.Sub(start), 2*time.Second)
+
+	// Without Retry-After, errors keep the usual backoff
+	resp := &http.Response{StatusCode: http.StatusInternalServerError, Header: http.Header{"Retry-After": {"60"}}}
+	_, ok := retryAfter(resp)
+	assert.False(t, ok)
+}
+
+func TestOpenStreams(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/truncated" {
+			// Announce more than is sent, then drop the connection
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("||ads.example.com^\n"))
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte("||ads.example.com^\n"))
+	}))
+	defer srv.Close()
+
+	f := New(models.HTTPConfig{Retries: 1})
+	body, _, err := f.Open(context.Background(), srv.URL+"/list.txt", Info{})
+	require.NoError(t, err)
+	data, err := io.ReadAll(body)
+	require.NoError(t, body.Close())
+	require.NoError(t, err)
+	assert.Equal(t, "||ads.example.com^\n", string(data))
+	assert.EqualValues(t, len(data), body.Size)
+	assert.EqualValues(t, len(data), body.Len())
+	assert.NoError(t, body.Err())
+
+	// Failures while reading are kept apart from the consumer's errors
+	body, _, err = f.Open(context.Background(), srv.URL+"/truncated", Info{})
+	require.NoError(t, err)
+	defer body.Close()
+	_, _ = io.Copy(io.Discard, body)
+	assert.ErrorIs(t, body.Err(), io.ErrUnexpectedEOF)
+}
+
+func TestHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	f := New(models.HTTPConfig{Retries: 1, Headers: map[string]string{"accept-language": "en", "x-token": "global"}})
+	_, err := f.Fetch(context.Background(), srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultUserAgent, got.Get("User-Agent"))
+	assert.Equal(t, "en", got.Get("Accept-Language"))
+
+	// Per-list settings override the defaults, whatever their case
+	list := f.WithHeaders("Mozilla/5.0", map[string]string{"X-Token": "list"})
+	_, err = list.Fetch(context.Background(), srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "Mozilla/5.0", got.Get("User-Agent"))
+	assert.Equal(t, "en", got.Get("Accept-Language"))
+	assert.Equal(t, []string{"list"}, got.Values("X-Token"))
+
+	// The original fetcher is unchanged
+	_, err = f.Fetch(context.Background(), srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "global", got.Get("X-Token"))
+}
+
+func TestTransportReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	var proto atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto.Store(int32(r.ProtoMajor))
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("||ads.example.com^\n"))
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, disable := range []bool{false, true} {
+		conns.Store(0)
+		f := New(models.HTTPConfig{Retries: 1, DisableHTTP2: disable})
+		roots := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+		f.client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: roots}
+
+		for _, path := range []string{"/easylist.txt", "/missing", "/easyprivacy.txt"} {
+			_, _ = f.Fetch(context.Background(), srv.URL+path)
+		}
+		want := int32(2)
+		if disable {
+			want = 1
+		}
+		assert.Equal(t, want, proto.Load(), "disable_http2=%v", disable)
+		assert.Equal(t, int32(1), conns.Load(), "disable_http2=%v", disable)
+	}
+}
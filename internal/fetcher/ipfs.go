@@ -0,0 +1,20 @@
+package fetcher
+
+import (
+	"cmp"
+	"strings"
+)
+
+// DefaultIPFSGateway serves ipfs:// lists when no gateway is configured
+const DefaultIPFSGateway = "https://ipfs.io"
+
+// resolve returns the URL to request for a list URL, ipfs://CID/path
+// becoming <gateway>/ipfs/CID/path
+func (f *Fetcher) resolve(url string) string {
+	rest, ok := strings.CutPrefix(url, "ipfs://")
+	if !ok {
+		return url
+	}
+	gateway := strings.TrimSuffix(cmp.Or(f.cfg.IPFSGateway, DefaultIPFSGateway), "/")
+	return gateway + "/ipfs/" + rest
+}
@@ -0,0 +1,30 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPFSGateway(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte("||ads.example.com^\n"))
+	}))
+	defer srv.Close()
+
+	f := New(models.HTTPConfig{Retries: 1, IPFSGateway: srv.URL + "/"})
+	data, _, err := f.FetchIfModified(context.Background(), "ipfs://QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG/easylist.txt", Info{})
+	require.NoError(t, err)
+	assert.Equal(t, "||ads.example.com^\n", string(data))
+	assert.Equal(t, "/ipfs/QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG/easylist.txt", path)
+
+	assert.Equal(t, "https://ipfs.io/ipfs/bafy/list.txt", New(models.HTTPConfig{}).resolve("ipfs://bafy/list.txt"))
+	assert.Equal(t, "https://easylist.to/easylist.txt", f.resolve("https://easylist.to/easylist.txt"))
+}
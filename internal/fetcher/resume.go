@@ -0,0 +1,237 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// minResumeBytes is the smallest download worth keeping for a resume
+var minResumeBytes int64 = 1 << 20
+
+// WithResume returns a fetcher that keeps large downloads in dir while they
+// arrive, so an interrupted one is continued with a Range request instead of
+// starting over. An empty dir disables keeping them.
+func (f *Fetcher) WithResume(dir string) *Fetcher {
+	c := *f
+	c.partialDir = dir
+	return &c
+}
+
+// rangeValidator returns the validator to send as If-Range when resuming
+// resp, "" if the server can't resume it
+func rangeValidator(resp *http.Response) string {
+	if resp.Header.Get("Accept-Ranges") != "bytes" || resp.ContentLength < minResumeBytes {
+		return ""
+	}
+	// Weak ETags may not be used for ranges
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// resumer returns a function requesting url from offset on, as long as it
+// still matches validator
+func (f *Fetcher) resumer(ctx context.Context, url, validator string) func(int64) (io.ReadCloser, error) {
+	if validator == "" {
+		return nil
+	}
+	return func(offset int64) (io.ReadCloser, error) {
+		req, err := f.newRequest(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+
+		resp, err := f.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusPartialContent || rangeStart(resp) != offset {
+			discard(resp.Body)
+			return nil, fmt.Errorf("resume at byte %d: HTTP %d", offset, resp.StatusCode)
+		}
+		return resp.Body, nil
+	}
+}
+
+// rangeStart returns the first byte of a 206 response, -1 if unknown
+func rangeStart(resp *http.Response) int64 {
+	spec, ok := strings.CutPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	if !ok {
+		return -1
+	}
+	first, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// partialMeta describes a kept download
+type partialMeta struct {
+	URL       string `json:"url"`
+	Validator string `json:"validator"`
+	Size      int64  `json:"size"`
+}
+
+// partial is a download kept on disk until it completes. All methods
+// accept a nil receiver, which keeps nothing.
+type partial struct {
+	path  string // data file, the metadata sits next to it
+	meta  partialMeta
+	file  *os.File
+	saved int64
+	done  bool
+}
+
+// partialPath returns where the download of url is kept in dir
+func partialPath(dir, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".part")
+}
+
+// newPartial starts keeping the download of url, nil if it can't be kept
+func newPartial(dir, url, validator string, size int64) *partial {
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil
+	}
+	p := &partial{
+		path: partialPath(dir, url),
+		meta: partialMeta{URL: url, Validator: validator, Size: size},
+	}
+	data, err := json.Marshal(p.meta)
+	if err != nil {
+		return nil
+	}
+	if err := os.WriteFile(p.path+".json", data, 0o644); err != nil {
+		return nil
+	}
+	if p.file, err = os.Create(p.path); err != nil {
+		os.Remove(p.path + ".json")
+		return nil
+	}
+	return p
+}
+
+// loadPartial returns the kept download of url, nil if there is none
+func loadPartial(dir, url string) *partial {
+	if dir == "" {
+		return nil
+	}
+	p := &partial{path: partialPath(dir, url)}
+	data, err := os.ReadFile(p.path + ".json")
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &p.meta); err != nil || p.meta.URL != url || p.meta.Validator == "" {
+		p.remove()
+		return nil
+	}
+	st, err := os.Stat(p.path)
+	if err != nil || st.Size() == 0 || st.Size() >= p.meta.Size {
+		p.remove()
+		return nil
+	}
+	p.saved = st.Size()
+	return p
+}
+
+// resumeWith continues the kept download with resp, a 206 response to a
+// Range request for the rest of it
+func (p *partial) resumeWith(resp *http.Response) (*Body, error) {
+	if start := rangeStart(resp); start != p.saved {
+		return nil, fmt.Errorf("resume at byte %d: server sent range from %d", p.saved, start)
+	}
+	file, err := os.OpenFile(p.path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	p.file = file
+	return &Body{
+		ReadCloser: readCloser{
+			Reader: io.MultiReader(io.NewSectionReader(file, 0, p.saved), resp.Body),
+			Closer: resp.Body,
+		},
+		Size: p.meta.Size,
+		part: p,
+	}, nil
+}
+
+// readCloser joins a reader with what closes it
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// write keeps data found at offset of the download
+func (p *partial) write(offset int64, data []byte) {
+	if p == nil || p.file == nil {
+		return
+	}
+	if end := offset + int64(len(data)); end <= p.saved {
+		return
+	}
+	if offset > p.saved {
+		p.abandon() // a gap can't be resumed
+		return
+	}
+	data = data[p.saved-offset:]
+	if _, err := p.file.WriteAt(data, p.saved); err != nil {
+		p.abandon()
+		return
+	}
+	p.saved += int64(len(data))
+}
+
+// abandon stops keeping the download
+func (p *partial) abandon() {
+	p.file.Close()
+	p.file = nil
+	p.remove()
+}
+
+// complete marks the download finished, so nothing is kept
+func (p *partial) complete() {
+	if p != nil {
+		p.done = true
+	}
+}
+
+// close stops writing, dropping the download if it completed
+func (p *partial) close() {
+	if p == nil || p.file == nil {
+		return
+	}
+	p.file.Close()
+	p.file = nil
+	if p.done {
+		p.remove()
+	}
+}
+
+// remove drops the kept download
+func (p *partial) remove() {
+	if p == nil {
+		return
+	}
+	os.Remove(p.path)
+	os.Remove(p.path + ".json")
+}
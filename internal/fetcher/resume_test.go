@@ -0,0 +1,165 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyList serves a large list with ranges, dropping connections halfway
+// through while broken
+type flakyList struct {
+	mu     sync.Mutex
+	data   []byte
+	etag   string
+	ranges []string
+
+	broken atomic.Bool
+	cuts   atomic.Int32 // connections dropped, up to when broken is set
+}
+
+func (l *flakyList) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	data, etag := l.data, l.etag
+	if rng := r.Header.Get("Range"); rng != "" {
+		l.ranges = append(l.ranges, rng)
+	}
+	l.mu.Unlock()
+
+	if r.Header.Get("Range") == "" && (l.broken.Load() || l.cuts.Load() > 0) {
+		l.cuts.Add(-1)
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data[:len(data)/2])
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+		return
+	}
+	if l.broken.Load() {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+		return
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "list.txt", time.Time{}, bytes.NewReader(data))
+}
+
+func (l *flakyList) Ranges() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ranges
+}
+
+func newFlakyList() *flakyList {
+	return &flakyList{
+		data: []byte(strings.Repeat("||ads.example.com^\n", 80000)),
+		etag: `"v1"`,
+	}
+}
+
+func readBody(t *testing.T, f *Fetcher, url string) ([]byte, *Body) {
+	t.Helper()
+	body, _, err := f.Open(context.Background(), url, Info{})
+	require.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	require.NoError(t, body.Close())
+	return data, body
+}
+
+func TestResumeInterruptedDownload(t *testing.T) {
+	list := newFlakyList()
+	list.cuts.Store(1)
+	srv := httptest.NewServer(list)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	f := New(models.HTTPConfig{Retries: 1}).WithResume(dir)
+	data, body := readBody(t, f, srv.URL+"/list.txt")
+	assert.NoError(t, body.Err())
+	assert.Equal(t, list.data, data)
+	assert.Equal(t, []string{"bytes=" + strconv.Itoa(len(list.data)/2) + "-"}, list.Ranges())
+
+	// Completed downloads aren't kept
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestResumeAcrossRuns(t *testing.T) {
+	list := newFlakyList()
+	list.broken.Store(true)
+	srv := httptest.NewServer(list)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	f := New(models.HTTPConfig{Retries: 1}).WithResume(dir)
+	_, body := readBody(t, f, srv.URL+"/list.txt")
+	require.Error(t, body.Err())
+	assert.EqualValues(t, len(list.data)/2, body.Len())
+
+	// The next run only fetches the missing half
+	list.broken.Store(false)
+	list.mu.Lock()
+	list.ranges = nil
+	list.mu.Unlock()
+	data, body := readBody(t, f, srv.URL+"/list.txt")
+	assert.NoError(t, body.Err())
+	assert.Equal(t, list.data, data)
+	assert.EqualValues(t, len(list.data), body.Len())
+	assert.Equal(t, []string{"bytes=" + strconv.Itoa(len(list.data)/2) + "-"}, list.Ranges())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestResumeDiscardsChangedList(t *testing.T) {
+	list := newFlakyList()
+	list.broken.Store(true)
+	srv := httptest.NewServer(list)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	f := New(models.HTTPConfig{Retries: 1}).WithResume(dir)
+	_, body := readBody(t, f, srv.URL+"/list.txt")
+	require.Error(t, body.Err())
+
+	// If-Range no longer matches, so the server sends the whole new list
+	list.broken.Store(false)
+	list.mu.Lock()
+	list.data = []byte(strings.Repeat("||tracker.example.org^\n", 60000))
+	list.etag = `"v2"`
+	list.mu.Unlock()
+	data, body := readBody(t, f, srv.URL+"/list.txt")
+	assert.NoError(t, body.Err())
+	assert.Equal(t, list.data, data)
+}
+
+func TestResumeSkipsSmallLists(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "list.txt", time.Time{}, strings.NewReader("||ads.example.com^\n"))
+	}))
+	defer srv.Close()
+
+	body, _, err := New(models.HTTPConfig{Retries: 1}).WithResume(t.TempDir()).Open(context.Background(), srv.URL, Info{})
+	require.NoError(t, err)
+	defer body.Close()
+	assert.Nil(t, body.part)
+	assert.Nil(t, body.resume)
+}
@@ -0,0 +1,112 @@
+package fetcher
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// pinPrefix starts an SPKI pin: the base64 SHA-256 of a certificate's
+// SubjectPublicKeyInfo, as in HPKP and curl's --pinnedpubkey
+const pinPrefix = "sha256/"
+
+// ParsePin decodes an SPKI pin, "sha256/" followed by a base64 digest
+func ParsePin(pin string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(pin, pinPrefix)
+	if !ok {
+		return nil, fmt.Errorf("pin %q does not start with %q", pin, pinPrefix)
+	}
+	sum, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("pin %q is not a base64 SHA-256 digest", pin)
+	}
+	return sum, nil
+}
+
+// LoadCA reads a PEM bundle of certificates trusted on top of the system
+// roots, for lists served over a private PKI
+func LoadCA(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("CA bundle %s holds no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// newTLSConfig returns the client TLS settings for a CA bundle and pins,
+// nil when neither is set
+func newTLSConfig(caFile string, pins []string) (*tls.Config, error) {
+	if caFile == "" && len(pins) == 0 {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := LoadCA(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if len(pins) > 0 {
+		sums := make([][]byte, 0, len(pins))
+		for _, pin := range pins {
+			sum, err := ParsePin(pin)
+			if err != nil {
+				return nil, err
+			}
+			sums = append(sums, sum)
+		}
+		// Checked after normal verification, any key of the verified
+		// chain may be pinned (leaf, intermediate or root)
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, chain := range cs.VerifiedChains {
+				for _, cert := range chain {
+					sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+					if slices.ContainsFunc(sums, func(pin []byte) bool { return string(pin) == string(sum[:]) }) {
+						return nil
+					}
+				}
+			}
+			return errors.New("no certificate of the server matches the pinned public keys")
+		}
+	}
+	return cfg, nil
+}
+
+// WithTLS returns a fetcher trusting caFile (on top of http.ca_file) and
+// accepting only servers presenting one of pins. Such a list gets its own
+// transport, connections of other lists are never reused for it.
+func (f *Fetcher) WithTLS(caFile string, pins []string) (*Fetcher, error) {
+	if caFile == "" && len(pins) == 0 {
+		return f, nil
+	}
+
+	tlsConfig, err := newTLSConfig(cmp.Or(caFile, f.cfg.CAFile), pins)
+	if err != nil {
+		return nil, err
+	}
+	transport := newTransport(f.cfg)
+	transport.TLSClientConfig = tlsConfig
+
+	c := *f
+	c.client = &http.Client{Timeout: f.client.Timeout, Transport: transport}
+	c.err = nil // the list's CA bundle replaced a broken http.ca_file
+	return &c, nil
+}
@@ -0,0 +1,61 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrivateCAAndPins(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("||ads.corp.example^\n"))
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "corp-ca.pem")
+	cert := srv.Certificate()
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644))
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	pin := "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+	otherPin := "sha256/" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	// The private CA is unknown to the system roots
+	_, err := New(models.HTTPConfig{Retries: 1}).Fetch(context.Background(), srv.URL)
+	require.Error(t, err)
+
+	data, err := New(models.HTTPConfig{Retries: 1, CAFile: caFile}).Fetch(context.Background(), srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "||ads.corp.example^\n", string(data))
+
+	// A list can bring its own CA and pins
+	f, err := New(models.HTTPConfig{Retries: 1}).WithTLS(caFile, []string{otherPin, pin})
+	require.NoError(t, err)
+	_, err = f.Fetch(context.Background(), srv.URL)
+	require.NoError(t, err)
+
+	f, err = New(models.HTTPConfig{Retries: 1, CAFile: caFile}).WithTLS("", []string{otherPin})
+	require.NoError(t, err)
+	_, err = f.Fetch(context.Background(), srv.URL)
+	assert.ErrorContains(t, err, "pinned public keys")
+}
+
+func TestInvalidTLSSettings(t *testing.T) {
+	_, err := ParsePin("sha1/AAAA")
+	assert.Error(t, err)
+	_, err = ParsePin("sha256/not-base64")
+	assert.Error(t, err)
+
+	// A broken CA bundle fails every request instead of trusting less
+	_, err = New(models.HTTPConfig{Retries: 1, CAFile: filepath.Join(t.TempDir(), "missing.pem")}).Fetch(context.Background(), "https://example.com/list.txt")
+	assert.ErrorContains(t, err, "reading CA bundle")
+}
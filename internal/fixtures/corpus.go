@@ -0,0 +1,104 @@
+package fixtures
+
+import (
+	"embed"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// CorpusDir is where the regression corpus lives in the source tree,
+// relative to the repository root, for the fixtures command
+const CorpusDir = "internal/fixtures/corpus"
+
+//go:embed corpus/*.json
+var corpus embed.FS
+
+// Corpus is a sample of the filter lines of an upstream list, each with
+// what conversion made of it when sampled
+type Corpus struct {
+	List        string    `json:"list"`
+	URL         string    `json:"url"`
+	ContentHash string    `json:"content_hash"` // sha256 of the list sampled
+	SampledAt   time.Time `json:"sampled_at"`
+	Seed        int64     `json:"seed"`
+	Lines       int       `json:"lines"` // lines of the list sampled
+	Converted   []string  `json:"converted"`
+	Skipped     []Sample  `json:"skipped"`
+}
+
+// Sample is a skipped filter line with its skip reason
+type Sample struct {
+	Line   string            `json:"line"`
+	Reason models.SkipReason `json:"reason"`
+}
+
+// Classifier tells what conversion makes of a line: converted, skipped
+// with a reason, or neither for comments and directives
+type Classifier func(line string) (converted bool, reason models.SkipReason)
+
+// Take visits lines in an order drawn from rng until it found n converted
+// and n skipped ones, and returns them sorted
+func Take(lines []string, n int, rng *rand.Rand, classify Classifier) (converted []string, skipped []Sample) {
+	converted, skipped = []string{}, []Sample{}
+	for _, i := range rng.Perm(len(lines)) {
+		if len(converted) >= n && len(skipped) >= n {
+			break
+		}
+		ok, reason := classify(lines[i])
+		switch {
+		case ok:
+			if len(converted) < n {
+				converted = append(converted, lines[i])
+			}
+		case reason != "":
+			if len(skipped) < n {
+				skipped = append(skipped, Sample{Line: lines[i], Reason: reason})
+			}
+		}
+	}
+	sort.Strings(converted)
+	sort.Slice(skipped, func(i, j int) bool {
+		if skipped[i].Reason != skipped[j].Reason {
+			return skipped[i].Reason < skipped[j].Reason
+		}
+		return skipped[i].Line < skipped[j].Line
+	})
+	return converted, skipped
+}
+
+// WriteCorpus writes the sample of a list to dir as <list>.json
+func WriteCorpus(dir string, c *Corpus) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, c.List+".json"), append(data, '\n'), 0644)
+}
+
+// ReadCorpus returns the samples embedded from CorpusDir
+func ReadCorpus() ([]Corpus, error) {
+	entries, err := corpus.ReadDir("corpus")
+	if err != nil {
+		return nil, err
+	}
+	var samples []Corpus
+	for _, e := range entries {
+		data, err := corpus.ReadFile(path.Join("corpus", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var c Corpus
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, err
+		}
+		samples = append(samples, c)
+	}
+	return samples, nil
+}
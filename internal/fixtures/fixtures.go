@@ -0,0 +1,125 @@
+// Package fixtures serves recorded filter list snapshots over HTTP, so the
+// whole build pipeline can be exercised by tests without network access
+package fixtures
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed lists/*.txt
+var lists embed.FS
+
+// recordedAt is the Last-Modified time of the recorded snapshots
+var recordedAt = time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+
+// Names returns the names of the recorded lists
+func Names() []string {
+	entries, _ := lists.ReadDir("lists")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List returns the content of a recorded list, nil if there is none
+func List(name string) []byte {
+	data, err := lists.ReadFile(path.Join("lists", name+".txt"))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// Server serves the recorded lists at /<name>.txt with ETag and
+// Last-Modified validators, answering conditional requests with 304
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	content     map[string][]byte
+	modified    map[string]time.Time
+	requests    map[string]int
+	notModified map[string]int
+}
+
+// NewServer starts a server with every recorded list; Close it when done
+func NewServer() *Server {
+	s := &Server{
+		content:     make(map[string][]byte),
+		modified:    make(map[string]time.Time),
+		requests:    make(map[string]int),
+		notModified: make(map[string]int),
+	}
+	for _, name := range Names() {
+		s.content[name] = List(name)
+		s.modified[name] = recordedAt
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// ListURL returns the URL a list is served at
+func (s *Server) ListURL(name string) string {
+	return s.URL + "/" + name + ".txt"
+}
+
+// Set replaces the content of a list, as if it was updated upstream
+func (s *Server) Set(name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content[name] = data
+	s.modified[name] = s.modified[name].Add(time.Hour)
+}
+
+// Requests returns how many times a list was requested
+func (s *Server) Requests(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[name]
+}
+
+// NotModified returns how many requests for a list were answered with 304
+func (s *Server) NotModified(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notModified[name]
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".txt")
+
+	s.mu.Lock()
+	data, ok := s.content[name]
+	modified := s.modified[name]
+	s.requests[name]++
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		s.mu.Lock()
+		s.notModified[name]++
+		s.mu.Unlock()
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(w, r, name+".txt", modified, bytes.NewReader(data))
+}
@@ -0,0 +1,79 @@
+package fixtures
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerConditionalRequests(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	require.Contains(t, Names(), "easylist")
+	resp, err := http.Get(srv.ListURL("easylist"))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, List("easylist"), body)
+
+	get := func(etag string) int {
+		req, _ := http.NewRequest(http.MethodGet, srv.ListURL("easylist"), nil)
+		req.Header.Set("If-None-Match", etag)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, http.StatusNotModified, get(etag))
+	assert.Equal(t, 1, srv.NotModified("easylist"))
+
+	srv.Set("easylist", []byte("||ads.example^\n"))
+	assert.Equal(t, http.StatusOK, get(etag))
+	assert.Equal(t, 3, srv.Requests("easylist"))
+
+	resp, err = http.Get(srv.URL + "/missing.txt")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestTake(t *testing.T) {
+	lines := []string{"! comment", "||a.com^", "||b.com^", "||c.com^", "##+js(a)", "##+js(b)", ""}
+	classify := func(line string) (bool, models.SkipReason) {
+		switch {
+		case strings.HasPrefix(line, "||"):
+			return true, ""
+		case strings.HasPrefix(line, "##+js"):
+			return false, models.SkipScriptlet
+		}
+		return false, ""
+	}
+
+	converted, skipped := Take(lines, 2, rand.New(rand.NewSource(1)), classify)
+	assert.Len(t, converted, 2)
+	assert.Len(t, skipped, 2)
+	assert.True(t, sort.StringsAreSorted(converted))
+	for _, s := range skipped {
+		assert.Equal(t, models.SkipScriptlet, s.Reason)
+	}
+
+	// The same seed draws the same sample
+	again, _ := Take(lines, 2, rand.New(rand.NewSource(1)), classify)
+	assert.Equal(t, converted, again)
+
+	corpus, err := ReadCorpus()
+	require.NoError(t, err)
+	assert.NotEmpty(t, corpus)
+}
@@ -0,0 +1,156 @@
+// Package health keeps a history of every list's downloads across daemon
+// builds and flags the changes that point to a broken upstream, such as a
+// list losing most of its rules or an error page served in its place
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Kinds of anomaly
+const (
+	KindShrank  = "shrank"  // far fewer rules or bytes than the last good build
+	KindFormat  = "format"  // not filter syntax, or another syntax than before
+	KindFailing = "failing" // several builds in a row failed to get the list
+)
+
+// unknownFormat is how parser.Format names content that is no list, e.g.
+// an HTML error page
+const unknownFormat = "unknown"
+
+// Sample is the state of a list after one build
+type Sample struct {
+	At     time.Time `json:"at"`
+	Bytes  int64     `json:"bytes"`
+	Rules  int       `json:"rules"`
+	Format string    `json:"format,omitempty"`
+	Failed bool      `json:"failed,omitempty"`
+}
+
+// Anomaly is a change of a list worth a human look
+type Anomaly struct {
+	List   string `json:"list"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+func (a Anomaly) String() string {
+	return fmt.Sprintf("%s %s: %s", a.List, a.Kind, a.Detail)
+}
+
+// Thresholds decide what counts as an anomaly
+type Thresholds struct {
+	Shrink      float64 // fraction of rules or bytes lost, e.g. 0.5
+	MaxFailures int     // failed builds in a row
+	Keep        int     // samples kept per list
+}
+
+// History maps list names to their samples, oldest first
+type History struct {
+	Lists map[string][]Sample `json:"lists"`
+}
+
+// Load reads a history, returning an empty one if the file does not exist
+func Load(path string) (*History, error) {
+	h := &History{Lists: make(map[string][]Sample)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("decoding health history %s: %w", path, err)
+	}
+	if h.Lists == nil {
+		h.Lists = make(map[string][]Sample)
+	}
+	return h, nil
+}
+
+// Save writes the history, creating its directory if needed
+func (h *History) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Record adds a sample of a list and returns its anomalies against the
+// list's last good sample
+func (h *History) Record(list string, s Sample, t Thresholds) []Anomaly {
+	samples := h.Lists[list]
+	var anomalies []Anomaly
+	flag := func(kind, format string, args ...any) {
+		anomalies = append(anomalies, Anomaly{List: list, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Failed {
+		failures := 1
+		for i := len(samples) - 1; i >= 0 && samples[i].Failed; i-- {
+			failures++
+		}
+		if t.MaxFailures > 0 && failures >= t.MaxFailures {
+			flag(KindFailing, "%d builds in a row without a download", failures)
+		}
+	} else {
+		if s.Format == unknownFormat {
+			flag(KindFormat, "content does not look like a filter list, e.g. an HTML page")
+		}
+		if last, ok := lastGood(samples); ok {
+			if last.Format != "" && s.Format != last.Format && s.Format != unknownFormat {
+				flag(KindFormat, "served as %s, was %s", s.Format, last.Format)
+			}
+			if lost := shrinkage(last.Rules, s.Rules); t.Shrink > 0 && lost >= t.Shrink {
+				flag(KindShrank, "%d rules, was %d (-%.0f%%)", s.Rules, last.Rules, lost*100)
+			} else if lost := shrinkage(int(last.Bytes), int(s.Bytes)); t.Shrink > 0 && lost >= t.Shrink {
+				flag(KindShrank, "%d bytes, was %d (-%.0f%%)", s.Bytes, last.Bytes, lost*100)
+			}
+		}
+	}
+
+	samples = append(samples, s)
+	if t.Keep > 0 && len(samples) > t.Keep {
+		samples = samples[len(samples)-t.Keep:]
+	}
+	h.Lists[list] = samples
+	return anomalies
+}
+
+// Failures returns how many builds in a row ended without the list
+func (h *History) Failures(list string) int {
+	samples := h.Lists[list]
+	n := 0
+	for i := len(samples) - 1; i >= 0 && samples[i].Failed; i-- {
+		n++
+	}
+	return n
+}
+
+// lastGood returns the latest sample with a download
+func lastGood(samples []Sample) (Sample, bool) {
+	for i := len(samples) - 1; i >= 0; i-- {
+		if !samples[i].Failed {
+			return samples[i], true
+		}
+	}
+	return Sample{}, false
+}
+
+// shrinkage returns the fraction of before lost in now, 0 if it grew
+func shrinkage(before, now int) float64 {
+	if before <= 0 || now >= before {
+		return 0
+	}
+	return float64(before-now) / float64(before)
+}
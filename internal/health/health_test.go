@@ -0,0 +1,63 @@
+package health
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var thresholds = Thresholds{Shrink: 0.5, MaxFailures: 3, Keep: 4}
+
+func TestRecordFlagsShrinkAndFormat(t *testing.T) {
+	h := &History{Lists: make(map[string][]Sample)}
+	at := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Empty(t, h.Record("easylist", Sample{At: at, Bytes: 100000, Rules: 1000, Format: "adblock"}, thresholds))
+	// Small changes are normal list churn
+	assert.Empty(t, h.Record("easylist", Sample{At: at, Bytes: 90000, Rules: 900, Format: "adblock"}, thresholds))
+
+	anomalies := h.Record("easylist", Sample{At: at, Bytes: 9000, Rules: 90, Format: "adblock"}, thresholds)
+	require.Len(t, anomalies, 1)
+	assert.Equal(t, KindShrank, anomalies[0].Kind)
+	assert.Equal(t, "easylist shrank: 90 rules, was 900 (-90%)", anomalies[0].String())
+
+	// An error page served instead of the list
+	anomalies = h.Record("easylist", Sample{At: at, Bytes: 2000, Format: "unknown"}, thresholds)
+	kinds := []string{}
+	for _, a := range anomalies {
+		kinds = append(kinds, a.Kind)
+	}
+	assert.Equal(t, []string{KindFormat, KindShrank}, kinds)
+
+	anomalies = h.Record("easylist", Sample{At: at, Bytes: 2000, Rules: 20, Format: "hosts"}, thresholds)
+	require.Len(t, anomalies, 1)
+	assert.Equal(t, "served as hosts, was unknown", anomalies[0].Detail)
+
+	assert.Len(t, h.Lists["easylist"], thresholds.Keep)
+}
+
+func TestRecordFlagsConsecutiveFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "health.json")
+	h, err := Load(path)
+	require.NoError(t, err)
+
+	at := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	h.Record("ubo", Sample{At: at, Bytes: 5000, Rules: 50, Format: "adblock"}, thresholds)
+	assert.Empty(t, h.Record("ubo", Sample{At: at, Failed: true}, thresholds))
+	assert.Empty(t, h.Record("ubo", Sample{At: at, Failed: true}, thresholds))
+	require.NoError(t, h.Save(path))
+
+	h, err = Load(path)
+	require.NoError(t, err)
+	anomalies := h.Record("ubo", Sample{At: at, Failed: true}, thresholds)
+	require.Len(t, anomalies, 1)
+	assert.Equal(t, KindFailing, anomalies[0].Kind)
+	assert.Equal(t, 3, h.Failures("ubo"))
+
+	// A recovered list is compared to its last download, not the failures
+	assert.Empty(t, h.Record("ubo", Sample{At: at, Bytes: 4800, Rules: 48, Format: "adblock"}, thresholds))
+	assert.Equal(t, 0, h.Failures("ubo"))
+}
@@ -0,0 +1,168 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a single hook command
+const DefaultTimeout = 5 * time.Minute
+
+// reVar matches the placeholders of a hook command
+var reVar = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// Vars describe the finished build a hook runs for
+type Vars struct {
+	OutputDir string
+	Manifest  string // path of manifest.json, empty when none was written
+	BuildID   string
+	Status    string // success or failure
+	Error     string // why the build failed
+}
+
+// values maps each placeholder to its value
+func (v Vars) values() map[string]string {
+	return map[string]string{
+		"{output_dir}": v.OutputDir,
+		"{manifest}":   v.Manifest,
+		"{build_id}":   v.BuildID,
+		"{status}":     v.Status,
+		"{error}":      v.Error,
+	}
+}
+
+// placeholders lists the placeholders of Vars, in the order errors name them
+var placeholders = []string{"{output_dir}", "{manifest}", "{build_id}", "{status}", "{error}"}
+
+// Validate checks that a hook command names a program and only uses known
+// placeholders
+func Validate(command string) error {
+	return ValidateCommand(command, placeholders)
+}
+
+// ValidateCommand checks that a command names a program and only uses the
+// known placeholders
+func ValidateCommand(command string, known []string) error {
+	args, err := splitWords(command)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("empty command")
+	}
+	for _, v := range reVar.FindAllString(command, -1) {
+		if !slices.Contains(known, v) {
+			want := strings.Join(known, ", ")
+			if i := strings.LastIndex(want, ", "); i != -1 {
+				want = want[:i] + " or " + want[i+2:]
+			}
+			return fmt.Errorf("unknown placeholder %s (want %s)", v, want)
+		}
+	}
+	return nil
+}
+
+// Run executes commands in order, stopping at the first that fails. A
+// command is split into arguments like a shell would, honouring quotes and
+// backslashes, but runs without one, so substituted paths may contain
+// spaces; use "sh -c '...'" for pipes or redirections. Output goes to out.
+func Run(ctx context.Context, commands []string, vars Vars, timeout time.Duration, out io.Writer) error {
+	values := vars.values()
+	for _, command := range commands {
+		if err := Exec(ctx, command, values, timeout, out); err != nil {
+			return fmt.Errorf("hook %q: %w", command, err)
+		}
+	}
+	return nil
+}
+
+// Exec runs a single command like Run, with values substituted for its
+// placeholders ("{file}" -> path)
+func Exec(ctx context.Context, command string, values map[string]string, timeout time.Duration, out io.Writer) error {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	args, err := splitWords(command)
+	if err != nil {
+		return err
+	}
+	for i, arg := range args {
+		args[i] = reVar.ReplaceAllStringFunc(arg, func(v string) string { return values[v] })
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd.Run()
+}
+
+// splitWords splits a command into arguments like a POSIX shell: blanks
+// separate arguments, single quotes keep everything up to the next one,
+// double quotes keep everything but backslash escapes of ", \, $ and `,
+// and a backslash outside quotes escapes the next character
+func splitWords(command string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\'':
+			inWord = true
+			end := slices.Index(runes[i+1:], '\'')
+			if end == -1 {
+				return nil, errors.New("unterminated single quote")
+			}
+			word.WriteString(string(runes[i+1 : i+1+end]))
+			i += end + 1
+		case c == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '"' {
+					closed = true
+					break
+				}
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]) {
+					i++
+				}
+				word.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, errors.New("unterminated double quote")
+			}
+		case c == '\\':
+			inWord = true
+			if i+1 == len(runes) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			word.WriteRune(runes[i])
+		default:
+			inWord = true
+			word.WriteRune(c)
+		}
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,84 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "output dir")
+	vars := Vars{OutputDir: dir, Manifest: filepath.Join(dir, "manifest.json"), BuildID: "b1", Status: "success"}
+
+	var out bytes.Buffer
+	err := Run(context.Background(), []string{"echo {build_id} {status}", "mkdir -p {output_dir}", "touch {manifest}"}, vars, 0, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "b1 success\n", out.String())
+	// Placeholders stay one argument, spaces included
+	assert.FileExists(t, vars.Manifest)
+
+	// The first failing command stops the rest
+	err = Run(context.Background(), []string{"false", "rm {manifest}"}, vars, 0, &out)
+	require.ErrorContains(t, err, `hook "false"`)
+	assert.FileExists(t, vars.Manifest)
+
+	err = Run(context.Background(), []string{"sleep 5"}, vars, 50*time.Millisecond, &out)
+	require.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate("./deploy.sh {output_dir} {manifest}"))
+	assert.ErrorContains(t, Validate("  "), "empty command")
+	assert.ErrorContains(t, Validate("sh -c './deploy.sh"), "unterminated single quote")
+	assert.ErrorContains(t, Validate("./deploy.sh {outdir}"), "unknown placeholder {outdir}")
+}
+
+func TestRunQuoted(t *testing.T) {
+	dir := t.TempDir()
+	vars := Vars{OutputDir: dir, BuildID: "b1"}
+
+	var out bytes.Buffer
+	err := Run(context.Background(), []string{
+		`sh -c 'echo "$1" > "$2"/built' hook {build_id} {output_dir}`,
+		`printf "%s|%s\n" "two words" it\'s`,
+	}, vars, 0, &out)
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dir, "built"))
+	require.NoError(t, err)
+	assert.Equal(t, "b1\n", string(data))
+	assert.Equal(t, "two words|it's\n", out.String())
+
+	err = Run(context.Background(), []string{`sh -c 'echo`}, vars, 0, &out)
+	assert.ErrorContains(t, err, "unterminated single quote")
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+		err     string
+	}{
+		{"./deploy.sh  {output_dir}\t{manifest}", []string{"./deploy.sh", "{output_dir}", "{manifest}"}, ""},
+		{`sh -c './deploy.sh {output_dir} | tee log'`, []string{"sh", "-c", "./deploy.sh {output_dir} | tee log"}, ""},
+		{`echo "a \"b\" \n" 'c\d' e\ f ''`, []string{"echo", `a "b" \n`, `c\d`, "e f", ""}, ""},
+		{`echo it'"'s`, []string{"echo", `it"s`}, ""},
+		{`echo "open`, nil, "unterminated double quote"},
+		{`echo \`, nil, "trailing backslash"},
+		{"   ", nil, ""},
+	}
+	for _, tt := range tests {
+		got, err := splitWords(tt.command)
+		if tt.err != "" {
+			assert.ErrorContains(t, err, tt.err, tt.command)
+			continue
+		}
+		require.NoError(t, err, tt.command)
+		assert.Equal(t, tt.want, got, tt.command)
+	}
+}
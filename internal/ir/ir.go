@@ -0,0 +1,87 @@
+// Package ir stores the parsed filters of a list, before conversion, so
+// the converter can be rerun on them without downloading or parsing the
+// list again
+package ir
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+)
+
+// Version changes whenever the parsed form of filters does, older dumps
+// are refused rather than converted wrongly
+const Version = 1
+
+// Ext is the extension of dump files, gzipped JSON
+const Ext = ".ir.json.gz"
+
+// List is the parsed form of a filter list
+type List struct {
+	Version      int             `json:"version"`
+	Name         string          `json:"name"`
+	ContentHash  string          `json:"content_hash,omitempty"` // of the list as served
+	Format       string          `json:"format,omitempty"`
+	Stats        parser.Stats    `json:"stats"`
+	FilterHashes []uint64        `json:"filter_hashes,omitempty"` // with overlap.dedup_filters
+	Filters      []models.Filter `json:"filters"`
+}
+
+// Path returns the dump file of a list in dir
+func Path(dir, name string) string {
+	return filepath.Join(dir, name+Ext)
+}
+
+// Write dumps a list into dir
+func Write(dir string, l *List) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(Path(dir, l.Name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	l.Version = Version
+	gz := gzip.NewWriter(f)
+	if err := json.NewEncoder(gz).Encode(l); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Read loads the dump of the named list from dir
+func Read(dir, name string) (*List, error) {
+	f, err := os.Open(Path(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no IR dump of %s in %s", name, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("reading IR of %s: %w", name, err)
+	}
+	var l List
+	if err := json.NewDecoder(gz).Decode(&l); err != nil {
+		return nil, fmt.Errorf("decoding IR of %s: %w", name, err)
+	}
+	if l.Version != Version {
+		return nil, fmt.Errorf("IR of %s has version %d, want %d: dump it again with --emit-ir", name, l.Version, Version)
+	}
+	return &l, nil
+}
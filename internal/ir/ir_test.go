@@ -0,0 +1,46 @@
+package ir
+
+import (
+	"compress/gzip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	p := parser.New()
+	filters, err := p.Parse(strings.NewReader("||ads.example.com^$script,third-party,domain=a.com|~b.a.com\nexample.com##.ad\n@@||cdn.example.com^\n##+js(noop)\n"))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	l := &List{Name: "easylist", ContentHash: "abc", Format: "adblock", Stats: p.Stats(), Filters: filters}
+	require.NoError(t, Write(dir, l))
+
+	read, err := Read(dir, "easylist")
+	require.NoError(t, err)
+	assert.Equal(t, Version, read.Version)
+	assert.Equal(t, filters, read.Filters)
+	assert.Equal(t, p.Stats().SkipReasons, read.Stats.SkipReasons)
+	assert.Equal(t, "abc", read.ContentHash)
+}
+
+func TestReadErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Read(dir, "missing")
+	assert.ErrorContains(t, err, "no IR dump of missing")
+
+	// Dumps of another version are refused
+	f, err := os.Create(Path(dir, "old"))
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write([]byte(`{"version":0,"name":"old"}`))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+	_, err = Read(dir, "old")
+	assert.ErrorContains(t, err, "--emit-ir")
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types of the Prometheus text exposition format
+const (
+	TypeGauge   = "gauge"
+	TypeCounter = "counter"
+)
+
+// Registry holds metric families and renders them in the Prometheus text
+// exposition format, enough for scraping without a client library
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	help    string
+	typ     string
+	samples map[string]float64 // rendered label set -> value
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Register declares a metric family; it must be called before Set/Add
+func (r *Registry) Register(name, typ, help string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families[name] = &family{help: help, typ: typ, samples: make(map[string]float64)}
+}
+
+// Set sets a sample, labels are given as alternating name/value pairs
+func (r *Registry) Set(name string, value float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mustFamily(name).samples[renderLabels(labels)] = value
+}
+
+// Add increments a sample, labels are given as alternating name/value pairs
+func (r *Registry) Add(name string, delta float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mustFamily(name).samples[renderLabels(labels)] += delta
+}
+
+// Reset drops all samples of a family, e.g. per-list gauges before a rebuild
+func (r *Registry) Reset(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mustFamily(name).samples = make(map[string]float64)
+}
+
+func (r *Registry) mustFamily(name string) *family {
+	f, ok := r.families[name]
+	if !ok {
+		panic(fmt.Sprintf("metrics: %s is not registered", name))
+	}
+	return f
+}
+
+// WriteTo renders every family sorted by name
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.typ)
+
+		labelSets := make([]string, 0, len(f.samples))
+		for labels := range f.samples {
+			labelSets = append(labelSets, labels)
+		}
+		sort.Strings(labelSets)
+		for _, labels := range labelSets {
+			fmt.Fprintf(cw, "%s%s %s\n", name, labels, strconv.FormatFloat(f.samples[labels], 'g', -1, 64))
+		}
+	}
+	if err := cw.w.Flush(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, cw.err
+}
+
+// Handler serves the registry for Prometheus scrapes
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// renderLabels formats name/value pairs as {a="1",b="2"}
+func renderLabels(pairs []string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+	r.Register("uwf_rules", TypeGauge, "Rules per list")
+	r.Register("uwf_errors_total", TypeCounter, "Errors")
+
+	r.Set("uwf_rules", 10, "list", "easylist")
+	r.Set("uwf_rules", 5, "list", `we"ird`)
+	r.Add("uwf_errors_total", 1)
+	r.Add("uwf_errors_total", 2)
+
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	assert.NoError(t, err)
+
+	expected := `# HELP uwf_errors_total Errors
+# TYPE uwf_errors_total counter
+uwf_errors_total 3
+# HELP uwf_rules Rules per list
+# TYPE uwf_rules gauge
+uwf_rules{list="easylist"} 10
+uwf_rules{list="we\"ird"} 5
+`
+	assert.Equal(t, expected, buf.String())
+
+	r.Reset("uwf_rules")
+	buf.Reset()
+	r.WriteTo(&buf)
+	assert.NotContains(t, buf.String(), "easylist")
+}
@@ -1,32 +1,463 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Config represents the main configuration
 type Config struct {
-	HTTP   HTTPConfig   `mapstructure:"http"`
-	Output OutputConfig `mapstructure:"output"`
-	Lists  []FilterList `mapstructure:"lists"`
+	HTTP       HTTPConfig          `mapstructure:"http"`
+	Output     OutputConfig        `mapstructure:"output"`
+	Strict     StrictConfig        `mapstructure:"strict"`
+	Overlap    OverlapConfig       `mapstructure:"overlap"`
+	PSL        PSLConfig           `mapstructure:"psl"`
+	Cache      CacheConfig         `mapstructure:"cache"`
+	Memory     MemoryConfig        `mapstructure:"memory"`
+	Safari     SafariConfig        `mapstructure:"safari"`
+	DNS        DNSConfig           `mapstructure:"dns"`
+	Archive    ArchiveConfig       `mapstructure:"archive"`
+	Retention  RetentionConfig     `mapstructure:"retention"`
+	Publish    PublishConfig       `mapstructure:"publish"`
+	Signing    SigningConfig       `mapstructure:"signing"`
+	Daemon     DaemonConfig        `mapstructure:"daemon"`
+	Webhooks   []WebhookConfig     `mapstructure:"webhooks"`
+	Hooks      HooksConfig         `mapstructure:"hooks"`
+	Compile    CompileConfig       `mapstructure:"compile"`
+	SmokeTest  SmokeTestConfig     `mapstructure:"smoke_test"`
+	Allowlist  AllowlistConfig     `mapstructure:"allowlist"`
+	Policy     PolicyConfig        `mapstructure:"policy"`
+	Transforms []Transform         `mapstructure:"transforms"`
+	Categories map[string]Category `mapstructure:"categories"` // host app metadata per list tag
+	Lists      []FilterList        `mapstructure:"lists"`
+	Include    []string            `mapstructure:"include"` // config fragment globs merged by the CLI
+}
+
+// Category describes the combined output of a list tag to host apps
+type Category struct {
+	Title       string `mapstructure:"title"` // defaults to the tag
+	Description string `mapstructure:"description"`
+	DefaultOff  bool   `mapstructure:"default_off"`
+}
+
+// ArchiveConfig controls the snapshots of raw downloaded lists written next
+// to the outputs, so a manifest can be traced back to its exact inputs
+type ArchiveConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Dir     string `mapstructure:"dir"` // subdirectory of the output directory
+}
+
+// RetentionConfig bounds the build artifacts kept over time: the copies of
+// versioned builds and archived lists. A build is kept while it is within
+// either limit.
+type RetentionConfig struct {
+	KeepBuilds int `mapstructure:"keep_builds"` // most recent versioned builds kept, 0 = no count limit
+	KeepDays   int `mapstructure:"keep_days"`   // builds and archived lists younger than this kept, 0 = no age limit
+}
+
+// Enabled reports whether any retention limit is set
+func (r RetentionConfig) Enabled() bool {
+	return r.KeepBuilds > 0 || r.KeepDays > 0
+}
+
+// CacheConfig locates per-list conversion results reused by "update"
+type CacheConfig struct {
+	Dir string `mapstructure:"dir"`
+}
+
+// MemoryConfig bounds the rules a build holds for its combined outputs,
+// spilling per-list rule sets to temporary files beyond the limit
+type MemoryConfig struct {
+	Limit    string `mapstructure:"limit"`     // e.g. "512MB", empty for no limit
+	SpillDir string `mapstructure:"spill_dir"` // empty for the system temporary directory
+}
+
+// LimitBytes parses Limit, 0 for no limit
+func (m MemoryConfig) LimitBytes() (int64, error) {
+	s := strings.TrimSpace(strings.ToUpper(m.Limit))
+	if s == "" {
+		return 0, nil
+	}
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 512MB or 2GB)", m.Limit)
+	}
+	return n * unit, nil
+}
+
+// SafariConfig maps the combined output onto the content blocker
+// extensions of a Safari app, each extension loading a single file
+type SafariConfig struct {
+	Extensions bool     `mapstructure:"extensions"` // cap parts and write safari-extensions.json
+	MaxRules   int      `mapstructure:"max_rules"`  // rules per extension, 0 = converter.SafariExtensionMaxRules
+	Bundles    []string `mapstructure:"bundle_ids"` // extension bundle identifiers, in load order
 }
 
 // HTTPConfig contains HTTP client settings
 type HTTPConfig struct {
-	Timeout time.Duration `mapstructure:"timeout"`
-	Retries int           `mapstructure:"retries"`
+	Timeout         time.Duration     `mapstructure:"timeout"`
+	Retries         int               `mapstructure:"retries"`
+	HostInterval    time.Duration     `mapstructure:"host_interval"`      // minimum time between requests to one host
+	MinRefetch      time.Duration     `mapstructure:"min_refetch"`        // cached lists younger than this are not fetched again
+	UserAgent       string            `mapstructure:"user_agent"`         // empty sends the tool's own
+	Headers         map[string]string `mapstructure:"headers"`            // sent with every request
+	DialTimeout     time.Duration     `mapstructure:"dial_timeout"`       // TCP connect, 0 = 10s
+	TLSTimeout      time.Duration     `mapstructure:"tls_timeout"`        // TLS handshake, 0 = 10s
+	IdleTimeout     time.Duration     `mapstructure:"idle_timeout"`       // keep-alive connections kept for reuse, 0 = 90s
+	MaxConnsPerHost int               `mapstructure:"max_conns_per_host"` // concurrent connections to one host, 0 = no limit
+	DisableHTTP2    bool              `mapstructure:"disable_http2"`      // HTTP/1.1 only, for broken servers or proxies
+	CAFile          string            `mapstructure:"ca_file"`            // PEM certificates trusted on top of the system roots
+	IPFSGateway     string            `mapstructure:"ipfs_gateway"`       // HTTP gateway ipfs:// lists are fetched through
 }
 
 // OutputConfig contains output settings
 type OutputConfig struct {
-	MaxRulesPerFile  int  `mapstructure:"max_rules_per_file"`
-	GenerateCombined bool `mapstructure:"generate_combined"`
-	GenerateManifest bool `mapstructure:"generate_manifest"`
+	MaxRulesPerFile        int      `mapstructure:"max_rules_per_file"`
+	PartName               string   `mapstructure:"part_name"` // template naming split parts, e.g. {name}-{index:02d}-of-{total}
+	GenerateCombined       bool     `mapstructure:"generate_combined"`
+	GenerateManifest       bool     `mapstructure:"generate_manifest"`
+	GenericCosmetic        string   `mapstructure:"generic_cosmetic"`         // keep, separate, drop
+	CombinedBudget         int      `mapstructure:"combined_budget"`          // max combined rules, 0 = unlimited
+	Target                 string   `mapstructure:"target"`                   // webkit, safari15, safari14
+	MaxSelectorComplexity  int      `mapstructure:"max_selector_complexity"`  // skip costlier selectors, 0 = no limit
+	CosmeticsAsCSS         bool     `mapstructure:"cosmetics_as_css"`         // write hiding rules as stylesheets
+	CSSDir                 string   `mapstructure:"css_dir"`                  // stylesheet directory below the output
+	Popups                 bool     `mapstructure:"popups"`                   // write $popup rules to popups.json
+	TypePartitions         []string `mapstructure:"type_partitions"`          // scripts, images, xhr: block rules in outputs of their own
+	RemoveParamBlock       bool     `mapstructure:"removeparam_block"`        // lossy: block requests with tracking params
+	TopURLThreshold        int      `mapstructure:"top_url_threshold"`        // if-domain size rewritten to if-top-url, 0 = never
+	VersionScheme          string   `mapstructure:"version_scheme"`           // date, semver, content
+	Version                string   `mapstructure:"version"`                  // manifest version for the semver scheme
+	TopURLChunkSize        int      `mapstructure:"top_url_chunk_size"`       // if-top-url entries per rule, 0 = one rule
+	GenericUnlessTopURL    []string `mapstructure:"generic_unless_top_url"`   // pages hot generic cosmetic rules stay off
+	GenericHotSelectors    []string `mapstructure:"generic_hot_selectors"`    // generic selectors restricted, empty = all
+	SelectorPrefix         string   `mapstructure:"selector_prefix"`          // selector hiding selectors are nested under
+	SelectorExclude        []string `mapstructure:"selector_exclude"`         // regexps of selectors never hidden
+	CosmeticExcludeDomains []string `mapstructure:"cosmetic_exclude_domains"` // domains nothing is hidden on
+	CSPCompanion           bool     `mapstructure:"csp_companion"`            // write $inline-script/$inline-font as csp.json
+	TopDomains             int      `mapstructure:"top_domains"`              // write the N most targeted domains, 0 = off
+	CoverageReport         bool     `mapstructure:"coverage_report"`          // write per-option outcomes to coverage.json
+	ExceptionsExport       bool     `mapstructure:"exceptions_export"`        // write converted exceptions to exceptions.json
+	InteractionsReport     bool     `mapstructure:"interactions_report"`      // write exceptions lifting other lists' rules to interactions.json
+	SourceMap              bool     `mapstructure:"source_map"`               // write the list each combined rule came from to source-map.json
+	MaxContentBlockers     int      `mapstructure:"max_content_blockers"`     // combined parts the host can register, 0 = no limit
+	UnknownOptions         string   `mapstructure:"unknown_options"`          // skip, warn, ignore
+	SalvageOptions         bool     `mapstructure:"salvage_options"`          // lossy: convert $redirect blocks as plain blocks
+	Shard                  string   `mapstructure:"shard"`                    // experimental: "", first-letter, hash
+	ShardCount             int      `mapstructure:"shard_count"`              // shards of the hash mode
+	Stale                  string   `mapstructure:"stale"`                    // remove, quarantine, keep
+	Versioned              bool     `mapstructure:"versioned"`                // keep a copy of every build in .versions/
+	WriteWorkers           int      `mapstructure:"write_workers"`            // content blocker files written at once, 0 = one per CPU
+	Fsync                  string   `mapstructure:"fsync"`                    // none, files, full
+}
+
+// Manifest version schemes
+const (
+	VersionSchemeDate    = "date"    // build date, 2006.01.02
+	VersionSchemeSemver  = "semver"  // output.version as configured
+	VersionSchemeContent = "content" // hash of the combined files
+)
+
+// Policies for network filters with options the parser does not recognize
+const (
+	UnknownOptionSkip   = "skip"   // drop the filter, as uBlock Origin does
+	UnknownOptionWarn   = "warn"   // convert without the option and report it
+	UnknownOptionIgnore = "ignore" // convert without the option silently
+)
+
+// Policies for content blocker files an earlier build wrote and the
+// current one does not, e.g. those of a disabled list
+const (
+	StaleRemove     = "remove"     // delete them
+	StaleQuarantine = "quarantine" // move them to .stale/ in the output directory
+	StaleKeep       = "keep"       // leave them, the default
+)
+
+// Policies for flushing written outputs to disk before the build goes on
+const (
+	FsyncNone  = "none"  // leave it to the OS
+	FsyncFiles = "files" // sync every file written
+	FsyncFull  = "full"  // sync every file and the directory holding it
+)
+
+// Resource type partitions: block rules limited to the partition's
+// resource types are written to content blockers of their own
+const (
+	PartitionScripts = "scripts" // script
+	PartitionImages  = "images"  // image
+	PartitionXHR     = "xhr"     // raw: XMLHttpRequest, fetch and WebSocket
+)
+
+// Experimental modes sharding combined outputs by the hostname rules are
+// anchored to
+const (
+	ShardFirstLetter = "first-letter" // one shard per leading character
+	ShardHash        = "hash"         // output.shard_count shards by hash
+)
+
+// Generic cosmetic filter handling modes
+const (
+	GenericCosmeticKeep     = "keep"     // convert inline with the rest of the list
+	GenericCosmeticSeparate = "separate" // write to dedicated *-generic outputs
+	GenericCosmeticDrop     = "drop"     // discard entirely
+)
+
+// StrictConfig controls failing the build on suspicious conversions
+type StrictConfig struct {
+	Enabled      bool    `mapstructure:"enabled"`
+	MaxSkipRatio float64 `mapstructure:"max_skip_ratio"` // 0.0-1.0, skipped / non-comment filters
+}
+
+// OverlapConfig controls detection of redundant lists
+type OverlapConfig struct {
+	Threshold    float64 `mapstructure:"threshold"`     // 0.0-1.0, share of a list's rules found in an earlier list
+	Dedup        bool    `mapstructure:"dedup"`         // skip redundant lists instead of only warning
+	DedupFilters bool    `mapstructure:"dedup_filters"` // drop blocking filters an earlier list already has
+}
+
+// PSLConfig controls the Public Suffix List used for domain handling
+type PSLConfig struct {
+	File string `mapstructure:"file"` // refreshed copy, the embedded snapshot is used if missing
+	URL  string `mapstructure:"url"`
+}
+
+// DNSConfig controls DNS blocklist exports derived from pure-hostname rules
+type DNSConfig struct {
+	Formats        []string `mapstructure:"formats"`         // hosts, dnsmasq, unbound, rpz, pihole
+	Sinkhole       string   `mapstructure:"sinkhole"`        // address for hosts/dnsmasq entries
+	Dir            string   `mapstructure:"dir"`             // subdirectory of the output directory
+	PiholeMetadata bool     `mapstructure:"pihole_metadata"` // write pihole-adlist.json alongside pihole.txt
+	PiholeAddress  string   `mapstructure:"pihole_address"`  // URL the adlist is published at
+}
+
+// PublishConfig controls uploading artifacts after a successful build.
+// Credentials fall back to AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY,
+// GOOGLE_OAUTH_ACCESS_TOKEN and WEBDAV_PASSWORD when left empty.
+type PublishConfig struct {
+	Enabled   bool   `mapstructure:"enabled"` // publish automatically after convert
+	Backend   string `mapstructure:"backend"` // s3, gcs, webdav
+	URL       string `mapstructure:"url"`     // S3 endpoint or WebDAV base URL
+	Bucket    string `mapstructure:"bucket"`
+	Prefix    string `mapstructure:"prefix"`
+	Region    string `mapstructure:"region"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	Token     string `mapstructure:"token"`
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password"`
+}
+
+// SigningConfig controls detached signatures of checksums.txt and manifest.json
+type SigningConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	Tool        string `mapstructure:"tool"`         // minisign, cosign
+	Key         string `mapstructure:"key"`          // secret key used to sign
+	PublicKey   string `mapstructure:"public_key"`   // public key used by verify
+	PasswordEnv string `mapstructure:"password_env"` // env var holding the key password
+}
+
+// DaemonConfig controls periodic rebuilds in daemon mode
+type DaemonConfig struct {
+	Interval time.Duration `mapstructure:"interval"`
+	Listen   string        `mapstructure:"listen"` // metrics address, empty disables
+	Health   HealthConfig  `mapstructure:"health"`
+	Compile  bool          `mapstructure:"compile"` // run "compile" after each successful build
+}
+
+// HealthConfig decides which changes of a list between daemon builds are
+// reported as anomalies
+type HealthConfig struct {
+	ShrinkRatio float64 `mapstructure:"shrink_ratio"` // fraction of rules or bytes lost, 0 disables
+	MaxFailures int     `mapstructure:"max_failures"` // failed builds in a row, 0 disables
+	History     int     `mapstructure:"history"`      // builds remembered per list
+}
+
+// HooksConfig lists commands run after each build, e.g. deployment steps
+type HooksConfig struct {
+	OnSuccess []string      `mapstructure:"on_success"` // run in order after a successful build
+	OnFailure []string      `mapstructure:"on_failure"` // run after a failed one
+	Timeout   time.Duration `mapstructure:"timeout"`    // per command, 0 = hooks.DefaultTimeout
+}
+
+// CompileConfig checks content blocker files before host apps load them,
+// skipping files that compiled before
+type CompileConfig struct {
+	Command string        `mapstructure:"command"` // compiles one file, e.g. with WebKit; empty only lints
+	Timeout time.Duration `mapstructure:"timeout"` // per file, 0 = hooks.DefaultTimeout
+}
+
+// WebhookConfig describes a notification target fired after daemon builds
+type WebhookConfig struct {
+	Type  string   `mapstructure:"type"`  // generic (POST build JSON + manifest), ntfy, matrix
+	URL   string   `mapstructure:"url"`   // endpoint, ntfy topic URL or Matrix homeserver
+	On    []string `mapstructure:"on"`    // success, failure (default: both)
+	Token string   `mapstructure:"token"` // bearer token / Matrix access token
+	Room  string   `mapstructure:"room"`  // Matrix room ID
+}
+
+// SmokeTestConfig drives the end-to-end browser smoke test
+type SmokeTestConfig struct {
+	Browser           string          `mapstructure:"browser"`             // WebKitGTK MiniBrowser binary
+	Args              []string        `mapstructure:"args"`                // extra browser arguments
+	ContentFilterFlag string          `mapstructure:"content_filter_flag"` // flag taking the rules JSON
+	Rules             []string        `mapstructure:"rules"`               // rule file globs to load
+	Timeout           time.Duration   `mapstructure:"timeout"`             // time allowed per page
+	Pages             []SmokeTestPage `mapstructure:"pages"`
+}
+
+// SmokeTestPage is a page to visit with its expected network behaviour
+type SmokeTestPage struct {
+	URL     string   `mapstructure:"url"`
+	Blocked []string `mapstructure:"blocked"` // hosts that must never be contacted
+	Allowed []string `mapstructure:"allowed"` // hosts that must be contacted
+}
+
+// AllowlistConfig lists sites and URLs exempted from all blocking. Entries
+// become ignore-previous-rules rules at the end of the combined output.
+type AllowlistConfig struct {
+	Domains []string `mapstructure:"domains"` // sites to disable blocking on, subdomains included
+	URLs    []string `mapstructure:"urls"`    // request patterns in filter syntax, e.g. ||cdn.example.com/player
+}
+
+// PolicyConfig holds domains every list is overridden on, for deployments
+// that must never break some sites or must always block others
+type PolicyConfig struct {
+	NeverBlockDomains  []string `mapstructure:"never_block_domains"`  // rules targeting them are dropped, their pages and requests exempted
+	AlwaysBlockDomains []string `mapstructure:"always_block_domains"` // requests blocked whatever exceptions the lists have
+}
+
+// Transform rewrites the converted rules of some lists, so a list can be
+// adjusted without forking it
+type Transform struct {
+	Action        string   `mapstructure:"action"`         // drop, resource-type, rewrite
+	Domain        string   `mapstructure:"domain"`         // drop: rules targeting it, rewrite: domain to replace
+	To            string   `mapstructure:"to"`             // rewrite: replacement domain
+	ResourceTypes []string `mapstructure:"resource_types"` // resource-type: WebKit types to force
+	Lists         []string `mapstructure:"lists"`          // list names, empty for every list
+}
+
+// Transform actions
+const (
+	TransformDrop         = "drop"          // drop rules targeting a domain or its subdomains
+	TransformResourceType = "resource-type" // force the resource types of request rules
+	TransformRewrite      = "rewrite"       // replace a domain and its subdomains
+)
+
+// AppliesTo reports whether the transform rewrites the named list
+func (t Transform) AppliesTo(list string) bool {
+	return len(t.Lists) == 0 || slices.Contains(t.Lists, list)
+}
+
+// TransformsFor returns the transforms applying to the named list, in order
+func (c *Config) TransformsFor(list string) []Transform {
+	var transforms []Transform
+	for _, t := range c.Transforms {
+		if t.AppliesTo(list) {
+			transforms = append(transforms, t)
+		}
+	}
+	return transforms
 }
 
 // FilterList represents a single filter list configuration
 type FilterList struct {
-	Name    string `mapstructure:"name"`
-	URL     string `mapstructure:"url"`
-	Enabled bool   `mapstructure:"enabled"`
+	Name           string            `mapstructure:"name"`
+	URL            string            `mapstructure:"url"`
+	Enabled        bool              `mapstructure:"enabled"`
+	Format         string            `mapstructure:"format"`          // auto (default), adblock, hosts, webkit-json
+	Tags           []string          `mapstructure:"tags"`            // categories, each gets a combined-<tag> output
+	MaxRules       int               `mapstructure:"max_rules"`       // cap on rules contributed to combined files
+	Priority       int               `mapstructure:"priority"`        // higher is served first under the combined budget
+	UpdateInterval time.Duration     `mapstructure:"update_interval"` // expected upstream refresh cadence
+	Trusted        bool              `mapstructure:"trusted"`         // allow lossy regex rewrites
+	UserAgent      string            `mapstructure:"user_agent"`      // overrides http.user_agent
+	Headers        map[string]string `mapstructure:"headers"`         // added to, or replacing, http.headers
+	CAFile         string            `mapstructure:"ca_file"`         // replaces http.ca_file for this list
+	Pins           []string          `mapstructure:"pins"`            // accepted SPKI pins, "sha256/<base64>"
+	SHA256         string            `mapstructure:"sha256"`          // expected content hash, verified after download
+	Encoding       string            `mapstructure:"encoding"`        // auto (default) or a WHATWG label, e.g. windows-1251
+	Title          string            `mapstructure:"title"`           // shown by host apps, defaults to the name
+	Description    string            `mapstructure:"description"`     // shown by host apps
+	DefaultOff     bool              `mapstructure:"default_off"`     // host apps leave the list off until enabled
+	DefaultTypes   []string          `mapstructure:"default_types"`   // WebKit resource types of block filters without a type option
+	Required       bool              `mapstructure:"required"`        // fail the build when the list can't be fetched or converted
+}
+
+// NormalizeListURL trims a list URL and lowercases its scheme and host.
+// Only http(s) URLs with a host, file:// paths and ipfs://CID[/path] are
+// accepted.
+func NormalizeListURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("empty URL")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return "", fmt.Errorf("URL %q has no host", raw)
+		}
+	case "file":
+		if u.Path == "" || !strings.HasPrefix(strings.ToLower(raw), "file://") {
+			return "", fmt.Errorf("URL %q: want file:///path", raw)
+		}
+		// Kept as written, the fetcher reads the path verbatim
+		return "file://" + raw[len("file://"):], nil
+	case "ipfs":
+		if u.Host == "" {
+			return "", fmt.Errorf("URL %q: want ipfs://CID/path", raw)
+		}
+		// CIDs are case-sensitive (base58 v0), only the scheme is lowered
+		return "ipfs://" + u.Host + u.EscapedPath(), nil
+	default:
+		return "", fmt.Errorf("URL %q: unsupported scheme %q (want http, https, file or ipfs)", raw, u.Scheme)
+	}
+
+	// url.Parse already lowercased the scheme; fragments are never sent
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+// NormalizeURLs normalizes every list URL in place and returns the lists
+// with unusable URLs or a URL another list already uses
+func (c *Config) NormalizeURLs() []error {
+	var problems []error
+	seen := make(map[string]string) // URL -> first list using it
+	for i := range c.Lists {
+		list := &c.Lists[i]
+		normalized, err := NormalizeListURL(list.URL)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("list %s: %w", list.Name, err))
+			continue
+		}
+		list.URL = normalized
+
+		if other, ok := seen[normalized]; ok {
+			problems = append(problems, fmt.Errorf("list %s: same URL as list %s (%s)", list.Name, other, normalized))
+			continue
+		}
+		seen[normalized] = list.Name
+	}
+	return problems
 }
 
 // EnabledLists returns only enabled filter lists
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeListURL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{input: " https://EasyList.to/easylist/easylist.txt\t", expected: "https://easylist.to/easylist/easylist.txt"},
+		{input: "HTTP://example.com/List.txt#section", expected: "http://example.com/List.txt"},
+		{input: "file:///home/me/rules.json", expected: "file:///home/me/rules.json"},
+		{input: "FILE:///home/me/my rules.json", expected: "file:///home/me/my rules.json"},
+		{input: "IPFS://QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG/easylist.txt", expected: "ipfs://QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG/easylist.txt"},
+		{input: "ipfs:///easylist.txt", wantErr: true},
+		{input: "", wantErr: true},
+		{input: "easylist.to/easylist.txt", wantErr: true},
+		{input: "ftp://example.com/list.txt", wantErr: true},
+		{input: "https:///list.txt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := NormalizeListURL(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestNormalizeURLs(t *testing.T) {
+	cfg := Config{Lists: []FilterList{
+		{Name: "easylist", URL: "https://easylist.to/easylist/easylist.txt "},
+		{Name: "mirror", URL: "https://EASYLIST.to/easylist/easylist.txt"},
+		{Name: "broken", URL: "not a url"},
+	}}
+
+	problems := cfg.NormalizeURLs()
+	require.Len(t, problems, 2)
+	assert.Contains(t, problems[0].Error(), "list mirror: same URL as list easylist")
+	assert.Contains(t, problems[1].Error(), "list broken")
+	assert.Equal(t, "https://easylist.to/easylist/easylist.txt", cfg.Lists[0].URL)
+
+	// Normalizing again changes nothing
+	before := cfg.Lists[0].URL
+	cfg.NormalizeURLs()
+	assert.Equal(t, before, cfg.Lists[0].URL)
+}
+
+func TestMemoryLimitBytes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		wantErr  bool
+	}{
+		{input: "", expected: 0},
+		{input: "512MB", expected: 512 << 20},
+		{input: "2 gb", expected: 2 << 30},
+		{input: "64KB", expected: 64 << 10},
+		{input: "1000", expected: 1000},
+		{input: "1.5GB", wantErr: true},
+		{input: "-1MB", wantErr: true},
+		{input: "lots", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := MemoryConfig{Limit: tt.input}.LimitBytes()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
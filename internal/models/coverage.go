@@ -0,0 +1,88 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// Outcome is how a filter was handled
+type Outcome int
+
+const (
+	OutcomeConverted    Outcome = iota // converted faithfully
+	OutcomeApproximated                // converted with a lossy rewrite
+	OutcomeSkipped                     // not converted
+)
+
+// OptionCoverage counts how filters using one option were handled
+type OptionCoverage struct {
+	Option       string `json:"option"`
+	Filters      int    `json:"filters"`
+	Converted    int    `json:"converted"`
+	Approximated int    `json:"approximated"`
+	Skipped      int    `json:"skipped"`
+}
+
+// Coverage tallies outcomes per filter option ($third-party, $redirect, ...)
+type Coverage map[string]OptionCoverage
+
+// OptionName normalizes a raw option ("~third-party", "domain=a.com") to
+// its name
+func OptionName(option string) string {
+	name, _, _ := strings.Cut(option, "=")
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "~"))
+}
+
+// Record counts a filter using options with the given outcome
+func (c Coverage) Record(options []string, outcome Outcome) {
+	for _, name := range options {
+		oc := c[name]
+		oc.Option = name
+		oc.Filters++
+		switch outcome {
+		case OutcomeConverted:
+			oc.Converted++
+		case OutcomeApproximated:
+			oc.Approximated++
+		case OutcomeSkipped:
+			oc.Skipped++
+		}
+		c[name] = oc
+	}
+}
+
+// Merge adds the counts of other
+func (c Coverage) Merge(other Coverage) {
+	for name, o := range other {
+		oc := c[name]
+		oc.Option = name
+		oc.Filters += o.Filters
+		oc.Converted += o.Converted
+		oc.Approximated += o.Approximated
+		oc.Skipped += o.Skipped
+		c[name] = oc
+	}
+}
+
+// Sorted returns the options with the most skipped (then approximated)
+// filters first: the modifiers worth supporting next
+func (c Coverage) Sorted() []OptionCoverage {
+	sorted := make([]OptionCoverage, 0, len(c))
+	for _, oc := range c {
+		sorted = append(sorted, oc)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Skipped != b.Skipped {
+			return a.Skipped > b.Skipped
+		}
+		if a.Approximated != b.Approximated {
+			return a.Approximated > b.Approximated
+		}
+		if a.Filters != b.Filters {
+			return a.Filters > b.Filters
+		}
+		return a.Option < b.Option
+	})
+	return sorted
+}
@@ -1,5 +1,7 @@
 package models
 
+import "strings"
+
 // FilterType represents the type of filter parsed
 type FilterType int
 
@@ -14,30 +16,56 @@ const (
 
 // Filter represents a parsed ABP/uBlock filter
 type Filter struct {
-	Type     FilterType
-	Raw      string        // Original filter line
-	Pattern  string        // URL pattern for network filters
-	Selector string        // CSS selector for cosmetic filters
-	Domains  []string      // Domains this filter applies to
-	Options  FilterOptions // Network filter options
+	Type     FilterType    `json:"t"`
+	Raw      string        `json:"r"`           // Original filter line
+	Pattern  string        `json:"p,omitempty"` // URL pattern for network filters
+	Selector string        `json:"s,omitempty"` // CSS selector for cosmetic filters
+	Domains  []string      `json:"d,omitempty"` // Domains this filter applies to
+	Options  FilterOptions `json:"o"`           // Network filter options
+}
+
+// IsGenericCosmetic returns true for cosmetic filters that apply on every site,
+// i.e. those without any positive (non-~) domain
+func (f Filter) IsGenericCosmetic() bool {
+	if f.Type != FilterTypeCosmetic {
+		return false
+	}
+	for _, d := range f.Domains {
+		if !strings.HasPrefix(d, "~") {
+			return false
+		}
+	}
+	return true
 }
 
 // FilterOptions contains parsed network filter options
 type FilterOptions struct {
-	ThirdParty     *bool    // nil = any, true = 3p only, false = 1p only
-	ResourceTypes  []string // script, image, stylesheet, etc.
-	Domains        []string // domain= values (apply to these domains)
-	ExcludeDomains []string // ~domain values (exclude these domains)
-	MatchCase      bool     // case-sensitive matching
-	Important      bool     // override exceptions
+	ThirdParty     *bool    `json:"3p,omitempty"`      // nil = any, true = 3p only, false = 1p only
+	StrictParty    bool     `json:"strict,omitempty"`  // $strict1p/$strict3p: ThirdParty compares hostnames, not sites
+	ResourceTypes  []string `json:"types,omitempty"`   // script, image, stylesheet, etc.
+	LoadContexts   []string `json:"ctx,omitempty"`     // frames targeted by $document/$popup (top) or $subdocument (child)
+	Domains        []string `json:"in,omitempty"`      // domain= values (apply to these domains)
+	ExcludeDomains []string `json:"out,omitempty"`     // ~domain values (exclude these domains)
+	MatchCase      bool     `json:"case,omitempty"`    // case-sensitive matching
+	Important      bool     `json:"imp,omitempty"`     // override exceptions
+	RemoveParam    string   `json:"rmp,omitempty"`     // $removeparam value, "*" when bare (every parameter)
+	InlineScript   bool     `json:"iscript,omitempty"` // $inline-script, a CSP rather than a request filter
+	InlineFont     bool     `json:"ifont,omitempty"`   // $inline-font, likewise
+	Salvaged       bool     `json:"salv,omitempty"`    // converted without an unsupported option, see Parser.SalvageOptions
+	Names          []string `json:"n,omitempty"`       // every option name as written, for coverage reports
 }
 
 // IsEmpty returns true if no options are set
 func (o FilterOptions) IsEmpty() bool {
 	return o.ThirdParty == nil &&
+		!o.StrictParty &&
 		len(o.ResourceTypes) == 0 &&
+		len(o.LoadContexts) == 0 &&
 		len(o.Domains) == 0 &&
 		len(o.ExcludeDomains) == 0 &&
 		!o.MatchCase &&
-		!o.Important
+		!o.Important &&
+		o.RemoveParam == "" &&
+		!o.InlineScript &&
+		!o.InlineFont
 }
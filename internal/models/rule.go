@@ -12,8 +12,11 @@ type WebKitTrigger struct {
 	URLFilterIsCaseSensitive *bool    `json:"url-filter-is-case-sensitive,omitempty"`
 	ResourceType             []string `json:"resource-type,omitempty"`
 	LoadType                 []string `json:"load-type,omitempty"`
+	LoadContext              []string `json:"load-context,omitempty"`
 	IfDomain                 []string `json:"if-domain,omitempty"`
 	UnlessDomain             []string `json:"unless-domain,omitempty"`
+	IfTopURL                 []string `json:"if-top-url,omitempty"`
+	UnlessTopURL             []string `json:"unless-top-url,omitempty"`
 }
 
 // WebKitAction defines what to do when a rule triggers
@@ -48,3 +51,9 @@ const (
 	LoadFirstParty = "first-party"
 	LoadThirdParty = "third-party"
 )
+
+// Load context constants (Safari 15+)
+const (
+	LoadContextTopFrame   = "top-frame"
+	LoadContextChildFrame = "child-frame"
+)
@@ -0,0 +1,138 @@
+package models
+
+// SkipReason identifies why a filter or rule was not converted. The values
+// are stable codes used in stats, manifests and metrics labels, so existing
+// codes must never be renamed.
+type SkipReason string
+
+// MaxSkipSamples is how many raw lines are kept per skip reason, as examples
+// for users checking what a list loses
+const MaxSkipSamples = 3
+
+// AddSkipSample keeps line as an example of reason unless enough are kept
+func AddSkipSample(samples map[SkipReason][]string, reason SkipReason, line string) {
+	if len(samples[reason]) < MaxSkipSamples {
+		samples[reason] = append(samples[reason], line)
+	}
+}
+
+// SkipPattern counts the skipped filters sharing a reason and detail, such
+// as a scriptlet or option name
+type SkipPattern struct {
+	Reason  SkipReason `json:"reason"`
+	Count   int        `json:"count"`
+	Example string     `json:"example"` // first skipped line
+}
+
+// SkipPatterns maps pattern keys ("scriptlet:set-constant", "invalid-regex")
+// to their counts
+type SkipPatterns map[string]SkipPattern
+
+// SkipPatternKey identifies the pattern of a skip, detail being optional
+func SkipPatternKey(reason SkipReason, detail string) string {
+	if detail == "" {
+		return string(reason)
+	}
+	return string(reason) + ":" + detail
+}
+
+// Add counts a skipped line
+func (p SkipPatterns) Add(reason SkipReason, detail, line string) {
+	key := SkipPatternKey(reason, detail)
+	pattern, ok := p[key]
+	if !ok {
+		pattern = SkipPattern{Reason: reason, Example: line}
+	}
+	pattern.Count++
+	p[key] = pattern
+}
+
+// Merge adds the counts of other
+func (p SkipPatterns) Merge(other SkipPatterns) {
+	for key, o := range other {
+		pattern, ok := p[key]
+		if !ok {
+			pattern = SkipPattern{Reason: o.Reason, Example: o.Example}
+		}
+		pattern.Count += o.Count
+		p[key] = pattern
+	}
+}
+
+// Skip reasons recorded by the parser
+const (
+	SkipScriptlet         SkipReason = "scriptlet"
+	SkipHTMLFilter        SkipReason = "html-filter"
+	SkipProcedural        SkipReason = "procedural"
+	SkipUnsupportedOption SkipReason = "unsupported-option"
+	SkipUnknownOption     SkipReason = "unknown-option"
+	SkipCosmeticException SkipReason = "cosmetic-exception"
+)
+
+// Skip reasons recorded by the converter
+const (
+	SkipInvalidRegex        SkipReason = "invalid-regex"
+	SkipEmptySelector       SkipReason = "empty-selector"
+	SkipInvalidUTF8         SkipReason = "invalid-utf8"
+	SkipNULByte             SkipReason = "nul-byte"
+	SkipControlChars        SkipReason = "control-characters"
+	SkipInvalidDomain       SkipReason = "invalid-domain"
+	SkipUnsupportedField    SkipReason = "unsupported-field"
+	SkipInvalidAction       SkipReason = "invalid-action"
+	SkipEmptyURLFilter      SkipReason = "empty-url-filter"
+	SkipUnsupportedByTarget SkipReason = "unsupported-by-target"
+	SkipComplexSelector     SkipReason = "complex-selector"
+	SkipRemoveParam         SkipReason = "removeparam"
+	SkipInlineScript        SkipReason = "inline-script"
+	SkipInlineFont          SkipReason = "inline-font"
+	SkipNeedsApproximation  SkipReason = "needs-approximation"
+	SkipInvalidTrigger      SkipReason = "invalid-trigger"
+	SkipRegexAnchor         SkipReason = "regex-anchor"
+)
+
+var skipDescriptions = map[SkipReason]string{
+	SkipScriptlet:           "scriptlet injection (##+js)",
+	SkipHTMLFilter:          "HTML filter (##^)",
+	SkipProcedural:          "procedural cosmetic filter (:has, :xpath, etc)",
+	SkipUnsupportedOption:   "unsupported option (redirect, csp, etc)",
+	SkipUnknownOption:       "unknown option",
+	SkipCosmeticException:   "cosmetic exception (#@#) with negated domains",
+	SkipInvalidRegex:        "regex not supported by WebKit",
+	SkipEmptySelector:       "empty CSS selector",
+	SkipInvalidUTF8:         "invalid UTF-8",
+	SkipNULByte:             "NUL byte",
+	SkipControlChars:        "control characters",
+	SkipInvalidDomain:       "no valid domain left",
+	SkipUnsupportedField:    "JSON rule field not supported",
+	SkipInvalidAction:       "JSON rule action not supported",
+	SkipEmptyURLFilter:      "empty url-filter",
+	SkipUnsupportedByTarget: "feature not supported by the target",
+	SkipComplexSelector:     "selector above complexity limit",
+	SkipRemoveParam:         "$removeparam not convertible to a block rule",
+	SkipInlineScript:        "$inline-script (CSP, see csp.json)",
+	SkipInlineFont:          "$inline-font (CSP, see csp.json)",
+	SkipNeedsApproximation:  "regex needs a lossy rewrite (list not trusted)",
+	SkipInvalidTrigger:      "rule WebKit would refuse to compile",
+	SkipRegexAnchor:         "regex anchors that cannot be kept",
+}
+
+// SkipReasons returns every known skip reason
+func SkipReasons() []SkipReason {
+	return []SkipReason{
+		SkipScriptlet, SkipHTMLFilter, SkipProcedural, SkipUnsupportedOption, SkipUnknownOption,
+		SkipCosmeticException, SkipInvalidRegex, SkipEmptySelector,
+		SkipInvalidUTF8, SkipNULByte, SkipControlChars, SkipInvalidDomain,
+		SkipUnsupportedField, SkipInvalidAction, SkipEmptyURLFilter,
+		SkipUnsupportedByTarget, SkipComplexSelector, SkipRemoveParam,
+		SkipInlineScript, SkipInlineFont, SkipNeedsApproximation, SkipInvalidTrigger,
+		SkipRegexAnchor,
+	}
+}
+
+// Description returns a human-readable explanation of the reason
+func (r SkipReason) Description() string {
+	if d, ok := skipDescriptions[r]; ok {
+		return d
+	}
+	return string(r)
+}
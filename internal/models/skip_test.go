@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipReasonsDescribed(t *testing.T) {
+	seen := make(map[SkipReason]bool)
+	for _, r := range SkipReasons() {
+		assert.False(t, seen[r], "duplicate code %s", r)
+		seen[r] = true
+		assert.NotEqual(t, string(r), r.Description(), "missing description for %s", r)
+	}
+	assert.Len(t, seen, len(skipDescriptions))
+}
+
+func TestSkipReasonsDocumented(t *testing.T) {
+	for _, r := range SkipReasons() {
+		doc, ok := r.Doc()
+		if assert.True(t, ok, "missing doc for %s", r) {
+			assert.NotEmpty(t, doc.Feature, r)
+			assert.NotEmpty(t, doc.Explanation, r)
+			assert.Contains(t, []Support{SupportNever, SupportPossible, SupportInput}, doc.Support, r)
+		}
+	}
+	assert.Len(t, skipDocs, len(skipDescriptions))
+}
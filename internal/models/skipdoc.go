@@ -0,0 +1,219 @@
+package models
+
+// Support says whether WebKit content blockers could ever express what a
+// skip reason drops
+type Support string
+
+const (
+	SupportNever    Support = "never"    // outside the content blocker model
+	SupportPossible Support = "possible" // a WebKit or converter change could cover it
+	SupportInput    Support = "input"    // the filter itself is broken
+)
+
+// SkipDoc explains a skip reason in depth, for the why command
+type SkipDoc struct {
+	Feature     string   // the uBO feature or filter syntax concerned
+	Explanation string   // why the filter is not converted
+	Support     Support  // whether WebKit could ever support it
+	Workarounds []string // what users can do about it
+}
+
+var skipDocs = map[SkipReason]SkipDoc{
+	SkipScriptlet: {
+		Feature: "scriptlet injection: example.com##+js(set-constant, ...)",
+		Explanation: "Scriptlets run JavaScript inside the page to neutralize ads and anti-adblock " +
+			"scripts. Content blockers only block requests and hide elements, they never run code.",
+		Support: SupportNever,
+		Workarounds: []string{
+			"Inject the scriptlets with a WebKit user script (WebKitUserContentManager) in the browser",
+			"Block the script the scriptlet defuses with a network filter when the site still works without it",
+		},
+	},
+	SkipHTMLFilter: {
+		Feature: "HTML filter: example.com##^script:has-text(...)",
+		Explanation: "HTML filters remove elements from the document source before it is parsed, " +
+			"which needs access to the response body. Content blockers never see response bodies.",
+		Support: SupportNever,
+		Workarounds: []string{
+			"Hide the resulting elements with a cosmetic filter (##) when they are visible",
+			"Block the resource the element loads with a network filter",
+		},
+	},
+	SkipProcedural: {
+		Feature: "procedural cosmetic filter: ##div:has-text(Sponsored), :has(), :not(), :xpath(), :upward(), :style()",
+		Explanation: "Procedural operators are evaluated by uBO's content script while the page changes. " +
+			"css-display-none takes CSS selectors and can only hide elements, not restyle or remove them. " +
+			"Operators that are also CSS, like :has() and :not(), are skipped too since older WebKit releases lack them.",
+		Support: SupportPossible,
+		Workarounds: []string{
+			"Rewrite the filter with plain CSS selectors if the list maintainer agrees",
+			"Run the procedural filters from a user script in the browser",
+		},
+	},
+	SkipUnsupportedOption: {
+		Feature: "network options without a WebKit action: $redirect, $csp, $replace, $header, $permissions, ...",
+		Explanation: "WebKit actions are block, block-cookies, css-display-none, ignore-previous-rules and " +
+			"make-https. Options that rewrite responses, redirect to neutered resources or edit headers have no equivalent.",
+		Support: SupportNever,
+		Workarounds: []string{
+			"For $removeparam, set output.removeparam_block = true to block third-party requests carrying known tracking parameters",
+			"For $redirect, set output.salvage_options = true to convert blocking filters as plain blocks, at the risk of breaking the page",
+		},
+	},
+	SkipUnknownOption: {
+		Feature: "filter options the parser does not know",
+		Explanation: "Converting a filter while dropping an option it does not understand could widen it, " +
+			"e.g. block a request on every site instead of one.",
+		Support: SupportPossible,
+		Workarounds: []string{
+			"Set output.unknown_options = \"warn\" to convert and report them, or \"ignore\" to convert silently",
+			"Report the option so the parser learns it",
+		},
+	},
+	SkipCosmeticException: {
+		Feature: "cosmetic exception with negated domains: ~example.com#@#.ad",
+		Explanation: "A #@# exception re-shows elements on the listed sites. A negated domain in an exception " +
+			"has no well-defined meaning, so the converter cannot tell which hiding rules it should lift.",
+		Support: SupportInput,
+		Workarounds: []string{
+			"Ask the list maintainer to list the sites the exception applies to",
+		},
+	},
+	SkipInvalidRegex: {
+		Feature: "regex filters: /banner[0-9]+\\.gif/",
+		Explanation: "WebKit's url-filter supports a small regex subset: no alternation (|), no {n,m} " +
+			"quantifiers, no lookarounds, backreferences or most character class escapes.",
+		Support: SupportPossible,
+		Workarounds: []string{
+			"Mark the list trusted = true to allow lossy rewrites of quantifiers and alternations",
+			"Rewrite the filter as a plain network filter with wildcards",
+		},
+	},
+	SkipEmptySelector: {
+		Feature:     "cosmetic filters without a selector: example.com##",
+		Explanation: "There is nothing to hide; WebKit rejects css-display-none rules without a selector.",
+		Support:     SupportInput,
+		Workarounds: []string{"Fix the filter upstream"},
+	},
+	SkipInvalidUTF8: {
+		Feature:     "filters that are not valid UTF-8",
+		Explanation: "WebKit rule lists are JSON, which must be valid UTF-8.",
+		Support:     SupportInput,
+		Workarounds: []string{
+			"Set encoding on the list if it is not served as UTF-8",
+			"Fix the filter upstream",
+		},
+	},
+	SkipNULByte: {
+		Feature:     "filters containing a NUL byte",
+		Explanation: "NUL bytes are never valid in URLs or selectors and usually mean a corrupted download.",
+		Support:     SupportInput,
+		Workarounds: []string{"Check the list downloads intact, e.g. with sha256 pinning"},
+	},
+	SkipControlChars: {
+		Feature:     "filters containing control characters",
+		Explanation: "Control characters cannot match URLs or selectors and break some WebKit versions.",
+		Support:     SupportInput,
+		Workarounds: []string{"Fix the filter upstream"},
+	},
+	SkipInvalidDomain: {
+		Feature: "domain= and cosmetic domain lists",
+		Explanation: "None of the filter's domains is a valid hostname, so it would either apply nowhere " +
+			"or, without the condition, everywhere.",
+		Support:     SupportInput,
+		Workarounds: []string{"Fix the domains upstream"},
+	},
+	SkipUnsupportedField: {
+		Feature:     "merged content blocker JSON (format = \"webkit-json\")",
+		Explanation: "The imported rule uses a trigger or action field WebKit does not define.",
+		Support:     SupportInput,
+		Workarounds: []string{"Remove or rename the field in the imported file"},
+	},
+	SkipInvalidAction: {
+		Feature:     "merged content blocker JSON (format = \"webkit-json\")",
+		Explanation: "The imported rule's action type is not one WebKit supports.",
+		Support:     SupportInput,
+		Workarounds: []string{"Use block, block-cookies, css-display-none, ignore-previous-rules or make-https"},
+	},
+	SkipEmptyURLFilter: {
+		Feature:     "merged content blocker JSON (format = \"webkit-json\")",
+		Explanation: "Every WebKit trigger needs a url-filter; use \".*\" to match every URL.",
+		Support:     SupportInput,
+		Workarounds: []string{"Add a url-filter to the imported rule"},
+	},
+	SkipUnsupportedByTarget: {
+		Feature: "trigger fields newer than output.target, such as load-context",
+		Explanation: "Older Safari releases refuse whole rule lists with unknown fields, and dropping the " +
+			"condition would widen the rule.",
+		Support:     SupportPossible,
+		Workarounds: []string{"Set output.target to a newer engine if your users run one"},
+	},
+	SkipComplexSelector: {
+		Feature: "cosmetic filters with costly selectors",
+		Explanation: "The selector is above output.max_selector_complexity. Complex selectors slow down " +
+			"style recalculation on every page the rule applies to.",
+		Support:     SupportPossible,
+		Workarounds: []string{"Raise output.max_selector_complexity, or set it to 0 to keep every selector"},
+	},
+	SkipRemoveParam: {
+		Feature: "$removeparam",
+		Explanation: "uBO strips the parameter and lets the request through; WebKit cannot rewrite URLs. " +
+			"With output.removeparam_block, third-party subresource requests carrying well-known tracking " +
+			"parameters are blocked instead, but this filter's parameter, exception or type options make that unsafe.",
+		Support: SupportNever,
+		Workarounds: []string{
+			"Strip tracking parameters in the browser's navigation handler",
+		},
+	},
+	SkipInlineScript: {
+		Feature: "$inline-script",
+		Explanation: "The filter adds a Content-Security-Policy forbidding inline scripts. Content blockers " +
+			"cannot add response headers.",
+		Support: SupportNever,
+		Workarounds: []string{
+			"Set output.csp_companion = true and apply the policies of csp.json from the browser",
+		},
+	},
+	SkipInlineFont: {
+		Feature: "$inline-font",
+		Explanation: "The filter adds a Content-Security-Policy forbidding inline fonts. Content blockers " +
+			"cannot add response headers.",
+		Support: SupportNever,
+		Workarounds: []string{
+			"Set output.csp_companion = true and apply the policies of csp.json from the browser",
+		},
+	},
+	SkipNeedsApproximation: {
+		Feature: "regex filters WebKit can only match approximately",
+		Explanation: "The regex needs a lossy rewrite, such as widening a {n,m} quantifier or splitting an " +
+			"alternation, which is only done for trusted lists.",
+		Support: SupportPossible,
+		Workarounds: []string{
+			"Mark the list trusted = true to allow the rewrites",
+		},
+	},
+	SkipInvalidTrigger: {
+		Feature: "rules WebKit would refuse to compile",
+		Explanation: "The converted rule failed the checks WebKit applies when compiling a rule list, such as " +
+			"combining if-domain and unless-domain. One invalid rule makes WebKit reject the whole list.",
+		Support: SupportInput,
+		Workarounds: []string{
+			"Look at the pattern detail in the skip report and fix the filter upstream",
+		},
+	},
+	SkipRegexAnchor: {
+		Feature: "anchors inside regex filters: /(^|\\.)example\\.com$/",
+		Explanation: "WebKit's url-filter only accepts ^ and $ at the edges of the whole pattern. A regex with " +
+			"anchors elsewhere, or whose anchors conflict with the filter's, cannot be kept as written.",
+		Support: SupportNever,
+		Workarounds: []string{
+			"Rewrite the regex with the anchors at its edges, or as a ||host^ filter",
+		},
+	},
+}
+
+// Doc returns the detailed explanation of the reason
+func (r SkipReason) Doc() (SkipDoc, bool) {
+	d, ok := skipDocs[r]
+	return d, ok
+}
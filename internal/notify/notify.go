@@ -0,0 +1,178 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// Webhook types
+const (
+	TypeGeneric = "generic"
+	TypeNtfy    = "ntfy"
+	TypeMatrix  = "matrix"
+)
+
+// Build outcomes a webhook can subscribe to
+const (
+	OnSuccess = "success"
+	OnFailure = "failure"
+)
+
+// Event describes a finished build
+type Event struct {
+	BuildID    string        `json:"build_id,omitempty"`
+	Status     string        `json:"status"` // success or failure
+	Error      string        `json:"error,omitempty"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Duration   time.Duration `json:"duration_ns"`
+	TotalRules int           `json:"total_rules"`
+	Manifest   any           `json:"manifest,omitempty"`
+	Anomalies  []string      `json:"anomalies,omitempty"` // list health problems found by the build
+}
+
+// Summary renders a one-line human description for chat-style targets
+func (e Event) Summary() string {
+	var s string
+	if e.Status == OnFailure {
+		s = fmt.Sprintf("Filter build failed after %s: %s", e.Duration.Round(time.Second), e.Error)
+	} else {
+		s = fmt.Sprintf("Filter build succeeded in %s: %d combined rules", e.Duration.Round(time.Second), e.TotalRules)
+	}
+	if len(e.Anomalies) > 0 {
+		s += "\nList anomalies: " + strings.Join(e.Anomalies, "; ")
+	}
+	return s
+}
+
+// Notifier fires configured webhooks
+type Notifier struct {
+	client *http.Client
+	hooks  []models.WebhookConfig
+}
+
+// New creates a notifier for the configured webhooks
+func New(hooks []models.WebhookConfig) *Notifier {
+	return &Notifier{
+		client: &http.Client{Timeout: 30 * time.Second},
+		hooks:  hooks,
+	}
+}
+
+// Notify sends the event to every webhook subscribed to its status and
+// returns the errors of the deliveries that failed
+func (n *Notifier) Notify(ctx context.Context, ev Event) []error {
+	var errs []error
+	for _, hook := range n.hooks {
+		if !subscribed(hook, ev.Status) {
+			continue
+		}
+		if err := n.send(ctx, hook, ev); err != nil {
+			errs = append(errs, fmt.Errorf("%s webhook %s: %w", hookType(hook), redact(hook.URL), err))
+		}
+	}
+	return errs
+}
+
+func (n *Notifier) send(ctx context.Context, hook models.WebhookConfig, ev Event) error {
+	var req *http.Request
+	var err error
+
+	switch hookType(hook) {
+	case TypeGeneric:
+		body, jerr := json.Marshal(ev)
+		if jerr != nil {
+			return jerr
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	case TypeNtfy:
+		// ntfy publishes the request body to the topic URL
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, strings.NewReader(ev.Summary()))
+		if err == nil {
+			req.Header.Set("Title", "ublock-webkit-filters build "+ev.Status)
+			if ev.Status == OnFailure || len(ev.Anomalies) > 0 {
+				req.Header.Set("Priority", "high")
+				req.Header.Set("Tags", "warning")
+			} else {
+				req.Header.Set("Tags", "white_check_mark")
+			}
+		}
+	case TypeMatrix:
+		if hook.Room == "" {
+			return fmt.Errorf("matrix webhook requires room")
+		}
+		body, jerr := json.Marshal(map[string]string{"msgtype": "m.text", "body": ev.Summary()})
+		if jerr != nil {
+			return jerr
+		}
+		endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/uwf-%d",
+			strings.TrimSuffix(hook.URL, "/"), url.PathEscape(hook.Room), time.Now().UnixNano())
+		req, err = http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	default:
+		return fmt.Errorf("unknown webhook type %q", hook.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	if hook.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+hook.Token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// subscribed reports whether a hook fires for status; empty means both
+func subscribed(hook models.WebhookConfig, status string) bool {
+	if len(hook.On) == 0 {
+		return true
+	}
+	for _, on := range hook.On {
+		if on == status {
+			return true
+		}
+	}
+	return false
+}
+
+func hookType(hook models.WebhookConfig) string {
+	if hook.Type == "" {
+		return TypeGeneric
+	}
+	return hook.Type
+}
+
+// redact strips credentials and query strings from URLs in error messages
+func redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "(invalid url)"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotify(t *testing.T) {
+	type request struct {
+		method, path, body, auth, title string
+	}
+	var received []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, request{r.Method, r.URL.Path, string(body), r.Header.Get("Authorization"), r.Header.Get("Title")})
+	}))
+	defer srv.Close()
+
+	n := New([]models.WebhookConfig{
+		{Type: TypeGeneric, URL: srv.URL + "/hook", On: []string{OnSuccess}},
+		{Type: TypeNtfy, URL: srv.URL + "/topic"},
+		{Type: TypeMatrix, URL: srv.URL, Room: "!room:example.org", Token: "secret", On: []string{OnFailure}},
+	})
+
+	errs := n.Notify(context.Background(), Event{Status: OnSuccess, Duration: 2 * time.Second, TotalRules: 42})
+	require.Empty(t, errs)
+	require.Len(t, received, 2)
+
+	var ev Event
+	require.NoError(t, json.Unmarshal([]byte(received[0].body), &ev))
+	assert.Equal(t, 42, ev.TotalRules)
+	assert.Equal(t, "/topic", received[1].path)
+	assert.Equal(t, "ublock-webkit-filters build success", received[1].title)
+
+	received = nil
+	errs = n.Notify(context.Background(), Event{Status: OnFailure, Error: "fetch failed"})
+	require.Empty(t, errs)
+	require.Len(t, received, 2)
+	assert.Equal(t, http.MethodPut, received[1].method)
+	assert.True(t, strings.HasPrefix(received[1].path, "/_matrix/client/v3/rooms/!room:example.org/send/m.room.message/"))
+	assert.Equal(t, "Bearer secret", received[1].auth)
+	assert.Contains(t, received[1].body, "fetch failed")
+}
+
+func TestSummaryListsAnomalies(t *testing.T) {
+	ev := Event{Status: OnSuccess, Duration: time.Second, TotalRules: 42, Anomalies: []string{"easylist shrank: 90 rules, was 900 (-90%)"}}
+	assert.Equal(t, "Filter build succeeded in 1s: 42 combined rules\nList anomalies: easylist shrank: 90 rules, was 900 (-90%)", ev.Summary())
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// Span is the byte range [Start, End) of a token within a filter line
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Option is a single $option of a network filter, as written
+type Option struct {
+	Name    string // without negation or value, e.g. "third-party", "domain"
+	Value   string // after "=", "" if none
+	Negated bool   // written with a leading ~
+	HasArg  bool   // written with "=", even if the value is empty
+	Raw     string // the whole option, e.g. "~third-party", "domain=a.com"
+	Span    Span
+}
+
+// NetworkNode is a network filter line split into its pattern and options,
+// each with its position, so rejections can point at the token responsible
+type NetworkNode struct {
+	Exception bool // @@ prefix
+	Pattern   string
+	PatternAt Span
+	Options   []Option
+}
+
+// parseNetworkNode tokenizes a network filter line, including any @@
+func parseNetworkNode(line string) NetworkNode {
+	var node NetworkNode
+	start := 0
+	if strings.HasPrefix(line, "@@") {
+		node.Exception = true
+		start = 2
+	}
+	end := len(line)
+
+	// Split pattern and options
+	if idx := strings.LastIndex(line, "$"); idx >= start {
+		// Check it's not escaped or part of regex, e.g. /ads$/ or an anchor
+		// followed by more of the regex, e.g. /^ads$|^track/
+		inRegex := strings.HasPrefix(strings.TrimLeft(line[start:], "|"), "/") &&
+			!strings.HasSuffix(strings.TrimRight(line[start:idx], "|"), "/") &&
+			strings.Contains(line[idx+1:], "/")
+		if (idx == start || line[idx-1] != '\\') && !strings.HasPrefix(line[idx+1:], "/") && !inRegex {
+			end = idx
+			node.Options = parseOptionList(line, idx+1)
+		}
+	}
+	node.Pattern = line[start:end]
+	node.PatternAt = Span{start, end}
+	return node
+}
+
+// parseOptionList splits the comma-separated options starting at offset
+func parseOptionList(line string, offset int) []Option {
+	var options []Option
+	for offset <= len(line) {
+		next := strings.IndexByte(line[offset:], ',')
+		if next == -1 {
+			next = len(line) - offset
+		}
+		raw := line[offset : offset+next]
+		trimmed := strings.TrimSpace(raw)
+		if trimmed != "" {
+			at := offset + strings.Index(raw, trimmed)
+			options = append(options, newOption(trimmed, Span{at, at + len(trimmed)}))
+		}
+		offset += next + 1
+	}
+	return options
+}
+
+// newOption splits a single option into negation, name and value
+func newOption(raw string, span Span) Option {
+	opt := Option{Raw: raw, Span: span}
+	name := raw
+	if rest, ok := strings.CutPrefix(name, "~"); ok {
+		opt.Negated = true
+		name = rest
+	}
+	opt.Name, opt.Value, opt.HasArg = strings.Cut(name, "=")
+	return opt
+}
+
+// Diagnostic locates the token a filter was skipped for
+type Diagnostic struct {
+	Line   int               `json:"line"` // 1-based line in the list
+	Reason models.SkipReason `json:"reason"`
+	Detail string            `json:"detail,omitempty"` // option, scriptlet or operator name
+	Span   Span              `json:"span"`             // within Text
+	Text   string            `json:"text"`
+}
+
+// String formats the diagnostic on a single line
+func (d Diagnostic) String() string {
+	what := d.Reason.Description()
+	if d.Detail != "" {
+		what += ": " + d.Detail
+	}
+	return fmt.Sprintf("line %d, col %d: %s", d.Line, d.Span.Start+1, what)
+}
+
+// Caret returns the filter with the offending token underlined below it
+func (d Diagnostic) Caret() string {
+	width := max(d.Span.End-d.Span.Start, 1)
+	return d.Text + "\n" + strings.Repeat(" ", d.Span.Start) + strings.Repeat("^", width)
+}
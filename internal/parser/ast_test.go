@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetworkNode(t *testing.T) {
+	line := "@@||ads.example.com^$script, ~third-party,domain=a.com|~b.a.com"
+	node := parseNetworkNode(line)
+	assert.True(t, node.Exception)
+	assert.Equal(t, "||ads.example.com^", node.Pattern)
+	assert.Equal(t, node.Pattern, line[node.PatternAt.Start:node.PatternAt.End])
+
+	require.Len(t, node.Options, 3)
+	for _, o := range node.Options {
+		assert.Equal(t, o.Raw, line[o.Span.Start:o.Span.End])
+	}
+	assert.Equal(t, Option{Name: "third-party", Negated: true, Raw: "~third-party", Span: Span{29, 41}}, node.Options[1])
+	assert.Equal(t, "domain", node.Options[2].Name)
+	assert.Equal(t, "a.com|~b.a.com", node.Options[2].Value)
+
+	// A trailing $ of a regex is not an option separator
+	node = parseNetworkNode("/ads$/")
+	assert.Equal(t, "/ads$/", node.Pattern)
+	assert.Empty(t, node.Options)
+
+	// Nor one followed by more of the regex
+	node = parseNetworkNode("/^ads$|^track/")
+	assert.Equal(t, "/^ads$|^track/", node.Pattern)
+	assert.Empty(t, node.Options)
+
+	node = parseNetworkNode("|/^ads$|^track/|$script,match-case")
+	assert.Equal(t, "|/^ads$|^track/|", node.Pattern)
+	require.Len(t, node.Options, 2)
+	assert.Equal(t, "match-case", node.Options[1].Name)
+}
+
+func TestDiagnosticsPointAtOption(t *testing.T) {
+	p := New()
+	_, err := p.Parse(strings.NewReader("! Title: test\n||ads.example.com^$script,redirect=noop.js,important\nexample.com##+js(set-constant, a, 1)\n"))
+	require.NoError(t, err)
+
+	diags := p.Stats().Diagnostics
+	require.Len(t, diags, 2)
+	assert.Equal(t, 2, diags[0].Line)
+	assert.Equal(t, models.SkipUnsupportedOption, diags[0].Reason)
+	assert.Equal(t, "redirect", diags[0].Detail)
+	assert.Equal(t, "redirect=noop.js", diags[0].Text[diags[0].Span.Start:diags[0].Span.End])
+	assert.Equal(t, "line 2, col 27: unsupported option (redirect, csp, etc): redirect", diags[0].String())
+	assert.Equal(t, "||ads.example.com^$script,redirect=noop.js,important\n"+
+		"                          ^^^^^^^^^^^^^^^^", diags[0].Caret())
+
+	assert.Equal(t, 3, diags[1].Line)
+	assert.Equal(t, "set-constant", diags[1].Detail)
+	assert.Equal(t, "##+js(set-constant, a, 1)", diags[1].Text[diags[1].Span.Start:])
+}
@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"hash/fnv"
+	"slices"
+	"strings"
+)
+
+// FilterSet holds hashes of raw filter lines, for dropping filters an
+// earlier list already provides
+type FilterSet map[uint64]struct{}
+
+// Add adds filter hashes to the set
+func (s FilterSet) Add(hashes ...uint64) {
+	for _, h := range hashes {
+		s[h] = struct{}{}
+	}
+}
+
+// HashFilter hashes a trimmed filter line. The hash is stable across runs,
+// so the hashes of cached lists can be stored with them.
+func HashFilter(line string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(line))
+	return h.Sum64()
+}
+
+// SkipKnown makes the parser drop blocking filters found in known, the
+// filters of earlier lists. Exceptions are always kept, they only lift
+// rules that come before them in the combined output.
+func (p *Parser) SkipKnown(known FilterSet) {
+	p.known = known
+}
+
+// Hashes returns the hashes of the filter lines parsed so far, sorted
+func (p *Parser) Hashes() []uint64 {
+	hashes := make([]uint64, 0, len(p.seen))
+	for h := range p.seen {
+		hashes = append(hashes, h)
+	}
+	slices.Sort(hashes)
+	return hashes
+}
+
+// duplicate reports whether line repeats a filter of this list or, unless
+// an exception, one of an earlier list, counting it
+func (p *Parser) duplicate(line string) bool {
+	if line[0] == '!' || line[0] == '[' {
+		return false // comments
+	}
+	h := HashFilter(line)
+	if _, ok := p.seen[h]; ok {
+		p.stats.Duplicates++
+		return true
+	}
+	if _, ok := p.known[h]; ok && !isException(line) {
+		p.stats.Known++
+		return true
+	}
+	p.seen[h] = struct{}{}
+	return false
+}
+
+// isException reports whether line is a network or cosmetic exception
+func isException(line string) bool {
+	return strings.HasPrefix(line, "@@") || strings.Contains(line, "#@#")
+}
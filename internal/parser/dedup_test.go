@@ -0,0 +1,34 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDropsDuplicates(t *testing.T) {
+	p := New()
+	filters, err := p.Parse(strings.NewReader("! a\n! a\n||ads.example.com^\n  ||ads.example.com^\n##.ad\n##.ad\n"))
+	require.NoError(t, err)
+	assert.Len(t, filters, 2)
+	assert.Equal(t, 2, p.Stats().Duplicates)
+	assert.Equal(t, 2, p.Stats().Comments) // comments are kept apart
+	assert.Len(t, p.Hashes(), 2)
+
+	// Blocking filters of earlier lists are dropped, exceptions kept
+	known := make(FilterSet)
+	known.Add(p.Hashes()...)
+	known.Add(HashFilter("@@||ads.example.com/ok"), HashFilter("example.com#@#.ad"))
+	p = New()
+	p.SkipKnown(known)
+	filters, err = p.Parse(strings.NewReader("||ads.example.com^\n@@||ads.example.com/ok\nexample.com#@#.ad\n||tracker.example.org^\n"))
+	require.NoError(t, err)
+	require.Len(t, filters, 3)
+	assert.Equal(t, models.FilterTypeException, filters[0].Type)
+	assert.Equal(t, models.FilterTypeCosmeticException, filters[1].Type)
+	assert.Equal(t, 1, p.Stats().Known)
+	assert.Zero(t, p.Stats().Duplicates)
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// LookupEncoding resolves a list encoding from config: "" and "auto" return
+// nil (detect), anything else must be a WHATWG label such as windows-1251,
+// iso-8859-2, shift_jis or utf-16le
+func LookupEncoding(name string) (encoding.Encoding, error) {
+	if name == "" || name == "auto" {
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	return enc, nil
+}
+
+// TextReader reads a list as UTF-8 with LF line endings, whatever byte
+// order mark, line endings and encoding it was served with
+type TextReader struct {
+	r          *bufio.Reader
+	fallback   bool   // read invalid UTF-8 lines as windows-1252
+	buf        []byte // normalized text not yet returned
+	err        error
+	transcoded int
+}
+
+// NewTextReader decodes r from enc, or with a nil enc from UTF-8, where a
+// UTF-8 or UTF-16 byte order mark is honored and lines that aren't valid
+// UTF-8 are read as windows-1252 (covering latin-1). A byte order mark
+// always overrides enc.
+func NewTextReader(r io.Reader, enc encoding.Encoding) *TextReader {
+	fallback := enc == nil
+	dec := transform.Transformer(transform.Nop)
+	if enc != nil {
+		dec = enc.NewDecoder()
+	}
+	return &TextReader{
+		r:        bufio.NewReader(transform.NewReader(r, unicode.BOMOverride(dec))),
+		fallback: fallback,
+	}
+}
+
+// Read returns normalized text
+func (t *TextReader) Read(p []byte) (int, error) {
+	for len(t.buf) == 0 {
+		if t.err != nil {
+			return 0, t.err
+		}
+		t.fill()
+	}
+	n := copy(p, t.buf)
+	t.buf = t.buf[n:]
+	return n, nil
+}
+
+// Transcoded returns how many lines were not UTF-8 and read as windows-1252
+func (t *TextReader) Transcoded() int {
+	return t.transcoded
+}
+
+// fill normalizes the next line into buf
+func (t *TextReader) fill() {
+	line, err := t.r.ReadBytes('\n')
+	t.err = err
+
+	// CRLF and lone CR (classic Mac) both end a line
+	if bytes.IndexByte(line, '\r') != -1 {
+		line = bytes.ReplaceAll(line, []byte("\r\n"), []byte("\n"))
+		line = bytes.ReplaceAll(line, []byte("\r"), []byte("\n"))
+	}
+	if t.fallback && !utf8.Valid(line) {
+		if decoded, err := charmap.Windows1252.NewDecoder().Bytes(line); err == nil {
+			line = decoded
+			t.transcoded++
+		}
+	}
+	t.buf = line
+}
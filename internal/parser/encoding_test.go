@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextReader(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		encoding   string
+		want       string
+		transcoded int
+	}{
+		{name: "utf-8 bom", input: "\xef\xbb\xbf||ads.example.com^\n", want: "||ads.example.com^\n"},
+		{name: "crlf", input: "||a.com^\r\n||b.com^\r\n", want: "||a.com^\n||b.com^\n"},
+		{name: "cr", input: "||a.com^\r||b.com^\r", want: "||a.com^\n||b.com^\n"},
+		{name: "utf-16le bom", input: "\xff\xfe|\x00|\x00a\x00.\x00d\x00e\x00\r\x00\n\x00", want: "||a.de\n"},
+		{name: "utf-16be bom", input: "\xfe\xff\x00|\x00|\x00a\x00.\x00d\x00e\x00\n", want: "||a.de\n"},
+		{name: "latin-1 line", input: "! caf\xe9\n||\xfcber.de^\n||ok.de^\n", want: "! café\n||über.de^\n||ok.de^\n", transcoded: 2},
+		{name: "utf-8 untouched", input: "! café\n", want: "! café\n"},
+		{name: "windows-1251", input: "! \xcf\xf0\xe8\xe2\xe5\xf2\n", encoding: "windows-1251", want: "! Привет\n"},
+		{name: "bom overrides label", input: "\xef\xbb\xbf! café\n", encoding: "windows-1251", want: "! café\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := LookupEncoding(tt.encoding)
+			require.NoError(t, err)
+			r := NewTextReader(strings.NewReader(tt.input), enc)
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+			assert.Equal(t, tt.transcoded, r.Transcoded())
+		})
+	}
+}
+
+func TestTextReaderParses(t *testing.T) {
+	p := New()
+	filters, err := p.Parse(NewTextReader(strings.NewReader("\xef\xbb\xbf||ads.example.com^$script\r||b.com^\r"), nil))
+	require.NoError(t, err)
+	require.Len(t, filters, 2)
+	assert.Equal(t, "||ads.example.com^", filters[0].Pattern)
+	assert.Equal(t, "||b.com^", filters[1].Pattern)
+}
+
+func TestLookupEncoding(t *testing.T) {
+	enc, err := LookupEncoding("auto")
+	require.NoError(t, err)
+	assert.Nil(t, enc)
+	_, err = LookupEncoding("klingon")
+	assert.Error(t, err)
+}
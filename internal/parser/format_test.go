@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectFormat(t *testing.T) {
+	for name, tc := range map[string]struct {
+		list string
+		want Format
+	}{
+		"adblock header":   {"[Adblock Plus 2.0]\n! Title: EasyList\n||ads.example.com^\n", FormatAdblock},
+		"adblock filters":  {"||ads.example.com^$third-party\nexample.com##.ad\n@@||cdn.example.com^\n", FormatAdblock},
+		"adblock selector": {"example.com##div[class=\"ad banner\"]\n", FormatAdblock},
+		"hosts":            {"# Peter Lowe's list\n127.0.0.1 localhost\n0.0.0.0 ads.example.com\n0.0.0.0 tracker.example.org # inline\n", FormatHosts},
+		"hosts ipv6":       {"::1 localhost\n:: ads.example.com\n:: tracker.example.org\n", FormatHosts},
+		"hosts tabs":       {"127.0.0.1\tads.example.com\n127.0.0.1\ttracker.example.org\n", FormatHosts},
+		"webkit json":      {`[{"trigger": {"url-filter": "ads"}, "action": {"type": "block"}}]`, FormatWebKitJSON},
+		"webkit json bom":  {"\xef\xbb\xbf\n  [ {\"action\": {\"type\": \"block\"}, \"trigger\": {\"url-filter\": \"ads\"}} ]", FormatWebKitJSON},
+		"empty json":       {"[]", FormatWebKitJSON},
+		"html":             {"<!DOCTYPE html>\n<html><body>Rate limited</body></html>\n", FormatUnknown},
+		"xml":              {"<?xml version=\"1.0\"?>\n<error/>\n", FormatUnknown},
+		"prose":            {"This list has moved to a new address\nPlease update your subscription\n", FormatUnknown},
+		"empty":            {"\n\n", FormatUnknown},
+	} {
+		assert.Equal(t, tc.want, DetectFormat([]byte(tc.list)), name)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, f := range []Format{FormatAdblock, FormatHosts, FormatWebKitJSON} {
+		got, err := ParseFormat(f.String())
+		assert.NoError(t, err)
+		assert.Equal(t, f, got)
+	}
+	for _, name := range []string{"", "auto"} {
+		got, err := ParseFormat(name)
+		assert.NoError(t, err)
+		assert.Equal(t, FormatUnknown, got)
+	}
+	_, err := ParseFormat("dnsmasq")
+	assert.ErrorContains(t, err, `unknown list format "dnsmasq"`)
+}
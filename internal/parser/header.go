@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header holds the metadata comments at the top of a filter list, such as
+// "! Title: EasyList" and "! Expires: 4 days (update frequency)"
+type Header struct {
+	Title   string        `json:"title,omitempty"`
+	Version string        `json:"version,omitempty"`
+	Expires time.Duration `json:"expires,omitempty"` // how long the list stays current
+}
+
+// parse records the metadata of a header comment line
+func (h *Header) parse(line string) {
+	key, value, ok := strings.Cut(strings.TrimLeft(line, "!# "), ":")
+	if !ok {
+		return
+	}
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "title":
+		h.Title = value
+	case "version":
+		h.Version = value
+	case "expires":
+		h.Expires = ParseExpires(value)
+	}
+}
+
+// ParseExpires reads the period of an Expires header like uBlock Origin
+// does: a number of days, or of hours when followed by "h", 0 if invalid
+func ParseExpires(value string) time.Duration {
+	i := strings.IndexFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	if i == -1 {
+		i = len(value)
+	}
+	n, err := strconv.Atoi(value[:i])
+	if err != nil || n <= 0 {
+		return 0
+	}
+	if strings.HasPrefix(strings.TrimSpace(value[i:]), "h") {
+		return time.Duration(n) * time.Hour
+	}
+	return time.Duration(n) * 24 * time.Hour
+}
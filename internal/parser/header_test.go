@@ -0,0 +1,38 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHeader(t *testing.T) {
+	list := `[Adblock Plus 2.0]
+! Title: EasyList
+! Version: 202409011200
+! Expires: 4 days (update frequency)
+! Homepage: https://easylist.to/
+||ads.example.com^
+! Version: 1
+`
+	p := New()
+	_, err := p.Parse(strings.NewReader(list))
+	require.NoError(t, err)
+	assert.Equal(t, Header{Title: "EasyList", Version: "202409011200", Expires: 96 * time.Hour}, p.Stats().Header)
+}
+
+func TestParseExpires(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"4 days (update frequency)": 96 * time.Hour,
+		"1 day":                     24 * time.Hour,
+		"12 hours":                  12 * time.Hour,
+		"6h":                        6 * time.Hour,
+		"soon":                      0,
+		"0 days":                    0,
+	} {
+		assert.Equal(t, want, ParseExpires(value), value)
+	}
+}
@@ -0,0 +1,45 @@
+package parser
+
+import "strings"
+
+// localHosts are the names hosts files map to themselves, not blocked
+var localHosts = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+	"0.0.0.0":               true,
+}
+
+// hostsFilters rewrites a hosts file line as filter lines: an entry
+// becomes a ||host^ filter per hostname, a # comment a ! comment. Lines
+// that are neither are returned as they are, lists mixing in filters
+// exist.
+func hostsFilters(line string) []string {
+	if strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "##") && !strings.HasPrefix(line, "#@#") {
+		return []string{"!" + line[1:]}
+	}
+	if !reHostsEntry.MatchString(line) {
+		return []string{line}
+	}
+
+	var filters []string
+	for _, host := range strings.Fields(line)[1:] {
+		if strings.HasPrefix(host, "#") {
+			break // trailing comment
+		}
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if localHosts[host] || !strings.Contains(host, ".") {
+			continue
+		}
+		filters = append(filters, "||"+host+"^")
+	}
+	return filters
+}
@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHosts(t *testing.T) {
+	list := `# Title: Peter Lowe's Ad and tracking server list
+127.0.0.1 localhost
+::1 ip6-localhost ip6-loopback
+0.0.0.0 0.0.0.0
+0.0.0.0 Ads.Example.com
+0.0.0.0 tracker.example.org metrics.example.org # trackers
+127.0.0.1	ads.example.com.
+:: ipv6.example.net
+||mixed.example^
+`
+	p := New()
+	p.Hosts(true)
+	filters, err := p.Parse(strings.NewReader(list))
+	require.NoError(t, err)
+	var patterns []string
+	for _, f := range filters {
+		assert.Equal(t, models.FilterTypeNetwork, f.Type, f.Raw)
+		patterns = append(patterns, f.Pattern)
+	}
+	assert.Equal(t, []string{
+		"||ads.example.com^", "||tracker.example.org^", "||metrics.example.org^",
+		"||ipv6.example.net^", "||mixed.example^",
+	}, patterns)
+	assert.Equal(t, 1, p.Stats().Duplicates)
+	assert.Equal(t, "Peter Lowe's Ad and tracking server list", p.Stats().Header.Title)
+	assert.Zero(t, p.Stats().Unsupported)
+
+	// Read as adblock syntax, entries are not host filters
+	p = New()
+	filters, err = p.Parse(strings.NewReader(list))
+	require.NoError(t, err)
+	for _, f := range filters {
+		assert.NotEqual(t, "||ads.example.com^", f.Pattern)
+	}
+}
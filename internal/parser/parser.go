@@ -3,6 +3,7 @@ package parser
 import (
 	"bufio"
 	"io"
+	"slices"
 	"strings"
 
 	"github.com/bnema/ublock-webkit-filters/internal/models"
@@ -11,6 +12,15 @@ import (
 // Parser parses ABP/uBlock filter lists
 type Parser struct {
 	stats Stats
+	line  int                 // number of the line being parsed
+	seen  map[uint64]struct{} // filter lines of this list so far
+	known FilterSet           // filters of earlier lists, see SkipKnown
+	cond  conditions          // !#if blocks around the current line
+	body  bool                // past the header comments
+
+	unknownOptions string // policy for unrecognized options, "" = skip
+	salvage        bool   // strip unsupported options that only refine a block
+	hosts          bool   // read hosts file entries, see Hosts
 }
 
 // Stats tracks parsing statistics
@@ -21,72 +31,152 @@ type Stats struct {
 	Cosmetic    int
 	Comments    int
 	Unsupported int
-	SkipReasons map[string]int // Detailed breakdown of skipped filters
+	SkipReasons map[models.SkipReason]int      // Detailed breakdown of skipped filters
+	Samples     map[models.SkipReason][]string // First raw lines per skip reason
+	Coverage    models.Coverage                // Options of filters skipped while parsing
+	Patterns    models.SkipPatterns            // Skips by reason and scriptlet/operator/option
+	Diagnostics []Diagnostic                   // Where the first skips per reason went wrong
+	Duplicates  int                            // Repeated filter lines dropped
+	Known       int                            // Filters dropped as already in an earlier list
+	Excluded    int                            // Lines in !#if branches that do not apply
+
+	// Unrecognized options by name, counted whatever the policy
+	UnknownOptions map[string]int
+
+	Header Header // metadata comments before the first filter
 }
 
-// SkipReason constants
-const (
-	SkipScriptlet         = "scriptlet (##+js)"
-	SkipHTMLFilter        = "html-filter (##^)"
-	SkipProcedural        = "procedural (:has, :xpath, etc)"
-	SkipUnsupportedOpt    = "unsupported-option (redirect, csp, etc)"
-	SkipInvalidRegex      = "invalid-regex"
-	SkipCosmeticException = "cosmetic-exception (#@#)"
-)
-
 // New creates a new parser
 func New() *Parser {
 	return &Parser{
 		stats: Stats{
-			SkipReasons: make(map[string]int),
+			SkipReasons: make(map[models.SkipReason]int),
+			Samples:     make(map[models.SkipReason][]string),
+			Coverage:    make(models.Coverage),
+			Patterns:    make(models.SkipPatterns),
+
+			UnknownOptions: make(map[string]int),
 		},
+		seen: make(map[uint64]struct{}),
 	}
 }
 
-// skip records a skipped filter with reason
-func (p *Parser) skip(reason string) models.Filter {
+// skip records a skipped filter with reason, detail naming the scriptlet,
+// operator or option responsible and at its position in line
+func (p *Parser) skip(reason models.SkipReason, detail, line string, at Span) models.Filter {
 	p.stats.SkipReasons[reason]++
+	if len(p.stats.Samples[reason]) < models.MaxSkipSamples {
+		p.stats.Diagnostics = append(p.stats.Diagnostics, Diagnostic{
+			Line: p.line, Reason: reason, Detail: detail, Span: at, Text: line,
+		})
+	}
+	models.AddSkipSample(p.stats.Samples, reason, line)
+	p.stats.Patterns.Add(reason, detail, line)
 	return models.Filter{Type: models.FilterTypeUnsupported}
 }
 
+// UnknownOptions sets what happens to network filters with options the
+// parser does not recognize, one of the models.UnknownOption* policies.
+// Converting them without the option can make them much broader, e.g. a
+// misspelled $redirect-rule turns into an unconditional block.
+func (p *Parser) UnknownOptions(policy string) {
+	p.unknownOptions = policy
+}
+
+// SalvageOptions makes the parser keep blocking filters whose only
+// unsupported options are redirects, e.g. $script,redirect=noopjs: the
+// request is still blocked, without the neutered resource uBlock Origin
+// would serve in its place
+func (p *Parser) SalvageOptions(enabled bool) {
+	p.salvage = enabled
+}
+
+// Hosts makes the parser read the list as a hosts file: 0.0.0.0 example.com
+// blocks example.com as ||example.com^ would, # starts a comment
+func (p *Parser) Hosts(enabled bool) {
+	p.hosts = enabled
+}
+
 // Stats returns parsing statistics
 func (p *Parser) Stats() Stats {
 	return p.stats
 }
 
+// avgLineBytes is the typical length of a filter list line, used to
+// presize results from a size hint
+const avgLineBytes = 40
+
 // Parse reads filter content and returns parsed filters
 func (p *Parser) Parse(r io.Reader) ([]models.Filter, error) {
+	return p.ParseSized(r, -1)
+}
+
+// ParseSized is Parse for a stream expected to hold size bytes (-1 if
+// unknown), such as a download still arriving
+func (p *Parser) ParseSized(r io.Reader, size int64) ([]models.Filter, error) {
 	var filters []models.Filter
+	if size > 0 {
+		filters = make([]models.Filter, 0, size/avgLineBytes)
+	}
 	scanner := bufio.NewScanner(r)
 
 	for scanner.Scan() {
+		p.line++
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
 			continue
 		}
+		if !p.hosts {
+			filters = p.add(line, filters)
+			continue
+		}
+		for _, filter := range hostsFilters(line) {
+			filters = p.add(filter, filters)
+		}
+	}
+
+	return filters, scanner.Err()
+}
 
-		filter := p.parseLine(line)
+// add parses a non-empty line and appends the filter it holds to filters
+func (p *Parser) add(line string, filters []models.Filter) []models.Filter {
+	if p.cond.directive(line) {
 		p.stats.Total++
+		p.stats.Comments++
+		return filters
+	}
+	if !p.cond.active() {
+		p.stats.Excluded++
+		return filters
+	}
+	if p.duplicate(line) {
+		return filters
+	}
 
-		switch filter.Type {
-		case models.FilterTypeComment:
-			p.stats.Comments++
-			continue // skip comments
-		case models.FilterTypeUnsupported:
-			p.stats.Unsupported++
-			continue // skip unsupported
-		case models.FilterTypeNetwork:
-			p.stats.Network++
-		case models.FilterTypeException:
-			p.stats.Exception++
-		case models.FilterTypeCosmetic, models.FilterTypeCosmeticException:
-			p.stats.Cosmetic++
-		}
+	filter := p.parseLine(line)
+	p.stats.Total++
 
-		filters = append(filters, filter)
+	switch filter.Type {
+	case models.FilterTypeComment:
+		p.stats.Comments++
+		if !p.body {
+			p.stats.Header.parse(line)
+		}
+		return filters // skip comments
+	case models.FilterTypeUnsupported:
+		p.stats.Unsupported++
+		p.body = true
+		return filters // skip unsupported
+	case models.FilterTypeNetwork:
+		p.stats.Network++
+	case models.FilterTypeException:
+		p.stats.Exception++
+	case models.FilterTypeCosmetic, models.FilterTypeCosmeticException:
+		p.stats.Cosmetic++
 	}
 
-	return filters, scanner.Err()
+	p.body = true
+	return append(filters, filter)
 }
 
 // parseLine parses a single filter line
@@ -97,18 +187,18 @@ func (p *Parser) parseLine(line string) models.Filter {
 	}
 
 	// Scriptlet injection - unsupported
-	if strings.Contains(line, "##+js(") || strings.Contains(line, "#@#+js(") {
-		return p.skip(SkipScriptlet)
+	if idx := indexAny(line, "##+js(", "#@#+js("); idx != -1 {
+		return p.skip(models.SkipScriptlet, scriptletName(line), line, Span{idx, len(line)})
 	}
 
 	// HTML filtering - unsupported
-	if strings.Contains(line, "##^") || strings.Contains(line, "#@#^") {
-		return p.skip(SkipHTMLFilter)
+	if idx := indexAny(line, "##^", "#@#^"); idx != -1 {
+		return p.skip(models.SkipHTMLFilter, "", line, Span{idx, len(line)})
 	}
 
 	// Procedural cosmetic filters - unsupported
-	if containsProcedural(line) {
-		return p.skip(SkipProcedural)
+	if op, idx := proceduralOperator(line); op != "" {
+		return p.skip(models.SkipProcedural, op, line, Span{idx, idx + len(op) + 1})
 	}
 
 	// Cosmetic filters
@@ -121,28 +211,45 @@ func (p *Parser) parseLine(line string) models.Filter {
 		return p.parseCosmetic(line, idx, true)
 	}
 
-	// Exception rules (whitelist)
-	if strings.HasPrefix(line, "@@") {
-		return p.parseNetwork(line[2:], true)
-	}
+	// Network filters and exception rules (whitelist)
+	return p.parseNetwork(line)
+}
 
-	// Network filters
-	return p.parseNetwork(line, false)
+// indexAny returns the first index of any of the substrings, -1 if none
+// occurs, trying them in order
+func indexAny(line string, substrs ...string) int {
+	for _, sub := range substrs {
+		if idx := strings.Index(line, sub); idx != -1 {
+			return idx
+		}
+	}
+	return -1
 }
 
-// containsProcedural checks for procedural cosmetic filter syntax
-func containsProcedural(line string) bool {
+// proceduralOperator returns the procedural cosmetic operator a line uses
+// (has-text, xpath, ...) and where it starts, "" if none
+func proceduralOperator(line string) (string, int) {
 	procedural := []string{
 		":has(", ":has-text(", ":xpath(", ":matches-css(",
 		":matches-attr(", ":min-text-length(", ":not(",
 		":upward(", ":remove(", ":style(",
 	}
 	for _, p := range procedural {
-		if strings.Contains(line, p) {
-			return true
+		if idx := strings.Index(line, p); idx != -1 {
+			return p[1 : len(p)-1], idx
 		}
 	}
-	return false
+	return "", -1
+}
+
+// scriptletName returns the scriptlet a ##+js(...) filter injects
+func scriptletName(line string) string {
+	_, args, ok := strings.Cut(line, "+js(")
+	if !ok {
+		return ""
+	}
+	name, _, _ := strings.Cut(args, ",")
+	return strings.TrimSpace(strings.TrimSuffix(name, ")"))
 }
 
 // parseCosmetic parses a cosmetic (CSS) filter
@@ -170,38 +277,41 @@ func (p *Parser) parseCosmetic(line string, sepIdx int, isException bool) models
 	}
 }
 
-// parseNetwork parses a network filter
-func (p *Parser) parseNetwork(line string, isException bool) models.Filter {
+// parseNetwork parses a network filter, an exception if it starts with @@
+func (p *Parser) parseNetwork(line string) models.Filter {
+	node := parseNetworkNode(line)
 	filterType := models.FilterTypeNetwork
-	if isException {
+	raw := line
+	if node.Exception {
 		filterType = models.FilterTypeException
+		raw = line[2:]
 	}
 
-	pattern := line
-	var options models.FilterOptions
+	options := parseOptions(node.Options)
 
-	// Split pattern and options
-	if idx := strings.LastIndex(line, "$"); idx != -1 {
-		// Check it's not escaped or part of regex
-		if idx == 0 || line[idx-1] != '\\' {
-			optPart := line[idx+1:]
-			// Skip if it looks like a regex end anchor
-			if !strings.HasPrefix(optPart, "/") {
-				pattern = line[:idx]
-				options = parseOptions(optPart)
+	// Check for unsupported options
+	if opt, ok := unsupportedOption(node.Options); ok {
+		if !p.salvage || !salvageable(node) {
+			p.stats.Coverage.Record(options.Names, models.OutcomeSkipped)
+			return p.skip(models.SkipUnsupportedOption, opt.Name, line, opt.Span)
+		}
+		options.Salvaged = true
+	}
 
-				// Check for unsupported options
-				if hasUnsupportedOptions(optPart) {
-					return p.skip(SkipUnsupportedOpt)
-				}
-			}
+	if unknown := unknownOptions(node.Options); len(unknown) > 0 {
+		for _, o := range unknown {
+			p.stats.UnknownOptions[o.Name]++
+		}
+		if p.unknownOptions == "" || p.unknownOptions == models.UnknownOptionSkip {
+			p.stats.Coverage.Record(options.Names, models.OutcomeSkipped)
+			return p.skip(models.SkipUnknownOption, unknown[0].Name, line, unknown[0].Span)
 		}
 	}
 
 	return models.Filter{
 		Type:    filterType,
-		Raw:     line,
-		Pattern: pattern,
+		Raw:     raw,
+		Pattern: node.Pattern,
 		Options: options,
 	}
 }
@@ -222,35 +332,47 @@ func parseDomainList(s string) []string {
 	return domains
 }
 
-// parseOptions parses network filter options
-func parseOptions(s string) models.FilterOptions {
+// parseOptions maps network filter options to what the converter models
+func parseOptions(options []Option) models.FilterOptions {
 	var opts models.FilterOptions
-	parts := strings.Split(s, ",")
 
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if part == "" {
-			continue
-		}
+	for _, o := range options {
+		opts.Names = append(opts.Names, models.OptionName(o.Raw))
 
 		switch {
-		case part == "third-party" || part == "3p":
-			t := true
+		case o.Name == "third-party" || o.Name == "3p":
+			t := !o.Negated
 			opts.ThirdParty = &t
-		case part == "~third-party" || part == "~3p" || part == "first-party" || part == "1p":
+		case (o.Name == "first-party" || o.Name == "1p") && !o.Negated:
 			f := false
 			opts.ThirdParty = &f
-		case part == "match-case":
+		case o.Raw == "strict1p" || o.Raw == "strict3p":
+			t := o.Raw == "strict3p"
+			opts.ThirdParty = &t
+			opts.StrictParty = true
+		case o.Raw == "match-case":
 			opts.MatchCase = true
-		case part == "important":
+		case o.Raw == "important":
 			opts.Important = true
-		case strings.HasPrefix(part, "domain="):
-			opts.Domains, opts.ExcludeDomains = parseDomainOption(part[7:])
+		case o.Raw == "inline-script":
+			opts.InlineScript = true
+		case o.Raw == "inline-font":
+			opts.InlineFont = true
+		case o.Name == "removeparam" && !o.Negated:
+			opts.RemoveParam = "*"
+			if o.HasArg {
+				opts.RemoveParam = o.Value
+			}
+		case o.Name == "domain" && o.HasArg && !o.Negated:
+			opts.Domains, opts.ExcludeDomains = parseDomainOption(o.Value)
 		default:
 			// Check if it's a resource type
-			if rt := mapResourceType(part); rt != "" {
+			if rt := mapResourceType(o.Raw); rt != "" {
 				opts.ResourceTypes = append(opts.ResourceTypes, rt)
 			}
+			if ctx := mapLoadContext(o.Raw); ctx != "" && !slices.Contains(opts.LoadContexts, ctx) {
+				opts.LoadContexts = append(opts.LoadContexts, ctx)
+			}
 		}
 	}
 
@@ -310,18 +432,78 @@ func mapResourceType(s string) string {
 	return ""
 }
 
-// hasUnsupportedOptions checks for options that can't be converted
-func hasUnsupportedOptions(s string) bool {
-	unsupported := []string{
-		"redirect=", "redirect-rule=",
-		"csp=", "removeparam=", "replace=",
-		"header=", "method=", "to=",
-		"permissions=", "uritransform=",
-	}
-	for _, u := range unsupported {
-		if strings.Contains(s, u) {
-			return true
+// mapLoadContext returns the frame a frame-targeted type applies to
+func mapLoadContext(s string) string {
+	switch s {
+	case "subdocument", "frame":
+		return models.LoadContextChildFrame
+	case "document", "doc", "popup":
+		return models.LoadContextTopFrame
+	}
+	return ""
+}
+
+// unsupportedOptions can't be converted when given a value
+var unsupportedOptions = []string{
+	"redirect", "redirect-rule",
+	"csp", "replace",
+	"header", "method", "to",
+	"permissions", "uritransform",
+}
+
+// knownOptions are the uBlock Origin, Adblock Plus and AdGuard options
+// besides resource types, whether this tool converts them or not
+var knownOptions = []string{
+	"third-party", "3p", "first-party", "1p", "strict1p", "strict3p",
+	"domain", "from", "to", "denyallow", "match-case", "important", "badfilter",
+	"all", "popunder", "webrtc", "inline-script", "inline-font",
+	"elemhide", "ehide", "generichide", "ghide", "specifichide", "shide",
+	"genericblock", "document", "doc", "cname", "ipaddress",
+	"redirect", "redirect-rule", "rewrite", "empty", "mp4",
+	"removeparam", "queryprune", "csp", "replace", "header", "method",
+	"permissions", "uritransform", "urlskip", "reason", "sitekey",
+}
+
+// unknownOptions returns the options neither known nor a resource type.
+// Underscores alone are uBlock Origin's no-op option.
+func unknownOptions(options []Option) []Option {
+	var unknown []Option
+	for _, o := range options {
+		if slices.Contains(knownOptions, o.Name) || mapResourceType(o.Name) != "" || strings.Trim(o.Name, "_") == "" {
+			continue
+		}
+		unknown = append(unknown, o)
+	}
+	return unknown
+}
+
+// salvageableOptions block the request themselves, so dropping them leaves
+// a plain block. The others must stay skipped: exceptions of them, and
+// redirect-rule, csp or replace, lift or modify rather than block, while
+// header, method and to narrow the filter down.
+var salvageableOptions = []string{"redirect"}
+
+// salvageable reports whether a filter can be converted without its
+// unsupported options
+func salvageable(node NetworkNode) bool {
+	if node.Exception {
+		return false
+	}
+	for _, o := range node.Options {
+		if o.HasArg && slices.Contains(unsupportedOptions, o.Name) && !slices.Contains(salvageableOptions, o.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// unsupportedOption returns the first option that can't be converted
+// (redirect=, csp=, ...)
+func unsupportedOption(options []Option) (Option, bool) {
+	for _, o := range options {
+		if o.HasArg && slices.Contains(unsupportedOptions, o.Name) {
+			return o, true
 		}
 	}
-	return false
+	return Option{}, false
 }
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUnknownOptions(t *testing.T) {
+	list := "||ads.example.com^$redirect-rul=noop.js\n||cdn.example.com^$script,~xhr,1p,___\n/pixel.$image,foo,foo\n"
+
+	// Skipped by default, like uBlock Origin does
+	p := New()
+	filters, err := p.Parse(strings.NewReader(list))
+	require.NoError(t, err)
+	require.Len(t, filters, 1)
+	assert.Equal(t, "||cdn.example.com^", filters[0].Pattern)
+	assert.Equal(t, 2, p.Stats().SkipReasons[models.SkipUnknownOption])
+	assert.Equal(t, map[string]int{"redirect-rul": 1, "foo": 2}, p.Stats().UnknownOptions)
+	require.NotEmpty(t, p.Stats().Diagnostics)
+	assert.Equal(t, "line 1, col 20: unknown option: redirect-rul", p.Stats().Diagnostics[0].String())
+
+	// Converted without them otherwise, still counted
+	for _, policy := range []string{models.UnknownOptionWarn, models.UnknownOptionIgnore} {
+		p := New()
+		p.UnknownOptions(policy)
+		filters, err := p.Parse(strings.NewReader(list))
+		require.NoError(t, err)
+		require.Len(t, filters, 3, policy)
+		for _, f := range filters {
+			assert.Equal(t, models.FilterTypeNetwork, f.Type, policy)
+		}
+		assert.Equal(t, []string{models.ResourceImage}, filters[2].Options.ResourceTypes, policy)
+		assert.Zero(t, p.Stats().SkipReasons[models.SkipUnknownOption], policy)
+		assert.Equal(t, map[string]int{"redirect-rul": 1, "foo": 2}, p.Stats().UnknownOptions, policy)
+	}
+}
+
+func TestParseSalvageOptions(t *testing.T) {
+	list := "||ads.example.com/ad.js$script,redirect=noopjs\n@@||ads.example.com/ad.js$redirect=noopjs\n||cdn.example.com^$redirect-rule=noopjs\n||cdn.example.com^$redirect=noopjs,csp=script-src 'none'\n"
+
+	p := New()
+	filters, err := p.Parse(strings.NewReader(list))
+	require.NoError(t, err)
+	assert.Empty(t, filters)
+	assert.Equal(t, 4, p.Stats().SkipReasons[models.SkipUnsupportedOption])
+
+	// Only the block whose sole unsupported option is the redirect
+	p = New()
+	p.SalvageOptions(true)
+	filters, err = p.Parse(strings.NewReader(list))
+	require.NoError(t, err)
+	require.Len(t, filters, 1)
+	assert.Equal(t, "||ads.example.com/ad.js", filters[0].Pattern)
+	assert.Equal(t, []string{models.ResourceScript}, filters[0].Options.ResourceTypes)
+	assert.True(t, filters[0].Options.Salvaged)
+	assert.Equal(t, 3, p.Stats().SkipReasons[models.SkipUnsupportedOption])
+}
@@ -0,0 +1,122 @@
+package parser
+
+import "strings"
+
+// envTokens are the !#if tokens that hold for the converted rules. Lists
+// are read as uBlock Origin on Safari reads them: its own syntax, element
+// hiding through stylesheets, no HTML filtering. Any other token, such as
+// env_firefox or adguard, is false, as in uBO.
+var envTokens = map[string]bool{
+	"ext_ublock":          true,
+	"env_safari":          true,
+	"cap_user_stylesheet": true,
+}
+
+// branch is an enclosing !#if block
+type branch struct {
+	active bool // lines of the current branch apply
+	parent bool // the block itself is in an applying branch
+}
+
+// conditions tracks the nested !#if blocks around the line being parsed
+type conditions struct {
+	stack []branch
+}
+
+// active reports whether lines at the current position apply
+func (c *conditions) active() bool {
+	return len(c.stack) == 0 || c.stack[len(c.stack)-1].active
+}
+
+// directive handles a !#if, !#else or !#endif line and reports whether
+// line was one. Stray !#else and !#endif lines are ignored, a block left
+// open runs to the end of the list, as in uBO.
+func (c *conditions) directive(line string) bool {
+	switch {
+	case strings.HasPrefix(line, "!#if "):
+		parent := c.active()
+		c.stack = append(c.stack, branch{active: parent && evalCondition(line[len("!#if "):]), parent: parent})
+	case line == "!#else":
+		if n := len(c.stack); n > 0 {
+			c.stack[n-1].active = c.stack[n-1].parent && !c.stack[n-1].active
+		}
+	case line == "!#endif":
+		if n := len(c.stack); n > 0 {
+			c.stack = c.stack[:n-1]
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// evalCondition evaluates an !#if expression of tokens combined with !,
+// &&, || and parentheses. Malformed expressions are false.
+func evalCondition(expr string) bool {
+	e := condExpr{s: strings.TrimSpace(expr), ok: true}
+	v := e.or()
+	e.space()
+	return v && e.ok && e.s == ""
+}
+
+// condExpr is a recursive descent parser over the rest of an expression
+type condExpr struct {
+	s  string
+	ok bool
+}
+
+func (e *condExpr) space() {
+	e.s = strings.TrimLeft(e.s, " \t")
+}
+
+func (e *condExpr) or() bool {
+	v := e.and()
+	for e.space(); strings.HasPrefix(e.s, "||"); e.space() {
+		e.s = e.s[2:]
+		// Both sides are parsed whatever the value
+		v = e.and() || v
+	}
+	return v
+}
+
+func (e *condExpr) and() bool {
+	v := e.unary()
+	for e.space(); strings.HasPrefix(e.s, "&&"); e.space() {
+		e.s = e.s[2:]
+		v = e.unary() && v
+	}
+	return v
+}
+
+func (e *condExpr) unary() bool {
+	e.space()
+	switch {
+	case strings.HasPrefix(e.s, "!"):
+		e.s = e.s[1:]
+		return !e.unary()
+	case strings.HasPrefix(e.s, "("):
+		e.s = e.s[1:]
+		v := e.or()
+		e.space()
+		if !strings.HasPrefix(e.s, ")") {
+			e.ok = false
+			return false
+		}
+		e.s = e.s[1:]
+		return v
+	}
+
+	end := strings.IndexFunc(e.s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_')
+	})
+	if end == -1 {
+		end = len(e.s)
+	}
+	if end == 0 {
+		e.ok = false
+		return false
+	}
+	token := e.s[:end]
+	e.s = e.s[end:]
+	return envTokens[token]
+}
@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConditionals(t *testing.T) {
+	list := `||always.example^
+!#if env_safari
+||safari.example^
+!#if !ext_ubol
+||nested.example^
+!#else
+||ubol.example^
+!#endif
+!#else
+||not-safari.example^
+!#if ext_ublock
+||inside-false.example^
+!#else
+||else-inside-false.example^
+!#endif
+!#endif
+!#if env_firefox || (env_safari && !env_mobile)
+||compound.example^
+!#endif
+!#if adguard
+||adguard.example^
+!#else
+||not-adguard.example^
+!#endif
+!#if env_safari &&
+||malformed.example^
+!#endif
+!#endif
+||after-stray-endif.example^
+!#if false
+||unterminated.example^
+`
+	p := New()
+	filters, err := p.Parse(strings.NewReader(list))
+	require.NoError(t, err)
+
+	var patterns []string
+	for _, f := range filters {
+		patterns = append(patterns, f.Pattern)
+	}
+	assert.Equal(t, []string{
+		"||always.example^", "||safari.example^", "||nested.example^",
+		"||compound.example^", "||not-adguard.example^", "||after-stray-endif.example^",
+	}, patterns)
+	assert.Equal(t, 7, p.Stats().Excluded)
+}
+
+func TestEvalCondition(t *testing.T) {
+	for expr, want := range map[string]bool{
+		"env_safari":                        true,
+		"!env_safari":                       false,
+		"ext_ublock && cap_user_stylesheet": true,
+		"env_chromium || env_firefox":       false,
+		"!(env_firefox || env_chromium)":    true,
+		"((env_safari))":                    true,
+		"false":                             false,
+		"unknown_token":                     false,
+		"":                                  false,
+		"env_safari )":                      false,
+		"(env_safari":                       false,
+		"env_safari & ext_ublock":           false,
+	} {
+		assert.Equal(t, want, evalCondition(expr), expr)
+	}
+}
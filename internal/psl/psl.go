@@ -0,0 +1,281 @@
+package psl
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/idna"
+)
+
+// DefaultURL is the canonical location of the Public Suffix List
+const DefaultURL = "https://publicsuffix.org/list/public_suffix_list.dat"
+
+//go:embed public_suffix_list.dat
+var embedded []byte
+
+// Rule kinds, a suffix may carry several (e.g. kawasaki.jp and *.kawasaki.jp)
+const (
+	kindNormal uint8 = 1 << iota
+	kindWildcard
+	kindException
+	kindICANN
+)
+
+// List is a parsed Public Suffix List
+type List struct {
+	rules    map[string]uint8
+	entities []string
+}
+
+var (
+	defaultOnce sync.Once
+	defaultMu   sync.RWMutex
+	defaultList *List
+)
+
+// Default returns the active list, the embedded snapshot unless replaced by SetDefault
+func Default() *List {
+	defaultOnce.Do(func() {
+		l, err := Parse(bytes.NewReader(embedded))
+		if err != nil {
+			panic(fmt.Sprintf("psl: embedded list is invalid: %v", err))
+		}
+		defaultMu.Lock()
+		if defaultList == nil {
+			defaultList = l
+		}
+		defaultMu.Unlock()
+	})
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultList
+}
+
+// SetDefault replaces the list returned by Default (e.g. after a refresh)
+func SetDefault(l *List) {
+	defaultOnce.Do(func() {})
+	defaultMu.Lock()
+	defaultList = l
+	defaultMu.Unlock()
+}
+
+// LoadFile parses a list from disk
+func LoadFile(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads a list in the publicsuffix.org format
+func Parse(r io.Reader) (*List, error) {
+	l := &List{rules: make(map[string]uint8)}
+	scanner := bufio.NewScanner(r)
+	icann := false
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.Contains(line, "===BEGIN ICANN DOMAINS==="):
+			icann = true
+			continue
+		case strings.Contains(line, "===END ICANN DOMAINS==="):
+			icann = false
+			continue
+		case line == "" || strings.HasPrefix(line, "//"):
+			continue
+		}
+
+		// Only the first whitespace-delimited token is significant
+		if idx := strings.IndexAny(line, " \t"); idx != -1 {
+			line = line[:idx]
+		}
+
+		kind := kindNormal
+		switch {
+		case strings.HasPrefix(line, "!"):
+			kind = kindException
+			line = line[1:]
+		case strings.HasPrefix(line, "*."):
+			kind = kindWildcard
+			line = line[2:]
+		}
+
+		suffix, err := Normalize(line)
+		if err != nil {
+			continue
+		}
+		if icann {
+			kind |= kindICANN
+		}
+		l.rules[suffix] |= kind
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(l.rules) == 0 {
+		return nil, fmt.Errorf("psl: no rules found")
+	}
+
+	l.entities = l.buildEntitySuffixes()
+	return l, nil
+}
+
+// Len returns the number of distinct suffix entries
+func (l *List) Len() int {
+	return len(l.rules)
+}
+
+// Normalize lowercases a domain, strips surrounding dots and converts
+// internationalized labels to punycode
+func Normalize(domain string) (string, error) {
+	d := strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if d == "" {
+		return "", fmt.Errorf("empty domain")
+	}
+	return toASCII(d)
+}
+
+// toASCII maps each non-ASCII label of a domain with IDNA lookup rules and
+// converts it to its xn-- form. ASCII labels are left alone, so entities
+// (example.*) and other tokens filters use pass through.
+func toASCII(domain string) (string, error) {
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := idna.Lookup.ToASCII(label)
+		if err != nil {
+			return "", fmt.Errorf("label %q: %w", label, err)
+		}
+		labels[i] = encoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// PublicSuffix returns the public suffix of a normalized domain. known is
+// false when only the implicit "*" rule matched (unlisted TLD).
+func (l *List) PublicSuffix(domain string) (suffix string, known bool) {
+	labels := strings.Split(domain, ".")
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+		kind := l.rules[candidate]
+
+		if kind&kindException != 0 {
+			return strings.Join(labels[i+1:], "."), true
+		}
+		if kind&kindNormal != 0 {
+			return candidate, true
+		}
+		if i+1 < len(labels) && l.rules[strings.Join(labels[i+1:], ".")]&kindWildcard != 0 {
+			return candidate, true
+		}
+	}
+	return labels[len(labels)-1], false
+}
+
+// RegistrableDomain returns the eTLD+1 of a normalized domain
+func (l *List) RegistrableDomain(domain string) (string, bool) {
+	suffix, _ := l.PublicSuffix(domain)
+	if len(domain) <= len(suffix) {
+		return "", false
+	}
+	rest := domain[:len(domain)-len(suffix)-1]
+	if idx := strings.LastIndex(rest, "."); idx != -1 {
+		rest = rest[idx+1:]
+	}
+	return rest + "." + suffix, true
+}
+
+// IsValidDomain reports whether a normalized domain is syntactically valid,
+// ends in a listed public suffix and is not itself a public suffix
+func (l *List) IsValidDomain(domain string) bool {
+	if len(domain) > 253 || !validHostname(domain) {
+		return false
+	}
+	suffix, known := l.PublicSuffix(domain)
+	return known && len(domain) > len(suffix)
+}
+
+// validHostname checks LDH label syntax
+func validHostname(domain string) bool {
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// IsEntity reports whether d uses uBO's entity syntax (example.*)
+func IsEntity(d string) bool {
+	return strings.HasSuffix(d, ".*") && len(d) > 2
+}
+
+// ExpandEntity expands an entity (google.*) into concrete domains, one per
+// suffix returned by EntitySuffixes
+func (l *List) ExpandEntity(entity string) []string {
+	base := strings.TrimSuffix(entity, ".*")
+	result := make([]string, len(l.entities))
+	for i, suffix := range l.entities {
+		result[i] = base + "." + suffix
+	}
+	return result
+}
+
+// EntitySuffixes returns the suffixes used for entity expansion
+func (l *List) EntitySuffixes() []string {
+	return l.entities
+}
+
+// Legacy generic TLDs that entity domains are commonly registered under
+var entityGenericTLDs = map[string]bool{
+	"com": true, "net": true, "org": true, "info": true, "biz": true,
+}
+
+// buildEntitySuffixes selects the ICANN suffixes entity sites realistically
+// live under: country-code TLDs, legacy generic TLDs and the co./com.
+// second-level domains of ccTLDs. Expanding to every one of the thousands
+// of listed suffixes would bloat rules for no practical gain.
+func (l *List) buildEntitySuffixes() []string {
+	var result []string
+	for suffix, kind := range l.rules {
+		if kind&kindICANN == 0 || kind&kindNormal == 0 {
+			continue
+		}
+		labels := strings.Split(suffix, ".")
+		switch {
+		case len(labels) == 1 && (len(suffix) == 2 || entityGenericTLDs[suffix]):
+			result = append(result, suffix)
+		case len(labels) == 2 && len(labels[1]) == 2 && (labels[0] == "co" || labels[0] == "com"):
+			result = append(result, suffix)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
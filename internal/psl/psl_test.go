@@ -0,0 +1,80 @@
+package psl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicSuffix(t *testing.T) {
+	l := Default()
+
+	tests := []struct {
+		domain       string
+		suffix       string
+		registrable  string
+		expectValid  bool
+		expectListed bool
+	}{
+		{"example.com", "com", "example.com", true, true},
+		{"ads.example.co.uk", "co.uk", "example.co.uk", true, true},
+		{"foo.bar.ck", "bar.ck", "foo.bar.ck", true, true},
+		{"www.ck", "ck", "www.ck", true, true},
+		{"co.uk", "co.uk", "", false, true},
+		{"example.notatld", "notatld", "example.notatld", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			suffix, known := l.PublicSuffix(tt.domain)
+			assert.Equal(t, tt.suffix, suffix)
+			assert.Equal(t, tt.expectListed, known)
+
+			registrable, _ := l.RegistrableDomain(tt.domain)
+			assert.Equal(t, tt.registrable, registrable)
+			assert.Equal(t, tt.expectValid, l.IsValidDomain(tt.domain))
+		})
+	}
+}
+
+func TestIsValidDomainRejectsGarbage(t *testing.T) {
+	l := Default()
+	for _, d := range []string{"com", "localhost", "foo bar.com", "-bad.com", "a..com", "ex$ample.com"} {
+		assert.False(t, l.IsValidDomain(d), d)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Example.COM.", "example.com"},
+		{"bücher.de", "xn--bcher-kva.de"},
+		{"例え.jp", "xn--r8jz45g.jp"},
+		// IDNA mapping: width, ideographic full stop and deviations
+		{"ｅｘａｍｐｌｅ.com", "example.com"},
+		{"例え。jp", "xn--r8jz45g.jp"},
+		{"faß.de", "xn--fa-hia.de"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := Normalize(tt.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	_, err := Normalize("ex\u2028ample.com")
+	assert.Error(t, err, "disallowed code points are rejected")
+}
+
+func TestExpandEntity(t *testing.T) {
+	expanded := Default().ExpandEntity("google.*")
+
+	assert.Contains(t, expanded, "google.com")
+	assert.Contains(t, expanded, "google.de")
+	assert.Contains(t, expanded, "google.co.uk")
+	assert.NotContains(t, expanded, "google.blogspot.com")
+}
@@ -0,0 +1,234 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// s3Uploader uploads to S3-compatible storage using path-style requests
+// signed with AWS Signature Version 4
+type s3Uploader struct {
+	client    *http.Client
+	endpoint  string
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+}
+
+func (u *s3Uploader) Upload(ctx context.Context, key string, body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.URL.Path += "/" + u.bucket + "/" + key
+	req.URL.RawPath = awsEscapePath(req.URL.Path)
+	req.Header.Set("Content-Type", contentType)
+	u.sign(req, body, time.Now().UTC())
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+// sign adds SigV4 headers covering the path as sent, host, payload hash,
+// date and every other header already set
+func (u *s3Uploader) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if name != "Authorization" {
+			headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := slices.Sorted(maps.Keys(headers))
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + u.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+u.secretKey), day)
+	key = hmacSHA256(key, u.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.accessKey, scope, signedHeaders, signature))
+}
+
+// gcsUploader uploads through the Cloud Storage JSON API with an OAuth token
+type gcsUploader struct {
+	client   *http.Client
+	endpoint string
+	bucket   string
+	token    string
+}
+
+func (u *gcsUploader) Upload(ctx context.Context, key string, body []byte, contentType string) error {
+	endpoint := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		u.endpoint, url.PathEscape(u.bucket), url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+u.token)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+// webdavUploader uploads with PUT, creating collections with MKCOL as needed
+type webdavUploader struct {
+	client   *http.Client
+	baseURL  string
+	username string
+	password string
+	created  map[string]bool
+}
+
+func (u *webdavUploader) Upload(ctx context.Context, key string, body []byte, contentType string) error {
+	if err := u.mkcolAll(ctx, path.Dir(key)); err != nil {
+		return err
+	}
+
+	req, err := u.newRequest(ctx, http.MethodPut, key, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+// mkcolAll creates every collection along dir, tolerating existing ones
+func (u *webdavUploader) mkcolAll(ctx context.Context, dir string) error {
+	if dir == "." || dir == "/" || dir == "" {
+		return nil
+	}
+
+	current := ""
+	for _, segment := range strings.Split(dir, "/") {
+		current = path.Join(current, segment)
+		if u.created[current] {
+			continue
+		}
+
+		req, err := u.newRequest(ctx, "MKCOL", current+"/", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := u.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		// 405 Method Not Allowed means the collection already exists
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			if err := checkResponse(resp); err != nil {
+				return fmt.Errorf("MKCOL %s: %w", current, err)
+			}
+		}
+		u.created[current] = true
+	}
+	return nil
+}
+
+func (u *webdavUploader) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.baseURL+"/"+escapePath(key), body)
+	if err != nil {
+		return nil, err
+	}
+	if u.username != "" {
+		req.SetBasicAuth(u.username, u.password)
+	}
+	return req, nil
+}
+
+// escapePath escapes each segment of a slash-separated key
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// awsEscapePath percent-encodes a path as SigV4 expects (RFC 3986): every
+// byte but unreserved characters and slashes, with uppercase hex digits
+func awsEscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
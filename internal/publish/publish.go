@@ -0,0 +1,170 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/artifact"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// Backend names
+const (
+	BackendS3     = "s3"
+	BackendGCS    = "gcs"
+	BackendWebDAV = "webdav"
+)
+
+// Uploader stores a single object under a key relative to the configured prefix
+type Uploader interface {
+	Upload(ctx context.Context, key string, body []byte, contentType string) error
+}
+
+// Publisher uploads build artifacts from an output directory
+type Publisher struct {
+	uploader Uploader
+	prefix   string
+}
+
+// New creates a publisher for the configured backend
+func New(cfg models.PublishConfig) (*Publisher, error) {
+	client := &http.Client{Timeout: 5 * time.Minute}
+
+	var uploader Uploader
+	switch cfg.Backend {
+	case BackendS3:
+		accessKey := firstNonEmpty(cfg.AccessKey, os.Getenv("AWS_ACCESS_KEY_ID"))
+		secretKey := firstNonEmpty(cfg.SecretKey, os.Getenv("AWS_SECRET_ACCESS_KEY"))
+		if cfg.URL == "" || cfg.Bucket == "" || accessKey == "" || secretKey == "" {
+			return nil, fmt.Errorf("s3 publishing requires url, bucket and credentials")
+		}
+		uploader = &s3Uploader{
+			client:    client,
+			endpoint:  strings.TrimSuffix(cfg.URL, "/"),
+			bucket:    cfg.Bucket,
+			region:    firstNonEmpty(cfg.Region, "us-east-1"),
+			accessKey: accessKey,
+			secretKey: secretKey,
+		}
+	case BackendGCS:
+		token := firstNonEmpty(cfg.Token, os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"))
+		if cfg.Bucket == "" || token == "" {
+			return nil, fmt.Errorf("gcs publishing requires bucket and an access token")
+		}
+		uploader = &gcsUploader{
+			client:   client,
+			endpoint: firstNonEmpty(strings.TrimSuffix(cfg.URL, "/"), "https://storage.googleapis.com"),
+			bucket:   cfg.Bucket,
+			token:    token,
+		}
+	case BackendWebDAV:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webdav publishing requires url")
+		}
+		uploader = &webdavUploader{
+			client:   client,
+			baseURL:  strings.TrimSuffix(cfg.URL, "/"),
+			username: cfg.Username,
+			password: firstNonEmpty(cfg.Password, os.Getenv("WEBDAV_PASSWORD")),
+			created:  make(map[string]bool),
+		}
+	default:
+		return nil, fmt.Errorf("unknown publish backend %q (want s3, gcs or webdav)", cfg.Backend)
+	}
+
+	return &Publisher{
+		uploader: uploader,
+		prefix:   strings.Trim(cfg.Prefix, "/"),
+	}, nil
+}
+
+// Publish uploads every artifact below dir, including checksums.txt and
+// signatures, and returns the uploaded keys. The checksum listing is
+// generated if the build did not write one.
+func (p *Publisher) Publish(ctx context.Context, dir string) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(dir, artifact.ChecksumsFile)); os.IsNotExist(err) {
+		if err := artifact.WriteChecksums(dir); err != nil {
+			return nil, fmt.Errorf("writing checksums: %w", err)
+		}
+	}
+
+	files, err := listUploads(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no artifacts found in %s", dir)
+	}
+
+	var uploaded []string
+	for _, rel := range files {
+		data, err := os.ReadFile(filepath.Join(dir, rel))
+		if err != nil {
+			return uploaded, err
+		}
+
+		key := path.Join(p.prefix, filepath.ToSlash(rel))
+		if err := p.uploader.Upload(ctx, key, data, contentType(rel)); err != nil {
+			return uploaded, fmt.Errorf("uploading %s: %w", key, err)
+		}
+		uploaded = append(uploaded, key)
+	}
+
+	return uploaded, nil
+}
+
+// listUploads returns sorted regular non-hidden files below dir
+func listUploads(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+func contentType(name string) string {
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		return ct
+	}
+	return "text/plain; charset=utf-8"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// checkResponse turns non-2xx responses into errors
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,120 @@
+// Package rulejson writes content blocker files rule by rule, byte for
+// byte as a json.Encoder indenting with two spaces would, without holding
+// the encoded file in memory. Encoders and write buffers are pooled, so
+// writing many large parts does not allocate them again for each file.
+package rulejson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// maxPooledBuffer caps the encoding buffers kept for reuse, so a rule with
+// a huge domain list does not pin its buffer for the rest of the build
+const maxPooledBuffer = 64 << 10
+
+// ruleEncoder encodes one array element, indented as inside the array
+type ruleEncoder struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+var encoders = sync.Pool{New: func() any {
+	e := &ruleEncoder{}
+	e.enc = json.NewEncoder(&e.buf)
+	e.enc.SetIndent("  ", "  ")
+	return e
+}}
+
+var writers = sync.Pool{New: func() any {
+	return bufio.NewWriterSize(nil, 256<<10)
+}}
+
+// Writer streams rules to w as the elements of a JSON array
+type Writer struct {
+	bw    *bufio.Writer
+	rules int
+	n     int64 // bytes written
+}
+
+// NewWriter returns a Writer buffering its output to w. Close must be
+// called to complete the array.
+func NewWriter(w io.Writer) *Writer {
+	bw := writers.Get().(*bufio.Writer)
+	bw.Reset(w)
+	return &Writer{bw: bw}
+}
+
+// Write appends a rule to the array
+func (w *Writer) Write(r models.WebKitRule) error {
+	e := encoders.Get().(*ruleEncoder)
+	defer func() {
+		if e.buf.Cap() <= maxPooledBuffer {
+			encoders.Put(e)
+		}
+	}()
+	e.buf.Reset()
+	if err := e.enc.Encode(r); err != nil {
+		return err
+	}
+
+	sep := ",\n  "
+	if w.rules == 0 {
+		sep = "[\n  "
+	}
+	w.rules++
+	if err := w.write([]byte(sep)); err != nil {
+		return err
+	}
+	return w.write(bytes.TrimSuffix(e.buf.Bytes(), []byte("\n")))
+}
+
+// Close ends the array and flushes it to the underlying writer
+func (w *Writer) Close() error {
+	end := "\n]\n"
+	if w.rules == 0 {
+		end = "[]\n"
+	}
+	err := w.write([]byte(end))
+	if err == nil {
+		err = w.bw.Flush()
+	}
+	w.bw.Reset(nil)
+	writers.Put(w.bw)
+	w.bw = nil
+	return err
+}
+
+// Size returns the bytes written so far, buffered ones included
+func (w *Writer) Size() int64 {
+	return w.n
+}
+
+func (w *Writer) write(p []byte) error {
+	n, err := w.bw.Write(p)
+	w.n += int64(n)
+	return err
+}
+
+// WriteAll writes rules as a JSON array, null for a nil slice as
+// json.Encoder would, and returns the bytes written
+func WriteAll(out io.Writer, rules []models.WebKitRule) (int64, error) {
+	if rules == nil {
+		n, err := io.WriteString(out, "null\n")
+		return int64(n), err
+	}
+	w := NewWriter(out)
+	for _, r := range rules {
+		if err := w.Write(r); err != nil {
+			w.Close()
+			return w.Size(), err
+		}
+	}
+	err := w.Close()
+	return w.Size(), err
+}
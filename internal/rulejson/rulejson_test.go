@@ -0,0 +1,47 @@
+package rulejson
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAllMatchesEncoder(t *testing.T) {
+	caseSensitive := true
+	rules := []models.WebKitRule{
+		{
+			Trigger: models.WebKitTrigger{URLFilter: `^https?://ads\.example\.com[/:]`, URLFilterIsCaseSensitive: &caseSensitive, ResourceType: []string{"script", "image"}},
+			Action:  models.WebKitAction{Type: models.ActionBlock},
+		},
+		{
+			Trigger: models.WebKitTrigger{URLFilter: ".*", IfDomain: []string{"*news.org"}},
+			Action:  models.WebKitAction{Type: models.ActionCSSDisplayNone, Selector: `a[href^="<ad>&"]`},
+		},
+		{
+			Trigger: models.WebKitTrigger{URLFilter: ".*", UnlessDomain: []string{"*example.com"}},
+			Action:  models.WebKitAction{Type: models.ActionIgnorePreviousRule},
+		},
+	}
+
+	for name, rules := range map[string][]models.WebKitRule{
+		"rules": rules,
+		"one":   rules[:1],
+		"empty": {},
+		"nil":   nil,
+	} {
+		var want bytes.Buffer
+		enc := json.NewEncoder(&want)
+		enc.SetIndent("", "  ")
+		require.NoError(t, enc.Encode(rules))
+
+		var got bytes.Buffer
+		n, err := WriteAll(&got, rules)
+		require.NoError(t, err)
+		assert.Equal(t, want.String(), got.String(), name)
+		assert.Equal(t, int64(got.Len()), n, name)
+	}
+}
@@ -0,0 +1,55 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type node struct {
+	Name     string    `json:"name"`
+	Children []node    `json:"children,omitempty"`
+	Parent   *node     `json:"parent"`
+	Seen     time.Time `json:"seen"`
+	Skipped  string    `json:"-"`
+	embedded
+}
+
+type embedded struct {
+	Depth int `json:"depth"`
+}
+
+func TestRules(t *testing.T) {
+	s := For([]models.WebKitRule{}, "rules")
+	assert.Equal(t, Draft, s.Schema)
+	assert.Equal(t, "array", s.Type)
+	assert.Equal(t, "#/$defs/WebKitRule", s.Items.Ref)
+
+	trigger := s.Defs["WebKitTrigger"]
+	require.NotNil(t, trigger)
+	assert.Equal(t, []string{"url-filter"}, trigger.Required)
+	assert.Equal(t, "boolean", trigger.Properties["url-filter-is-case-sensitive"].Type)
+	assert.Equal(t, "string", trigger.Properties["if-domain"].Items.Type)
+}
+
+func TestRecursiveAndEmbedded(t *testing.T) {
+	s := For(node{}, "node")
+	assert.Equal(t, "#/$defs/node", s.Ref)
+
+	n := s.Defs["node"]
+	require.NotNil(t, n)
+	assert.Equal(t, "#/$defs/node", n.Properties["children"].Items.Ref)
+	assert.Equal(t, "null", n.Properties["parent"].AnyOf[1].Type)
+	assert.Equal(t, "date-time", n.Properties["seen"].Format)
+	assert.Equal(t, "integer", n.Properties["depth"].Type)
+	assert.NotContains(t, n.Properties, "Skipped")
+	assert.ElementsMatch(t, []string{"name", "parent", "seen", "depth"}, n.Required)
+
+	// The schema is plain JSON
+	_, err := json.Marshal(s)
+	assert.NoError(t, err)
+}
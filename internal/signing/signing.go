@@ -0,0 +1,118 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// Supported signing tools
+const (
+	ToolMinisign = "minisign"
+	ToolCosign   = "cosign"
+)
+
+// Signer signs and verifies files by shelling out to minisign or cosign
+type Signer struct {
+	tool      string
+	key       string
+	publicKey string
+	password  string
+}
+
+// New creates a signer from config. The key password is read from the
+// environment variable named by PasswordEnv (cosign also honours
+// COSIGN_PASSWORD on its own).
+func New(cfg models.SigningConfig) (*Signer, error) {
+	switch cfg.Tool {
+	case ToolMinisign, ToolCosign:
+	default:
+		return nil, fmt.Errorf("unknown signing tool %q (want minisign or cosign)", cfg.Tool)
+	}
+
+	if _, err := exec.LookPath(cfg.Tool); err != nil {
+		return nil, fmt.Errorf("%s not found in PATH: %w", cfg.Tool, err)
+	}
+
+	var password string
+	if cfg.PasswordEnv != "" {
+		password = os.Getenv(cfg.PasswordEnv)
+	}
+
+	return &Signer{
+		tool:      cfg.Tool,
+		key:       cfg.Key,
+		publicKey: cfg.PublicKey,
+		password:  password,
+	}, nil
+}
+
+// SignatureFile returns the detached signature path for a file
+func (s *Signer) SignatureFile(path string) string {
+	if s.tool == ToolMinisign {
+		return path + ".minisig"
+	}
+	return path + ".sig"
+}
+
+// Sign writes a detached signature next to path
+func (s *Signer) Sign(ctx context.Context, path string) error {
+	if s.key == "" {
+		return fmt.Errorf("signing.key is not configured")
+	}
+
+	var args []string
+	var env []string
+	switch s.tool {
+	case ToolMinisign:
+		args = []string{"-S", "-s", s.key, "-m", path, "-x", s.SignatureFile(path)}
+	case ToolCosign:
+		args = []string{"sign-blob", "--yes", "--key", s.key, "--output-signature", s.SignatureFile(path), path}
+		if s.password != "" {
+			env = append(env, "COSIGN_PASSWORD="+s.password)
+		}
+	}
+
+	// minisign reads the key password from stdin when it is not a terminal
+	stdin := ""
+	if s.tool == ToolMinisign && s.password != "" {
+		stdin = s.password + "\n"
+	}
+	return s.run(ctx, args, env, stdin)
+}
+
+// Verify checks the detached signature of path against the public key
+func (s *Signer) Verify(ctx context.Context, path string) error {
+	if s.publicKey == "" {
+		return fmt.Errorf("signing.public_key is not configured")
+	}
+
+	var args []string
+	switch s.tool {
+	case ToolMinisign:
+		args = []string{"-V", "-q", "-p", s.publicKey, "-m", path, "-x", s.SignatureFile(path)}
+	case ToolCosign:
+		args = []string{"verify-blob", "--key", s.publicKey, "--signature", s.SignatureFile(path), path}
+	}
+	return s.run(ctx, args, nil, "")
+}
+
+func (s *Signer) run(ctx context.Context, args, env []string, stdin string) error {
+	cmd := exec.CommandContext(ctx, s.tool, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = strings.NewReader(stdin)
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w: %s", s.tool, args[0], err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
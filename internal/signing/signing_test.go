@@ -0,0 +1,112 @@
+package signing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTool puts a tool in PATH recording its arguments, COSIGN_PASSWORD
+// and stdin into dir, and failing if FAKE_FAIL is set
+func fakeTool(t *testing.T, tool string) (dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	script := `#!/bin/sh
+printf '%s\n' "$@" > "` + dir + `/args"
+printf '%s' "$COSIGN_PASSWORD" > "` + dir + `/env"
+cat > "` + dir + `/stdin"
+if [ -n "$FAKE_FAIL" ]; then
+	echo "signature verification failed" >&2
+	exit 1
+fi
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tool), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+// recorded returns what the fake tool recorded in dir
+func recorded(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(models.SigningConfig{Tool: "gpg"})
+	assert.ErrorContains(t, err, `unknown signing tool "gpg"`)
+
+	t.Setenv("PATH", t.TempDir())
+	_, err = New(models.SigningConfig{Tool: ToolCosign})
+	assert.ErrorContains(t, err, "cosign not found in PATH")
+
+	fakeTool(t, ToolMinisign)
+	s, err := New(models.SigningConfig{Tool: ToolMinisign})
+	require.NoError(t, err)
+	assert.Equal(t, "rules.json.minisig", s.SignatureFile("rules.json"))
+}
+
+func TestSignMinisign(t *testing.T) {
+	dir := fakeTool(t, ToolMinisign)
+	t.Setenv("UWF_TEST_KEY_PASSWORD", "hunter2")
+	s, err := New(models.SigningConfig{Tool: ToolMinisign, Key: "minisign.key", PublicKey: "minisign.pub", PasswordEnv: "UWF_TEST_KEY_PASSWORD"})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Sign(context.Background(), "out/combined.json"))
+	assert.Equal(t, "-S\n-s\nminisign.key\n-m\nout/combined.json\n-x\nout/combined.json.minisig\n", recorded(t, dir, "args"))
+	// The password goes to stdin, not the environment
+	assert.Equal(t, "hunter2\n", recorded(t, dir, "stdin"))
+	assert.Empty(t, recorded(t, dir, "env"))
+
+	require.NoError(t, s.Verify(context.Background(), "out/combined.json"))
+	assert.Equal(t, "-V\n-q\n-p\nminisign.pub\n-m\nout/combined.json\n-x\nout/combined.json.minisig\n", recorded(t, dir, "args"))
+	assert.Empty(t, recorded(t, dir, "stdin"))
+}
+
+func TestSignCosign(t *testing.T) {
+	dir := fakeTool(t, ToolCosign)
+	t.Setenv("UWF_TEST_KEY_PASSWORD", "hunter2")
+	s, err := New(models.SigningConfig{Tool: ToolCosign, Key: "cosign.key", PublicKey: "cosign.pub", PasswordEnv: "UWF_TEST_KEY_PASSWORD"})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Sign(context.Background(), "combined.json"))
+	assert.Equal(t, "sign-blob\n--yes\n--key\ncosign.key\n--output-signature\ncombined.json.sig\ncombined.json\n", recorded(t, dir, "args"))
+	assert.Equal(t, "hunter2", recorded(t, dir, "env"))
+	assert.Empty(t, recorded(t, dir, "stdin"))
+
+	require.NoError(t, s.Verify(context.Background(), "combined.json"))
+	assert.Equal(t, "verify-blob\n--key\ncosign.pub\n--signature\ncombined.json.sig\ncombined.json\n", recorded(t, dir, "args"))
+}
+
+func TestSignErrors(t *testing.T) {
+	dir := fakeTool(t, ToolMinisign)
+	s, err := New(models.SigningConfig{Tool: ToolMinisign})
+	require.NoError(t, err)
+
+	// Missing keys fail before running the tool
+	assert.ErrorContains(t, s.Sign(context.Background(), "combined.json"), "signing.key is not configured")
+	assert.ErrorContains(t, s.Verify(context.Background(), "combined.json"), "signing.public_key is not configured")
+	assert.NoFileExists(t, filepath.Join(dir, "args"))
+
+	// Failures carry the tool's output
+	s, err = New(models.SigningConfig{Tool: ToolMinisign, Key: "minisign.key", PublicKey: "minisign.pub"})
+	require.NoError(t, err)
+	t.Setenv("FAKE_FAIL", "1")
+	err = s.Verify(context.Background(), "combined.json")
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "minisign -V: exit status 1"), err.Error())
+	assert.ErrorContains(t, err, "signature verification failed")
+	assert.ErrorContains(t, s.Sign(context.Background(), "combined.json"), "minisign -S: exit status 1")
+
+	// A cancelled context stops the tool
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, s.Sign(ctx, "combined.json"))
+}
@@ -0,0 +1,104 @@
+// Package skipdb remembers the skip patterns of earlier builds, so patterns
+// upstream lists start using can be reported when they first appear
+package skipdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// Entry describes one skip pattern
+type Entry struct {
+	Reason    models.SkipReason `json:"reason"`
+	FirstSeen time.Time         `json:"first_seen"`
+	LastSeen  time.Time         `json:"last_seen"`
+	Count     int               `json:"count"`   // filters skipped by the last build that saw it
+	Lists     []string          `json:"lists"`   // lists using it in that build
+	Example   string            `json:"example"` // first skipped line
+}
+
+// DB maps skip pattern keys (models.SkipPatternKey) to their history
+type DB struct {
+	Patterns map[string]*Entry `json:"patterns"`
+}
+
+// Load reads a database, returning an empty one if the file does not exist
+func Load(path string) (*DB, error) {
+	db := &DB{Patterns: make(map[string]*Entry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, fmt.Errorf("decoding skip database %s: %w", path, err)
+	}
+	if db.Patterns == nil {
+		db.Patterns = make(map[string]*Entry)
+	}
+	return db, nil
+}
+
+// Save writes the database, creating its directory if needed
+func (db *DB) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Update records the skip patterns of a build, per list, and returns the
+// keys no earlier build had, most skipped filters first
+func (db *DB) Update(now time.Time, lists map[string]models.SkipPatterns) []string {
+	names := make([]string, 0, len(lists))
+	for name := range lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var added []string
+	touched := make(map[string]bool)
+	for _, name := range names {
+		for key, pattern := range lists[name] {
+			entry, ok := db.Patterns[key]
+			if !ok {
+				entry = &Entry{Reason: pattern.Reason, FirstSeen: now, Example: pattern.Example}
+				db.Patterns[key] = entry
+				added = append(added, key)
+			}
+			if !touched[key] {
+				// Counts describe the latest build only
+				touched[key] = true
+				entry.Count, entry.Lists = 0, nil
+			}
+			entry.LastSeen = now
+			entry.Count += pattern.Count
+			if !slices.Contains(entry.Lists, name) {
+				entry.Lists = append(entry.Lists, name)
+			}
+		}
+	}
+
+	sort.Slice(added, func(i, j int) bool {
+		a, b := db.Patterns[added[i]], db.Patterns[added[j]]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return added[i] < added[j]
+	})
+	return added
+}
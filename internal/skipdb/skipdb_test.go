@@ -0,0 +1,44 @@
+package skipdb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateReportsNewPatterns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "skips.json")
+	db, err := Load(path)
+	require.NoError(t, err)
+
+	first := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	easylist := make(models.SkipPatterns)
+	easylist.Add(models.SkipScriptlet, "set-constant", "example.com##+js(set-constant, a, 1)")
+	easylist.Add(models.SkipInvalidRegex, "", "/a|b/")
+	added := db.Update(first, map[string]models.SkipPatterns{"easylist": easylist})
+	assert.ElementsMatch(t, []string{"scriptlet:set-constant", "invalid-regex"}, added)
+	require.NoError(t, db.Save(path))
+
+	// A later build only reports what is new, most used first
+	db, err = Load(path)
+	require.NoError(t, err)
+	second := first.Add(24 * time.Hour)
+	ubo := make(models.SkipPatterns)
+	ubo.Add(models.SkipScriptlet, "set-constant", "example.org##+js(set-constant, b, 2)")
+	ubo.Add(models.SkipScriptlet, "abort-on-property-read", "example.org##+js(abort-on-property-read, c)")
+	ubo.Add(models.SkipUnsupportedOption, "redirect", "||ads.example^$redirect=noopjs")
+	ubo.Add(models.SkipUnsupportedOption, "redirect", "||cdn.example^$redirect=noopjs")
+	added = db.Update(second, map[string]models.SkipPatterns{"easylist": easylist, "ubo": ubo})
+	assert.Equal(t, []string{"unsupported-option:redirect", "scriptlet:abort-on-property-read"}, added)
+
+	entry := db.Patterns["scriptlet:set-constant"]
+	assert.Equal(t, first, entry.FirstSeen)
+	assert.Equal(t, second, entry.LastSeen)
+	assert.Equal(t, 2, entry.Count)
+	assert.Equal(t, []string{"easylist", "ubo"}, entry.Lists)
+	assert.Equal(t, "example.com##+js(set-constant, a, 1)", entry.Example)
+}
@@ -0,0 +1,108 @@
+package smoketest
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recordingProxy is a forwarding HTTP/CONNECT proxy that remembers every
+// host the browser tried to reach. Requests blocked by the content blocker
+// never leave the browser, so they never show up here.
+type recordingProxy struct {
+	mu        sync.Mutex
+	hosts     map[string]bool
+	transport *http.Transport
+}
+
+func newRecordingProxy() *recordingProxy {
+	return &recordingProxy{
+		hosts:     make(map[string]bool),
+		transport: &http.Transport{Proxy: nil, ResponseHeaderTimeout: 30 * time.Second},
+	}
+}
+
+func (p *recordingProxy) record(hostport string) {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	p.mu.Lock()
+	p.hosts[strings.ToLower(host)] = true
+	p.mu.Unlock()
+}
+
+// reset forgets recorded hosts between pages
+func (p *recordingProxy) reset() {
+	p.mu.Lock()
+	p.hosts = make(map[string]bool)
+	p.mu.Unlock()
+}
+
+// requested returns a snapshot of the recorded hosts
+func (p *recordingProxy) requested() map[string]bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	snapshot := make(map[string]bool, len(p.hosts))
+	for h := range p.hosts {
+		snapshot[h] = true
+	}
+	return snapshot
+}
+
+func (p *recordingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.record(r.Host)
+		p.tunnel(w, r)
+		return
+	}
+
+	p.record(r.URL.Host)
+	r.RequestURI = ""
+	resp, err := p.transport.RoundTrip(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for k, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// tunnel relays a CONNECT request (HTTPS) byte for byte
+func (p *recordingProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := net.DialTimeout("tcp", r.Host, 10*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	go func() {
+		io.Copy(upstream, client)
+		upstream.Close()
+	}()
+	io.Copy(client, upstream)
+	client.Close()
+}
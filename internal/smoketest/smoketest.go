@@ -0,0 +1,169 @@
+package smoketest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// DefaultContentFilterFlag is the MiniBrowser option taking a content
+// blocker JSON file
+const DefaultContentFilterFlag = "--content-filter"
+
+// PageResult reports what happened while loading one test page
+type PageResult struct {
+	URL            string
+	Requested      []string // hosts the browser actually contacted
+	LeakedBlocked  []string // expected-blocked hosts that were contacted anyway
+	MissingAllowed []string // expected hosts that were never contacted
+}
+
+// Passed reports whether the page met its expectations
+func (r PageResult) Passed() bool {
+	return len(r.LeakedBlocked) == 0 && len(r.MissingAllowed) == 0
+}
+
+// Run loads every configured page in a WebKitGTK browser subprocess with
+// the given rule files applied, routing traffic through a recording proxy
+func Run(ctx context.Context, cfg models.SmokeTestConfig) ([]PageResult, error) {
+	// Without the flag the browser loads no rules and every page passes
+	// without checking anything
+	if cfg.ContentFilterFlag == "" {
+		return nil, errors.New("smoke_test.content_filter_flag is empty")
+	}
+	browser, err := exec.LookPath(cfg.Browser)
+	if err != nil {
+		return nil, fmt.Errorf("browser %q not found: %w", cfg.Browser, err)
+	}
+
+	rulesFile, err := mergeRules(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(rulesFile)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	proxy := newRecordingProxy()
+	srv := &http.Server{Handler: proxy, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	proxyURL := "http://" + listener.Addr().String()
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 20 * time.Second
+	}
+
+	var results []PageResult
+	for _, page := range cfg.Pages {
+		proxy.reset()
+
+		args := append([]string{}, cfg.Args...)
+		args = append(args, cfg.ContentFilterFlag+"="+rulesFile, page.URL)
+
+		pageCtx, cancel := context.WithTimeout(ctx, timeout)
+		cmd := exec.CommandContext(pageCtx, browser, args...)
+		cmd.Env = append(os.Environ(),
+			"http_proxy="+proxyURL, "https_proxy="+proxyURL,
+			"HTTP_PROXY="+proxyURL, "HTTPS_PROXY="+proxyURL,
+		)
+		// The browser never exits on its own; it is killed at the deadline
+		runErr := cmd.Run()
+		cancel()
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		if runErr != nil && pageCtx.Err() == nil {
+			return results, fmt.Errorf("%s exited early on %s: %w", cfg.Browser, page.URL, runErr)
+		}
+
+		results = append(results, evaluate(page, proxy.requested()))
+	}
+
+	return results, nil
+}
+
+// evaluate compares contacted hosts against the page expectations
+func evaluate(page models.SmokeTestPage, requested map[string]bool) PageResult {
+	result := PageResult{URL: page.URL}
+	for host := range requested {
+		result.Requested = append(result.Requested, host)
+	}
+	sort.Strings(result.Requested)
+
+	for _, blocked := range page.Blocked {
+		if matchesAny(blocked, requested) {
+			result.LeakedBlocked = append(result.LeakedBlocked, blocked)
+		}
+	}
+	for _, allowed := range page.Allowed {
+		if !matchesAny(allowed, requested) {
+			result.MissingAllowed = append(result.MissingAllowed, allowed)
+		}
+	}
+	return result
+}
+
+// matchesAny reports whether domain or one of its subdomains was contacted
+func matchesAny(domain string, requested map[string]bool) bool {
+	domain = strings.ToLower(domain)
+	for host := range requested {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeRules concatenates the rule files matched by the globs into one
+// temporary file, since the browser accepts a single content filter
+func mergeRules(patterns []string) (string, error) {
+	var rules []json.RawMessage
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", err
+		}
+		sort.Strings(matches)
+		for _, path := range matches {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			var part []json.RawMessage
+			if err := json.Unmarshal(data, &part); err != nil {
+				return "", fmt.Errorf("%s: %w", path, err)
+			}
+			rules = append(rules, part...)
+		}
+	}
+	if len(rules) == 0 {
+		return "", fmt.Errorf("no rules found in %s", strings.Join(patterns, ", "))
+	}
+
+	f, err := os.CreateTemp("", "uwf-smoke-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(rules); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,101 @@
+package smoketest
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	page := models.SmokeTestPage{
+		URL:     "https://news.example/",
+		Blocked: []string{"doubleclick.net", "Tracker.org"},
+		Allowed: []string{"news.example", "cdn.example"},
+	}
+	requested := map[string]bool{"news.example": true, "stats.tracker.org": true, "notdoubleclick.net": true}
+
+	result := evaluate(page, requested)
+	assert.Equal(t, []string{"news.example", "notdoubleclick.net", "stats.tracker.org"}, result.Requested)
+	// Subdomains count, lookalike domains do not
+	assert.Equal(t, []string{"Tracker.org"}, result.LeakedBlocked)
+	assert.Equal(t, []string{"cdn.example"}, result.MissingAllowed)
+	assert.False(t, result.Passed())
+
+	result = evaluate(models.SmokeTestPage{URL: page.URL, Blocked: []string{"doubleclick.net"}, Allowed: []string{"news.example"}}, requested)
+	assert.True(t, result.Passed())
+}
+
+func TestMergeRules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+	write("combined-part2.json", `[{"trigger":{"url-filter":"b"},"action":{"type":"block"}}]`)
+	write("combined-part1.json", `[{"trigger":{"url-filter":"a"},"action":{"type":"block"}}]`)
+	write("popups.json", `[{"trigger":{"url-filter":"c"},"action":{"type":"block"}}]`)
+
+	path, err := mergeRules([]string{filepath.Join(dir, "combined*.json"), filepath.Join(dir, "popups.json")})
+	require.NoError(t, err)
+	defer os.Remove(path)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var rules []models.WebKitRule
+	require.NoError(t, json.Unmarshal(data, &rules))
+	var filters []string
+	for _, r := range rules {
+		filters = append(filters, r.Trigger.URLFilter)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, filters, "globs in order, matches sorted")
+
+	_, err = mergeRules([]string{filepath.Join(dir, "missing*.json")})
+	assert.ErrorContains(t, err, "no rules found")
+
+	write("broken.json", `{"trigger": {}}`)
+	_, err = mergeRules([]string{filepath.Join(dir, "broken.json")})
+	assert.ErrorContains(t, err, "broken.json")
+}
+
+func TestRunPassesRules(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "combined.json")
+	require.NoError(t, os.WriteFile(rules, []byte(`[{"trigger":{"url-filter":"a"},"action":{"type":"block"}}]`), 0644))
+
+	// A browser recording its arguments, then exiting
+	argsFile := filepath.Join(dir, "args")
+	browser := filepath.Join(dir, "browser")
+	require.NoError(t, os.WriteFile(browser, []byte("#!/bin/sh\necho \"$@\" > "+argsFile+"\n"), 0755))
+
+	cfg := models.SmokeTestConfig{
+		Browser:           browser,
+		Args:              []string{"--headless"},
+		ContentFilterFlag: DefaultContentFilterFlag,
+		Rules:             []string{rules},
+		Timeout:           5 * time.Second,
+		Pages:             []models.SmokeTestPage{{URL: "https://example.com/", Allowed: []string{"example.com"}}},
+	}
+	results, err := Run(context.Background(), cfg)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, []string{"example.com"}, results[0].MissingAllowed)
+
+	data, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	args := strings.Fields(string(data))
+	require.Len(t, args, 3)
+	assert.Equal(t, "--headless", args[0])
+	assert.True(t, strings.HasPrefix(args[1], "--content-filter="), args[1])
+	assert.Equal(t, "https://example.com/", args[2])
+
+	// Without the flag the rules would silently not load
+	cfg.ContentFilterFlag = ""
+	_, err = Run(context.Background(), cfg)
+	assert.ErrorContains(t, err, "content_filter_flag is empty")
+}
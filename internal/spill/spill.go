@@ -0,0 +1,343 @@
+// Package spill keeps rule sets in temporary files when a build would not
+// fit in memory, and deduplicates rules spread over them with an external
+// sort, so only the unique rules and one chunk of keys are held at a time
+package spill
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+)
+
+// Store is a temporary directory of rule sets, removed by Close
+type Store struct {
+	dir   string
+	files int
+}
+
+// Run is a rule set written to a Store, one JSON rule per line
+type Run struct {
+	path  string
+	Rules int
+}
+
+// New creates a store in parent, the system temporary directory if empty
+func New(parent string) (*Store, error) {
+	if parent != "" {
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := os.MkdirTemp(parent, "uwf-spill-")
+	if err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Close removes the store and its runs
+func (s *Store) Close() error {
+	return os.RemoveAll(s.dir)
+}
+
+func (s *Store) create(kind string) (*os.File, error) {
+	s.files++
+	return os.Create(filepath.Join(s.dir, fmt.Sprintf("%s-%d", kind, s.files)))
+}
+
+// Write stores rules as a new run
+func (s *Store) Write(rules []models.WebKitRule) (*Run, error) {
+	f, err := s.create("run")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range rules {
+		if err := enc.Encode(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return &Run{path: f.Name(), Rules: len(rules)}, f.Close()
+}
+
+// Read loads the rules of a run
+func (r *Run) Read() ([]models.WebKitRule, error) {
+	rules := make([]models.WebKitRule, 0, r.Rules)
+	err := r.each(func(line []byte) error {
+		var rule models.WebKitRule
+		if err := json.Unmarshal(line, &rule); err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+		return nil
+	})
+	return rules, err
+}
+
+// each calls fn with the JSON of every rule of the run, in order
+func (r *Run) each(fn func(line []byte) error) error {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if line = bytes.TrimSuffix(line, []byte("\n")); len(line) > 0 {
+			if ferr := fn(line); ferr != nil {
+				return fmt.Errorf("%s: %w", filepath.Base(r.path), ferr)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// key identifies a rule in the external sort: a digest of its JSON, the
+// same representation converter.Deduplicate keys rules on, and its
+// position in the runs
+type key struct {
+	digest [16]byte
+	seq    uint64
+}
+
+const keySize = 16 + 8
+
+func compareKeys(a, b key) int {
+	if c := bytes.Compare(a.digest[:], b.digest[:]); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.seq, b.seq)
+}
+
+// Deduplicate returns the rules of runs in order, dropping repeats of an
+// earlier rule like converter.Deduplicate. Keys are sorted in chunks of at
+// most memory bytes written to the store, then merged to find the first
+// occurrence of every rule. The unique rules are returned in one slice, so
+// memory bounds the sort, not the result.
+func (s *Store) Deduplicate(runs []*Run, memory int64) ([]models.WebKitRule, error) {
+	chunk := int(max(memory/keySize, 1))
+
+	// Sorted chunks of keys
+	var chunks []string
+	defer func() {
+		for _, path := range chunks {
+			os.Remove(path)
+		}
+	}()
+	buf := make([]key, 0, chunk)
+	flush := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+		slices.SortFunc(buf, compareKeys)
+		path, err := s.writeKeys(buf)
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, path)
+		buf = buf[:0]
+		return nil
+	}
+
+	var total uint64
+	for _, run := range runs {
+		err := run.each(func(line []byte) error {
+			sum := sha256.Sum256(line)
+			var k key
+			copy(k.digest[:], sum[:16])
+			k.seq = total
+			total++
+			buf = append(buf, k)
+			if len(buf) == chunk {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	// The first key of every digest in the merged chunks is the rule kept
+	first := make([]uint64, (total+63)/64)
+	err := mergeKeys(chunks, func(k key, repeat bool) {
+		if !repeat {
+			first[k.seq/64] |= 1 << (k.seq % 64)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []models.WebKitRule
+	var seq uint64
+	for _, run := range runs {
+		err := run.each(func(line []byte) error {
+			defer func() { seq++ }()
+			if first[seq/64]&(1<<(seq%64)) == 0 {
+				return nil
+			}
+			var rule models.WebKitRule
+			if err := json.Unmarshal(line, &rule); err != nil {
+				return err
+			}
+			result = append(result, rule)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// writeKeys writes sorted keys to a new chunk file
+func (s *Store) writeKeys(keys []key) (string, error) {
+	f, err := s.create("keys")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	var rec [keySize]byte
+	for _, k := range keys {
+		copy(rec[:16], k.digest[:])
+		binary.BigEndian.PutUint64(rec[16:], k.seq)
+		if _, err := w.Write(rec[:]); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// chunkReader reads the keys of a chunk file
+type chunkReader struct {
+	r   *bufio.Reader
+	f   *os.File
+	cur key
+}
+
+func (c *chunkReader) next() (bool, error) {
+	var rec [keySize]byte
+	if _, err := io.ReadFull(c.r, rec[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	copy(c.cur.digest[:], rec[:16])
+	c.cur.seq = binary.BigEndian.Uint64(rec[16:])
+	return true, nil
+}
+
+// chunkHeap orders chunk readers by their current key
+type chunkHeap []*chunkReader
+
+func (h chunkHeap) Len() int           { return len(h) }
+func (h chunkHeap) Less(i, j int) bool { return compareKeys(h[i].cur, h[j].cur) < 0 }
+func (h chunkHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *chunkHeap) Push(x any)        { *h = append(*h, x.(*chunkReader)) }
+func (h *chunkHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// mergeKeys calls fn with the keys of sorted chunks in order, reporting
+// whether each repeats the digest of the key before it
+func mergeKeys(paths []string, fn func(k key, repeat bool)) error {
+	h := make(chunkHeap, 0, len(paths))
+	defer func() {
+		for _, c := range h {
+			c.f.Close()
+		}
+	}()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		c := &chunkReader{r: bufio.NewReader(f), f: f}
+		ok, err := c.next()
+		if err != nil || !ok {
+			f.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		h = append(h, c)
+	}
+	heap.Init(&h)
+
+	var prev [16]byte
+	started := false
+	for h.Len() > 0 {
+		c := h[0]
+		fn(c.cur, started && c.cur.digest == prev)
+		prev, started = c.cur.digest, true
+
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+			c.f.Close()
+		}
+	}
+	return nil
+}
+
+// Size estimates the memory rules take, to decide when to spill them
+func Size(rules []models.WebKitRule) int64 {
+	const (
+		ruleOverhead   = 256 // structs, slice and string headers
+		stringOverhead = 16
+	)
+	var n int64
+	for _, r := range rules {
+		n += ruleOverhead + int64(len(r.Trigger.URLFilter)+len(r.Action.Selector))
+		for _, list := range [][]string{r.Trigger.IfDomain, r.Trigger.UnlessDomain, r.Trigger.IfTopURL, r.Trigger.UnlessTopURL, r.Trigger.ResourceType, r.Trigger.LoadType, r.Trigger.LoadContext} {
+			for _, s := range list {
+				n += stringOverhead + int64(len(s))
+			}
+		}
+	}
+	return n
+}
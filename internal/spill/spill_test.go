@@ -0,0 +1,71 @@
+package spill
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bnema/ublock-webkit-filters/internal/converter"
+	"github.com/bnema/ublock-webkit-filters/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func spillRules(names ...string) []models.WebKitRule {
+	rules := make([]models.WebKitRule, len(names))
+	for i, name := range names {
+		rules[i] = models.WebKitRule{
+			Trigger: models.WebKitTrigger{URLFilter: name},
+			Action:  models.WebKitAction{Type: models.ActionBlock},
+		}
+	}
+	return rules
+}
+
+func TestRunRoundTrip(t *testing.T) {
+	s, err := New(t.TempDir())
+	require.NoError(t, err)
+	defer s.Close()
+
+	rules := spillRules("ads", "tracker")
+	rules[1].Trigger.IfDomain = []string{"*example.com"}
+	run, err := s.Write(rules)
+	require.NoError(t, err)
+	assert.Equal(t, 2, run.Rules)
+
+	read, err := run.Read()
+	require.NoError(t, err)
+	assert.Equal(t, rules, read)
+}
+
+func TestDeduplicateMatchesInMemory(t *testing.T) {
+	s, err := New(t.TempDir())
+	require.NoError(t, err)
+	defer s.Close()
+
+	var all []models.WebKitRule
+	var runs []*Run
+	for i := range 4 {
+		var names []string
+		for j := range 25 {
+			names = append(names, fmt.Sprintf("rule%d", (i*7+j*3)%40))
+		}
+		rules := spillRules(names...)
+		all = append(all, rules...)
+		run, err := s.Write(rules)
+		require.NoError(t, err)
+		runs = append(runs, run)
+	}
+
+	// Chunks smaller than a run, so keys are merged from several files
+	got, err := s.Deduplicate(runs, 7*keySize)
+	require.NoError(t, err)
+	assert.Equal(t, converter.Deduplicate(all), got)
+}
+
+func TestSize(t *testing.T) {
+	small := spillRules("a")
+	large := spillRules("a")
+	large[0].Trigger.IfDomain = []string{"*example.com", "*example.org"}
+	assert.Greater(t, Size(large), Size(small))
+	assert.Zero(t, Size(nil))
+}